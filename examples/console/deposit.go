@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	agentpkg "github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+// depositor deposits the channel's asset from the account into a channel
+// account.
+type depositor struct {
+	HorizonClient     horizonclient.ClientInterface
+	NetworkPassphrase string
+	Account           *keypair.FromAddress
+	Signer            *keypair.Full
+	Destination       *keypair.FromAddress
+	Agent             *agentpkg.Agent
+}
+
+// Deposit deposits the amount in stroops.
+func (d depositor) Deposit(amt int64) error {
+	return d.DepositAmount(amount.StringFromInt64(amt))
+}
+
+// DepositAmount deposits the amount, formatted as a decimal.
+func (d depositor) DepositAmount(amountStr string) error {
+	asset, err := channelAsset(d.Agent)
+	if err != nil {
+		return err
+	}
+	account, err := d.HorizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: d.Account.Address()})
+	if err != nil {
+		return fmt.Errorf("getting state of local channel account: %w", err)
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
+		Operations: []txnbuild.Operation{
+			&txnbuild.Payment{Destination: d.Destination.Address(), Asset: asset.Asset(), Amount: amountStr},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("building deposit payment tx: %w", err)
+	}
+	tx, err = tx.Sign(d.NetworkPassphrase, d.Signer)
+	if err != nil {
+		return fmt.Errorf("signing deposit payment tx: %w", err)
+	}
+	_, err = d.HorizonClient.SubmitTransaction(tx)
+	if err != nil {
+		return fmt.Errorf("submitting deposit payment tx: %w", err)
+	}
+	return nil
+}
+
+// channelAsset returns the asset of the agent's channel. It is read from the
+// agent's snapshot so that it is known for a channel restored from a file.
+func channelAsset(agent *agentpkg.Agent) (state.Asset, error) {
+	s := agent.Snapshot()
+	if s.State == nil {
+		return "", fmt.Errorf("no channel")
+	}
+	return s.State.Snapshot.OpenAgreement.Envelope.Details.Asset, nil
+}
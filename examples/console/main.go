@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,10 +20,13 @@ import (
 	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/txnbuild"
 	agentpkg "github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/agent/acceptpolicy"
 	"github.com/stellar/starlight/sdk/agent/agenthttp"
 	"github.com/stellar/starlight/sdk/agent/bufferedagent"
 	"github.com/stellar/starlight/sdk/agent/horizon"
+	"github.com/stellar/starlight/sdk/agent/provision"
 	"github.com/stellar/starlight/sdk/agent/submit"
+	"github.com/stellar/starlight/sdk/agent/submitqueue"
 	"github.com/stellar/starlight/sdk/state"
 	"github.com/stellar/starlight/sdk/txbuild"
 )
@@ -41,7 +45,6 @@ func main() {
 }
 
 var (
-	asset               = state.Asset("")
 	otherChannelAccount = (*keypair.FromAddress)(nil)
 	closeAgreements     = []state.CloseAgreement{}
 )
@@ -52,6 +55,7 @@ func run() error {
 	signerKeyStr := "S..."
 	filename := ""
 	httpPort := ""
+	apiToken := ""
 	listenPort := ""
 	connectAddr := ""
 	cpuProfileFile := ""
@@ -61,6 +65,7 @@ func run() error {
 	fs.BoolVar(&showHelp, "h", showHelp, "Show this help")
 	fs.StringVar(&horizonURL, "horizon", horizonURL, "Horizon URL")
 	fs.StringVar(&httpPort, "port", httpPort, "Port to serve API on")
+	fs.StringVar(&apiToken, "api-token", apiToken, "Bearer token for the control API and event stream served under /api/ on the port, disabled if empty")
 	fs.StringVar(&signerKeyStr, "signer", signerKeyStr, "Account S signer")
 	fs.StringVar(&filename, "f", filename, "File to write and load channel state")
 	fs.StringVar(&listenPort, "listen-port", listenPort, "Listen on port")
@@ -125,19 +130,32 @@ func run() error {
 	}
 
 	stats := &stats{}
+	eventStream := agenthttp.NewEventStream(1000)
+	metrics := agenthttp.NewPrometheusMetrics()
 
 	events := make(chan interface{})
+	closed := make(chan struct{}, 1)
 	go func() {
 		for {
-			switch e := (<-events).(type) {
+			e := <-events
+			eventStream.Publish(e)
+			switch e := e.(type) {
 			case agentpkg.ErrorEvent:
 				fmt.Fprintf(os.Stderr, "error: %v\n", e.Err)
 			case agentpkg.ConnectedEvent:
 				otherChannelAccount = e.ChannelAccount
 				fmt.Fprintf(os.Stderr, "connected\n")
 			case agentpkg.OpenedEvent:
-				asset = e.OpenAgreement.Envelope.Details.Asset
-				fmt.Fprintf(os.Stderr, "channel opened for asset %v\n", asset)
+				fmt.Fprintf(os.Stderr, "channel opened for asset %v\n", e.OpenAgreement.Envelope.Details.Asset)
+			case agentpkg.OpenRejectedEvent:
+				fmt.Fprintf(os.Stderr, "open rejected: %s\n", e.Message)
+				if cp := e.CounterProposal; cp != nil {
+					fmt.Fprintf(os.Stderr, "counter-proposal: asset=%v observation-period-time=%v observation-period-ledger-gap=%d\n", cp.Asset, cp.ObservationPeriodTime, cp.ObservationPeriodLedgerGap)
+				}
+			case agentpkg.PaymentRejectedEvent:
+				fmt.Fprintf(os.Stderr, "payment rejected: %s\n", e.Message)
+			case agentpkg.CloseRejectedEvent:
+				fmt.Fprintf(os.Stderr, "close rejected: %s\n", e.Message)
 
 			case agentpkg.PaymentReceivedEvent:
 				closeAgreements = append(closeAgreements, e.CloseAgreement)
@@ -167,6 +185,14 @@ func run() error {
 				fmt.Fprintf(os.Stderr, "channel closing with outdated state\n")
 			case agentpkg.ClosedEvent:
 				fmt.Fprintf(os.Stderr, "channel closed\n")
+				select {
+				case closed <- struct{}{}:
+				default:
+				}
+			case agentpkg.CloseFailedEvent:
+				fmt.Fprintf(os.Stderr, "channel %s tx %s failed: %v\n", e.Tx.Type, e.Tx.Hash, e.ResultCodes)
+			case agentpkg.ChannelCompromisedEvent:
+				fmt.Fprintf(os.Stderr, "channel account %s compromised: %s\n", e.Compromise.ChannelAccount, e.Compromise.Reason)
 			}
 		}
 	}()
@@ -179,19 +205,70 @@ func run() error {
 	}
 	balanceCollector := &horizon.BalanceCollector{HorizonClient: horizonClient}
 	sequenceNumberCollector := &horizon.SequenceNumberCollector{HorizonClient: horizonClient}
+	acceptPolicy := &acceptpolicy.AssetRiskPolicy{
+		IssuerFlagsCollector: &horizon.IssuerFlagsCollector{HorizonClient: horizonClient},
+		Warn: func(o agentpkg.OpenProposal, risks []acceptpolicy.AssetRisk) {
+			fmt.Fprintf(os.Stderr, "warning: issuer of asset %s has %v set\n", o.Details.Asset.StringCanonical(), risks)
+		},
+	}
 	submitter := &submit.Submitter{
 		SubmitTxer:        &horizon.Submitter{HorizonClient: horizonClient},
 		NetworkPassphrase: networkDetails.NetworkPassphrase,
 		BaseFee:           txnbuild.MinBaseFee,
+		MaxBaseFee:        100 * txnbuild.MinBaseFee,
 		FeeAccount:        accountKey,
 		FeeAccountSigners: []*keypair.Full{signerKey},
+		RetryPolicy: submit.RetryPolicy{
+			MaxAttempts: 5,
+			Backoff:     time.Second,
+			MaxBackoff:  10 * time.Second,
+		},
+	}
+
+	// When state is saved to a file, the agent's submissions are recorded in
+	// a queue next to it so that they are submitted even if the process
+	// stops before they complete.
+	var agentSubmitter agentpkg.Submitter = submitter
+	if filename != "" {
+		queueEvents := make(chan interface{})
+		go func() {
+			for e := range queueEvents {
+				if e, ok := e.(submitqueue.FailedEvent); ok {
+					fmt.Fprintf(os.Stderr, "error: %v\n", e.Err)
+				}
+			}
+		}()
+		queue := submitqueue.NewQueue(submitqueue.Config{
+			Submitter:               submitter,
+			Store:                   submitqueue.FileStore{Path: filename + ".queue"},
+			NetworkPassphrase:       networkDetails.NetworkPassphrase,
+			SequenceNumberCollector: sequenceNumberCollector,
+			Events:                  queueEvents,
+		})
+		err = queue.Start()
+		if err != nil {
+			return fmt.Errorf("starting submit queue: %w", err)
+		}
+		defer queue.Stop()
+		agentSubmitter = queue
+	}
+
+	provisioner := &provision.Provisioner{
+		NetworkPassphrase:       networkDetails.NetworkPassphrase,
+		Creator:                 accountKey.FromAddress(),
+		CreatorSigner:           signerKey,
+		SequenceNumberCollector: sequenceNumberCollector,
+		BalanceCollector:        balanceCollector,
+		AccountCollector:        &horizon.AccountCollector{HorizonClient: horizonClient},
+		Submitter:               submitter,
+		LogWriter:               io.Discard,
 	}
 
 	var channelAccountKey *keypair.FromAddress
 	var underlyingAgent *agentpkg.Agent
 	underlyingEvents := make(chan interface{})
 	if file == nil {
-		account, err := horizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: accountKey.Address()})
+		_, err := horizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: accountKey.Address()})
 		if horizonclient.IsNotFoundError(err) {
 			fmt.Fprintf(os.Stdout, "account %s does not exist\n", accountKey.Address())
 			fmt.Fprintf(os.Stdout, "attempting to create using friendbot\n")
@@ -204,12 +281,8 @@ func run() error {
 			if err != nil {
 				return err
 			}
-			account, err = horizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: accountKey.Address()})
-		}
-		if err != nil {
-			return err
+			_, err = horizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: accountKey.Address()})
 		}
-		accountSeqNum, err := account.GetSequenceNumber()
 		if err != nil {
 			return err
 		}
@@ -227,11 +300,13 @@ func run() error {
 			NetworkPassphrase:          networkDetails.NetworkPassphrase,
 			SequenceNumberCollector:    sequenceNumberCollector,
 			BalanceCollector:           balanceCollector,
-			Submitter:                  submitter,
+			AcceptPolicy:               acceptPolicy,
+			Submitter:                  agentSubmitter,
 			Streamer:                   streamer,
 			ChannelAccountKey:          channelAccountKey,
 			ChannelAccountSigner:       signerKey,
-			LogWriter:                  io.Discard,
+			CloseOnCompromise:          true,
+			Metrics:                    metrics,
 			Events:                     underlyingEvents,
 		}
 		if filename != "" {
@@ -245,24 +320,11 @@ func run() error {
 		}
 		underlyingAgent = agentpkg.NewAgent(config)
 
-		tx, err := txbuild.CreateChannelAccount(txbuild.CreateChannelAccountParams{
-			Creator:        accountKey.FromAddress(),
-			ChannelAccount: channelAccountKey.FromAddress(),
-			SequenceNumber: accountSeqNum + 1,
-			Asset:          txnbuild.NativeAsset{},
-		})
-		if err != nil {
-			return fmt.Errorf("creating channel account tx: %w", err)
-		}
-		tx, err = tx.Sign(networkDetails.NetworkPassphrase, signerKey, channelAccountKeyFull)
-		if err != nil {
-			return fmt.Errorf("signing tx to create channel account: %w", err)
-		}
 		err = retry(10, func() error {
-			return submitter.SubmitTx(tx)
+			return provisioner.Provision(channelAccountKeyFull, state.NativeAsset, 0)
 		})
 		if err != nil {
-			return fmt.Errorf("submitting tx to create channel account: %w", err)
+			return fmt.Errorf("provisioning channel account: %w", err)
 		}
 		fmt.Fprintln(os.Stdout, "channel account created")
 	} else {
@@ -274,7 +336,8 @@ func run() error {
 			NetworkPassphrase:          networkDetails.NetworkPassphrase,
 			SequenceNumberCollector:    sequenceNumberCollector,
 			BalanceCollector:           balanceCollector,
-			Submitter:                  submitter,
+			AcceptPolicy:               acceptPolicy,
+			Submitter:                  agentSubmitter,
 			Streamer:                   streamer,
 			Snapshotter: JSONFileSnapshotter{
 				Filename:                   filename,
@@ -285,16 +348,36 @@ func run() error {
 			},
 			ChannelAccountKey:    channelAccountKey,
 			ChannelAccountSigner: signerKey,
-			LogWriter:            io.Discard,
+			CloseOnCompromise:    true,
+			Metrics:              metrics,
 			Events:               underlyingEvents,
 		}
 		underlyingAgent = agentpkg.NewAgentFromSnapshot(config, file.Snapshot)
 	}
+
+	// Once the channel closes the channel account is retired, returning its
+	// balance and the reserves it was sponsored to the account.
+	go func() {
+		<-closed
+		err := retry(10, func() error {
+			asset, err := channelAsset(underlyingAgent)
+			if err != nil {
+				return err
+			}
+			return provisioner.Retire(channelAccountKey, asset)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: retiring channel account: %v\n", err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "channel account retired")
+	}()
+
 	bufferedConfig := bufferedagent.Config{
 		Agent:         underlyingAgent,
 		AgentEvents:   underlyingEvents,
 		MaxBufferSize: 1,
-		LogWriter:     io.Discard,
+		Metrics:       metrics,
 		Events:        events,
 	}
 	agent := bufferedagent.NewAgent(bufferedConfig)
@@ -304,6 +387,27 @@ func run() error {
 		fmt.Fprintf(os.Stdout, "agent http served on :%s\n", httpPort)
 		mux := http.ServeMux{}
 		mux.Handle("/", agentHandler)
+		mux.Handle("/metrics", metrics)
+		if apiToken == "" {
+			mux.Handle("/events", eventStream)
+		} else {
+			// Events are only streamed to clients holding the token, at
+			// /api/events, when the control API is enabled.
+			controlHandler := agenthttp.NewControl(agenthttp.ControlConfig{
+				Agent:       underlyingAgent,
+				BearerToken: apiToken,
+				Depositor: depositor{
+					HorizonClient:     horizonClient,
+					NetworkPassphrase: networkDetails.NetworkPassphrase,
+					Account:           accountKey,
+					Signer:            signerKey,
+					Destination:       channelAccountKey,
+					Agent:             underlyingAgent,
+				},
+				Events: eventStream,
+			})
+			mux.Handle("/api/", http.StripPrefix("/api", controlHandler))
+		}
 		mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
 			err := json.NewEncoder(w).Encode(stats)
 			if err != nil {
@@ -331,7 +435,7 @@ func run() error {
 		}
 	}
 
-	err = runShell(agent, stats, submitter, horizonClient, networkDetails.NetworkPassphrase, accountKey, channelAccountKey, signerKey)
+	err = runShell(agent, underlyingAgent, stats, submitter, horizonClient, networkDetails.NetworkPassphrase, accountKey, channelAccountKey, signerKey)
 	if err != nil {
 		fmt.Fprintf(os.Stdout, "error: %#v\n", err)
 	}
@@ -339,7 +443,7 @@ func run() error {
 	return nil
 }
 
-func runShell(agent *bufferedagent.Agent, stats *stats, submitter agentpkg.Submitter, horizonClient horizonclient.ClientInterface, networkPassphrase string, account, channelAccount *keypair.FromAddress, signer *keypair.Full) (err error) {
+func runShell(agent *bufferedagent.Agent, underlyingAgent *agentpkg.Agent, stats *stats, submitter agentpkg.Submitter, horizonClient horizonclient.ClientInterface, networkPassphrase string, account, channelAccount *keypair.FromAddress, signer *keypair.Full) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("panic: %v", r)
@@ -389,34 +493,15 @@ func runShell(agent *bufferedagent.Agent, stats *stats, submitter agentpkg.Submi
 			if len(c.Args) >= 2 && c.Args[1] != "" {
 				destination = otherChannelAccount
 			}
-			account, err := horizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: account.Address()})
-			if err != nil {
-				c.Err(fmt.Errorf("getting state of local channel account: %w", err))
-				return
-			}
-			tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
-				SourceAccount:        &account,
-				IncrementSequenceNum: true,
-				BaseFee:              txnbuild.MinBaseFee,
-				Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimeout(300)},
-				Operations: []txnbuild.Operation{
-					&txnbuild.Payment{Destination: destination.Address(), Asset: asset.Asset(), Amount: depositAmountStr},
-				},
-			})
-			if err != nil {
-				c.Err(fmt.Errorf("building deposit payment tx: %w", err))
-				return
-			}
-			tx, err = tx.Sign(networkPassphrase, signer)
-			if err != nil {
-				c.Err(fmt.Errorf("signing deposit payment tx: %w", err))
-				return
-			}
-			_, err = horizonClient.SubmitTransaction(tx)
-			if err != nil {
-				c.Err(fmt.Errorf("submitting deposit payment tx: %w", err))
-				return
+			d := depositor{
+				HorizonClient:     horizonClient,
+				NetworkPassphrase: networkPassphrase,
+				Account:           account,
+				Signer:            signer,
+				Destination:       destination,
+				Agent:             underlyingAgent,
 			}
+			c.Err(d.DepositAmount(depositAmountStr))
 		},
 	})
 	shell.AddCmd(&ishell.Cmd{
@@ -465,11 +550,15 @@ func runShell(agent *bufferedagent.Agent, stats *stats, submitter agentpkg.Submi
 				for {
 					amt := amt - (int64(i) % amtRange)
 					_, err = agent.PaymentWithMemo(amt, memo)
-					if err != nil {
+					if errors.Is(err, bufferedagent.ErrBufferFull) {
 						continue
 					}
 					break
 				}
+				if err != nil {
+					c.Err(err)
+					return
+				}
 			}
 			agent.Wait()
 			for stats.bufferedPaymentsSent != int64(x) {
@@ -481,6 +570,41 @@ func runShell(agent *bufferedagent.Agent, stats *stats, submitter agentpkg.Submi
 			c.Err(err)
 		},
 	})
+	shell.AddCmd(&ishell.Cmd{
+		Name: "flushpolicy",
+		Help: "flushpolicy [<max-linger> <max-memo-bytes> <max-amount>] - show or set when buffered payments are flushed, 0 for no limit",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) == 0 {
+				p := agent.FlushPolicy()
+				fmt.Fprintf(os.Stdout, "max linger: %v, max memo bytes: %d, max amount: %s\n", p.MaxLinger, p.MaxMemoByteSize, amount.StringFromInt64(p.MaxAmount))
+				return
+			}
+			if len(c.Args) != 3 {
+				c.Err(fmt.Errorf("expected 3 arguments, got %d", len(c.Args)))
+				return
+			}
+			maxLinger, err := time.ParseDuration(c.Args[0])
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			maxMemoByteSize, err := strconv.Atoi(c.Args[1])
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			maxAmount, err := amount.ParseInt64(c.Args[2])
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			agent.SetFlushPolicy(bufferedagent.FlushPolicy{
+				MaxLinger:       maxLinger,
+				MaxMemoByteSize: maxMemoByteSize,
+				MaxAmount:       maxAmount,
+			})
+		},
+	})
 	shell.AddCmd(&ishell.Cmd{
 		Name: "declareclose",
 		Help: "declareclose - declare to close the channel",
@@ -488,6 +612,13 @@ func runShell(agent *bufferedagent.Agent, stats *stats, submitter agentpkg.Submi
 			c.Err(agent.DeclareClose())
 		},
 	})
+	shell.AddCmd(&ishell.Cmd{
+		Name: "forceclose",
+		Help: "forceclose - declare and close the channel without the other participant",
+		Func: func(c *ishell.Context) {
+			c.Err(agent.ForceClose())
+		},
+	})
 	shell.AddCmd(&ishell.Cmd{
 		Name: "close",
 		Help: "close - close the channel",
@@ -556,6 +687,46 @@ func runShell(agent *bufferedagent.Agent, stats *stats, submitter agentpkg.Submi
 			}
 		},
 	})
+	shell.AddCmd(&ishell.Cmd{
+		Name: "estimate",
+		Help: "estimate [num-assets] [base-fee] - estimate the reserves and fees of a channel",
+		Func: func(c *ishell.Context) {
+			p := txbuild.EstimateParams{BaseFee: txnbuild.MinBaseFee}
+			var err error
+			if len(c.Args) >= 1 {
+				p.NumAssets, err = strconv.Atoi(c.Args[0])
+				if err != nil {
+					c.Err(fmt.Errorf("parsing num-assets: %w", err))
+					return
+				}
+			}
+			if len(c.Args) >= 2 {
+				p.BaseFee, err = strconv.ParseInt(c.Args[1], 10, 64)
+				if err != nil {
+					c.Err(fmt.Errorf("parsing base-fee: %w", err))
+					return
+				}
+			}
+			ledgers, err := horizonClient.Ledgers(horizonclient.LedgerRequest{Order: horizonclient.OrderDesc, Limit: 1})
+			if err != nil {
+				c.Err(fmt.Errorf("getting latest ledger: %w", err))
+				return
+			}
+			if len(ledgers.Embedded.Records) > 0 {
+				p.BaseReserve = int64(ledgers.Embedded.Records[0].BaseReserve)
+			}
+			e, err := txbuild.EstimateChannel(p)
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			fmt.Fprintf(os.Stdout, "sponsored reserves per participant: %d (%s XLM)\n", e.SponsoredReserves, amount.StringFromInt64(e.SponsoredReservesAmount))
+			fmt.Fprintf(os.Stdout, "open: ops=%d fee=%s XLM\n", e.OpenOperations, amount.StringFromInt64(e.OpenFee))
+			fmt.Fprintf(os.Stdout, "declaration: ops=%d fee=%s XLM\n", e.DeclarationOperations, amount.StringFromInt64(e.DeclarationFee))
+			fmt.Fprintf(os.Stdout, "close: ops=%d fee=%s XLM\n", e.CloseOperations, amount.StringFromInt64(e.CloseFee))
+			fmt.Fprintf(os.Stdout, "total fees: %s XLM\n", amount.StringFromInt64(e.TotalFee))
+		},
+	})
 
 	shell.Run()
 	return nil
@@ -0,0 +1,195 @@
+// Package acceptpolicy contains an agent.AcceptPolicy that accepts or rejects
+// opens and payments proposed by the other participant using a set of
+// configurable rules.
+package acceptpolicy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+// Policy is an agent.AcceptPolicy that accepts opens and payments that
+// satisfy all of its rules. Rules that are zero valued are not checked.
+type Policy struct {
+	// Assets are the only assets that channels are accepted for.
+	Assets []state.Asset
+
+	// Counterparties are the only signers of the other participant that opens
+	// and payments are accepted from.
+	Counterparties []*keypair.FromAddress
+
+	// MinPaymentAmount is the minimum amount of a payment.
+	MinPaymentAmount int64
+
+	// ValidateMemo is called with the memo of each payment, and if it returns
+	// an error the payment is not accepted.
+	ValidateMemo func(memo []byte) error
+
+	// MaxPayments is the maximum number of payments accepted within
+	// MaxPaymentsInterval. Payments count towards the limit when they are
+	// recorded with RecordPayment, which the agent calls once a payment is
+	// confirmed.
+	MaxPayments         int
+	MaxPaymentsInterval time.Duration
+
+	// Now returns the current time, and if not set defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	payments []time.Time
+}
+
+var (
+	_ agent.AcceptPolicy    = &Policy{}
+	_ agent.PaymentRecorder = &Policy{}
+)
+
+// AcceptOpen returns an error if the open does not satisfy the policy.
+func (p *Policy) AcceptOpen(o agent.OpenProposal) error {
+	err := p.checkCounterparty(o.Signer)
+	if err != nil {
+		return err
+	}
+	err = p.checkAsset(o.Details.Asset)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AcceptPayment returns an error if the payment does not satisfy the policy.
+// Payments that are accepted do not count towards the rate limit until they
+// are recorded with RecordPayment.
+func (p *Policy) AcceptPayment(pp agent.PaymentProposal) error {
+	err := p.checkCounterparty(pp.Signer)
+	if err != nil {
+		return err
+	}
+	err = p.checkAsset(pp.Asset)
+	if err != nil {
+		return err
+	}
+	if pp.Details.PaymentAmount < p.MinPaymentAmount {
+		return fmt.Errorf("payment amount %d is less than min %d", pp.Details.PaymentAmount, p.MinPaymentAmount)
+	}
+	if p.ValidateMemo != nil {
+		err = p.ValidateMemo(pp.Details.Memo)
+		if err != nil {
+			return fmt.Errorf("invalid memo: %w", err)
+		}
+	}
+	return p.checkRate()
+}
+
+// RecordPayment records a payment that was confirmed, counting it towards the
+// rate limit.
+func (p *Policy) RecordPayment(pp agent.PaymentProposal) {
+	if p.MaxPayments <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.payments = append(p.payments, p.now())
+}
+
+func (p *Policy) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+func (p *Policy) checkCounterparty(signer *keypair.FromAddress) error {
+	if len(p.Counterparties) == 0 {
+		return nil
+	}
+	for _, c := range p.Counterparties {
+		if signer != nil && c.Equal(signer) {
+			return nil
+		}
+	}
+	return fmt.Errorf("counterparty is not allowed")
+}
+
+func (p *Policy) checkAsset(asset state.Asset) error {
+	if len(p.Assets) == 0 {
+		return nil
+	}
+	for _, a := range p.Assets {
+		if a.StringCanonical() == asset.StringCanonical() {
+			return nil
+		}
+	}
+	return fmt.Errorf("asset %s is not allowed", asset.StringCanonical())
+}
+
+func (p *Policy) checkRate() error {
+	if p.MaxPayments <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	since := p.now().Add(-p.MaxPaymentsInterval)
+
+	// Drop payments that are outside the interval.
+	i := 0
+	for i < len(p.payments) && !p.payments[i].After(since) {
+		i++
+	}
+	p.payments = p.payments[i:]
+
+	if len(p.payments) >= p.MaxPayments {
+		return fmt.Errorf("payment rate exceeds %d payments per %v", p.MaxPayments, p.MaxPaymentsInterval)
+	}
+	return nil
+}
+
+// Policies is an agent.AcceptPolicy that accepts opens and payments only if
+// every policy it contains accepts them.
+type Policies []agent.AcceptPolicy
+
+var (
+	_ agent.AcceptPolicy    = Policies{}
+	_ agent.PaymentRecorder = Policies{}
+)
+
+// AcceptOpen returns the first error returned by the policies.
+func (ps Policies) AcceptOpen(o agent.OpenProposal) error {
+	for _, p := range ps {
+		err := p.AcceptOpen(o)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AcceptPayment returns the first error returned by the policies.
+func (ps Policies) AcceptPayment(pp agent.PaymentProposal) error {
+	for _, p := range ps {
+		err := p.AcceptPayment(pp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordPayment records the payment with the policies that implement
+// agent.PaymentRecorder.
+func (ps Policies) RecordPayment(pp agent.PaymentProposal) {
+	for _, p := range ps {
+		if r, ok := p.(agent.PaymentRecorder); ok {
+			r.RecordPayment(pp)
+		}
+	}
+}
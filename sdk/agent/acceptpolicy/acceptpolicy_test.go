@@ -0,0 +1,111 @@
+package acceptpolicy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_zeroAcceptsAll(t *testing.T) {
+	p := &Policy{}
+	signer := keypair.MustRandom().FromAddress()
+	assert.NoError(t, p.AcceptOpen(agent.OpenProposal{Signer: signer}))
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{Signer: signer}))
+}
+
+func TestPolicy_counterparties(t *testing.T) {
+	allowed := keypair.MustRandom().FromAddress()
+	other := keypair.MustRandom().FromAddress()
+	p := &Policy{Counterparties: []*keypair.FromAddress{allowed}}
+
+	assert.NoError(t, p.AcceptOpen(agent.OpenProposal{Signer: allowed}))
+	assert.EqualError(t, p.AcceptOpen(agent.OpenProposal{Signer: other}), "counterparty is not allowed")
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{Signer: allowed}))
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{Signer: other}), "counterparty is not allowed")
+}
+
+func TestPolicy_assets(t *testing.T) {
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	p := &Policy{Assets: []state.Asset{state.NativeAsset}}
+
+	assert.NoError(t, p.AcceptOpen(agent.OpenProposal{Details: state.OpenDetails{Asset: state.NativeAsset}}))
+	assert.EqualError(t, p.AcceptOpen(agent.OpenProposal{Details: state.OpenDetails{Asset: asset}}), "asset "+asset.StringCanonical()+" is not allowed")
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{Asset: state.NativeAsset}))
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{Asset: asset}), "asset "+asset.StringCanonical()+" is not allowed")
+}
+
+func TestPolicy_minPaymentAmount(t *testing.T) {
+	p := &Policy{MinPaymentAmount: 100}
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{Details: state.CloseDetails{PaymentAmount: 100}}))
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{Details: state.CloseDetails{PaymentAmount: 99}}), "payment amount 99 is less than min 100")
+}
+
+func TestPolicy_validateMemo(t *testing.T) {
+	p := &Policy{
+		ValidateMemo: func(memo []byte) error {
+			if len(memo) == 0 {
+				return fmt.Errorf("memo is empty")
+			}
+			return nil
+		},
+	}
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{Details: state.CloseDetails{Memo: []byte("order-1")}}))
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{}), "invalid memo: memo is empty")
+}
+
+func TestPolicy_maxPayments(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &Policy{
+		MaxPayments:         2,
+		MaxPaymentsInterval: time.Second,
+		Now:                 func() time.Time { return now },
+	}
+
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{}))
+	p.RecordPayment(agent.PaymentProposal{})
+	now = now.Add(500 * time.Millisecond)
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{}))
+	p.RecordPayment(agent.PaymentProposal{})
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{}), "payment rate exceeds 2 payments per 1s")
+
+	// Once the first payment falls outside the interval another is accepted.
+	now = now.Add(500 * time.Millisecond)
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{}))
+	p.RecordPayment(agent.PaymentProposal{})
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{}), "payment rate exceeds 2 payments per 1s")
+}
+
+func TestPolicy_maxPaymentsOnlyCountsRecorded(t *testing.T) {
+	p := &Policy{
+		MaxPayments:         1,
+		MaxPaymentsInterval: time.Minute,
+	}
+
+	// Payments that are accepted but never recorded, because the agent found
+	// them invalid, do not count towards the limit.
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{}))
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{}))
+	p.RecordPayment(agent.PaymentProposal{})
+	assert.EqualError(t, p.AcceptPayment(agent.PaymentProposal{}), "payment rate exceeds 1 payments per 1m0s")
+}
+
+func TestPolicies(t *testing.T) {
+	ps := Policies{
+		&Policy{MinPaymentAmount: 10},
+		&Policy{MinPaymentAmount: 100},
+	}
+	assert.NoError(t, ps.AcceptOpen(agent.OpenProposal{}))
+	assert.NoError(t, ps.AcceptPayment(agent.PaymentProposal{Details: state.CloseDetails{PaymentAmount: 100}}))
+	assert.EqualError(t, ps.AcceptPayment(agent.PaymentProposal{Details: state.CloseDetails{PaymentAmount: 50}}), "payment amount 50 is less than min 100")
+	assert.EqualError(t, ps.AcceptPayment(agent.PaymentProposal{Details: state.CloseDetails{PaymentAmount: 5}}), "payment amount 5 is less than min 10")
+
+	limited := &Policy{MaxPayments: 1, MaxPaymentsInterval: time.Minute}
+	ps = Policies{&AssetRiskPolicy{}, limited}
+	ps.RecordPayment(agent.PaymentProposal{})
+	assert.EqualError(t, ps.AcceptPayment(agent.PaymentProposal{}), "payment rate exceeds 1 payments per 1m0s")
+}
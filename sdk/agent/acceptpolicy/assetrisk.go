@@ -0,0 +1,92 @@
+package acceptpolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+// AssetRisk is a flag set on the issuer of a channel's asset that allows the
+// issuer to cause the channel's close to fail, or to take the asset held by the
+// channel accounts.
+type AssetRisk string
+
+const (
+	// AssetRiskAuthRevocable indicates the issuer can revoke the
+	// authorization of the channel accounts' trustlines, preventing the
+	// close from paying out the asset.
+	AssetRiskAuthRevocable AssetRisk = "auth_revocable"
+
+	// AssetRiskAuthClawbackEnabled indicates trustlines are created with
+	// clawback enabled, allowing the issuer to claw back the asset held by
+	// the channel accounts.
+	AssetRiskAuthClawbackEnabled AssetRisk = "auth_clawback_enabled"
+)
+
+// AssetRisks returns the risks posed by the issuer of the asset, using the
+// collector to get the issuer's flags. The native asset has no issuer and
+// poses no risk.
+func AssetRisks(c agent.IssuerFlagsCollector, asset state.Asset) ([]AssetRisk, error) {
+	if asset.IsNative() {
+		return nil, nil
+	}
+	issuer, err := keypair.ParseAddress(asset.Issuer())
+	if err != nil {
+		return nil, fmt.Errorf("parsing issuer of asset %s: %w", asset.StringCanonical(), err)
+	}
+	flags, err := c.GetIssuerFlags(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("getting flags of issuer of asset %s: %w", asset.StringCanonical(), err)
+	}
+	var risks []AssetRisk
+	if flags.IsAuthRevocable() {
+		risks = append(risks, AssetRiskAuthRevocable)
+	}
+	if flags.IsAuthClawbackEnabled() {
+		risks = append(risks, AssetRiskAuthClawbackEnabled)
+	}
+	return risks, nil
+}
+
+// AssetRiskPolicy is an agent.AcceptPolicy that rejects opens for assets
+// whose issuer poses a risk to the success of the channel's close, as
+// described by AssetRisk. Payments are always accepted since the asset was
+// checked at open.
+type AssetRiskPolicy struct {
+	IssuerFlagsCollector agent.IssuerFlagsCollector
+
+	// Warn, if set, is called with the risks of an open's asset and the open
+	// is accepted instead of rejected.
+	Warn func(o agent.OpenProposal, risks []AssetRisk)
+}
+
+var _ agent.AcceptPolicy = &AssetRiskPolicy{}
+
+// AcceptOpen returns an error if the issuer of the open's asset poses a risk
+// and no Warn func is set, or if the issuer's flags could not be checked.
+func (p *AssetRiskPolicy) AcceptOpen(o agent.OpenProposal) error {
+	risks, err := AssetRisks(p.IssuerFlagsCollector, o.Details.Asset)
+	if err != nil {
+		return err
+	}
+	if len(risks) == 0 {
+		return nil
+	}
+	if p.Warn != nil {
+		p.Warn(o, risks)
+		return nil
+	}
+	riskStrs := make([]string, len(risks))
+	for i, r := range risks {
+		riskStrs[i] = string(r)
+	}
+	return fmt.Errorf("asset %s issuer has %s set", o.Details.Asset.StringCanonical(), strings.Join(riskStrs, ", "))
+}
+
+// AcceptPayment accepts all payments.
+func (p *AssetRiskPolicy) AcceptPayment(pp agent.PaymentProposal) error {
+	return nil
+}
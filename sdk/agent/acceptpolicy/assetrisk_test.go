@@ -0,0 +1,88 @@
+package acceptpolicy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type issuerFlagsCollectorFunc func(issuer *keypair.FromAddress) (xdr.AccountFlags, error)
+
+func (f issuerFlagsCollectorFunc) GetIssuerFlags(issuer *keypair.FromAddress) (xdr.AccountFlags, error) {
+	return f(issuer)
+}
+
+func TestAssetRisks(t *testing.T) {
+	issuer := "GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3"
+	asset := state.Asset("ABCD:" + issuer)
+
+	testCases := []struct {
+		name      string
+		flags     xdr.AccountFlags
+		wantRisks []AssetRisk
+	}{
+		{"none", 0, nil},
+		{"auth required", xdr.AccountFlagsAuthRequiredFlag, nil},
+		{"auth revocable", xdr.AccountFlagsAuthRevocableFlag, []AssetRisk{AssetRiskAuthRevocable}},
+		{"auth clawback enabled", xdr.AccountFlagsAuthRevocableFlag | xdr.AccountFlagsAuthClawbackEnabledFlag, []AssetRisk{AssetRiskAuthRevocable, AssetRiskAuthClawbackEnabled}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := issuerFlagsCollectorFunc(func(i *keypair.FromAddress) (xdr.AccountFlags, error) {
+				assert.Equal(t, issuer, i.Address())
+				return tc.flags, nil
+			})
+			risks, err := AssetRisks(c, asset)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRisks, risks)
+		})
+	}
+
+	t.Run("native", func(t *testing.T) {
+		c := issuerFlagsCollectorFunc(func(i *keypair.FromAddress) (xdr.AccountFlags, error) {
+			t.Fatal("native asset has no issuer")
+			return 0, nil
+		})
+		risks, err := AssetRisks(c, state.NativeAsset)
+		require.NoError(t, err)
+		assert.Empty(t, risks)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := issuerFlagsCollectorFunc(func(i *keypair.FromAddress) (xdr.AccountFlags, error) {
+			return 0, errors.New("not found")
+		})
+		_, err := AssetRisks(c, asset)
+		assert.EqualError(t, err, "getting flags of issuer of asset "+string(asset)+": not found")
+	})
+}
+
+func TestAssetRiskPolicy(t *testing.T) {
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	c := issuerFlagsCollectorFunc(func(i *keypair.FromAddress) (xdr.AccountFlags, error) {
+		return xdr.AccountFlagsAuthRevocableFlag | xdr.AccountFlagsAuthClawbackEnabledFlag, nil
+	})
+	open := agent.OpenProposal{Details: state.OpenDetails{Asset: asset}}
+
+	p := &AssetRiskPolicy{IssuerFlagsCollector: c}
+	assert.EqualError(t, p.AcceptOpen(open), "asset "+string(asset)+" issuer has auth_revocable, auth_clawback_enabled set")
+	assert.NoError(t, p.AcceptOpen(agent.OpenProposal{Details: state.OpenDetails{Asset: state.NativeAsset}}))
+	assert.NoError(t, p.AcceptPayment(agent.PaymentProposal{Asset: asset}))
+
+	var warned []AssetRisk
+	p = &AssetRiskPolicy{
+		IssuerFlagsCollector: c,
+		Warn: func(o agent.OpenProposal, risks []AssetRisk) {
+			assert.Equal(t, open, o)
+			warned = risks
+		},
+	}
+	assert.NoError(t, p.AcceptOpen(open))
+	assert.Equal(t, []AssetRisk{AssetRiskAuthRevocable, AssetRiskAuthClawbackEnabled}, warned)
+}
@@ -15,8 +15,11 @@ import (
 
 	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
 	"github.com/stellar/starlight/sdk/agent/msg"
+	"github.com/stellar/starlight/sdk/agent/trace"
 	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
 )
 
 // BalanceCollector gets the balance of an asset for an account.
@@ -29,12 +32,37 @@ type SequenceNumberCollector interface {
 	GetSequenceNumber(account *keypair.FromAddress) (int64, error)
 }
 
+// IssuerFlagsCollector gets the flags set on the issuer account of an asset.
+type IssuerFlagsCollector interface {
+	GetIssuerFlags(issuer *keypair.FromAddress) (xdr.AccountFlags, error)
+}
+
 // Submitter submits a transaction to the network.
 type Submitter interface {
 	SubmitTx(tx *txnbuild.Transaction) error
 }
 
+// TypedSubmitter is optionally implemented by a Submitter to be told the type
+// of the channel's transactions it submits. The agent calls SubmitTypedTx
+// instead of SubmitTx when the Submitter implements it, so that a Submitter
+// that queues transactions can tell which supersede others.
+type TypedSubmitter interface {
+	SubmitTypedTx(txType txbuild.TransactionType, tx *txnbuild.Transaction) error
+}
+
 // Streamer streams transactions that affect a set of accounts.
+//
+// Streamers also report the ledgers that close while streaming, so that the
+// agent can observe when the ledger gap of an observation period has passed,
+// by sending a StreamedTransaction with only the LedgerSequence and
+// LedgerCloseTime set. A ledger only needs to be reported if no transaction
+// was streamed from it.
+//
+// Streaming resumes after the given cursor. What an empty cursor streams from
+// depends on the implementation, but every implementation streams the
+// transactions submitted after StreamTx is called. The horizon and ledgermeta
+// Streamers stream from the beginning, and the stellarrpc Streamer streams
+// from the latest ledger.
 type Streamer interface {
 	StreamTx(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func())
 }
@@ -49,11 +77,59 @@ type StreamedTransaction struct {
 	// they were executed on the Stellar network.
 	TransactionOrderID int64
 
+	// LedgerSequence and LedgerCloseTime are the sequence and close time of
+	// the ledger the transaction was included in, or of the ledger reported
+	// if there is no transaction. They are used to determine when the
+	// observation period of a declaration ends.
+	LedgerSequence  uint32
+	LedgerCloseTime time.Time
+
 	TransactionXDR string
 	ResultXDR      string
 	ResultMetaXDR  string
 }
 
+// AcceptPolicy decides whether opens and payments proposed by the other
+// participant are acceptable. The agent consults the policy before signing an
+// open or payment, and if the policy returns an error the agent rejects the
+// open or payment, sending the error's message to the other participant.
+//
+// The agent also consults AcceptOpen before proposing an open itself, so that
+// a policy that limits the asset or counterparty of a channel applies to
+// channels the agent opens, and if the policy returns an error the open is
+// not proposed.
+type AcceptPolicy interface {
+	AcceptOpen(p OpenProposal) error
+	AcceptPayment(p PaymentProposal) error
+}
+
+// PaymentRecorder is optionally implemented by an AcceptPolicy to be told of
+// the payments the agent confirms. The agent calls RecordPayment after a
+// payment the policy accepted is confirmed, and not for payments that are
+// rejected as invalid after the policy accepted them, so that a policy that
+// limits the rate of payments only counts payments that were received.
+type PaymentRecorder interface {
+	RecordPayment(p PaymentProposal)
+}
+
+// OpenProposal is an open proposed by either participant that is given to an
+// AcceptPolicy. ChannelAccount and Signer are always those of the other
+// participant.
+type OpenProposal struct {
+	ChannelAccount *keypair.FromAddress
+	Signer         *keypair.FromAddress
+	Details        state.OpenDetails
+}
+
+// PaymentProposal is a payment proposed by the other participant that is
+// given to an AcceptPolicy.
+type PaymentProposal struct {
+	ChannelAccount *keypair.FromAddress
+	Signer         *keypair.FromAddress
+	Asset          state.Asset
+	Details        state.CloseDetails
+}
+
 // Snapshotter is given a snapshot of the agent and its dependencies whenever
 // its meaningful state changes. Snapshots can be restore using
 // NewAgentFromSnapshot.
@@ -61,6 +137,31 @@ type Snapshotter interface {
 	Snapshot(a *Agent, s Snapshot)
 }
 
+// Metrics records measurements of the agent's activity. The agent calls its
+// functions while holding its lock, so they should return quickly.
+type Metrics interface {
+	// PaymentSent is called when a payment proposed by the agent is
+	// finalized, with the time taken from proposing to finalizing.
+	PaymentSent(amount int64, latency time.Duration)
+
+	// PaymentReceived is called when a payment proposed by the other
+	// participant is confirmed.
+	PaymentReceived(amount int64)
+
+	// TxIngested is called when a transaction is ingested, with the time since
+	// the ledger the transaction was included in closed. The lag is zero if
+	// the Streamer does not provide the ledger close time.
+	TxIngested(lag time.Duration)
+
+	// TxSubmitted is called when one of the channel's transactions is
+	// submitted, with the error returned by the Submitter.
+	TxSubmitted(txType txbuild.TransactionType, err error)
+
+	// ChannelState is called with the state of the channel after each
+	// transaction is ingested.
+	ChannelState(s state.State)
+}
+
 // Config contains the information that can be supplied to configure the Agent
 // at construction.
 type Config struct {
@@ -69,15 +170,56 @@ type Config struct {
 	MaxOpenExpiry              time.Duration
 	NetworkPassphrase          string
 
+	// AcceptedAssets are the assets the agent will accept an open for. If
+	// empty, an open for any asset will be accepted.
+	AcceptedAssets []state.Asset
+
+	// MinObservationPeriodTime, MaxObservationPeriodTime,
+	// MinObservationPeriodLedgerGap, and MaxObservationPeriodLedgerGap limit
+	// the observation periods the agent will accept an open for. Limits that
+	// are zero are not enforced.
+	MinObservationPeriodTime      time.Duration
+	MaxObservationPeriodTime      time.Duration
+	MinObservationPeriodLedgerGap uint32
+	MaxObservationPeriodLedgerGap uint32
+
+	// AcceptPolicy, if set, is consulted before confirming opens and payments
+	// proposed by the other participant.
+	AcceptPolicy AcceptPolicy
+
+	// CloseOnCompromise, if true, causes the agent to force close the channel
+	// when a compromise of either channel account is observed while the
+	// channel is open.
+	CloseOnCompromise bool
+
 	SequenceNumberCollector SequenceNumberCollector
 	BalanceCollector        BalanceCollector
 	Submitter               Submitter
 	Streamer                Streamer
 	Snapshotter             Snapshotter
 
+	// Metrics, if set, records measurements of the agent's activity.
+	Metrics Metrics
+
+	// Tracer, if set, traces the lifecycle of payments, and the submission and
+	// ingestion of transactions. The trace context of a payment is sent to the
+	// other participant so that both agents' spans are part of one trace. The
+	// submission of a transaction is traced as part of the operation that
+	// submitted it, and the ingestion of a transaction the agent submitted is
+	// traced as part of its submission.
+	Tracer trace.Tracer
+
 	ChannelAccountKey    *keypair.FromAddress
 	ChannelAccountSigner *keypair.Full
 
+	// Logger, if set, is used to log the agent's activity with fields
+	// identifying the channel. A *slog.Logger can be used.
+	Logger Logger
+
+	// LogWriter, if set and Logger is not set, is written the agent's logs as
+	// lines of key=value pairs.
+	//
+	// Deprecated: Use Logger.
 	LogWriter io.Writer
 
 	Events chan<- interface{}
@@ -91,18 +233,33 @@ func NewAgent(c Config) *Agent {
 		maxOpenExpiry:              c.MaxOpenExpiry,
 		networkPassphrase:          c.NetworkPassphrase,
 
+		acceptedAssets:                c.AcceptedAssets,
+		minObservationPeriodTime:      c.MinObservationPeriodTime,
+		maxObservationPeriodTime:      c.MaxObservationPeriodTime,
+		minObservationPeriodLedgerGap: c.MinObservationPeriodLedgerGap,
+		maxObservationPeriodLedgerGap: c.MaxObservationPeriodLedgerGap,
+
+		acceptPolicy:      c.AcceptPolicy,
+		closeOnCompromise: c.CloseOnCompromise,
+
 		sequenceNumberCollector: c.SequenceNumberCollector,
 		balanceCollector:        c.BalanceCollector,
 		submitter:               c.Submitter,
 		streamer:                c.Streamer,
 		snapshotter:             c.Snapshotter,
 
+		metrics: c.Metrics,
+		tracer:  c.Tracer,
+
 		channelAccountKey:    c.ChannelAccountKey,
 		channelAccountSigner: c.ChannelAccountSigner,
 
+		logger:    loggerOrWriter(c.Logger, c.LogWriter),
 		logWriter: c.LogWriter,
 
 		events: c.Events,
+
+		closeRetryInterval: defaultCloseRetryInterval,
 	}
 	return agent
 }
@@ -142,19 +299,34 @@ type Agent struct {
 	maxOpenExpiry              time.Duration
 	networkPassphrase          string
 
+	acceptedAssets                []state.Asset
+	minObservationPeriodTime      time.Duration
+	maxObservationPeriodTime      time.Duration
+	minObservationPeriodLedgerGap uint32
+	maxObservationPeriodLedgerGap uint32
+
+	acceptPolicy      AcceptPolicy
+	closeOnCompromise bool
+
 	sequenceNumberCollector SequenceNumberCollector
 	balanceCollector        BalanceCollector
 	submitter               Submitter
 	streamer                Streamer
 	snapshotter             Snapshotter
 
+	metrics Metrics
+	tracer  trace.Tracer
+
 	channelAccountKey    *keypair.FromAddress
 	channelAccountSigner *keypair.Full
 
+	logger    Logger
 	logWriter io.Writer
 
 	events chan<- interface{}
 
+	closeRetryInterval time.Duration
+
 	// mu is a lock for the mutable fields of this type. It should be locked
 	// when reading or writing any of the mutable fields. The mutable fields are
 	// listed below. If pushing to a chan, such as Events, it is unnecessary to
@@ -168,6 +340,16 @@ type Agent struct {
 	streamerTransactions      <-chan StreamedTransaction
 	streamerCursor            string
 	streamerCancel            func()
+	closeTimer                *time.Timer
+	closePending              bool
+	closeReadyLedger          uint32
+	closeReadyAt              time.Time
+	latestLedger              uint32
+	paymentProposedAt         time.Time
+	paymentSpan               trace.Span
+	submittedTxSpans          map[string]trace.SpanContext
+	submissions               []submission
+	submitting                bool
 }
 
 // Config returns the configuration that the Agent was constructed with.
@@ -178,15 +360,28 @@ func (a *Agent) Config() Config {
 		MaxOpenExpiry:              a.maxOpenExpiry,
 		NetworkPassphrase:          a.networkPassphrase,
 
+		AcceptedAssets:                a.acceptedAssets,
+		MinObservationPeriodTime:      a.minObservationPeriodTime,
+		MaxObservationPeriodTime:      a.maxObservationPeriodTime,
+		MinObservationPeriodLedgerGap: a.minObservationPeriodLedgerGap,
+		MaxObservationPeriodLedgerGap: a.maxObservationPeriodLedgerGap,
+
+		AcceptPolicy:      a.acceptPolicy,
+		CloseOnCompromise: a.closeOnCompromise,
+
 		SequenceNumberCollector: a.sequenceNumberCollector,
 		BalanceCollector:        a.balanceCollector,
 		Submitter:               a.submitter,
 		Streamer:                a.streamer,
 		Snapshotter:             a.snapshotter,
 
+		Metrics: a.metrics,
+		Tracer:  a.tracer,
+
 		ChannelAccountKey:    a.channelAccountKey,
 		ChannelAccountSigner: a.channelAccountSigner,
 
+		Logger:    a.logger,
 		LogWriter: a.logWriter,
 
 		Events: a.events,
@@ -231,7 +426,7 @@ func (a *Agent) hello() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	enc := msg.NewEncoder(io.MultiWriter(a.conn, a.logWriter))
+	enc := msg.NewEncoder(a.conn)
 	err := enc.Encode(msg.Message{
 		Type: msg.TypeHello,
 		Hello: &msg.Hello{
@@ -260,8 +455,23 @@ func (a *Agent) initChannel(initiator bool, snapshot *state.Snapshot) {
 	} else {
 		a.channel = state.NewChannelFromSnapshot(config, *snapshot)
 	}
-	a.streamerTransactions, a.streamerCancel = a.streamer.StreamTx(a.streamerCursor)
-	go a.ingestLoop()
+	a.streamerTransactions, a.streamerCancel = a.streamer.StreamTx(a.streamerCursor, a.channelAccountKey, a.otherChannelAccount)
+	go a.ingestLoop(a.streamerTransactions)
+}
+
+// resetChannel discards a channel that has not been opened, stopping
+// ingestion for the channel, so that a new channel can be opened.
+func (a *Agent) resetChannel() {
+	a.stopScheduledClose()
+	a.streamerCancel()
+	a.channel = nil
+	a.streamerTransactions = nil
+	a.streamerCancel = nil
+	if a.paymentSpan != nil {
+		a.paymentSpan.End()
+		a.paymentSpan = nil
+	}
+	a.submittedTxSpans = nil
 }
 
 // Open kicks off the open process which will continue after the function
@@ -270,6 +480,36 @@ func (a *Agent) Open(asset state.Asset) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	// Expire the channel before the max open expiry. If both participants are
+	// using the same max open expiry, we need to set the expiry earlier so that
+	// small amounts of clock drift doesn't cause the open agreement to be
+	// rejected by the other participant.
+	openExpiresAt := time.Now().Add(a.maxOpenExpiry / 2)
+
+	return a.open(msg.OpenCounterProposal{
+		ObservationPeriodTime:      a.observationPeriodTime,
+		ObservationPeriodLedgerGap: a.observationPeriodLedgerGap,
+		Asset:                      asset,
+		ExpiresAt:                  openExpiresAt,
+	})
+}
+
+// OpenWithCounterProposal kicks off the open process using the parameters of a
+// counter-proposal received from the other participant in an
+// OpenRejectedEvent. The process will continue after the function returns.
+func (a *Agent) OpenWithCounterProposal(p msg.OpenCounterProposal) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	maxExpiresAt := time.Now().Add(a.maxOpenExpiry / 2)
+	if p.ExpiresAt.After(maxExpiresAt) {
+		p.ExpiresAt = maxExpiresAt
+	}
+
+	return a.open(p)
+}
+
+func (a *Agent) open(p msg.OpenCounterProposal) error {
 	if a.conn == nil {
 		return fmt.Errorf("not connected")
 	}
@@ -282,27 +522,42 @@ func (a *Agent) Open(asset state.Asset) error {
 		return fmt.Errorf("getting sequence number of channel account: %w", err)
 	}
 
-	a.initChannel(true, nil)
+	params := state.OpenParams{
+		ObservationPeriodTime:      p.ObservationPeriodTime,
+		ObservationPeriodLedgerGap: p.ObservationPeriodLedgerGap,
+		Asset:                      p.Asset,
+		ExpiresAt:                  p.ExpiresAt,
+		StartingSequence:           seqNum + 1,
+	}
+	if a.acceptPolicy != nil {
+		err = a.acceptPolicy.AcceptOpen(OpenProposal{
+			ChannelAccount: a.otherChannelAccount,
+			Signer:         a.otherChannelAccountSigner,
+			Details: state.OpenDetails{
+				ObservationPeriodTime:      params.ObservationPeriodTime,
+				ObservationPeriodLedgerGap: params.ObservationPeriodLedgerGap,
+				Asset:                      params.Asset,
+				ExpiresAt:                  params.ExpiresAt,
+				StartingSequence:           params.StartingSequence,
+				ProposingSigner:            a.channelAccountSigner.FromAddress(),
+				ConfirmingSigner:           a.otherChannelAccountSigner,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("open not accepted: %w", err)
+		}
+	}
 
-	// Expire the channel before the max open expiry. If both participants are
-	// using the same max open expiry, we need to set the expiry earlier so that
-	// small amounts of clock drift doesn't cause the open agreement to be
-	// rejected by the other participant.
-	openExpiresAt := time.Now().Add(a.maxOpenExpiry / 2)
+	a.initChannel(true, nil)
 
-	open, err := a.channel.ProposeOpen(state.OpenParams{
-		ObservationPeriodTime:      a.observationPeriodTime,
-		ObservationPeriodLedgerGap: a.observationPeriodLedgerGap,
-		Asset:                      asset,
-		ExpiresAt:                  openExpiresAt,
-		StartingSequence:           seqNum + 1,
-	})
+	open, err := a.channel.ProposeOpen(params)
 	if err != nil {
+		a.resetChannel()
 		return fmt.Errorf("proposing open: %w", err)
 	}
 	a.takeSnapshot()
 
-	enc := msg.NewEncoder(io.MultiWriter(a.conn, a.logWriter))
+	enc := msg.NewEncoder(a.conn)
 	err = enc.Encode(msg.Message{
 		Type:        msg.TypeOpenRequest,
 		OpenRequest: &open.Envelope,
@@ -337,40 +592,79 @@ func (a *Agent) PaymentWithMemo(paymentAmount int64, memo []byte) error {
 		return fmt.Errorf("no channel")
 	}
 
-	ca, err := a.channel.ProposePaymentWithMemo(paymentAmount, memo)
-	if errors.Is(err, state.ErrUnderfunded) {
-		fmt.Fprintf(a.logWriter, "local is underfunded for this payment based on cached account balances, checking channel account...\n")
-		var balance int64
-		balance, err = a.balanceCollector.GetBalance(a.channel.LocalChannelAccount().Address, a.channel.OpenAgreement().Envelope.Details.Asset)
-		if err != nil {
-			return err
-		}
-		a.channel.UpdateLocalChannelAccountBalance(balance)
-		ca, err = a.channel.ProposePaymentWithMemo(paymentAmount, memo)
-	}
+	span := trace.Start(a.tracer, "payment", trace.SpanContext{})
+	span.SetAttributes("amount", paymentAmount)
+	ca, err := a.proposePayment(span, paymentAmount, memo)
 	if err != nil {
-		return fmt.Errorf("proposing payment %d: %w", paymentAmount, err)
+		span.RecordError(err)
+		span.End()
+		return err
 	}
+	span.SetAttributes("iteration", ca.Envelope.Details.IterationNumber)
+	a.paymentProposedAt = time.Now()
 	a.takeSnapshot()
 
-	enc := msg.NewEncoder(io.MultiWriter(a.conn, a.logWriter))
+	// Only one payment can be in progress at a time, so a payment span still
+	// open belongs to a payment that was never finalized.
+	if a.paymentSpan != nil {
+		a.paymentSpan.End()
+	}
+	a.paymentSpan = span
+
+	enc := msg.NewEncoder(a.conn)
 	err = enc.Encode(msg.Message{
 		Type:           msg.TypePaymentRequest,
+		TraceParent:    span.SpanContext().TraceParent(),
 		PaymentRequest: &ca.Envelope,
 	})
 	if err != nil {
-		return fmt.Errorf("sending payment: %w", err)
+		err = fmt.Errorf("sending payment: %w", err)
+		span.RecordError(err)
+		span.End()
+		a.paymentSpan = nil
+		return err
 	}
 
 	return nil
 }
 
+// proposePayment proposes the payment, refreshing the local channel account
+// balance if the cached balance is insufficient.
+//
+// Must be called with the mutex locked.
+func (a *Agent) proposePayment(parent trace.Span, paymentAmount int64, memo []byte) (ca state.CloseAgreement, err error) {
+	span := trace.Start(a.tracer, "payment.propose", parent.SpanContext())
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	ca, err = a.channel.ProposePaymentWithMemo(paymentAmount, memo)
+	if errors.Is(err, state.ErrUnderfunded) {
+		a.log().Info("local is underfunded for this payment based on cached account balances, checking channel account")
+		var balance int64
+		balance, err = a.balanceCollector.GetBalance(a.channel.LocalChannelAccount().Address, a.channel.OpenAgreement().Envelope.Details.Asset)
+		if err != nil {
+			return state.CloseAgreement{}, err
+		}
+		a.channel.UpdateLocalChannelAccountBalance(balance)
+		ca, err = a.channel.ProposePaymentWithMemo(paymentAmount, memo)
+	}
+	if err != nil {
+		return state.CloseAgreement{}, fmt.Errorf("proposing payment %d: %w", paymentAmount, err)
+	}
+	return ca, nil
+}
+
 // DeclareClose kicks off the close process by submitting a tx to the network to
 // begin the close process, then asynchronously coordinating with the remote
 // participant to coordinate the close. If the participant responds the agent
 // will automatically submit the final close tx that can be submitted
-// immediately. If no closed notification occurs before the observation period,
-// manually submit the close by calling Close.
+// immediately. If the participant does not respond, the agent will
+// automatically submit the close tx once the declaration tx has been ingested
+// and the observation period has passed.
 func (a *Agent) DeclareClose() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -382,30 +676,24 @@ func (a *Agent) DeclareClose() error {
 		return fmt.Errorf("no channel")
 	}
 
+	span := trace.Start(a.tracer, "close.declare", trace.SpanContext{})
+	defer span.End()
+
 	// Submit declaration tx.
-	declTx, _, err := a.channel.CloseTxs()
+	err := a.submitDeclaration(span.SpanContext())
 	if err != nil {
-		return fmt.Errorf("building declaration tx: %w", err)
-	}
-	declHash, err := declTx.HashHex(a.networkPassphrase)
-	if err != nil {
-		return fmt.Errorf("hashing decl tx: %w", err)
-	}
-	fmt.Fprintln(a.logWriter, "submitting declaration:", declHash)
-	err = a.submitter.SubmitTx(declTx)
-	if err != nil {
-		return fmt.Errorf("submitting declaration tx: %w", err)
+		return err
 	}
 
 	// Attempt revising the close agreement to close early.
-	fmt.Fprintln(a.logWriter, "proposing a revised close for immediate submission")
+	a.log().Info("proposing a revised close for immediate submission")
 	ca, err := a.channel.ProposeClose()
 	if err != nil {
 		return fmt.Errorf("proposing the close: %w", err)
 	}
 	a.takeSnapshot()
 
-	enc := msg.NewEncoder(io.MultiWriter(a.conn, a.logWriter))
+	enc := msg.NewEncoder(a.conn)
 	err = enc.Encode(msg.Message{
 		Type:         msg.TypeCloseRequest,
 		CloseRequest: &ca.Envelope,
@@ -417,15 +705,175 @@ func (a *Agent) DeclareClose() error {
 	return nil
 }
 
+// ForceClose closes the channel without the participation of the other
+// participant, by submitting the declaration tx of the latest authorized close
+// agreement and then, once the declaration tx has been ingested and the
+// observation period has passed, the close tx. ForceClose does not require a
+// connection and can be used on an agent restored with NewAgentFromSnapshot.
+//
+// If the latest declaration has already been ingested the close tx is
+// scheduled for submission without resubmitting the declaration.
+func (a *Agent) ForceClose() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.channel == nil {
+		return fmt.Errorf("no channel")
+	}
+
+	s, err := a.channel.State()
+	if err != nil {
+		return fmt.Errorf("getting channel state: %w", err)
+	}
+	switch s {
+	case state.StateNone, state.StateError:
+		return fmt.Errorf("channel is not open")
+	case state.StateClosed:
+		return fmt.Errorf("channel is already closed")
+	case state.StateClosing:
+		// The declaration was ingested before the agent was restored, so
+		// the time it was included in a ledger is unknown. Scheduling from
+		// the current time is later than necessary but always safe.
+		a.scheduleClose(StreamedTransaction{})
+		return nil
+	}
+
+	span := trace.Start(a.tracer, "close.force", trace.SpanContext{})
+	defer span.End()
+	return a.submitDeclaration(span.SpanContext())
+}
+
+// submitDeclaration queues the declaration tx of the latest authorized close
+// agreement for submission, as part of the operation traced by the parent
+// span. A failed submission is sent as an ErrorEvent.
+//
+// Must be called with the mutex locked.
+func (a *Agent) submitDeclaration(parent trace.SpanContext) error {
+	declTx, _, err := a.channel.CloseTxs()
+	if err != nil {
+		return fmt.Errorf("building declaration tx: %w", err)
+	}
+	declHash, err := declTx.HashHex(a.networkPassphrase)
+	if err != nil {
+		return fmt.Errorf("hashing decl tx: %w", err)
+	}
+	a.log().Info("submitting declaration tx", "tx", declHash)
+	a.submitTx(parent, txbuild.TransactionTypeDeclaration, declTx, nil)
+	return nil
+}
+
+// submission is a transaction queued for submission by the agent.
+type submission struct {
+	span   trace.Span
+	txType txbuild.TransactionType
+	tx     *txnbuild.Transaction
+	hash   string
+	done   func(err error)
+}
+
+// submitTx queues the channel's transaction for submission, recording the
+// outcome in the metrics. The submission is traced as a child of the parent
+// span, and the ingestion of the transaction is traced as a child of the
+// submission.
+//
+// Transactions are submitted in the order they are queued by a goroutine that
+// holds the mutex only while taking from the queue and reporting the outcome,
+// so that a Submitter that is slow or retries does not block the agent. When
+// the submission completes done is called with its error and the mutex
+// locked. If done is nil a failed submission is sent as an ErrorEvent.
+//
+// Must be called with the mutex locked.
+func (a *Agent) submitTx(parent trace.SpanContext, txType txbuild.TransactionType, tx *txnbuild.Transaction, done func(err error)) {
+	span := trace.Start(a.tracer, "tx.submit", parent)
+	span.SetAttributes("tx_type", string(txType))
+
+	hash, err := tx.HashHex(a.networkPassphrase)
+	if err != nil {
+		hash = ""
+	}
+	if sc := span.SpanContext(); sc.IsValid() && hash != "" {
+		if a.submittedTxSpans == nil {
+			a.submittedTxSpans = map[string]trace.SpanContext{}
+		}
+		a.submittedTxSpans[hash] = sc
+	}
+
+	a.submissions = append(a.submissions, submission{
+		span:   span,
+		txType: txType,
+		tx:     tx,
+		hash:   hash,
+		done:   done,
+	})
+	if !a.submitting {
+		a.submitting = true
+		go a.submitLoop()
+	}
+}
+
+// submitLoop submits queued transactions until the queue is empty.
+func (a *Agent) submitLoop() {
+	for {
+		a.mu.Lock()
+		if len(a.submissions) == 0 {
+			a.submitting = false
+			a.mu.Unlock()
+			return
+		}
+		s := a.submissions[0]
+		a.submissions = a.submissions[1:]
+		a.mu.Unlock()
+
+		var err error
+		if ts, ok := a.submitter.(TypedSubmitter); ok {
+			err = ts.SubmitTypedTx(s.txType, s.tx)
+		} else {
+			err = a.submitter.SubmitTx(s.tx)
+		}
+
+		a.mu.Lock()
+		a.submitted(s, err)
+		a.mu.Unlock()
+	}
+}
+
+// submitted records the outcome of a submission.
+//
+// Must be called with the mutex locked.
+func (a *Agent) submitted(s submission, err error) {
+	defer s.span.End()
+	if err != nil {
+		s.span.RecordError(err)
+		delete(a.submittedTxSpans, s.hash)
+	}
+	if a.metrics != nil {
+		a.metrics.TxSubmitted(s.txType, err)
+	}
+	if s.done != nil {
+		s.done(err)
+		return
+	}
+	if err != nil {
+		a.sendErrorEvent(fmt.Errorf("submitting %s tx %s: %w", s.txType, s.hash, err))
+		return
+	}
+	a.log().Info("submitted tx", "tx", s.hash, "tx_type", string(s.txType))
+}
+
 // Close closes the channel. The close must have been declared first either by
-// calling DeclareClose or by the other participant. If the close fails it may
-// be because the channel is already closed, or the participant has submitted
-// the same close which is already queued but not yet processed, or the
-// observation period has not yet passed since the close was declared.
+// calling DeclareClose or by the other participant. The close tx is submitted
+// asynchronously, and if the submission fails an ErrorEvent is sent. If the
+// close fails it may be because the channel is already closed, or the
+// participant has submitted the same close which is already queued but not yet
+// processed, or the observation period has not yet passed since the close was
+// declared.
 func (a *Agent) Close() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	span := trace.Start(a.tracer, "close", trace.SpanContext{})
+	defer span.End()
+
 	_, closeTx, err := a.channel.CloseTxs()
 	if err != nil {
 		return fmt.Errorf("building close tx: %w", err)
@@ -434,19 +882,14 @@ func (a *Agent) Close() error {
 	if err != nil {
 		return fmt.Errorf("hashing close tx: %w", err)
 	}
-	fmt.Fprintln(a.logWriter, "submitting close tx:", closeHash)
-	err = a.submitter.SubmitTx(closeTx)
-	if err != nil {
-		fmt.Fprintln(a.logWriter, "error submitting close tx:", closeHash, ",", err)
-		return fmt.Errorf("submitting close tx %s: %w", closeHash, err)
-	}
-	fmt.Fprintln(a.logWriter, "submitted close tx:", closeHash)
+	a.log().Info("submitting close tx", "tx", closeHash)
+	a.submitTx(span.SpanContext(), txbuild.TransactionTypeClose, closeTx, nil)
 	return nil
 }
 
 func (a *Agent) receive() error {
-	recv := msg.NewDecoder(io.TeeReader(a.conn, a.logWriter))
-	send := msg.NewEncoder(io.MultiWriter(a.conn, a.logWriter))
+	recv := msg.NewDecoder(a.conn)
+	send := msg.NewEncoder(a.conn)
 	m := msg.Message{}
 	err := recv.Decode(&m)
 	if err == io.EOF {
@@ -466,17 +909,17 @@ func (a *Agent) receiveLoop() {
 	for {
 		err := a.receive()
 		if err == io.EOF {
-			fmt.Fprintln(a.logWriter, "error receiving: EOF, stopping receiving")
+			a.logWithLock().Info("connection closed, stopping receiving")
 			break
 		}
 		if err != nil {
-			fmt.Fprintf(a.logWriter, "error receiving: %v\n", err)
+			a.logWithLock().Error("error receiving", "error", err)
 		}
 	}
 }
 
 func (a *Agent) handle(m msg.Message, send *msg.Encoder) error {
-	fmt.Fprintf(a.logWriter, "handling %v\n", m.Type)
+	a.logWithLock().Debug("handling message", "type", m.Type)
 	handler := handlerMap[m.Type]
 	if handler == nil {
 		err := fmt.Errorf("handling message %d: unrecognized message type", m.Type)
@@ -500,10 +943,13 @@ var handlerMap = map[msg.Type]func(*Agent, msg.Message, *msg.Encoder) error{
 	msg.TypeHello:           (*Agent).handleHello,
 	msg.TypeOpenRequest:     (*Agent).handleOpenRequest,
 	msg.TypeOpenResponse:    (*Agent).handleOpenResponse,
+	msg.TypeOpenReject:      (*Agent).handleOpenReject,
 	msg.TypePaymentRequest:  (*Agent).handlePaymentRequest,
 	msg.TypePaymentResponse: (*Agent).handlePaymentResponse,
+	msg.TypePaymentReject:   (*Agent).handlePaymentReject,
 	msg.TypeCloseRequest:    (*Agent).handleCloseRequest,
 	msg.TypeCloseResponse:   (*Agent).handleCloseResponse,
+	msg.TypeCloseReject:     (*Agent).handleCloseReject,
 }
 
 func (a *Agent) handleHello(m msg.Message, send *msg.Encoder) error {
@@ -524,8 +970,7 @@ func (a *Agent) handleHello(m msg.Message, send *msg.Encoder) error {
 	a.otherChannelAccount = &h.ChannelAccount
 	a.otherChannelAccountSigner = &h.Signer
 
-	fmt.Fprintf(a.logWriter, "other's channel account: %v\n", a.otherChannelAccount.Address())
-	fmt.Fprintf(a.logWriter, "other's signer: %v\n", a.otherChannelAccountSigner.Address())
+	a.log().Info("connected", "peer_signer", a.otherChannelAccountSigner.Address())
 
 	if a.events != nil {
 		a.events <- ConnectedEvent{ChannelAccount: &h.ChannelAccount, Signer: &h.Signer}
@@ -539,18 +984,39 @@ func (a *Agent) handleOpenRequest(m msg.Message, send *msg.Encoder) error {
 	defer a.mu.Unlock()
 
 	if a.channel != nil {
-		return fmt.Errorf("channel already exists")
+		return a.rejectOpen(send, msg.OpenReject{
+			Reject: msg.Reject{Reason: msg.RejectReasonChannelState, Message: "channel already exists"},
+		})
+	}
+
+	openIn := *m.OpenRequest
+	if reject := a.checkOpenPolicy(openIn.Details); reject != nil {
+		return a.rejectOpen(send, *reject)
+	}
+	if a.acceptPolicy != nil {
+		err := a.acceptPolicy.AcceptOpen(OpenProposal{
+			ChannelAccount: a.otherChannelAccount,
+			Signer:         a.otherChannelAccountSigner,
+			Details:        openIn.Details,
+		})
+		if err != nil {
+			return a.rejectOpen(send, msg.OpenReject{
+				Reject: msg.Reject{Reason: msg.RejectReasonNotAccepted, Message: fmt.Sprintf("open not accepted: %v", err)},
+			})
+		}
 	}
 
 	a.initChannel(false, nil)
 
-	openIn := *m.OpenRequest
 	open, err := a.channel.ConfirmOpen(openIn)
 	if err != nil {
-		return fmt.Errorf("confirming open: %w", err)
+		a.resetChannel()
+		return a.rejectOpen(send, msg.OpenReject{
+			Reject: msg.Reject{Reason: msg.RejectReasonInvalid, Message: fmt.Sprintf("confirming open: %v", err)},
+		})
 	}
 	a.takeSnapshot()
-	fmt.Fprintf(a.logWriter, "open authorized\n")
+	a.log().Info("open authorized")
 
 	err = send.Encode(msg.Message{
 		Type:         msg.TypeOpenResponse,
@@ -570,38 +1036,90 @@ func (a *Agent) handleOpenResponse(m msg.Message, send *msg.Encoder) error {
 		return fmt.Errorf("no channel")
 	}
 
-	openEnvelope := a.channel.OpenAgreement().Envelope
-	openEnvelope.ConfirmerSignatures = *m.OpenResponse
-	_, err := a.channel.ConfirmOpen(openEnvelope)
+	span := trace.Start(a.tracer, "open.finalize", trace.SpanContext{})
+	defer span.End()
+
+	signatures := *m.OpenResponse
+	_, err := a.channel.FinalizeOpen(signatures)
 	if err != nil {
-		return fmt.Errorf("confirming open: %w", err)
+		return fmt.Errorf("finalizing open: %w", err)
 	}
 	a.takeSnapshot()
-	fmt.Fprintf(a.logWriter, "open authorized\n")
+	a.log().Info("open authorized")
 
 	openTx, err := a.channel.OpenTx()
 	if err != nil {
 		return fmt.Errorf("building open tx: %w", err)
 	}
-	err = a.submitter.SubmitTx(openTx)
-	if err != nil {
-		return fmt.Errorf("submitting open tx: %w", err)
-	}
+	a.submitTx(span.SpanContext(), txbuild.TransactionTypeOpen, openTx, nil)
 	return nil
 }
 
-func (a *Agent) handlePaymentRequest(m msg.Message, send *msg.Encoder) error {
+func (a *Agent) handleOpenReject(m msg.Message, send *msg.Encoder) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	if a.channel == nil {
 		return fmt.Errorf("no channel")
 	}
+	if a.channel.OpenAgreement().Envelope.HasAllSignatures() {
+		return fmt.Errorf("open rejected after open was authorized")
+	}
+
+	reject := *m.OpenReject
+	a.resetChannel()
+	a.takeSnapshot()
+	a.log().Warn("open rejected", "reason", reject.Reason, "message", reject.Message)
+
+	if a.events != nil {
+		a.events <- OpenRejectedEvent{
+			Reason:          reject.Reason,
+			Message:         reject.Message,
+			CounterProposal: reject.CounterProposal,
+		}
+	}
+	return nil
+}
+
+func (a *Agent) handlePaymentRequest(m msg.Message, send *msg.Encoder) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// A trace context that cannot be parsed starts a new trace rather than
+	// failing the payment.
+	parent, _ := trace.ParseTraceParent(m.TraceParent)
+	span := trace.Start(a.tracer, "payment.confirm", parent)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if a.channel == nil {
+		return a.reject(send, msg.Message{
+			Type:          msg.TypePaymentReject,
+			PaymentReject: &msg.Reject{Reason: msg.RejectReasonChannelState, Message: "no channel"},
+		})
+	}
 
 	paymentIn := *m.PaymentRequest
+	proposal := PaymentProposal{
+		ChannelAccount: a.otherChannelAccount,
+		Signer:         a.otherChannelAccountSigner,
+		Asset:          a.channel.OpenAgreement().Envelope.Details.Asset,
+		Details:        paymentIn.Details,
+	}
+	if a.acceptPolicy != nil {
+		err := a.acceptPolicy.AcceptPayment(proposal)
+		if err != nil {
+			return a.rejectPayment(send, paymentIn, msg.Reject{Reason: msg.RejectReasonNotAccepted, Message: fmt.Sprintf("payment not accepted: %v", err)})
+		}
+	}
+
 	payment, err := a.channel.ConfirmPayment(paymentIn)
 	if errors.Is(err, state.ErrUnderfunded) {
-		fmt.Fprintf(a.logWriter, "remote is underfunded for this payment based on cached account balances, checking their channel account...\n")
+		a.log().Info("remote is underfunded for this payment based on cached account balances, checking their channel account")
 		var balance int64
 		balance, err = a.balanceCollector.GetBalance(a.channel.RemoteChannelAccount().Address, a.channel.OpenAgreement().Envelope.Details.Asset)
 		if err != nil {
@@ -611,12 +1129,28 @@ func (a *Agent) handlePaymentRequest(m msg.Message, send *msg.Encoder) error {
 		payment, err = a.channel.ConfirmPayment(paymentIn)
 	}
 	if err != nil {
-		return fmt.Errorf("confirming payment: %w", err)
+		reason := msg.RejectReasonInvalid
+		if errors.Is(err, state.ErrUnderfunded) {
+			reason = msg.RejectReasonUnderfunded
+		}
+		return a.rejectPayment(send, paymentIn, msg.Reject{Reason: reason, Message: fmt.Sprintf("confirming payment: %v", err)})
 	}
 	a.takeSnapshot()
-	fmt.Fprintf(a.logWriter, "payment authorized\n")
+	if r, ok := a.acceptPolicy.(PaymentRecorder); ok {
+		r.RecordPayment(proposal)
+	}
+	a.log().Info("payment received", "amount", payment.Envelope.Details.PaymentAmount)
+	if a.metrics != nil {
+		a.metrics.PaymentReceived(payment.Envelope.Details.PaymentAmount)
+	}
 
-	err = send.Encode(msg.Message{Type: msg.TypePaymentResponse, PaymentResponse: &payment.Envelope.ConfirmerSignatures})
+	span.SetAttributes("amount", payment.Envelope.Details.PaymentAmount, "iteration", payment.Envelope.Details.IterationNumber)
+
+	err = send.Encode(msg.Message{
+		Type:            msg.TypePaymentResponse,
+		TraceParent:     span.SpanContext().TraceParent(),
+		PaymentResponse: &payment.Envelope.ConfirmerSignatures,
+	})
 	if a.events != nil {
 		a.events <- PaymentReceivedEvent{CloseAgreement: payment}
 	}
@@ -634,13 +1168,36 @@ func (a *Agent) handlePaymentResponse(m msg.Message, send *msg.Encoder) error {
 		return fmt.Errorf("no channel")
 	}
 
+	parent := trace.SpanContext{}
+	if a.paymentSpan != nil {
+		parent = a.paymentSpan.SpanContext()
+	}
+	span := trace.Start(a.tracer, "payment.finalize", parent)
+
 	signatures := *m.PaymentResponse
 	payment, err := a.channel.FinalizePayment(signatures)
+
+	// End the finalize span before the payment span so that the child ends
+	// within its parent.
 	if err != nil {
-		return fmt.Errorf("confirming payment: %w", err)
+		span.RecordError(err)
+	}
+	span.End()
+	if a.paymentSpan != nil {
+		if err != nil {
+			a.paymentSpan.RecordError(err)
+		}
+		a.paymentSpan.End()
+		a.paymentSpan = nil
+	}
+	if err != nil {
+		return fmt.Errorf("finalizing payment: %w", err)
 	}
 	a.takeSnapshot()
-	fmt.Fprintf(a.logWriter, "payment authorized\n")
+	a.log().Info("payment sent", "amount", payment.Envelope.Details.PaymentAmount)
+	if a.metrics != nil {
+		a.metrics.PaymentSent(payment.Envelope.Details.PaymentAmount, time.Since(a.paymentProposedAt))
+	}
 
 	if a.events != nil {
 		a.events <- PaymentSentEvent{CloseAgreement: payment}
@@ -648,7 +1205,7 @@ func (a *Agent) handlePaymentResponse(m msg.Message, send *msg.Encoder) error {
 	return nil
 }
 
-func (a *Agent) handleCloseRequest(m msg.Message, send *msg.Encoder) error {
+func (a *Agent) handlePaymentReject(m msg.Message, send *msg.Encoder) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -656,11 +1213,56 @@ func (a *Agent) handleCloseRequest(m msg.Message, send *msg.Encoder) error {
 		return fmt.Errorf("no channel")
 	}
 
+	ca, ok := a.channel.LatestUnauthorizedCloseAgreement()
+	if !ok {
+		return fmt.Errorf("no unauthorized payment to reject")
+	}
+	if ca.Envelope.Details.ObservationPeriodTime == 0 && ca.Envelope.Details.ObservationPeriodLedgerGap == 0 {
+		return fmt.Errorf("payment rejected while close in progress")
+	}
+
+	reject := *m.PaymentReject
+	if a.paymentSpan != nil {
+		a.paymentSpan.RecordError(fmt.Errorf("payment rejected with reason %d: %s", reject.Reason, reject.Message))
+		a.paymentSpan.End()
+		a.paymentSpan = nil
+	}
+	payment, _ := a.channel.DiscardUnauthorizedCloseAgreement()
+	a.takeSnapshot()
+	a.log().Warn("payment rejected", "reason", reject.Reason, "message", reject.Message)
+
+	if a.events != nil {
+		a.events <- PaymentRejectedEvent{
+			CloseAgreement: payment,
+			Reason:         reject.Reason,
+			Message:        reject.Message,
+		}
+	}
+	return nil
+}
+
+func (a *Agent) handleCloseRequest(m msg.Message, send *msg.Encoder) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.channel == nil {
+		return a.reject(send, msg.Message{
+			Type:        msg.TypeCloseReject,
+			CloseReject: &msg.Reject{Reason: msg.RejectReasonChannelState, Message: "no channel"},
+		})
+	}
+
+	span := trace.Start(a.tracer, "close.confirm", trace.SpanContext{})
+	defer span.End()
+
 	// Agree to the close and send it back to requesting participant.
 	closeIn := *m.CloseRequest
 	close, err := a.channel.ConfirmClose(closeIn)
 	if err != nil {
-		return fmt.Errorf("confirming close: %v\n", err)
+		return a.reject(send, msg.Message{
+			Type:        msg.TypeCloseReject,
+			CloseReject: &msg.Reject{Reason: msg.RejectReasonInvalid, Message: fmt.Sprintf("confirming close: %v", err)},
+		})
 	}
 	a.takeSnapshot()
 
@@ -671,7 +1273,7 @@ func (a *Agent) handleCloseRequest(m msg.Message, send *msg.Encoder) error {
 	if err != nil {
 		return fmt.Errorf("encoding close to send back: %v\n", err)
 	}
-	fmt.Fprintln(a.logWriter, "close ready")
+	a.log().Info("close ready")
 
 	// Submit the close immediately since it is valid immediately.
 	_, closeTx, err := a.channel.CloseTxs()
@@ -682,12 +1284,8 @@ func (a *Agent) handleCloseRequest(m msg.Message, send *msg.Encoder) error {
 	if err != nil {
 		return fmt.Errorf("hashing close tx: %w", err)
 	}
-	fmt.Fprintln(a.logWriter, "submitting close", hash)
-	err = a.submitter.SubmitTx(closeTx)
-	if err != nil {
-		return fmt.Errorf("submitting close tx: %w", err)
-	}
-	fmt.Fprintln(a.logWriter, "close successful")
+	a.log().Info("submitting close tx", "tx", hash)
+	a.submitTx(span.SpanContext(), txbuild.TransactionTypeClose, closeTx, nil)
 	return nil
 }
 
@@ -699,16 +1297,17 @@ func (a *Agent) handleCloseResponse(m msg.Message, send *msg.Encoder) error {
 		return fmt.Errorf("no channel")
 	}
 
+	span := trace.Start(a.tracer, "close.finalize", trace.SpanContext{})
+	defer span.End()
+
 	// Store updated agreement from other participant.
-	closeAgreement, _ := a.channel.LatestUnauthorizedCloseAgreement()
-	closeEnvelope := closeAgreement.Envelope
-	closeEnvelope.ConfirmerSignatures = *m.CloseResponse
-	_, err := a.channel.ConfirmClose(closeEnvelope)
+	signatures := *m.CloseResponse
+	_, err := a.channel.FinalizeClose(signatures)
 	if err != nil {
-		return fmt.Errorf("confirming close: %v\n", err)
+		return fmt.Errorf("finalizing close: %w", err)
 	}
 	a.takeSnapshot()
-	fmt.Fprintln(a.logWriter, "close ready")
+	a.log().Info("close ready")
 
 	// Submit the close immediately since it is valid immediately.
 	_, closeTx, err := a.channel.CloseTxs()
@@ -719,11 +1318,37 @@ func (a *Agent) handleCloseResponse(m msg.Message, send *msg.Encoder) error {
 	if err != nil {
 		return fmt.Errorf("hashing close tx: %w", err)
 	}
-	fmt.Fprintln(a.logWriter, "submitting close", hash)
-	err = a.submitter.SubmitTx(closeTx)
-	if err != nil {
-		return fmt.Errorf("submitting close tx: %w", err)
+	a.log().Info("submitting close tx", "tx", hash)
+	a.submitTx(span.SpanContext(), txbuild.TransactionTypeClose, closeTx, nil)
+	return nil
+}
+
+func (a *Agent) handleCloseReject(m msg.Message, send *msg.Encoder) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.channel == nil {
+		return fmt.Errorf("no channel")
+	}
+
+	ca, ok := a.channel.LatestUnauthorizedCloseAgreement()
+	if !ok {
+		return fmt.Errorf("no unauthorized close to reject")
+	}
+	if ca.Envelope.Details.ObservationPeriodTime != 0 || ca.Envelope.Details.ObservationPeriodLedgerGap != 0 {
+		return fmt.Errorf("close rejected while payment in progress")
+	}
+
+	reject := *m.CloseReject
+	a.channel.DiscardUnauthorizedCloseAgreement()
+	a.takeSnapshot()
+	a.log().Warn("close rejected", "reason", reject.Reason, "message", reject.Message)
+
+	if a.events != nil {
+		a.events <- CloseRejectedEvent{
+			Reason:  reject.Reason,
+			Message: reject.Message,
+		}
 	}
-	fmt.Fprintln(a.logWriter, "close successful")
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,7 +13,9 @@ import (
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/txnbuild"
 	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent/trace"
 	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
 	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -48,6 +51,45 @@ func (f snapshotterFunc) Snapshot(a *Agent, s Snapshot) {
 	f(a, s)
 }
 
+type recordingMetrics struct {
+	mu               sync.Mutex
+	paymentsSent     []int64
+	paymentsReceived []int64
+	txsIngested      int
+	txsSubmitted     []txbuild.TransactionType
+	channelStates    []state.State
+}
+
+func (m *recordingMetrics) PaymentSent(amount int64, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paymentsSent = append(m.paymentsSent, amount)
+}
+
+func (m *recordingMetrics) PaymentReceived(amount int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paymentsReceived = append(m.paymentsReceived, amount)
+}
+
+func (m *recordingMetrics) TxIngested(lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txsIngested++
+}
+
+func (m *recordingMetrics) TxSubmitted(txType txbuild.TransactionType, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txsSubmitted = append(m.txsSubmitted, txType)
+}
+
+func (m *recordingMetrics) ChannelState(s state.State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.channelStates = append(m.channelStates, s)
+}
+
 func assertAgentSnapshotsAndRestores(t *testing.T, agent *Agent, config Config, snapshot Snapshot) {
 	t.Helper()
 
@@ -90,11 +132,14 @@ func TestAgent_openPaymentClose(t *testing.T) {
 
 	// Setup the local agent.
 	localVars := struct {
-		submittedTx        *txnbuild.Transaction
+		submittedTxs       chan *txnbuild.Transaction
 		transactionsStream chan StreamedTransaction
 	}{}
+	localVars.submittedTxs = make(chan *txnbuild.Transaction, 1)
 	localVars.transactionsStream = make(chan StreamedTransaction)
 	localEvents := make(chan interface{}, 1)
+	localMetrics := &recordingMetrics{}
+	localTracer := trace.NewRecorder()
 	localConfig := Config{
 		ObservationPeriodTime:      20 * time.Second,
 		ObservationPeriodLedgerGap: 1,
@@ -113,7 +158,7 @@ func TestAgent_openPaymentClose(t *testing.T) {
 			return 100_0000000, nil
 		}),
 		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
-			localVars.submittedTx = tx
+			localVars.submittedTxs <- tx
 			return nil
 		}),
 		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
@@ -121,6 +166,8 @@ func TestAgent_openPaymentClose(t *testing.T) {
 		}),
 		ChannelAccountKey:    localChannelAccount.FromAddress(),
 		ChannelAccountSigner: localSigner,
+		Metrics:              localMetrics,
+		Tracer:               localTracer,
 		LogWriter:            io.Discard,
 		Events:               localEvents,
 	}
@@ -131,11 +178,13 @@ func TestAgent_openPaymentClose(t *testing.T) {
 
 	// Setup the remote agent.
 	remoteVars := struct {
-		submittedTx        *txnbuild.Transaction
+		submittedTxs       chan *txnbuild.Transaction
 		transactionsStream chan StreamedTransaction
 	}{}
+	remoteVars.submittedTxs = make(chan *txnbuild.Transaction, 1)
 	remoteVars.transactionsStream = make(chan StreamedTransaction)
 	remoteEvents := make(chan interface{}, 1)
+	remoteTracer := trace.NewRecorder()
 	remoteConfig := Config{
 		ObservationPeriodTime:      20 * time.Second,
 		ObservationPeriodLedgerGap: 1,
@@ -154,7 +203,7 @@ func TestAgent_openPaymentClose(t *testing.T) {
 			return 100_0000000, nil
 		}),
 		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
-			remoteVars.submittedTx = tx
+			remoteVars.submittedTxs <- tx
 			return nil
 		}),
 		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
@@ -162,6 +211,7 @@ func TestAgent_openPaymentClose(t *testing.T) {
 		}),
 		ChannelAccountKey:    remoteChannelAccount.FromAddress(),
 		ChannelAccountSigner: remoteSigner,
+		Tracer:               remoteTracer,
 		LogWriter:            io.Discard,
 		Events:               remoteEvents,
 	}
@@ -260,8 +310,7 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	// Expect the open tx to have been submitted.
 	openTx, err := localAgent.channel.OpenTx()
 	require.NoError(t, err)
-	assert.Equal(t, openTx, localVars.submittedTx)
-	localVars.submittedTx = nil
+	assert.Equal(t, openTx, <-localVars.submittedTxs)
 
 	// Ingest the submitted open tx, as if it was processed on network.
 	openTxXDR, err := openTx.Base64()
@@ -288,6 +337,24 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	}
 	localVars.transactionsStream <- openTxStreamed
 	remoteVars.transactionsStream <- openTxStreamed
+	openTxHash, err := openTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+
+	// Expect open tx observed events.
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeOpen, localObservedEvent.Tx.Type)
+		assert.Equal(t, int64(0), localObservedEvent.Tx.IterationNumber)
+		assert.Equal(t, openTxHash, localObservedEvent.Tx.Hash.String())
+		assert.True(t, localObservedEvent.Successful)
+		assert.Equal(t, []string{"tx_success"}, localObservedEvent.ResultCodes)
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.Equal(t, localObservedEvent, remoteEvent)
+	}
 
 	// Expect opened event.
 	{
@@ -323,6 +390,25 @@ func TestAgent_openPaymentClose(t *testing.T) {
 		assert.Equal(t, int64(50_0000000), remotePaymentEvent.CloseAgreement.Envelope.Details.Balance)
 	}
 
+	// Expect the status to reflect the payment.
+	{
+		status, err := localAgent.Status()
+		require.NoError(t, err)
+		assert.Equal(t, state.StateOpen, status.State)
+		assert.True(t, status.Initiator)
+		assert.Equal(t, state.NativeAsset, status.Asset)
+		assert.Equal(t, int64(50_0000000), status.Balance)
+		assert.Equal(t, int64(2), status.IterationNumber)
+		assert.Equal(t, status.LocalChannelAccount.Balance-50_0000000, status.SendCapacity)
+		assert.Equal(t, status.RemoteChannelAccount.Balance+50_0000000, status.ReceiveCapacity)
+		assert.Nil(t, status.UnauthorizedCloseAgreement)
+		remoteStatus, err := remoteAgent.Status()
+		require.NoError(t, err)
+		assert.False(t, remoteStatus.Initiator)
+		assert.Equal(t, status.SendCapacity, remoteStatus.ReceiveCapacity)
+		assert.Equal(t, status.LatestCloseAgreement, remoteStatus.LatestCloseAgreement)
+	}
+
 	// Make another payment.
 	err = remoteAgent.Payment(20_0000000)
 	require.NoError(t, err)
@@ -407,8 +493,8 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	}
 
 	// Expect no txs to have been submitted for payments.
-	assert.Nil(t, localVars.submittedTx)
-	assert.Nil(t, remoteVars.submittedTx)
+	assert.Len(t, localVars.submittedTxs, 0)
+	assert.Len(t, remoteVars.submittedTxs, 0)
 
 	// Declare the close, and start negotiating for an early close.
 	err = localAgent.DeclareClose()
@@ -417,7 +503,7 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	// Expect the declaration tx to have been submitted.
 	localDeclTx, _, err := localAgent.channel.CloseTxs()
 	require.NoError(t, err)
-	assert.Equal(t, localDeclTx, localVars.submittedTx)
+	assert.Equal(t, localDeclTx, <-localVars.submittedTxs)
 
 	// Ingest the local submitted declaration tx, as if it was processed on
 	// network.
@@ -463,6 +549,24 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	}
 	localVars.transactionsStream <- localDeclTxStreamed
 	remoteVars.transactionsStream <- localDeclTxStreamed
+	localDeclTxHash, err := localDeclTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+
+	// Expect declaration tx observed events.
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeDeclaration, localObservedEvent.Tx.Type)
+		assert.Equal(t, int64(5), localObservedEvent.Tx.IterationNumber)
+		assert.Equal(t, localDeclTxHash, localObservedEvent.Tx.Hash.String())
+		assert.True(t, localObservedEvent.Successful)
+		assert.Equal(t, []string{"tx_success"}, localObservedEvent.ResultCodes)
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.Equal(t, localObservedEvent, remoteEvent)
+	}
 
 	// Expect closing event.
 	{
@@ -486,8 +590,8 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	_, remoteCloseTx, err := remoteAgent.channel.CloseTxs()
 	require.NoError(t, err)
 	assert.Equal(t, localCloseTx, remoteCloseTx)
-	assert.Equal(t, localCloseTx, localVars.submittedTx)
-	assert.Equal(t, remoteCloseTx, remoteVars.submittedTx)
+	assert.Equal(t, localCloseTx, <-localVars.submittedTxs)
+	assert.Equal(t, remoteCloseTx, <-remoteVars.submittedTxs)
 
 	// Ingest the local submitted close tx, as if it was processed on network.
 	// Assume the local submitted successfully first, so the remote did not
@@ -533,6 +637,24 @@ func TestAgent_openPaymentClose(t *testing.T) {
 	}
 	localVars.transactionsStream <- localCloseTxStreamed
 	remoteVars.transactionsStream <- localCloseTxStreamed
+	localCloseTxHash, err := localCloseTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+
+	// Expect close tx observed events.
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeClose, localObservedEvent.Tx.Type)
+		assert.Equal(t, int64(5), localObservedEvent.Tx.IterationNumber)
+		assert.Equal(t, localCloseTxHash, localObservedEvent.Tx.Hash.String())
+		assert.True(t, localObservedEvent.Successful)
+		assert.Equal(t, []string{"tx_success"}, localObservedEvent.ResultCodes)
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.Equal(t, localObservedEvent, remoteEvent)
+	}
 
 	// Expect closed event.
 	{
@@ -543,6 +665,67 @@ func TestAgent_openPaymentClose(t *testing.T) {
 		require.True(t, ok)
 		assert.Equal(t, remoteEvent, ClosedEvent{})
 	}
+
+	// Expect the metrics to have recorded the payments, submissions, and
+	// ingestion.
+	localMetrics.mu.Lock()
+	defer localMetrics.mu.Unlock()
+	assert.Equal(t, []int64{50_0000000}, localMetrics.paymentsSent)
+	assert.Equal(t, []int64{20_0000000, 20_0000000, 200_0000000}, localMetrics.paymentsReceived)
+	assert.Equal(t, []txbuild.TransactionType{txbuild.TransactionTypeOpen, txbuild.TransactionTypeDeclaration, txbuild.TransactionTypeClose}, localMetrics.txsSubmitted)
+	assert.Equal(t, 3, localMetrics.txsIngested)
+	assert.Equal(t, []state.State{state.StateOpen, state.StateClosing, state.StateClosed}, localMetrics.channelStates)
+
+	// Expect each payment to be traced across both agents, with the confirm
+	// span of the receiver a child of the payment span of the sender, and the
+	// finalize span ending within the payment span.
+	assertPaymentsTraced := func(sender, receiver *trace.Recorder, amounts []int64) {
+		payments := sender.SpansNamed("payment")
+		confirms := receiver.SpansNamed("payment.confirm")
+		finalizes := sender.SpansNamed("payment.finalize")
+		require.Len(t, payments, len(amounts))
+		require.Len(t, confirms, len(amounts))
+		require.Len(t, finalizes, len(amounts))
+		for i, amount := range amounts {
+			assert.Equal(t, amount, payments[i].Attributes["amount"])
+			assert.Empty(t, payments[i].Errors)
+			assert.Equal(t, payments[i].SpanContext, confirms[i].Parent)
+			assert.Equal(t, payments[i].SpanContext.TraceID, confirms[i].SpanContext.TraceID)
+			assert.Equal(t, payments[i].SpanContext, finalizes[i].Parent)
+			assert.False(t, finalizes[i].End.After(payments[i].End), "finalize span ended after its parent")
+		}
+	}
+	assertPaymentsTraced(localTracer, remoteTracer, []int64{50_0000000})
+	assertPaymentsTraced(remoteTracer, localTracer, []int64{20_0000000, 20_0000000, 200_0000000})
+
+	// Expect the submissions to be traced as part of the operations that
+	// submitted them, and the ingestion of the submitted txs as part of their
+	// submission.
+	submits := localTracer.SpansNamed("tx.submit")
+	require.Len(t, submits, 3)
+	assert.Equal(t, "open", submits[0].Attributes["tx_type"])
+	assert.Equal(t, "declaration", submits[1].Attributes["tx_type"])
+	assert.Equal(t, "close", submits[2].Attributes["tx_type"])
+	openFinalizes := localTracer.SpansNamed("open.finalize")
+	require.Len(t, openFinalizes, 1)
+	assert.Equal(t, openFinalizes[0].SpanContext, submits[0].Parent)
+	declares := localTracer.SpansNamed("close.declare")
+	require.Len(t, declares, 1)
+	assert.Equal(t, declares[0].SpanContext, submits[1].Parent)
+	closeFinalizes := localTracer.SpansNamed("close.finalize")
+	require.Len(t, closeFinalizes, 1)
+	assert.Equal(t, closeFinalizes[0].SpanContext, submits[2].Parent)
+	ingests := localTracer.SpansNamed("tx.ingest")
+	require.Len(t, ingests, 3)
+	for i := range ingests {
+		assert.Equal(t, submits[i].SpanContext, ingests[i].Parent)
+	}
+	assert.Equal(t, "closed", ingests[2].Attributes["state"])
+	remoteSubmits := remoteTracer.SpansNamed("tx.submit")
+	require.Len(t, remoteSubmits, 1)
+	remoteCloseConfirms := remoteTracer.SpansNamed("close.confirm")
+	require.Len(t, remoteCloseConfirms, 1)
+	assert.Equal(t, remoteCloseConfirms[0].SpanContext, remoteSubmits[0].Parent)
 }
 
 func TestAgent_concurrency(t *testing.T) {
@@ -725,3 +908,93 @@ func TestAgent_concurrency(t *testing.T) {
 	<-localPaymentConfirmedOrError
 	<-remotePaymentConfirmedOrError
 }
+
+func TestAgent_submitTx_submitsInOrderWithoutHoldingTheLock(t *testing.T) {
+	newTx := func(seq int64) *txnbuild.Transaction {
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount: &txnbuild.SimpleAccount{AccountID: keypair.MustRandom().Address(), Sequence: seq},
+			BaseFee:       txnbuild.MinBaseFee,
+			Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+			Operations:    []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: seq + 1}},
+		})
+		require.NoError(t, err)
+		return tx
+	}
+	declTx := newTx(1)
+	closeTx := newTx(2)
+
+	// The submitter blocks until released, and takes a snapshot of the agent,
+	// which locks the agent, and so would deadlock if the agent remained
+	// locked while submitting.
+	var agent *Agent
+	release := make(chan struct{})
+	submittedTxs := make(chan *txnbuild.Transaction, 2)
+	agent = &Agent{
+		networkPassphrase: network.TestNetworkPassphrase,
+		submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			<-release
+			agent.Snapshot()
+			submittedTxs <- tx
+			return nil
+		}),
+		logWriter: io.Discard,
+	}
+
+	// Expect queuing to return while the submitter is blocked.
+	done := make(chan error, 2)
+	agent.mu.Lock()
+	agent.submitTx(trace.SpanContext{}, txbuild.TransactionTypeDeclaration, declTx, func(err error) { done <- err })
+	agent.submitTx(trace.SpanContext{}, txbuild.TransactionTypeClose, closeTx, func(err error) { done <- err })
+	agent.mu.Unlock()
+
+	// Expect the txs to be submitted in the order queued.
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("submission did not complete")
+		}
+	}
+	assert.Equal(t, declTx, <-submittedTxs)
+	assert.Equal(t, closeTx, <-submittedTxs)
+}
+
+type typedSubmitterFunc func(txType txbuild.TransactionType, tx *txnbuild.Transaction) error
+
+func (f typedSubmitterFunc) SubmitTx(tx *txnbuild.Transaction) error {
+	panic("SubmitTx called on a TypedSubmitter")
+}
+
+func (f typedSubmitterFunc) SubmitTypedTx(txType txbuild.TransactionType, tx *txnbuild.Transaction) error {
+	return f(txType, tx)
+}
+
+func TestAgent_submitTx_typedSubmitter(t *testing.T) {
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{AccountID: keypair.MustRandom().Address(), Sequence: 1},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations:    []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: 2}},
+	})
+	require.NoError(t, err)
+
+	submittedTypes := make(chan txbuild.TransactionType, 1)
+	agent := &Agent{
+		networkPassphrase: network.TestNetworkPassphrase,
+		submitter: typedSubmitterFunc(func(txType txbuild.TransactionType, tx *txnbuild.Transaction) error {
+			submittedTypes <- txType
+			return nil
+		}),
+		logWriter: io.Discard,
+	}
+
+	// Expect a TypedSubmitter to be told the type of the tx.
+	done := make(chan error, 1)
+	agent.mu.Lock()
+	agent.submitTx(trace.SpanContext{}, txbuild.TransactionTypeClose, tx, func(err error) { done <- err })
+	agent.mu.Unlock()
+	require.NoError(t, <-done)
+	assert.Equal(t, txbuild.TransactionTypeClose, <-submittedTypes)
+}
@@ -1,5 +1,7 @@
 // Package agenthttp contains a simple HTTP handler that, when requested, will
-// return a snapshot of an agent's snapshot at that moment.
+// return a snapshot of an agent's snapshot at that moment, a handler that
+// serves an API for controlling an agent, a handler that streams an agent's
+// events, and a handler that exports an agent's metrics to Prometheus.
 package agenthttp
 
 import (
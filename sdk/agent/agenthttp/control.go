@@ -0,0 +1,326 @@
+package agenthttp
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Agent is the agent controlled by a control API handler. It is implemented
+// by *agent.Agent.
+type Agent interface {
+	Open(asset state.Asset) error
+	PaymentWithMemo(paymentAmount int64, memo []byte) error
+	DeclareClose() error
+	Close() error
+	Status() (agent.Status, error)
+	Snapshot() agent.Snapshot
+}
+
+var _ Agent = &agent.Agent{}
+
+// Depositor deposits an amount of the channel's asset into the local channel
+// account.
+type Depositor interface {
+	Deposit(amount int64) error
+}
+
+// ControlConfig contains the information for setting up a control API
+// handler.
+type ControlConfig struct {
+	Agent Agent
+
+	// BearerToken is the token that requests must include in their
+	// Authorization header. If empty, requests are not authenticated, which
+	// should only be used when the handler is not reachable by others.
+	BearerToken string
+
+	// Depositor, if set, handles deposits. If not set, deposit requests are
+	// responded to with status Not Implemented.
+	Depositor Depositor
+
+	// Events, if set, is served at /events for streaming the agent's events.
+	// If not set, event stream requests are responded to with status Not
+	// Implemented.
+	Events *EventStream
+}
+
+// NewControl creates a new http.Handler that serves an API for controlling the
+// agent, opening, paying, and closing its channel, and for reading the state
+// of its channel. The API is described by the OpenAPI document served at
+// /openapi.json.
+func NewControl(c ControlConfig) http.Handler {
+	h := controlHandler{ControlConfig: c}
+	m := http.NewServeMux()
+	m.HandleFunc("/openapi.json", h.handleOpenAPI)
+	m.Handle("/open", h.authenticated(http.MethodPost, h.handleOpen))
+	m.Handle("/pay", h.authenticated(http.MethodPost, h.handlePay))
+	m.Handle("/declare-close", h.authenticated(http.MethodPost, h.handleDeclareClose))
+	m.Handle("/close", h.authenticated(http.MethodPost, h.handleClose))
+	m.Handle("/deposit", h.authenticated(http.MethodPost, h.handleDeposit))
+	m.Handle("/state", h.authenticated(http.MethodGet, h.handleState))
+	m.Handle("/agreements", h.authenticated(http.MethodGet, h.handleAgreements))
+	m.Handle("/capacity", h.authenticated(http.MethodGet, h.handleCapacity))
+	m.Handle("/snapshot", h.authenticated(http.MethodGet, h.handleSnapshot))
+	m.Handle("/events", h.authenticated(http.MethodGet, h.handleEvents))
+	return m
+}
+
+type controlHandler struct {
+	ControlConfig
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// authenticated wraps the handler so that it is only called for requests with
+// the method and the bearer token.
+func (h controlHandler) authenticated(method string, f http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.BearerToken != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(h.BearerToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid bearer token"))
+				return
+			}
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		f(w, r)
+	})
+}
+
+// decodeRequest decodes the JSON request body into v, responding with an
+// error and returning false if it cannot be decoded.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decoding request: %w", err))
+		return false
+	}
+	return true
+}
+
+// writeResult responds with the error if the agent returned one, otherwise
+// with the status of the agent's channel.
+func (h controlHandler) writeResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	h.handleState(w, nil)
+}
+
+func (h controlHandler) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPI)
+}
+
+type openRequest struct {
+	Asset state.Asset `json:"asset"`
+}
+
+func (h controlHandler) handleOpen(w http.ResponseWriter, r *http.Request) {
+	req := openRequest{}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	h.writeResult(w, h.Agent.Open(req.Asset))
+}
+
+type payRequest struct {
+	Amount int64  `json:"amount"`
+	Memo   []byte `json:"memo,omitempty"`
+}
+
+func (h controlHandler) handlePay(w http.ResponseWriter, r *http.Request) {
+	req := payRequest{}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("amount must be positive"))
+		return
+	}
+	h.writeResult(w, h.Agent.PaymentWithMemo(req.Amount, req.Memo))
+}
+
+func (h controlHandler) handleDeclareClose(w http.ResponseWriter, r *http.Request) {
+	h.writeResult(w, h.Agent.DeclareClose())
+}
+
+func (h controlHandler) handleClose(w http.ResponseWriter, r *http.Request) {
+	h.writeResult(w, h.Agent.Close())
+}
+
+type depositRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+func (h controlHandler) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	if h.Depositor == nil {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("deposits not supported"))
+		return
+	}
+	req := depositRequest{}
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("amount must be positive"))
+		return
+	}
+	h.writeResult(w, h.Depositor.Deposit(req.Amount))
+}
+
+func (h controlHandler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if h.Events == nil {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("event streaming not supported"))
+		return
+	}
+	h.Events.ServeHTTP(w, r)
+}
+
+type channelAccountResponse struct {
+	Address        string `json:"address,omitempty"`
+	SequenceNumber int64  `json:"sequence_number"`
+	Balance        int64  `json:"balance"`
+}
+
+func newChannelAccountResponse(ca state.ChannelAccount) channelAccountResponse {
+	r := channelAccountResponse{
+		SequenceNumber: ca.SequenceNumber,
+		Balance:        ca.Balance,
+	}
+	if ca.Address != nil {
+		r.Address = ca.Address.Address()
+	}
+	return r
+}
+
+type stateResponse struct {
+	State                string                 `json:"state"`
+	Initiator            bool                   `json:"initiator"`
+	Asset                state.Asset            `json:"asset"`
+	Balance              int64                  `json:"balance"`
+	IterationNumber      int64                  `json:"iteration_number"`
+	LocalChannelAccount  channelAccountResponse `json:"local_channel_account"`
+	RemoteChannelAccount channelAccountResponse `json:"remote_channel_account"`
+}
+
+func (h controlHandler) handleState(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Agent.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stateResponse{
+		State:                s.State.String(),
+		Initiator:            s.Initiator,
+		Asset:                s.Asset,
+		Balance:              s.Balance,
+		IterationNumber:      s.IterationNumber,
+		LocalChannelAccount:  newChannelAccountResponse(s.LocalChannelAccount),
+		RemoteChannelAccount: newChannelAccountResponse(s.RemoteChannelAccount),
+	})
+}
+
+type agreementResponse struct {
+	IterationNumber  int64  `json:"iteration_number"`
+	Balance          int64  `json:"balance"`
+	PaymentAmount    int64  `json:"payment_amount"`
+	Memo             []byte `json:"memo,omitempty"`
+	ProposingSigner  string `json:"proposing_signer,omitempty"`
+	ConfirmingSigner string `json:"confirming_signer,omitempty"`
+}
+
+func newAgreementResponse(ca state.CloseAgreement) agreementResponse {
+	d := ca.Envelope.Details
+	r := agreementResponse{
+		IterationNumber: d.IterationNumber,
+		Balance:         d.Balance,
+		PaymentAmount:   d.PaymentAmount,
+		Memo:            d.Memo,
+	}
+	if d.ProposingSigner != nil {
+		r.ProposingSigner = d.ProposingSigner.Address()
+	}
+	if d.ConfirmingSigner != nil {
+		r.ConfirmingSigner = d.ConfirmingSigner.Address()
+	}
+	return r
+}
+
+type agreementsResponse struct {
+	Latest       *agreementResponse `json:"latest"`
+	Unauthorized *agreementResponse `json:"unauthorized"`
+}
+
+func (h controlHandler) handleAgreements(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Agent.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := agreementsResponse{}
+	if !s.LatestCloseAgreement.Envelope.Empty() {
+		latest := newAgreementResponse(s.LatestCloseAgreement)
+		resp.Latest = &latest
+	}
+	if s.UnauthorizedCloseAgreement != nil {
+		unauthorized := newAgreementResponse(*s.UnauthorizedCloseAgreement)
+		resp.Unauthorized = &unauthorized
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type capacityResponse struct {
+	Asset   state.Asset `json:"asset"`
+	Send    int64       `json:"send"`
+	Receive int64       `json:"receive"`
+}
+
+func (h controlHandler) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Agent.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, capacityResponse{
+		Asset:   s.Asset,
+		Send:    s.SendCapacity,
+		Receive: s.ReceiveCapacity,
+	})
+}
+
+func (h controlHandler) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.Agent.Snapshot())
+}
@@ -0,0 +1,209 @@
+package agenthttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAgent struct {
+	calls  []string
+	err    error
+	status agent.Status
+}
+
+func (a *fakeAgent) Open(asset state.Asset) error {
+	a.calls = append(a.calls, "open "+string(asset))
+	return a.err
+}
+
+func (a *fakeAgent) PaymentWithMemo(paymentAmount int64, memo []byte) error {
+	a.calls = append(a.calls, "pay "+string(memo))
+	a.status.Balance += paymentAmount
+	return a.err
+}
+
+func (a *fakeAgent) DeclareClose() error {
+	a.calls = append(a.calls, "declare-close")
+	return a.err
+}
+
+func (a *fakeAgent) Close() error {
+	a.calls = append(a.calls, "close")
+	return a.err
+}
+
+func (a *fakeAgent) Status() (agent.Status, error) {
+	return a.status, nil
+}
+
+func (a *fakeAgent) Snapshot() agent.Snapshot {
+	return agent.Snapshot{StreamerCursor: "123"}
+}
+
+type depositorFunc func(amount int64) error
+
+func (f depositorFunc) Deposit(amount int64) error {
+	return f(amount)
+}
+
+func serve(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestControl_auth(t *testing.T) {
+	a := &fakeAgent{}
+	h := NewControl(ControlConfig{Agent: a, BearerToken: "secret"})
+
+	w := serve(h, http.MethodGet, "/state", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "invalid bearer token"}`, w.Body.String())
+
+	w = serve(h, http.MethodPost, "/close", "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, a.calls)
+
+	w = serve(h, http.MethodGet, "/state", "secret", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(h, http.MethodGet, "/close", "secret", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Empty(t, a.calls)
+
+	// The OpenAPI document is served without authentication.
+	w = serve(h, http.MethodGet, "/openapi.json", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	doc := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestControl_actions(t *testing.T) {
+	a := &fakeAgent{status: agent.Status{State: state.StateOpen}}
+	var deposited int64
+	h := NewControl(ControlConfig{
+		Agent: a,
+		Depositor: depositorFunc(func(amount int64) error {
+			deposited += amount
+			return nil
+		}),
+	})
+
+	w := serve(h, http.MethodPost, "/open", "", `{"asset": "native"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(h, http.MethodPost, "/pay", "", `{"amount": 100, "memo": "bWVtbw=="}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "open", jsonField(t, w, "state"))
+	assert.Equal(t, float64(100), jsonField(t, w, "balance"))
+	w = serve(h, http.MethodPost, "/declare-close", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(h, http.MethodPost, "/close", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve(h, http.MethodPost, "/deposit", "", `{"amount": 50}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, []string{"open native", "pay memo", "declare-close", "close"}, a.calls)
+	assert.Equal(t, int64(50), deposited)
+
+	// Invalid requests.
+	w = serve(h, http.MethodPost, "/pay", "", `{"amount": 0}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "amount must be positive"}`, w.Body.String())
+	w = serve(h, http.MethodPost, "/pay", "", `{"amount": 1, "other": 1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(h, http.MethodPost, "/open", "", `not json`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, a.calls, 4)
+
+	// Errors from the agent.
+	a.err = errors.New("not connected")
+	w = serve(h, http.MethodPost, "/close", "", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "not connected"}`, w.Body.String())
+}
+
+func TestControl_depositNotSupported(t *testing.T) {
+	h := NewControl(ControlConfig{Agent: &fakeAgent{}})
+	w := serve(h, http.MethodPost, "/deposit", "", `{"amount": 50}`)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestControl_reads(t *testing.T) {
+	localSigner := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	remoteSigner := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+	localChannelAccount := keypair.MustParseAddress("GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	a := &fakeAgent{status: agent.Status{
+		State:                state.StateOpen,
+		Initiator:            true,
+		Asset:                state.NativeAsset,
+		Balance:              100,
+		IterationNumber:      2,
+		LocalChannelAccount:  state.ChannelAccount{Address: localChannelAccount, SequenceNumber: 101, Balance: 1000},
+		RemoteChannelAccount: state.ChannelAccount{Balance: 2000},
+		SendCapacity:         900,
+		ReceiveCapacity:      2100,
+		LatestCloseAgreement: state.CloseAgreement{Envelope: state.CloseEnvelope{Details: state.CloseDetails{
+			IterationNumber:  2,
+			Balance:          100,
+			PaymentAmount:    100,
+			ProposingSigner:  localSigner,
+			ConfirmingSigner: remoteSigner,
+		}}},
+	}}
+	h := NewControl(ControlConfig{Agent: a})
+
+	w := serve(h, http.MethodGet, "/state", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"state": "open",
+		"initiator": true,
+		"asset": "native",
+		"balance": 100,
+		"iteration_number": 2,
+		"local_channel_account": {"address": "GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3", "sequence_number": 101, "balance": 1000},
+		"remote_channel_account": {"sequence_number": 0, "balance": 2000}
+	}`, w.Body.String())
+
+	w = serve(h, http.MethodGet, "/agreements", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"latest": {
+			"iteration_number": 2,
+			"balance": 100,
+			"payment_amount": 100,
+			"proposing_signer": "GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36",
+			"confirming_signer": "GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO"
+		},
+		"unauthorized": null
+	}`, w.Body.String())
+
+	w = serve(h, http.MethodGet, "/capacity", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"asset": "native", "send": 900, "receive": 2100}`, w.Body.String())
+
+	w = serve(h, http.MethodGet, "/snapshot", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "123", jsonField(t, w, "StreamerCursor"))
+}
+
+// jsonField returns the value of the field in the JSON response body.
+func jsonField(t *testing.T, w *httptest.ResponseRecorder, field string) interface{} {
+	v := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v))
+	return v[field]
+}
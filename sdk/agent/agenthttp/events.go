@@ -0,0 +1,256 @@
+package agenthttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/stellar/starlight/sdk/agent"
+)
+
+// eventStreamKeepAlive is the interval at which a comment is written to idle
+// event streams so that proxies do not close them.
+const eventStreamKeepAlive = 15 * time.Second
+
+// EventTypeMissed is the type of the event written to a stream in place of
+// events that are no longer buffered, such as when a client resumes from an
+// event that has been discarded or from before the stream was restarted.
+// Clients receiving it should refresh their view of the agent, such as from a
+// snapshot, as events have been missed.
+const EventTypeMissed = "missed"
+
+// Event is an event written to an event stream.
+type Event struct {
+	// ID identifies the event. IDs increase by one for each event published.
+	ID uint64 `json:"id"`
+
+	// Type is the snake case name of the event's Go type without its Event
+	// suffix, e.g. payment_sent for agent.PaymentSentEvent.
+	Type string `json:"type"`
+
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// EventStream is an http.Handler that streams events published to it as
+// Server-Sent Events. Each event is written as a message containing the JSON
+// encoding of an Event.
+//
+// The most recent events are buffered so that clients that reconnect with the
+// Last-Event-ID header, or a last_event_id query parameter, receive the events
+// they missed. Clients that connect without either only receive events
+// published after they connect.
+//
+// Publishing never blocks on clients. A client that falls further behind than
+// the buffer receives an event of type EventTypeMissed before continuing with
+// the oldest buffered event.
+type EventStream struct {
+	bufferSize int
+
+	mu          sync.Mutex
+	lastID      uint64
+	buffer      []Event
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewEventStream creates an EventStream that buffers the given number of the
+// most recent events for clients resuming a stream.
+func NewEventStream(bufferSize int) *EventStream {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &EventStream{
+		bufferSize:  bufferSize,
+		subscribers: map[chan struct{}]struct{}{},
+	}
+}
+
+// Publish publishes the event to all clients streaming events. Events are any
+// of the events emitted by an agent or buffered agent.
+func (s *EventStream) Publish(e interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	s.buffer = append(s.buffer, Event{
+		ID:   s.lastID,
+		Type: eventType(e),
+		Time: time.Now().UTC(),
+		Data: eventData(e),
+	})
+	if len(s.buffer) > s.bufferSize {
+		s.buffer = append(s.buffer[:0:0], s.buffer[len(s.buffer)-s.bufferSize:]...)
+	}
+
+	for notify := range s.subscribers {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// eventsAfter returns the buffered events published after the event with the
+// ID, whether any events after that ID are no longer buffered, and the ID of
+// the latest event. An ID after the latest event, such as from before the
+// stream was restarted, is treated as missing all events.
+func (s *EventStream) eventsAfter(id uint64) (events []Event, missed bool, latestID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id > s.lastID {
+		return nil, true, s.lastID
+	}
+	if id == s.lastID {
+		return nil, false, s.lastID
+	}
+	oldestID := s.lastID - uint64(len(s.buffer)) + 1
+	if id+1 < oldestID {
+		return append([]Event(nil), s.buffer...), true, s.lastID
+	}
+	return append([]Event(nil), s.buffer[id+1-oldestID:]...), false, s.lastID
+}
+
+func (s *EventStream) subscribe() (lastID uint64, notify chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notify = make(chan struct{}, 1)
+	s.subscribers[notify] = struct{}{}
+	return s.lastID, notify
+}
+
+func (s *EventStream) unsubscribe(notify chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, notify)
+}
+
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	lastID, notify := s.subscribe()
+	defer s.unsubscribe(notify)
+
+	resumeID := r.Header.Get("Last-Event-ID")
+	if resumeID == "" {
+		resumeID = r.URL.Query().Get("last_event_id")
+	}
+	if resumeID != "" {
+		id, err := strconv.ParseUint(resumeID, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("parsing last event id: %w", err))
+			return
+		}
+		lastID = id
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		events, missed, latestID := s.eventsAfter(lastID)
+		if missed {
+			// The missed event takes the ID of the event before the events
+			// that follow it, so that a client resuming from it receives them.
+			missedID := latestID
+			if len(events) > 0 {
+				missedID = events[0].ID - 1
+			}
+			err := writeEvent(w, Event{ID: missedID, Type: EventTypeMissed, Time: time.Now().UTC()})
+			if err != nil {
+				return
+			}
+		}
+		for _, e := range events {
+			err := writeEvent(w, e)
+			if err != nil {
+				return
+			}
+		}
+		lastID = latestID
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-notify:
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.ID, data)
+	if err != nil {
+		return fmt.Errorf("writing event: %w", err)
+	}
+	return nil
+}
+
+// eventType returns the snake case name of the event's type without its Event
+// suffix.
+func eventType(e interface{}) string {
+	t := reflect.TypeOf(e)
+	if t == nil {
+		return ""
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := strings.TrimSuffix(t.Name(), "Event")
+	b := strings.Builder{}
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// eventData returns a value for the event that encodes to JSON with all of the
+// event's information, since errors do not encode their message.
+func eventData(e interface{}) interface{} {
+	switch e := e.(type) {
+	case agent.ErrorEvent:
+		errorEvent := struct{ Err string }{}
+		if e.Err != nil {
+			errorEvent.Err = e.Err.Error()
+		}
+		return errorEvent
+	default:
+		return e
+	}
+}
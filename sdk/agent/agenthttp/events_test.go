@@ -0,0 +1,152 @@
+package agenthttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/agent/bufferedagent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamEvents connects to the event stream and returns a function that reads
+// the next event from it.
+func streamEvents(t *testing.T, url string, header http.Header) func() Event {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	return func() Event {
+		e := Event{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			if data := strings.TrimPrefix(line, "data: "); data != line {
+				require.NoError(t, json.Unmarshal([]byte(data), &e))
+			} else if line == "" && e.Type != "" {
+				return e
+			}
+		}
+		require.NoError(t, scanner.Err())
+		require.Fail(t, "stream ended")
+		return e
+	}
+}
+
+func TestEventStream_live(t *testing.T) {
+	s := NewEventStream(10)
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	// Events published before connecting are not received.
+	s.Publish(agent.ClosingEvent{})
+
+	next := streamEvents(t, server.URL, nil)
+	s.Publish(agent.ConnectedEvent{})
+	s.Publish(agent.ErrorEvent{Err: errors.New("oops")})
+	s.Publish(bufferedagent.BufferedPaymentsSentEvent{BufferID: "1"})
+
+	e := next()
+	assert.Equal(t, uint64(2), e.ID)
+	assert.Equal(t, "connected", e.Type)
+	assert.False(t, e.Time.IsZero())
+
+	e = next()
+	assert.Equal(t, uint64(3), e.ID)
+	assert.Equal(t, "error", e.Type)
+	assert.Equal(t, map[string]interface{}{"Err": "oops"}, e.Data)
+
+	e = next()
+	assert.Equal(t, uint64(4), e.ID)
+	assert.Equal(t, "buffered_payments_sent", e.Type)
+	assert.Equal(t, "1", e.Data.(map[string]interface{})["BufferID"])
+}
+
+func TestEventStream_resume(t *testing.T) {
+	s := NewEventStream(2)
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	s.Publish(agent.OpenedEvent{})
+	s.Publish(agent.PaymentSentEvent{})
+	s.Publish(agent.PaymentReceivedEvent{})
+
+	// Resuming from a buffered event receives the events after it.
+	next := streamEvents(t, server.URL, http.Header{"Last-Event-ID": {"2"}})
+	e := next()
+	assert.Equal(t, uint64(3), e.ID)
+	assert.Equal(t, "payment_received", e.Type)
+
+	// Resuming from an event no longer buffered receives a missed event
+	// followed by the buffered events.
+	next = streamEvents(t, server.URL+"?last_event_id=0", nil)
+	e = next()
+	assert.Equal(t, uint64(1), e.ID)
+	assert.Equal(t, EventTypeMissed, e.Type)
+	e = next()
+	assert.Equal(t, uint64(2), e.ID)
+	assert.Equal(t, "payment_sent", e.Type)
+	e = next()
+	assert.Equal(t, uint64(3), e.ID)
+
+	// Resuming from an event not yet published, such as from before the
+	// stream was restarted, receives a missed event and then new events.
+	next = streamEvents(t, server.URL, http.Header{"Last-Event-ID": {"10"}})
+	e = next()
+	assert.Equal(t, uint64(3), e.ID)
+	assert.Equal(t, EventTypeMissed, e.Type)
+	s.Publish(agent.ClosedEvent{})
+	e = next()
+	assert.Equal(t, uint64(4), e.ID)
+	assert.Equal(t, "closed", e.Type)
+}
+
+func TestEventStream_invalidRequests(t *testing.T) {
+	s := NewEventStream(2)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Last-Event-ID", "abc")
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "parsing last event id")
+}
+
+func TestControl_events(t *testing.T) {
+	h := NewControl(ControlConfig{Agent: &fakeAgent{}, BearerToken: "secret"})
+	w := serve(h, http.MethodGet, "/events", "secret", "")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+
+	s := NewEventStream(2)
+	h = NewControl(ControlConfig{Agent: &fakeAgent{}, BearerToken: "secret", Events: s})
+	w = serve(h, http.MethodGet, "/events", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	next := streamEvents(t, server.URL+"/events", http.Header{"Authorization": {"Bearer secret"}})
+	s.Publish(agent.ChannelCompromisedEvent{})
+	e := next()
+	assert.Equal(t, uint64(1), e.ID)
+	assert.Equal(t, "channel_compromised", e.Type)
+}
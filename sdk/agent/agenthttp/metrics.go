@@ -0,0 +1,249 @@
+package agenthttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/agent/bufferedagent"
+	"github.com/stellar/starlight/sdk/agent/submit"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
+)
+
+var (
+	paymentLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	flushPaymentsBuckets  = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+	flushByteSizeBuckets  = []float64{64, 256, 1024, 4096, 16384, 65536}
+)
+
+// channelStates are the states reported by the channel state gauge.
+var channelStates = []state.State{
+	state.StateError,
+	state.StateNone,
+	state.StateOpen,
+	state.StateClosingWithOutdatedState,
+	state.StateClosedWithOutdatedState,
+	state.StateClosing,
+	state.StateClosed,
+}
+
+// PrometheusMetrics records the measurements of an agent and buffered agent,
+// and is an http.Handler that exports them in the Prometheus text exposition
+// format. Set it as the Metrics of the agent's and buffered agent's configs
+// to record their measurements.
+type PrometheusMetrics struct {
+	mu sync.Mutex
+
+	paymentsSent           uint64
+	paymentsSentAmount     int64
+	paymentsReceived       uint64
+	paymentsReceivedAmount int64
+	paymentLatency         histogram
+
+	bufferDepth         int
+	bufferFlushPayments histogram
+	bufferFlushByteSize histogram
+
+	txsIngested  uint64
+	ingestionLag time.Duration
+
+	txsSubmitted map[submission]uint64
+
+	channelState    state.State
+	channelStateSet bool
+}
+
+var (
+	_ agent.Metrics         = &PrometheusMetrics{}
+	_ bufferedagent.Metrics = &PrometheusMetrics{}
+)
+
+type submission struct {
+	txType  txbuild.TransactionType
+	outcome string
+}
+
+// NewPrometheusMetrics creates a new PrometheusMetrics with no measurements.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		paymentLatency:      newHistogram(paymentLatencyBuckets),
+		bufferFlushPayments: newHistogram(flushPaymentsBuckets),
+		bufferFlushByteSize: newHistogram(flushByteSizeBuckets),
+		txsSubmitted:        map[submission]uint64{},
+	}
+}
+
+// PaymentSent implements agent.Metrics.
+func (m *PrometheusMetrics) PaymentSent(amount int64, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paymentsSent++
+	m.paymentsSentAmount += amount
+	m.paymentLatency.observe(latency.Seconds())
+}
+
+// PaymentReceived implements agent.Metrics.
+func (m *PrometheusMetrics) PaymentReceived(amount int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paymentsReceived++
+	m.paymentsReceivedAmount += amount
+}
+
+// TxIngested implements agent.Metrics.
+func (m *PrometheusMetrics) TxIngested(lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txsIngested++
+	m.ingestionLag = lag
+}
+
+// TxSubmitted implements agent.Metrics. Submissions are counted by the type of
+// transaction and by the outcome, which is success or the kind of error as
+// classified by submit.Classify.
+func (m *PrometheusMetrics) TxSubmitted(txType txbuild.TransactionType, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = submit.Classify(err).String()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txsSubmitted[submission{txType: txType, outcome: outcome}]++
+}
+
+// ChannelState implements agent.Metrics.
+func (m *PrometheusMetrics) ChannelState(s state.State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.channelState = s
+	m.channelStateSet = true
+}
+
+// BufferDepth implements bufferedagent.Metrics.
+func (m *PrometheusMetrics) BufferDepth(payments int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bufferDepth = payments
+}
+
+// BufferFlushed implements bufferedagent.Metrics.
+func (m *PrometheusMetrics) BufferFlushed(payments int, byteSize int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bufferFlushPayments.observe(float64(payments))
+	m.bufferFlushByteSize.observe(float64(byteSize))
+}
+
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.write(w)
+}
+
+// write writes the measurements in the Prometheus text exposition format.
+func (m *PrometheusMetrics) write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := &strings.Builder{}
+
+	writeHeader(b, "starlight_payments_sent_total", "counter", "Payments proposed by the agent and finalized.")
+	writeSample(b, "starlight_payments_sent_total", "", float64(m.paymentsSent))
+	writeHeader(b, "starlight_payments_sent_amount_total", "counter", "Amount of payments sent, in stroops of the channel's asset.")
+	writeSample(b, "starlight_payments_sent_amount_total", "", float64(m.paymentsSentAmount))
+	writeHeader(b, "starlight_payments_received_total", "counter", "Payments proposed by the other participant and confirmed.")
+	writeSample(b, "starlight_payments_received_total", "", float64(m.paymentsReceived))
+	writeHeader(b, "starlight_payments_received_amount_total", "counter", "Amount of payments received, in stroops of the channel's asset.")
+	writeSample(b, "starlight_payments_received_amount_total", "", float64(m.paymentsReceivedAmount))
+	writeHeader(b, "starlight_payment_latency_seconds", "histogram", "Time from proposing a payment to it being finalized.")
+	m.paymentLatency.write(b, "starlight_payment_latency_seconds")
+
+	writeHeader(b, "starlight_buffer_depth", "gauge", "Payments buffered by the buffered agent waiting to be flushed.")
+	writeSample(b, "starlight_buffer_depth", "", float64(m.bufferDepth))
+	writeHeader(b, "starlight_buffer_flush_payments", "histogram", "Payments in each buffer flushed as a single payment.")
+	m.bufferFlushPayments.write(b, "starlight_buffer_flush_payments")
+	writeHeader(b, "starlight_buffer_flush_bytes", "histogram", "Size of each buffer flushed as a single payment's memo.")
+	m.bufferFlushByteSize.write(b, "starlight_buffer_flush_bytes")
+
+	writeHeader(b, "starlight_transactions_ingested_total", "counter", "Transactions of the channel accounts ingested.")
+	writeSample(b, "starlight_transactions_ingested_total", "", float64(m.txsIngested))
+	writeHeader(b, "starlight_ingestion_lag_seconds", "gauge", "Time between the ledger of the last ingested transaction closing and it being ingested.")
+	writeSample(b, "starlight_ingestion_lag_seconds", "", m.ingestionLag.Seconds())
+
+	writeHeader(b, "starlight_transactions_submitted_total", "counter", "Channel transactions submitted, by type and outcome.")
+	submissions := make([]submission, 0, len(m.txsSubmitted))
+	for s := range m.txsSubmitted {
+		submissions = append(submissions, s)
+	}
+	sort.Slice(submissions, func(i, j int) bool {
+		if submissions[i].txType != submissions[j].txType {
+			return submissions[i].txType < submissions[j].txType
+		}
+		return submissions[i].outcome < submissions[j].outcome
+	})
+	for _, s := range submissions {
+		labels := fmt.Sprintf(`type=%q,outcome=%q`, s.txType, s.outcome)
+		writeSample(b, "starlight_transactions_submitted_total", labels, float64(m.txsSubmitted[s]))
+	}
+
+	writeHeader(b, "starlight_channel_state", "gauge", "State of the channel, 1 for the current state and 0 for others.")
+	for _, s := range channelStates {
+		value := 0.0
+		if m.channelStateSet && s == m.channelState {
+			value = 1
+		}
+		writeSample(b, "starlight_channel_state", fmt.Sprintf(`state=%q`, s.String()), value)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHeader(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(b *strings.Builder, name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(b, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// histogram counts observations in cumulative buckets with the given upper
+// bounds.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(b *strings.Builder, name string) {
+	for i, bound := range h.bounds {
+		writeSample(b, name+"_bucket", fmt.Sprintf(`le="%s"`, strconv.FormatFloat(bound, 'g', -1, 64)), float64(h.counts[i]))
+	}
+	writeSample(b, name+"_bucket", `le="+Inf"`, float64(h.count))
+	writeSample(b, name+"_sum", "", h.sum)
+	writeSample(b, name+"_count", "", float64(h.count))
+}
@@ -0,0 +1,63 @@
+package agenthttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+
+	m.PaymentSent(100, 20*time.Millisecond)
+	m.PaymentSent(50, 2*time.Second)
+	m.PaymentReceived(30)
+	m.BufferDepth(3)
+	m.BufferFlushed(3, 100)
+	m.BufferDepth(0)
+	m.TxIngested(1500 * time.Millisecond)
+	m.TxSubmitted(txbuild.TransactionTypeOpen, nil)
+	m.TxSubmitted(txbuild.TransactionTypeClose, errors.New("connection refused"))
+	m.TxSubmitted(txbuild.TransactionTypeClose, errors.New("connection refused"))
+	m.ChannelState(state.StateOpen)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE starlight_payments_sent_total counter",
+		"starlight_payments_sent_total 2",
+		"starlight_payments_sent_amount_total 150",
+		"starlight_payments_received_total 1",
+		"starlight_payments_received_amount_total 30",
+		"# TYPE starlight_payment_latency_seconds histogram",
+		`starlight_payment_latency_seconds_bucket{le="0.01"} 0`,
+		`starlight_payment_latency_seconds_bucket{le="0.025"} 1`,
+		`starlight_payment_latency_seconds_bucket{le="2.5"} 2`,
+		`starlight_payment_latency_seconds_bucket{le="+Inf"} 2`,
+		"starlight_payment_latency_seconds_sum 2.02",
+		"starlight_payment_latency_seconds_count 2",
+		"starlight_buffer_depth 0",
+		`starlight_buffer_flush_payments_bucket{le="2"} 0`,
+		`starlight_buffer_flush_payments_bucket{le="5"} 1`,
+		`starlight_buffer_flush_bytes_bucket{le="256"} 1`,
+		"starlight_buffer_flush_bytes_sum 100",
+		"starlight_transactions_ingested_total 1",
+		"starlight_ingestion_lag_seconds 1.5",
+		`starlight_transactions_submitted_total{type="close",outcome="unknown"} 2`,
+		`starlight_transactions_submitted_total{type="open",outcome="success"} 1`,
+		`starlight_channel_state{state="none"} 0`,
+		`starlight_channel_state{state="open"} 1`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+}
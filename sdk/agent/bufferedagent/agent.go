@@ -9,10 +9,10 @@ package bufferedagent
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stellar/starlight/sdk/agent"
@@ -23,6 +23,47 @@ import (
 // as configured when the buffered agent was created.
 var ErrBufferFull = errors.New("buffer full")
 
+// ErrPaymentTooLarge indicates that a payment exceeds the maximum amount or
+// memo byte size of an agreement in the flush policy, and so could never be
+// sent even in an agreement of its own.
+var ErrPaymentTooLarge = errors.New("payment too large")
+
+// FlushPolicy controls when buffered payments are flushed into an agreement,
+// trading off the latency of payments against the number of agreements needed
+// to make them. The zero value flushes buffered payments as soon as the
+// previous agreement completes, with no limit on the size of an agreement.
+type FlushPolicy struct {
+	// MaxLinger, if set, is the longest time a payment waits in the buffer for
+	// other payments to join it in an agreement. The buffer is flushed sooner
+	// if it is full. If not set, the buffer is flushed as soon as the previous
+	// agreement completes.
+	MaxLinger time.Duration
+
+	// MaxMemoByteSize, if set, is the maximum byte size of the memo of an
+	// agreement. Payments that would take the memo over the maximum are
+	// buffered for the next agreement. The size of the memo is estimated
+	// before it is encoded, and the estimate is never less than the encoded
+	// size, so that memos stay within the size the other participant accepts.
+	MaxMemoByteSize int
+
+	// MaxAmount, if set, is the maximum total amount of the payments in an
+	// agreement. Payments that would take the total over the maximum are
+	// buffered for the next agreement.
+	MaxAmount int64
+}
+
+// Metrics records measurements of the buffered agent's buffer. Its functions
+// may be called concurrently and should return quickly.
+type Metrics interface {
+	// BufferDepth is called with the number of payments buffered whenever a
+	// payment is buffered or the buffer is flushed.
+	BufferDepth(payments int)
+
+	// BufferFlushed is called when a buffer is proposed as a payment, with the
+	// number of payments it contains and its size in bytes.
+	BufferFlushed(payments int, byteSize int)
+}
+
 // Config contains the information that can be supplied to configure the Agent
 // at construction.
 type Config struct {
@@ -31,6 +72,21 @@ type Config struct {
 
 	MaxBufferSize int
 
+	// FlushPolicy controls when buffered payments are flushed into an
+	// agreement.
+	FlushPolicy FlushPolicy
+
+	// Metrics, if set, records measurements of the buffer.
+	Metrics Metrics
+
+	// Logger, if set, is used to log the buffered agent's activity. A
+	// *slog.Logger can be used.
+	Logger agent.Logger
+
+	// LogWriter, if set and Logger is not set, is written the buffered
+	// agent's logs as lines of key=value pairs.
+	//
+	// Deprecated: Use Logger.
 	LogWriter io.Writer
 
 	Events chan<- interface{}
@@ -38,13 +94,24 @@ type Config struct {
 
 // NewAgent constructs a new buffered agent with the given config.
 func NewAgent(c Config) *Agent {
+	logger := c.Logger
+	if logger == nil {
+		w := c.LogWriter
+		if w == nil {
+			w = io.Discard
+		}
+		logger = agent.NewTextLogger(w)
+	}
 	agent := &Agent{
 		agent:       c.Agent,
 		agentEvents: c.AgentEvents,
 
 		maxbufferSize: c.MaxBufferSize,
+		flushPolicy:   c.FlushPolicy,
+
+		metrics: c.Metrics,
 
-		logWriter: c.LogWriter,
+		logger: logger,
 
 		bufferReady:  make(chan struct{}, 1),
 		sendingReady: make(chan struct{}, 1),
@@ -55,10 +122,11 @@ func NewAgent(c Config) *Agent {
 	bufferReadyCloseOnce := sync.Once{}
 	agent.bufferReadyClose = func() {
 		bufferReadyCloseOnce.Do(func() {
+			agent.bufferReadyClosed = true
 			close(agent.bufferReady)
 		})
 	}
-	agent.resetbuffer()
+	agent.buffers = []paymentBuffer{newPaymentBuffer()}
 	agent.sendingReady <- struct{}{}
 	go agent.flushLoop()
 	return agent
@@ -68,12 +136,20 @@ func NewAgent(c Config) *Agent {
 // buffers payments by collapsing them down into single payments while it waits
 // for a chance to make the next payment.
 //
+// Payments are collected in a buffer until it is flushed according to the
+// flush policy. When a payment does not fit in the buffer's agreement, the
+// buffer is sealed and flushed as soon as possible, and the payment starts a
+// new buffer.
+//
 // All functions of the Agent are safe to call from multiple goroutines as they
 // use an internal mutex.
 type Agent struct {
 	maxbufferSize int
+	flushPolicy   FlushPolicy
+
+	metrics Metrics
 
-	logWriter io.Writer
+	logger agent.Logger
 
 	agentEvents <-chan interface{}
 	events      chan<- interface{}
@@ -86,15 +162,51 @@ type Agent struct {
 
 	agent *agent.Agent
 
-	bufferID          string
-	buffer            []BufferedPayment
-	bufferTotalAmount int64
-	bufferReady       chan struct{}
-	bufferReadyClose  func()
+	// buffers are the buffers waiting to be flushed, in the order they will
+	// be flushed. The last buffer is the one new payments are added to, and
+	// any buffers before it are sealed.
+	buffers          []paymentBuffer
+	bufferReady      chan struct{}
+	bufferReadyClose func()
+	// bufferReadyClosed is true once bufferReady is closed and can no longer
+	// be signaled.
+	bufferReadyClosed bool
 	sendingReady      chan struct{}
 	idle              chan struct{}
 }
 
+// paymentBuffer is a set of buffered payments that will be flushed together in
+// a single agreement.
+type paymentBuffer struct {
+	id          string
+	payments    []BufferedPayment
+	totalAmount int64
+	// payloadSize is the sum of the estimated encoded sizes of the payments.
+	payloadSize int
+	// firstAt is the time the first payment was added to the buffer.
+	firstAt time.Time
+}
+
+func newPaymentBuffer() paymentBuffer {
+	return paymentBuffer{id: uuid.NewString()}
+}
+
+// fits returns true if the payment can be added to the buffer without the
+// buffer's agreement exceeding the limits of the flush policy.
+func (b paymentBuffer) fits(amount int64, payloadSize int, p FlushPolicy) bool {
+	maxAmount := p.MaxAmount
+	if maxAmount == 0 {
+		maxAmount = math.MaxInt64
+	}
+	if amount > maxAmount-b.totalAmount {
+		return false
+	}
+	if p.MaxMemoByteSize != 0 && estimateMemoByteSize(b.payloadSize+payloadSize) > p.MaxMemoByteSize {
+		return false
+	}
+	return true
+}
+
 // MaxBufferSize returns the maximum buffer size that was configured at
 // construction or changed with SetMaxBufferSize. The maximum buffer size is the
 // maximum number of payments that can be buffered while waiting for the
@@ -110,6 +222,25 @@ func (a *Agent) SetMaxBufferSize(maxbufferSize int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.maxbufferSize = maxbufferSize
+	a.signalBufferReady()
+}
+
+// FlushPolicy returns the flush policy that was configured at construction or
+// changed with SetFlushPolicy.
+func (a *Agent) FlushPolicy() FlushPolicy {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushPolicy
+}
+
+// SetFlushPolicy sets and changes the flush policy. Payments already buffered
+// stay in the agreements they were buffered for, but are flushed according to
+// the new policy's max linger time.
+func (a *Agent) SetFlushPolicy(p FlushPolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flushPolicy = p
+	a.signalBufferReady()
 }
 
 // Open opens the channel for the given asset. The open is coordinated with the
@@ -122,27 +253,36 @@ func (a *Agent) Open(asset state.Asset) error {
 	return a.agent.Open(asset)
 }
 
-// PaymentWithMemo buffers a payment which will be paid in the next agreement.
-// The identifier for the buffer is returned. An error may be returned
-// immediately if the buffer is full. Any errors relating to the payment, and
-// confirmation of the payment, will be returned asynchronously on the events
-// channel.
+// PaymentWithMemo buffers a payment which will be paid in the next agreement
+// that it fits in. The identifier for the buffer is returned. An error may be
+// returned immediately if the buffer is full, or if the payment is too large
+// for any agreement. Any errors relating to the payment, and confirmation of
+// the payment, will be returned asynchronously on the events channel.
 func (a *Agent) PaymentWithMemo(paymentAmount int64, memo string) (bufferID string, err error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	if a.maxbufferSize != 0 && len(a.buffer) == a.maxbufferSize {
+	if a.maxbufferSize != 0 && a.bufferLen() == a.maxbufferSize {
 		return "", ErrBufferFull
 	}
-	if paymentAmount > math.MaxInt64-a.bufferTotalAmount {
-		return "", ErrBufferFull
+	payloadSize := estimatePaymentByteSize(memo)
+	if !(paymentBuffer{}).fits(paymentAmount, payloadSize, a.flushPolicy) {
+		return "", ErrPaymentTooLarge
 	}
-	a.buffer = append(a.buffer, BufferedPayment{Amount: paymentAmount, Memo: memo})
-	a.bufferTotalAmount += paymentAmount
-	bufferID = a.bufferID
-	select {
-	case a.bufferReady <- struct{}{}:
-	default:
+	if b := a.buffers[len(a.buffers)-1]; len(b.payments) > 0 && !b.fits(paymentAmount, payloadSize, a.flushPolicy) {
+		a.buffers = append(a.buffers, newPaymentBuffer())
+	}
+	b := &a.buffers[len(a.buffers)-1]
+	if len(b.payments) == 0 {
+		b.firstAt = time.Now()
+	}
+	b.payments = append(b.payments, BufferedPayment{Amount: paymentAmount, Memo: memo})
+	b.totalAmount += paymentAmount
+	b.payloadSize += payloadSize
+	bufferID = b.id
+	if a.metrics != nil {
+		a.metrics.BufferDepth(a.bufferLen())
 	}
+	a.signalBufferReady()
 	return
 }
 
@@ -161,8 +301,8 @@ func (a *Agent) Wait() {
 // DeclareClose starts the close process of the channel by submitting the latest
 // declaration to the network, then coordinating an immediate close with the
 // other participant. If an immediate close can be coordinated it will
-// automatically occur, otherwise a participant must call Close after the
-// observation period has passed to close the channel.
+// automatically occur, otherwise the close is automatically submitted after
+// the observation period has passed.
 //
 // It is not possible to make new payments once called.
 func (a *Agent) DeclareClose() error {
@@ -172,6 +312,19 @@ func (a *Agent) DeclareClose() error {
 	return a.agent.DeclareClose()
 }
 
+// ForceClose starts the close process of the channel by submitting the latest
+// declaration to the network, without coordinating with the other participant,
+// and submits the close after the observation period has passed. It does not
+// require a connection to the other participant.
+//
+// It is not possible to make new payments once called.
+func (a *Agent) ForceClose() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bufferReadyClose()
+	return a.agent.ForceClose()
+}
+
 // Close submits the close transaction to the network. DeclareClose must have
 // been called by one of the participants before hand.
 func (a *Agent) Close() error {
@@ -184,8 +337,8 @@ func (a *Agent) Close() error {
 func (a *Agent) eventLoop() {
 	defer close(a.events)
 	defer close(a.sendingReady)
-	defer fmt.Fprintf(a.logWriter, "event loop stopped\n")
-	fmt.Fprintf(a.logWriter, "event loop started\n")
+	defer a.logger.Debug("event loop stopped")
+	a.logger.Debug("event loop started")
 	for {
 		ae, open := <-a.agentEvents
 		if !open {
@@ -223,38 +376,99 @@ func (a *Agent) eventLoop() {
 				BufferByteSize: len(e.CloseAgreement.Envelope.Details.Memo),
 				Payments:       memo.Payments,
 			}
+		case agent.PaymentRejectedEvent:
+			a.sendingReady <- struct{}{}
+			memo := bufferedPaymentsMemo{}
+			err := memo.UnmarshalBinary(e.CloseAgreement.Envelope.Details.Memo)
+			if err != nil {
+				a.events <- agent.ErrorEvent{Err: err}
+				continue
+			}
+			a.events <- BufferedPaymentsRejectedEvent{
+				PaymentRejectedEvent: e,
+				BufferID:             memo.ID,
+				BufferByteSize:       len(e.CloseAgreement.Envelope.Details.Memo),
+				Payments:             memo.Payments,
+			}
 		}
 	}
 }
 
 func (a *Agent) flushLoop() {
-	defer fmt.Fprintf(a.logWriter, "flush loop stopped\n")
-	fmt.Fprintf(a.logWriter, "flush loop started\n")
+	defer a.logger.Debug("flush loop stopped")
+	a.logger.Debug("flush loop started")
 	for {
 		_, open := <-a.sendingReady
 		if !open {
 			return
 		}
-		select {
-		case _, open = <-a.bufferReady:
-			if !open {
-				return
-			}
-			a.flush()
-		default:
+		open = a.waitForFlush()
+		if !open {
+			return
+		}
+		a.flush()
+	}
+}
+
+// waitForFlush waits until the next buffer should be flushed according to the
+// flush policy, indicating the agent is idle while the buffer is empty. It
+// returns false if the buffer has been closed.
+func (a *Agent) waitForFlush() bool {
+	for {
+		var wait time.Duration
+		var empty bool
+		func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			wait, empty = a.nextFlush()
+		}()
+
+		if empty {
 			select {
-			case _, open = <-a.bufferReady:
+			case _, open := <-a.bufferReady:
 				if !open {
-					return
+					return false
 				}
-				a.flush()
 			case a.idle <- struct{}{}:
-				a.sendingReady <- struct{}{}
 			}
+			continue
+		}
+		if wait <= 0 {
+			return true
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case _, open := <-a.bufferReady:
+			timer.Stop()
+			if !open {
+				return false
+			}
+		case <-timer.C:
 		}
 	}
 }
 
+// nextFlush returns how long to wait before flushing the next buffer, or true
+// if there are no buffered payments to flush. Sealed buffers and full buffers
+// are flushed without waiting, and otherwise the buffer is flushed once its
+// first payment has lingered for the max linger time.
+//
+// Must be called with the mutex locked.
+func (a *Agent) nextFlush() (wait time.Duration, empty bool) {
+	b := a.buffers[0]
+	if len(b.payments) == 0 {
+		return 0, true
+	}
+	if len(a.buffers) > 1 {
+		return 0, false
+	}
+	if a.maxbufferSize != 0 && a.bufferLen() >= a.maxbufferSize {
+		return 0, false
+	}
+	return time.Until(b.firstAt.Add(a.flushPolicy.MaxLinger)), false
+}
+
 func (a *Agent) flush() {
 	var bufferID string
 	var buffer []BufferedPayment
@@ -264,10 +478,17 @@ func (a *Agent) flush() {
 		a.mu.Lock()
 		defer a.mu.Unlock()
 
-		bufferID = a.bufferID
-		buffer = a.buffer
-		bufferTotalAmount = a.bufferTotalAmount
-		a.resetbuffer()
+		b := a.buffers[0]
+		bufferID = b.id
+		buffer = b.payments
+		bufferTotalAmount = b.totalAmount
+		a.buffers = a.buffers[1:]
+		if len(a.buffers) == 0 {
+			a.buffers = append(a.buffers, newPaymentBuffer())
+		}
+		if a.metrics != nil && len(buffer) > 0 {
+			a.metrics.BufferDepth(a.bufferLen())
+		}
 	}()
 
 	if len(buffer) == 0 {
@@ -286,16 +507,40 @@ func (a *Agent) flush() {
 		return
 	}
 
+	a.logger.Debug("flushing buffer", "buffer_id", bufferID, "payments", len(buffer), "amount", bufferTotalAmount, "byte_size", len(memoBytes))
 	err = a.agent.PaymentWithMemo(bufferTotalAmount, memoBytes)
 	if err != nil {
+		a.logger.Error("error flushing buffer", "buffer_id", bufferID, "error", err)
 		a.events <- agent.ErrorEvent{Err: err}
 		a.sendingReady <- struct{}{}
 		return
 	}
+	if a.metrics != nil {
+		a.metrics.BufferFlushed(len(buffer), len(memoBytes))
+	}
 }
 
-func (a *Agent) resetbuffer() {
-	a.bufferID = uuid.NewString()
-	a.buffer = nil
-	a.bufferTotalAmount = 0
+// bufferLen returns the number of payments buffered across all buffers.
+//
+// Must be called with the mutex locked.
+func (a *Agent) bufferLen() int {
+	n := 0
+	for _, b := range a.buffers {
+		n += len(b.payments)
+	}
+	return n
+}
+
+// signalBufferReady signals the flush loop that the buffers have changed,
+// without blocking if a signal is already pending.
+//
+// Must be called with the mutex locked.
+func (a *Agent) signalBufferReady() {
+	if a.bufferReadyClosed {
+		return
+	}
+	select {
+	case a.bufferReady <- struct{}{}:
+	default:
+	}
 }
@@ -0,0 +1,139 @@
+package bufferedagent
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/agent/msg"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAgent returns an agent that buffers payments without a flush loop
+// flushing them.
+func newTestAgent(p FlushPolicy) *Agent {
+	return &Agent{
+		flushPolicy: p,
+		buffers:     []paymentBuffer{newPaymentBuffer()},
+		bufferReady: make(chan struct{}, 1),
+	}
+}
+
+func TestAgent_PaymentWithMemo_maxAmount(t *testing.T) {
+	a := newTestAgent(FlushPolicy{MaxAmount: 100})
+
+	id1, err := a.Payment(60)
+	require.NoError(t, err)
+	id2, err := a.Payment(40)
+	require.NoError(t, err)
+	assert.Equal(t, id1, id2)
+
+	// The payment doesn't fit in the first agreement so it starts another.
+	id3, err := a.Payment(1)
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id3)
+
+	_, err = a.Payment(101)
+	assert.ErrorIs(t, err, ErrPaymentTooLarge)
+
+	require.Len(t, a.buffers, 2)
+	assert.Equal(t, []BufferedPayment{{Amount: 60}, {Amount: 40}}, a.buffers[0].payments)
+	assert.Equal(t, int64(100), a.buffers[0].totalAmount)
+	assert.Equal(t, []BufferedPayment{{Amount: 1}}, a.buffers[1].payments)
+	assert.Equal(t, 3, a.bufferLen())
+}
+
+func TestAgent_PaymentWithMemo_maxMemoByteSize(t *testing.T) {
+	memo := string(make([]byte, 1000))
+	maxMemoByteSize := estimateMemoByteSize(2 * estimatePaymentByteSize(memo))
+	a := newTestAgent(FlushPolicy{MaxMemoByteSize: maxMemoByteSize})
+
+	id1, err := a.PaymentWithMemo(1, memo)
+	require.NoError(t, err)
+	id2, err := a.PaymentWithMemo(1, memo)
+	require.NoError(t, err)
+	assert.Equal(t, id1, id2)
+	id3, err := a.PaymentWithMemo(1, memo)
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id3)
+
+	_, err = a.PaymentWithMemo(1, string(make([]byte, maxMemoByteSize)))
+	assert.ErrorIs(t, err, ErrPaymentTooLarge)
+
+	memoBytes, err := (&bufferedPaymentsMemo{ID: id1, Payments: a.buffers[0].payments}).MarshalBinary()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(memoBytes), maxMemoByteSize)
+}
+
+func TestAgent_nextFlush(t *testing.T) {
+	a := newTestAgent(FlushPolicy{MaxLinger: time.Minute, MaxAmount: 100})
+
+	_, empty := a.nextFlush()
+	assert.True(t, empty)
+
+	// A buffer waits for the max linger time for more payments.
+	_, err := a.Payment(60)
+	require.NoError(t, err)
+	wait, empty := a.nextFlush()
+	assert.False(t, empty)
+	assert.Greater(t, int64(wait), int64(59*time.Second))
+	assert.LessOrEqual(t, int64(wait), int64(time.Minute))
+
+	// A sealed buffer is flushed without waiting.
+	_, err = a.Payment(60)
+	require.NoError(t, err)
+	wait, empty = a.nextFlush()
+	assert.False(t, empty)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// A full buffer is flushed without waiting.
+	a = newTestAgent(FlushPolicy{MaxLinger: time.Minute})
+	a.maxbufferSize = 1
+	_, err = a.Payment(60)
+	require.NoError(t, err)
+	wait, empty = a.nextFlush()
+	assert.False(t, empty)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// Without a max linger time a buffer is flushed without waiting.
+	a = newTestAgent(FlushPolicy{})
+	_, err = a.Payment(60)
+	require.NoError(t, err)
+	wait, _ = a.nextFlush()
+	assert.LessOrEqual(t, int64(wait), int64(0))
+}
+
+func TestAgent_eventLoop_paymentRejected(t *testing.T) {
+	memo, err := (&bufferedPaymentsMemo{ID: "id", Payments: []BufferedPayment{{Amount: 1}}}).MarshalBinary()
+	require.NoError(t, err)
+
+	agentEvents := make(chan interface{}, 1)
+	events := make(chan interface{}, 2)
+	a := &Agent{
+		agentEvents:  agentEvents,
+		events:       events,
+		sendingReady: make(chan struct{}, 1),
+		logger:       agent.NewTextLogger(io.Discard),
+	}
+	go a.eventLoop()
+
+	rejected := agent.PaymentRejectedEvent{
+		CloseAgreement: state.CloseAgreement{Envelope: state.CloseEnvelope{Details: state.CloseDetails{Memo: memo}}},
+		Reason:         msg.RejectReasonNotAccepted,
+		Message:        "payment not accepted",
+	}
+	agentEvents <- rejected
+	close(agentEvents)
+
+	assert.Equal(t, rejected, <-events)
+	e, ok := (<-events).(BufferedPaymentsRejectedEvent)
+	require.True(t, ok)
+	assert.Equal(t, rejected, e.PaymentRejectedEvent)
+	assert.Equal(t, msg.RejectReasonNotAccepted, e.Reason)
+	assert.Equal(t, "payment not accepted", e.Message)
+	assert.Equal(t, "id", e.BufferID)
+	assert.Equal(t, []BufferedPayment{{Amount: 1}}, e.Payments)
+}
@@ -43,3 +43,32 @@ func (m *bufferedPaymentsMemo) UnmarshalBinary(b []byte) error {
 	}
 	return nil
 }
+
+// Upper bounds on the bytes added by each part of the encoding of a buffered
+// payments memo, used to estimate the size of a memo before it is encoded.
+const (
+	// memoOverheadByteSize bounds the bytes for the gzip header and trailer,
+	// the gob type definitions, and the buffer ID.
+	memoOverheadByteSize = 256
+	// paymentOverheadByteSize bounds the bytes for each payment other than its
+	// memo, being its amount, the length of its memo, and gob field markers.
+	paymentOverheadByteSize = 32
+	// deflateBlockByteSize and deflateBlockOverheadByteSize bound the bytes
+	// added by deflate when storing data that cannot be compressed.
+	deflateBlockByteSize         = 16 * 1024
+	deflateBlockOverheadByteSize = 5
+)
+
+// estimatePaymentByteSize returns an upper bound on the bytes that a payment
+// with the memo adds to the gob encoding of a buffered payments memo.
+func estimatePaymentByteSize(memo string) int {
+	return len(memo) + paymentOverheadByteSize
+}
+
+// estimateMemoByteSize returns an upper bound on the encoded size of a
+// buffered payments memo containing payments that total payloadSize, as
+// returned by estimatePaymentByteSize, without encoding it.
+func estimateMemoByteSize(payloadSize int) int {
+	blocks := payloadSize/deflateBlockByteSize + 1
+	return memoOverheadByteSize + payloadSize + blocks*deflateBlockOverheadByteSize
+}
@@ -0,0 +1,44 @@
+package bufferedagent
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateMemoByteSize(t *testing.T) {
+	testCases := []struct {
+		payments int
+		memoSize int
+	}{
+		{0, 0},
+		{1, 0},
+		{1, 100},
+		{10, 1000},
+		{100, 10},
+		{2, 70000},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d payments of memo size %d", tc.payments, tc.memoSize), func(t *testing.T) {
+			memo := bufferedPaymentsMemo{ID: newPaymentBuffer().id}
+			payloadSize := 0
+			for i := 0; i < tc.payments; i++ {
+				// Random memos are incompressible, making the encoding as large
+				// as it can be.
+				b := make([]byte, tc.memoSize)
+				_, err := rand.Read(b)
+				require.NoError(t, err)
+				memo.Payments = append(memo.Payments, BufferedPayment{Amount: math.MaxInt64, Memo: string(b)})
+				payloadSize += estimatePaymentByteSize(string(b))
+			}
+
+			memoBytes, err := memo.MarshalBinary()
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(memoBytes), estimateMemoByteSize(payloadSize))
+		})
+	}
+}
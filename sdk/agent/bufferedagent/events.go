@@ -18,3 +18,13 @@ type BufferedPaymentsSentEvent struct {
 	BufferByteSize int
 	Payments       []BufferedPayment
 }
+
+// BufferedPaymentsRejectedEvent occurs when a payment that was buffered is
+// rejected by the other participant. None of the buffered payments were made.
+// The embedded event contains the reason the other participant gave.
+type BufferedPaymentsRejectedEvent struct {
+	agent.PaymentRejectedEvent
+	BufferID       string
+	BufferByteSize int
+	Payments       []BufferedPayment
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stellar/starlight/sdk/agent/submit"
+	"github.com/stellar/starlight/sdk/agent/trace"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
+)
+
+// defaultCloseRetryInterval is the time to wait before resubmitting a close tx
+// that failed for a temporary reason, such as the network rejecting it because
+// the observation period had not yet passed.
+const defaultCloseRetryInterval = 5 * time.Second
+
+// scheduleClose schedules the submission of the close tx for once the
+// observation period of the latest close agreement has passed since the
+// declaration tx was included in a ledger. The ledger gap has passed once the
+// Streamer has been observed to reach the ledger the declaration tx was
+// included in plus the gap, and the observation period time is a separate
+// lower bound measured from the close time of that ledger. If the ledger of
+// the declaration tx is unknown the next ledger observed is used in its place,
+// and if its close time is unknown the current time is used, which is later
+// than necessary but always safe. If the close is submitted too early it is
+// resubmitted until it succeeds.
+//
+// Coordinated closes are not scheduled because they have no observation period
+// and are submitted by both participants when they are authorized.
+//
+// The channel emits ClosedEvent when the close tx is ingested.
+//
+// Must be called with the mutex locked.
+func (a *Agent) scheduleClose(declTx StreamedTransaction) {
+	d := a.channel.LatestCloseAgreement().Envelope.Details
+	if d.ObservationPeriodTime == 0 && d.ObservationPeriodLedgerGap == 0 {
+		return
+	}
+
+	declaredAt := declTx.LedgerCloseTime
+	if declaredAt.IsZero() {
+		declaredAt = time.Now()
+	}
+
+	a.stopScheduledClose()
+	a.closePending = true
+	a.closeReadyLedger = 0
+	if declTx.LedgerSequence != 0 {
+		a.closeReadyLedger = declTx.LedgerSequence + d.ObservationPeriodLedgerGap
+	}
+	a.closeReadyAt = declaredAt.Add(d.ObservationPeriodTime)
+	a.log().Info("scheduling close tx", "close_ledger", a.closeReadyLedger, "close_at", a.closeReadyAt, "declaration_ledger", declTx.LedgerSequence)
+
+	if wait := time.Until(a.closeReadyAt); wait > 0 {
+		a.closeTimer = time.AfterFunc(wait, func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.closeTimer = nil
+			a.closeIfReady()
+		})
+	}
+	a.closeIfReady()
+}
+
+// observeLedger records the ledger of a streamed transaction as the latest
+// ledger observed, and if a close is scheduled without knowing the ledger of
+// its declaration tx, uses the ledger in its place.
+//
+// Must be called with the mutex locked.
+func (a *Agent) observeLedger(tx StreamedTransaction) {
+	if tx.LedgerSequence <= a.latestLedger {
+		return
+	}
+	a.latestLedger = tx.LedgerSequence
+	if a.closePending && a.closeReadyLedger == 0 {
+		gap := a.channel.LatestCloseAgreement().Envelope.Details.ObservationPeriodLedgerGap
+		a.closeReadyLedger = a.latestLedger + gap
+	}
+}
+
+// closeIfReady submits the scheduled close tx if the latest ledger observed
+// has reached the end of the ledger gap and the observation period time has
+// passed.
+//
+// Must be called with the mutex locked.
+func (a *Agent) closeIfReady() {
+	if !a.closePending {
+		return
+	}
+	if a.closeReadyLedger == 0 || a.latestLedger < a.closeReadyLedger {
+		return
+	}
+	if time.Now().Before(a.closeReadyAt) {
+		return
+	}
+	a.stopScheduledClose()
+	a.submitScheduledClose()
+}
+
+// stopScheduledClose stops any scheduled close from being submitted.
+//
+// Must be called with the mutex locked.
+func (a *Agent) stopScheduledClose() {
+	a.closePending = false
+	if a.closeTimer != nil {
+		a.closeTimer.Stop()
+		a.closeTimer = nil
+	}
+}
+
+// scheduledClose resubmits the close tx after a previous submission failed.
+func (a *Agent) scheduledClose() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closeTimer = nil
+	a.submitScheduledClose()
+}
+
+// submitScheduledClose submits the close tx of the latest close agreement if
+// the channel is still closing, resubmitting it if the submission fails for a
+// temporary reason.
+//
+// Must be called with the mutex locked.
+func (a *Agent) submitScheduledClose() {
+	// The channel may have been closed, or closed with a new agreement, while
+	// waiting, in which case there is nothing to submit.
+	if a.channel == nil {
+		return
+	}
+	s, err := a.channel.State()
+	if err != nil || s != state.StateClosing {
+		return
+	}
+
+	span := trace.Start(a.tracer, "close.scheduled", trace.SpanContext{})
+	defer span.End()
+
+	_, closeTx, err := a.channel.CloseTxs()
+	if err != nil {
+		a.sendErrorEvent(fmt.Errorf("building scheduled close tx: %w", err))
+		return
+	}
+	closeHash, err := closeTx.HashHex(a.networkPassphrase)
+	if err != nil {
+		a.sendErrorEvent(fmt.Errorf("hashing scheduled close tx: %w", err))
+		return
+	}
+	a.log().Info("submitting scheduled close tx", "tx", closeHash)
+	a.submitTx(span.SpanContext(), txbuild.TransactionTypeClose, closeTx, func(err error) {
+		if kind := submit.Classify(err); err != nil && kind.Temporary() {
+			// The close may have been ingested or rescheduled while it was
+			// being submitted.
+			if a.closeTimer != nil || a.channel == nil {
+				return
+			}
+			if s, err := a.channel.State(); err != nil || s != state.StateClosing {
+				return
+			}
+			a.log().Warn("scheduled close tx failed temporarily", "tx", closeHash, "kind", kind, "retry_in", a.closeRetryInterval)
+			a.closeTimer = time.AfterFunc(a.closeRetryInterval, a.scheduledClose)
+			return
+		}
+		if err != nil {
+			a.sendErrorEvent(fmt.Errorf("submitting scheduled close tx %s: %w", closeHash, err))
+			return
+		}
+		a.log().Info("submitted scheduled close tx", "tx", closeHash)
+	})
+}
+
+// sendErrorEvent logs the error and sends it as an ErrorEvent.
+//
+// Must be called with the mutex locked.
+func (a *Agent) sendErrorEvent(err error) {
+	a.log().Error("error", "error", err)
+	if a.events != nil {
+		a.events <- ErrorEvent{Err: err}
+	}
+}
@@ -0,0 +1,634 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_scheduledClose(t *testing.T) {
+	localChannelAccount := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	localSigner := keypair.MustParseFull("SCBMAMOPWKL2YHWELK63VLAY2R74A6GTLLD4ON223B7K5KZ37MUR6IDF")
+	remoteChannelAccount := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+	remoteSigner := keypair.MustParseFull("SBM7D2IIDSRX5Y3VMTMTXXPB6AIB4WYGZBC2M64U742BNOK32X6SW4NF")
+
+	localTransactionsStream := make(chan StreamedTransaction)
+	remoteTransactionsStream := make(chan StreamedTransaction)
+	sequenceNumberCollector := sequenceNumberCollector(func(accountID *keypair.FromAddress) (int64, error) {
+		if accountID.Equal(localChannelAccount) {
+			return 28037546508288, nil
+		}
+		if accountID.Equal(remoteChannelAccount) {
+			return 28054726377472, nil
+		}
+		return 0, fmt.Errorf("unknown channel account")
+	})
+	balanceCollector := balanceCollectorFunc(func(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+		return 100_0000000, nil
+	})
+
+	// Setup the local agent with a submitter that rejects the first close tx
+	// because the observation period has not passed.
+	localSubmittedTxs := make(chan string, 10)
+	localSubmissions := 0
+	localEvents := make(chan interface{}, 1)
+	localAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector:           balanceCollector,
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			hash, err := tx.HashHex(network.TestNetworkPassphrase)
+			if err != nil {
+				return err
+			}
+			localSubmittedTxs <- hash
+			// The submissions are the open, the declaration, then the close.
+			localSubmissions++
+			if localSubmissions == 3 {
+				return fmt.Errorf("submitting tx: horizon error: \"Transaction Failed\" (tx_bad_minseq_age_or_gap)")
+			}
+			return nil
+		}),
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return localTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    localChannelAccount.FromAddress(),
+		ChannelAccountSigner: localSigner,
+		LogWriter:            io.Discard,
+		Events:               localEvents,
+	})
+	localAgent.closeRetryInterval = time.Millisecond
+
+	// Setup the remote agent.
+	remoteEvents := make(chan interface{}, 1)
+	remoteAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector:           balanceCollector,
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			return nil
+		}),
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return remoteTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    remoteChannelAccount.FromAddress(),
+		ChannelAccountSigner: remoteSigner,
+		LogWriter:            io.Discard,
+		Events:               remoteEvents,
+	})
+
+	// Connect the two agents.
+	type ReadWriter struct {
+		io.Reader
+		io.Writer
+	}
+	localMsgs := bytes.Buffer{}
+	remoteMsgs := bytes.Buffer{}
+	localAgent.conn = ReadWriter{
+		Reader: &remoteMsgs,
+		Writer: &localMsgs,
+	}
+	remoteAgent.conn = ReadWriter{
+		Reader: &localMsgs,
+		Writer: &remoteMsgs,
+	}
+	err := localAgent.hello()
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = remoteAgent.hello()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	<-localEvents
+	<-remoteEvents
+
+	// Open the channel.
+	err = localAgent.Open(state.NativeAsset)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	<-localSubmittedTxs
+
+	// Ingest the open tx, as if it was processed on network.
+	openTx, err := localAgent.channel.OpenTx()
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	openTxStreamed := StreamedTransaction{
+		TransactionXDR: openTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+				InitiatorSigner:         localSigner.Address(),
+				ResponderSigner:         remoteSigner.Address(),
+				InitiatorChannelAccount: localChannelAccount.Address(),
+				ResponderChannelAccount: remoteChannelAccount.Address(),
+				StartSequence:           28037546508289,
+				Asset:                   txnbuild.NativeAsset{},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	localTransactionsStream <- openTxStreamed
+	remoteTransactionsStream <- openTxStreamed
+	assert.IsType(t, ChannelTxObservedEvent{}, <-localEvents)
+	assert.IsType(t, ChannelTxObservedEvent{}, <-remoteEvents)
+	<-localEvents
+	<-remoteEvents
+
+	// Declare the close, that the remote never responds to.
+	err = localAgent.DeclareClose()
+	require.NoError(t, err)
+	localDeclTx, localCloseTx, err := localAgent.channel.CloseTxs()
+	require.NoError(t, err)
+	localDeclTxHash, err := localDeclTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	localCloseTxHash, err := localCloseTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, localDeclTxHash, <-localSubmittedTxs)
+
+	// Ingest the declaration tx, as if it was processed on network in a
+	// ledger that closed after the observation period started.
+	localDeclTxXDR, err := localDeclTx.Base64()
+	require.NoError(t, err)
+	localTransactionsStream <- StreamedTransaction{
+		LedgerSequence:  2,
+		LedgerCloseTime: time.Now().Add(-time.Minute),
+		TransactionXDR:  localDeclTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{
+				{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId: xdr.MustAddress(localChannelAccount.Address()),
+						SeqNum:    xdr.SequenceNumber(localDeclTx.SequenceNumber()),
+						Signers: []xdr.Signer{
+							{Key: xdr.MustSigner(localSigner.Address()), Weight: 1},
+							{Key: xdr.MustSigner(remoteSigner.Address()), Weight: 1},
+						},
+						Thresholds: xdr.Thresholds{0, 2, 2, 2},
+					},
+				},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeDeclaration, localObservedEvent.Tx.Type)
+		assert.True(t, localObservedEvent.Successful)
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.Equal(t, ClosingEvent{}, localEvent)
+	}
+
+	// Expect the close tx not to be submitted until a ledger after the ledger
+	// gap is observed.
+	select {
+	case hash := <-localSubmittedTxs:
+		t.Fatalf("unexpected tx submitted: %s", hash)
+	case <-time.After(10 * time.Millisecond):
+	}
+	localTransactionsStream <- StreamedTransaction{LedgerSequence: 3, LedgerCloseTime: time.Now()}
+
+	// Expect the close tx to be submitted, and resubmitted after the first
+	// submission is rejected.
+	assert.Equal(t, localCloseTxHash, <-localSubmittedTxs)
+	assert.Equal(t, localCloseTxHash, <-localSubmittedTxs)
+
+	// Ingest the close tx, as if it was processed on network.
+	localCloseTxXDR, err := localCloseTx.Base64()
+	require.NoError(t, err)
+	localTransactionsStream <- StreamedTransaction{
+		TransactionXDR: localCloseTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{
+				{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId: xdr.MustAddress(localChannelAccount.Address()),
+						SeqNum:    xdr.SequenceNumber(localCloseTx.SequenceNumber()),
+						Signers: []xdr.Signer{
+							{Key: xdr.MustSigner(localSigner.Address()), Weight: 1},
+						},
+						Thresholds: xdr.Thresholds{0, 1, 1, 1},
+					},
+				},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeClose, localObservedEvent.Tx.Type)
+		assert.True(t, localObservedEvent.Successful)
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.Equal(t, ClosedEvent{}, localEvent)
+	}
+
+	// Expect no further submissions.
+	select {
+	case hash := <-localSubmittedTxs:
+		t.Fatalf("unexpected tx submitted: %s", hash)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestAgent_ForceClose(t *testing.T) {
+	localChannelAccount := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	localSigner := keypair.MustParseFull("SCBMAMOPWKL2YHWELK63VLAY2R74A6GTLLD4ON223B7K5KZ37MUR6IDF")
+	remoteChannelAccount := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+	remoteSigner := keypair.MustParseFull("SBM7D2IIDSRX5Y3VMTMTXXPB6AIB4WYGZBC2M64U742BNOK32X6SW4NF")
+
+	localTransactionsStream := make(chan StreamedTransaction)
+	remoteTransactionsStream := make(chan StreamedTransaction)
+	sequenceNumberCollector := sequenceNumberCollector(func(accountID *keypair.FromAddress) (int64, error) {
+		if accountID.Equal(localChannelAccount) {
+			return 28037546508288, nil
+		}
+		if accountID.Equal(remoteChannelAccount) {
+			return 28054726377472, nil
+		}
+		return 0, fmt.Errorf("unknown channel account")
+	})
+	balanceCollector := balanceCollectorFunc(func(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+		return 100_0000000, nil
+	})
+	submitter := submitterFunc(func(tx *txnbuild.Transaction) error {
+		return nil
+	})
+
+	// Setup the local agent.
+	localEvents := make(chan interface{}, 1)
+	localConfig := Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector:           balanceCollector,
+		Submitter:                  submitter,
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return localTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    localChannelAccount.FromAddress(),
+		ChannelAccountSigner: localSigner,
+		LogWriter:            io.Discard,
+		Events:               localEvents,
+	}
+	localAgent := NewAgent(localConfig)
+
+	// Setup the remote agent.
+	remoteEvents := make(chan interface{}, 1)
+	remoteAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector:           balanceCollector,
+		Submitter:                  submitter,
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return remoteTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    remoteChannelAccount.FromAddress(),
+		ChannelAccountSigner: remoteSigner,
+		LogWriter:            io.Discard,
+		Events:               remoteEvents,
+	})
+
+	// Connect the two agents.
+	type ReadWriter struct {
+		io.Reader
+		io.Writer
+	}
+	localMsgs := bytes.Buffer{}
+	remoteMsgs := bytes.Buffer{}
+	localAgent.conn = ReadWriter{
+		Reader: &remoteMsgs,
+		Writer: &localMsgs,
+	}
+	remoteAgent.conn = ReadWriter{
+		Reader: &localMsgs,
+		Writer: &remoteMsgs,
+	}
+	err := localAgent.hello()
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = remoteAgent.hello()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	<-localEvents
+	<-remoteEvents
+
+	// Open the channel.
+	err = localAgent.Open(state.NativeAsset)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+
+	// Ingest the open tx, as if it was processed on network.
+	openTx, err := localAgent.channel.OpenTx()
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	openTxStreamed := StreamedTransaction{
+		Cursor:         "1",
+		TransactionXDR: openTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+				InitiatorSigner:         localSigner.Address(),
+				ResponderSigner:         remoteSigner.Address(),
+				InitiatorChannelAccount: localChannelAccount.Address(),
+				ResponderChannelAccount: remoteChannelAccount.Address(),
+				StartSequence:           28037546508289,
+				Asset:                   txnbuild.NativeAsset{},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	localTransactionsStream <- openTxStreamed
+	remoteTransactionsStream <- openTxStreamed
+	assert.IsType(t, ChannelTxObservedEvent{}, <-localEvents)
+	assert.IsType(t, ChannelTxObservedEvent{}, <-remoteEvents)
+	<-localEvents
+	<-remoteEvents
+
+	// Restore the local agent from a snapshot, without a connection, with a
+	// submitter that records submitted txs.
+	localDeclTx, localCloseTx, err := localAgent.channel.CloseTxs()
+	require.NoError(t, err)
+	localDeclTxHash, err := localDeclTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	localCloseTxHash, err := localCloseTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	restoredSubmittedTxs := make(chan string, 10)
+	restoredTransactionsStream := make(chan StreamedTransaction)
+	restoredConfig := localConfig
+	restoredConfig.Submitter = submitterFunc(func(tx *txnbuild.Transaction) error {
+		hash, err := tx.HashHex(network.TestNetworkPassphrase)
+		if err != nil {
+			return err
+		}
+		restoredSubmittedTxs <- hash
+		return nil
+	})
+	restoredConfig.Streamer = streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+		// Expect streaming to resume from the open tx for both channel
+		// accounts.
+		assert.Equal(t, "1", cursor)
+		assert.Equal(t, []*keypair.FromAddress{localChannelAccount, remoteChannelAccount}, accounts)
+		return restoredTransactionsStream, func() {}
+	})
+	var restoredSnapshot Snapshot
+	restoredConfig.Snapshotter = snapshotterFunc(func(a *Agent, s Snapshot) {
+		restoredSnapshot = s
+	})
+	restoredAgent := NewAgentFromSnapshot(restoredConfig, localAgent.buildSnapshot())
+	require.Nil(t, restoredAgent.conn)
+
+	// Force close, and expect the declaration tx to be submitted.
+	err = restoredAgent.ForceClose()
+	require.NoError(t, err)
+	assert.Equal(t, localDeclTxHash, <-restoredSubmittedTxs)
+
+	// Ingest the declaration tx, as if it was processed on network in a
+	// ledger that closed after the observation period started.
+	localDeclTxXDR, err := localDeclTx.Base64()
+	require.NoError(t, err)
+	restoredTransactionsStream <- StreamedTransaction{
+		LedgerSequence:  2,
+		LedgerCloseTime: time.Now().Add(-time.Minute),
+		TransactionXDR:  localDeclTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{
+				{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId: xdr.MustAddress(localChannelAccount.Address()),
+						SeqNum:    xdr.SequenceNumber(localDeclTx.SequenceNumber()),
+						Signers: []xdr.Signer{
+							{Key: xdr.MustSigner(localSigner.Address()), Weight: 1},
+							{Key: xdr.MustSigner(remoteSigner.Address()), Weight: 1},
+						},
+						Thresholds: xdr.Thresholds{0, 2, 2, 2},
+					},
+				},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeDeclaration, localObservedEvent.Tx.Type)
+		assert.True(t, localObservedEvent.Successful)
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.Equal(t, ClosingEvent{}, localEvent)
+	}
+
+	// Expect the close tx to be submitted once a ledger after the ledger gap
+	// is observed.
+	restoredTransactionsStream <- StreamedTransaction{LedgerSequence: 3, LedgerCloseTime: time.Now()}
+	assert.Equal(t, localCloseTxHash, <-restoredSubmittedTxs)
+
+	// Restore another agent from the snapshot taken after the declaration
+	// was ingested, and expect force close to schedule the close without
+	// resubmitting the declaration.
+	restoredAgainConfig := restoredConfig
+	restoredAgainConfig.Streamer = streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+		return make(chan StreamedTransaction), func() {}
+	})
+	restoredAgainConfig.Snapshotter = nil
+	restoredAgainConfig.Events = nil
+	restoredAgain := NewAgentFromSnapshot(restoredAgainConfig, restoredSnapshot)
+	err = restoredAgain.ForceClose()
+	require.NoError(t, err)
+	restoredAgain.mu.Lock()
+	assert.NotNil(t, restoredAgain.closeTimer)
+	restoredAgain.stopScheduledClose()
+	restoredAgain.mu.Unlock()
+	select {
+	case hash := <-restoredSubmittedTxs:
+		t.Fatalf("unexpected tx submitted: %s", hash)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Ingest the close tx, as if it was processed on network.
+	localCloseTxXDR, err := localCloseTx.Base64()
+	require.NoError(t, err)
+	restoredTransactionsStream <- StreamedTransaction{
+		TransactionXDR: localCloseTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{
+				{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId: xdr.MustAddress(localChannelAccount.Address()),
+						SeqNum:    xdr.SequenceNumber(localCloseTx.SequenceNumber()),
+						Signers: []xdr.Signer{
+							{Key: xdr.MustSigner(localSigner.Address()), Weight: 1},
+						},
+						Thresholds: xdr.Thresholds{0, 1, 1, 1},
+					},
+				},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		localObservedEvent, ok := localEvent.(ChannelTxObservedEvent)
+		require.True(t, ok)
+		assert.Equal(t, txbuild.TransactionTypeClose, localObservedEvent.Tx.Type)
+		assert.True(t, localObservedEvent.Successful)
+	}
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.Equal(t, ClosedEvent{}, localEvent)
+	}
+
+	// Expect force close to fail once the channel is closed.
+	err = restoredAgent.ForceClose()
+	require.EqualError(t, err, "channel is already closed")
+}
+
+func TestAgent_scheduleClose_waitsForLedgerGapAndTime(t *testing.T) {
+	localChannel, closeTx := newClosingTestChannel(t)
+	closeTxHash, err := closeTx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+
+	submittedTxs := make(chan string, 1)
+	txs := make(chan StreamedTransaction, 1)
+	agent := &Agent{
+		networkPassphrase: network.TestNetworkPassphrase,
+		submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			hash, err := tx.HashHex(network.TestNetworkPassphrase)
+			if err != nil {
+				return err
+			}
+			submittedTxs <- hash
+			return nil
+		}),
+		logWriter:            io.Discard,
+		channel:              localChannel,
+		streamerTransactions: txs,
+	}
+	expectNoSubmission := func() {
+		select {
+		case hash := <-submittedTxs:
+			t.Fatalf("unexpected tx submitted: %s", hash)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// The ledger gap is 1, so a declaration in ledger 2 is not ready until
+	// ledger 3 is observed, even though its observation period time passed.
+	agent.mu.Lock()
+	agent.scheduleClose(StreamedTransaction{LedgerSequence: 2, LedgerCloseTime: time.Now().Add(-time.Minute)})
+	agent.mu.Unlock()
+	expectNoSubmission()
+	txs <- StreamedTransaction{LedgerSequence: 3, LedgerCloseTime: time.Now()}
+	require.NoError(t, agent.ingest(txs))
+	assert.Equal(t, closeTxHash, <-submittedTxs)
+
+	// A declaration whose observation period time has not passed is not ready
+	// when the ledger gap has passed, and waits on the time.
+	agent.mu.Lock()
+	agent.scheduleClose(StreamedTransaction{LedgerSequence: 2, LedgerCloseTime: time.Now().Add(time.Hour)})
+	assert.True(t, agent.closePending)
+	assert.NotNil(t, agent.closeTimer)
+	agent.stopScheduledClose()
+	agent.mu.Unlock()
+	expectNoSubmission()
+
+	// A declaration in an unknown ledger is ready once a ledger after the
+	// ledger gap from the next ledger observed is observed.
+	agent.mu.Lock()
+	agent.scheduleClose(StreamedTransaction{})
+	agent.mu.Unlock()
+	txs <- StreamedTransaction{LedgerSequence: 4}
+	require.NoError(t, agent.ingest(txs))
+	expectNoSubmission()
+	txs <- StreamedTransaction{LedgerSequence: 5}
+	require.NoError(t, agent.ingest(txs))
+	assert.Equal(t, closeTxHash, <-submittedTxs)
+}
@@ -1,7 +1,10 @@
 package agent
 
 import (
+	"time"
+
 	"github.com/stellar/go/keypair"
+	"github.com/stellar/starlight/sdk/agent/msg"
 	"github.com/stellar/starlight/sdk/state"
 )
 
@@ -45,3 +48,60 @@ type ClosingWithOutdatedStateEvent struct{}
 
 // ClosedEvent occurs when the channel is successfully closed.
 type ClosedEvent struct{}
+
+// OpenRejectedEvent occurs when an open proposed by the agent is rejected by
+// the other participant. The event contains the reason for the rejection, and
+// optionally a counter-proposal that the other participant would accept,
+// which can be proposed with OpenWithCounterProposal.
+type OpenRejectedEvent struct {
+	Reason          msg.RejectReason
+	Message         string
+	CounterProposal *msg.OpenCounterProposal
+}
+
+// PaymentRejectedEvent occurs when a payment proposed by the agent is rejected
+// by the other participant. The rejected agreement is discarded so that
+// another payment can be proposed.
+type PaymentRejectedEvent struct {
+	CloseAgreement state.CloseAgreement
+	Reason         msg.RejectReason
+	Message        string
+}
+
+// CloseRejectedEvent occurs when a coordinated close proposed by the agent is
+// rejected by the other participant. The channel can still be closed by
+// calling Close after the observation period.
+type CloseRejectedEvent struct {
+	Reason  msg.RejectReason
+	Message string
+}
+
+// ChannelTxObservedEvent occurs when one of the channel's transactions is
+// observed on the network, whether it succeeded or failed. A failed declaration
+// or close does not progress the state of the channel, and is followed by a
+// CloseFailedEvent.
+type ChannelTxObservedEvent struct {
+	Tx                 state.ChannelTx
+	Successful         bool
+	ResultCodes        []string
+	TransactionOrderID int64
+	LedgerSequence     uint32
+	LedgerCloseTime    time.Time
+}
+
+// CloseFailedEvent occurs when a declaration or close transaction of the
+// channel is observed to have failed on the network. The channel stays open
+// after a failed declaration, and stays closing after a failed close, in which
+// case the close is resubmitted.
+type CloseFailedEvent struct {
+	Tx          state.ChannelTx
+	ResultCodes []string
+}
+
+// ChannelCompromisedEvent occurs when a change to one of the channel accounts,
+// or to its trustline for the channel's asset, is observed after the channel
+// opened that leaves the account in a state other than the state validated at
+// open, such as a signer being added or the trustline being deauthorized.
+type ChannelCompromisedEvent struct {
+	Compromise state.Compromise
+}
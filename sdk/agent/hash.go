@@ -6,15 +6,18 @@ import (
 	"github.com/stellar/go/txnbuild"
 )
 
+// hashTx returns the hash of the transaction, or of the inner transaction if
+// the transaction is a fee bump, which is the hash the channel's agreements
+// refer to.
 func hashTx(txXDR, networkPassphrase string) (string, error) {
 	tx, err := txnbuild.TransactionFromXDR(txXDR)
 	if err != nil {
 		return "", fmt.Errorf("parsing transaction xdr: %w", err)
 	}
 	if feeBump, ok := tx.FeeBump(); ok {
-		hash, err := feeBump.HashHex(networkPassphrase)
+		hash, err := feeBump.InnerTransaction().HashHex(networkPassphrase)
 		if err != nil {
-			return "", fmt.Errorf("hashing fee bump tx: %w", err)
+			return "", fmt.Errorf("hashing fee bump inner tx: %w", err)
 		}
 		return hash, nil
 	}
@@ -0,0 +1,53 @@
+package horizon
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/starlight/sdk/agent/provision"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+var _ provision.AccountCollector = &AccountCollector{}
+
+// AccountCollector implements a provisioner's interface for collecting the
+// signers and trustlines of an account by querying Horizon's accounts
+// endpoint.
+type AccountCollector struct {
+	HorizonClient horizonclient.ClientInterface
+}
+
+// GetAccount queries Horizon for the signers and trustlines of the given
+// account, returning provision.ErrAccountNotFound if Horizon does not know of
+// the account.
+func (h *AccountCollector) GetAccount(accountID *keypair.FromAddress) (provision.Account, error) {
+	account, err := h.HorizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: accountID.Address()})
+	if horizonclient.IsNotFoundError(err) {
+		return provision.Account{}, provision.ErrAccountNotFound
+	}
+	if err != nil {
+		return provision.Account{}, fmt.Errorf("getting account details of %s: %w", accountID.Address(), err)
+	}
+	a := provision.Account{
+		LowThreshold:    account.Thresholds.LowThreshold,
+		MediumThreshold: account.Thresholds.MedThreshold,
+		HighThreshold:   account.Thresholds.HighThreshold,
+		Signers:         map[string]int32{},
+		TrustLines:      map[state.Asset]bool{},
+	}
+	for _, s := range account.Signers {
+		if s.Key == accountID.Address() {
+			a.MasterWeight = byte(s.Weight)
+			continue
+		}
+		a.Signers[s.Key] = s.Weight
+	}
+	for _, b := range account.Balances {
+		if b.Asset.Type == "native" || b.LiquidityPoolId != "" {
+			continue
+		}
+		a.TrustLines[balanceAsset(b)] = b.IsAuthorized != nil && *b.IsAuthorized
+	}
+	return a, nil
+}
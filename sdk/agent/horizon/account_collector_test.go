@@ -0,0 +1,69 @@
+package horizon
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/go/support/render/problem"
+	"github.com/stellar/starlight/sdk/agent/provision"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountCollector(t *testing.T) {
+	accountID := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	signer := "GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO"
+	issuer := "GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3"
+	authorized := true
+	unauthorized := false
+
+	hc := &horizonclient.MockClient{}
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{
+		Thresholds: horizon.AccountThresholds{LowThreshold: 1, MedThreshold: 2, HighThreshold: 3},
+		Signers: []horizon.Signer{
+			{Key: signer, Weight: 1},
+			{Key: accountID.Address(), Weight: 0},
+		},
+		Balances: []horizon.Balance{
+			{
+				LiquidityPoolId: "dd7b1ab831c273310ddbec6f97870aa83c2fbd78ce22aded37ecbf4f3380fac7",
+				Asset:           base.Asset{Type: "liquidity_pool_shares"},
+			},
+			{IsAuthorized: &authorized, Asset: base.Asset{Type: "credit_alphanum4", Code: "ABCD", Issuer: issuer}},
+			{IsAuthorized: &unauthorized, Asset: base.Asset{Type: "credit_alphanum4", Code: "EFGH", Issuer: issuer}},
+			{Asset: base.Asset{Type: "native"}},
+		},
+	}, nil).Once()
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{}, &horizonclient.Error{
+		Problem: problem.P{Type: "https://stellar.org/horizon-errors/not_found", Status: http.StatusNotFound},
+	}).Once()
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{}, errors.New("unavailable")).Once()
+
+	c := AccountCollector{HorizonClient: hc}
+
+	account, err := c.GetAccount(accountID)
+	require.NoError(t, err)
+	assert.Equal(t, provision.Account{
+		MasterWeight:    0,
+		LowThreshold:    1,
+		MediumThreshold: 2,
+		HighThreshold:   3,
+		Signers:         map[string]int32{signer: 1},
+		TrustLines: map[state.Asset]bool{
+			state.Asset("ABCD:" + issuer): true,
+			state.Asset("EFGH:" + issuer): false,
+		},
+	}, account)
+
+	_, err = c.GetAccount(accountID)
+	assert.ErrorIs(t, err, provision.ErrAccountNotFound)
+
+	_, err = c.GetAccount(accountID)
+	assert.EqualError(t, err, "getting account details of GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36: unavailable")
+}
@@ -20,21 +20,62 @@ type BalanceCollector struct {
 }
 
 // GetBalance queries Horizon for the balance of the given asset on the given
-// account.
+// account. The balance is the balance available for spending, which is the
+// balance less any selling liabilities. If the account does not hold the asset
+// the balance is zero.
 func (h *BalanceCollector) GetBalance(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
-	var account horizon.Account
+	balances, err := h.GetBalances(accountID)
+	if err != nil {
+		return 0, err
+	}
+	return balances[state.Asset(asset.StringCanonical())], nil
+}
+
+// GetBalances queries Horizon for the balances of all assets held by the given
+// account, keyed by the canonical form of each asset. The balances are the
+// balances available for spending, which are the balances less any selling
+// liabilities. Liquidity pool shares are not included.
+func (h *BalanceCollector) GetBalances(accountID *keypair.FromAddress) (map[state.Asset]int64, error) {
 	account, err := h.HorizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: accountID.Address()})
 	if err != nil {
-		return 0, fmt.Errorf("getting account details of %s: %w", accountID, err)
+		return nil, fmt.Errorf("getting account details of %s: %w", accountID.Address(), err)
 	}
+	balances := make(map[state.Asset]int64, len(account.Balances))
 	for _, b := range account.Balances {
-		if b.Asset.Code == asset.Code() || b.Asset.Issuer == asset.Issuer() {
-			balance, err := amount.ParseInt64(account.Balances[0].Balance)
-			if err != nil {
-				return 0, fmt.Errorf("parsing %s balance of %s: %w", asset, accountID, err)
-			}
-			return balance, nil
+		if b.LiquidityPoolId != "" {
+			continue
 		}
+		asset := balanceAsset(b)
+		balance, err := availableBalance(b)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s balance of %s: %w", asset, accountID.Address(), err)
+		}
+		balances[asset] = balance
+	}
+	return balances, nil
+}
+
+// balanceAsset returns the asset of the balance in canonical form.
+func balanceAsset(b horizon.Balance) state.Asset {
+	if b.Asset.Type == "native" {
+		return state.NativeAsset
+	}
+	return state.Asset(b.Asset.Code + ":" + b.Asset.Issuer)
+}
+
+// availableBalance returns the balance available for spending, as calculated
+// by state.AvailableBalance.
+func availableBalance(b horizon.Balance) (int64, error) {
+	balance, err := amount.ParseInt64(b.Balance)
+	if err != nil {
+		return 0, err
+	}
+	if b.SellingLiabilities == "" {
+		return balance, nil
+	}
+	sellingLiabilities, err := amount.ParseInt64(b.SellingLiabilities)
+	if err != nil {
+		return 0, fmt.Errorf("parsing selling liabilities: %w", err)
 	}
-	return 0, nil
+	return state.AvailableBalance(balance, sellingLiabilities), nil
 }
@@ -0,0 +1,143 @@
+package horizon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalanceCollector(t *testing.T) {
+	accountID := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	issuer1 := "GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO"
+	issuer2 := "GBPPEHGF322UNA62WHRHBCUBCVOIT3SLUY7U7XGEEISZIJJUD3IUBLC4"
+
+	hc := &horizonclient.MockClient{}
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{
+		Balances: []horizon.Balance{
+			{
+				Balance:         "5.0000000",
+				LiquidityPoolId: "dd7b1ab831c273310ddbec6f97870aa83c2fbd78ce22aded37ecbf4f3380fac7",
+				Asset:           base.Asset{Type: "liquidity_pool_shares"},
+			},
+			{
+				Balance:            "100.0000000",
+				SellingLiabilities: "10.0000000",
+				Asset:              base.Asset{Type: "credit_alphanum4", Code: "ABCD", Issuer: issuer1},
+			},
+			{
+				Balance:            "200.0000000",
+				SellingLiabilities: "0.0000000",
+				Asset:              base.Asset{Type: "credit_alphanum4", Code: "ABCD", Issuer: issuer2},
+			},
+			{
+				Balance:            "300.0000000",
+				SellingLiabilities: "0.0000000",
+				Asset:              base.Asset{Type: "credit_alphanum12", Code: "ABCDEFGH", Issuer: issuer1},
+			},
+			{
+				Balance:            "1000.0000000",
+				SellingLiabilities: "1.5000000",
+				Asset:              base.Asset{Type: "native"},
+			},
+		},
+	}, nil)
+
+	bc := BalanceCollector{HorizonClient: hc}
+
+	balances, err := bc.GetBalances(accountID)
+	require.NoError(t, err)
+	assert.Equal(t, map[state.Asset]int64{
+		state.NativeAsset:                  998_500_0000,
+		state.Asset("ABCD:" + issuer1):     90_000_0000,
+		state.Asset("ABCD:" + issuer2):     200_000_0000,
+		state.Asset("ABCDEFGH:" + issuer1): 300_000_0000,
+	}, balances)
+
+	testCases := []struct {
+		asset   state.Asset
+		balance int64
+	}{
+		{state.NativeAsset, 998_500_0000},
+		{state.Asset(""), 998_500_0000},
+		{state.Asset("ABCD:" + issuer1), 90_000_0000},
+		{state.Asset("ABCD:" + issuer2), 200_000_0000},
+		{state.Asset("ABCDEFGH:" + issuer1), 300_000_0000},
+		{state.Asset("EFGH:" + issuer1), 0},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.asset), func(t *testing.T) {
+			balance, err := bc.GetBalance(accountID, tc.asset)
+			require.NoError(t, err)
+			assert.Equal(t, tc.balance, balance)
+		})
+	}
+}
+
+func TestBalanceCollector_availableBalance(t *testing.T) {
+	accountID := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	issuer := "GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO"
+
+	// The available balance is the same as calculated from the same balances
+	// ingested by a channel.
+	for _, b := range txbuildtest.BalancesWithLiabilities {
+		hc := &horizonclient.MockClient{}
+		hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{
+			Balances: []horizon.Balance{
+				{
+					Balance:            amount.StringFromInt64(b.Balance),
+					BuyingLiabilities:  amount.StringFromInt64(b.BuyingLiabilities),
+					SellingLiabilities: amount.StringFromInt64(b.SellingLiabilities),
+					Asset:              base.Asset{Type: "native"},
+				},
+				{
+					Balance:            amount.StringFromInt64(b.Balance),
+					BuyingLiabilities:  amount.StringFromInt64(b.BuyingLiabilities),
+					SellingLiabilities: amount.StringFromInt64(b.SellingLiabilities),
+					Asset:              base.Asset{Type: "credit_alphanum4", Code: "TEST", Issuer: issuer},
+				},
+			},
+		}, nil)
+
+		bc := BalanceCollector{HorizonClient: hc}
+		balances, err := bc.GetBalances(accountID)
+		require.NoError(t, err)
+		assert.Equal(t, map[state.Asset]int64{
+			state.NativeAsset:             b.Available,
+			state.Asset("TEST:" + issuer): b.Available,
+		}, balances)
+	}
+}
+
+func TestBalanceCollector_errors(t *testing.T) {
+	accountID := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+
+	hc := &horizonclient.MockClient{}
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{}, errors.New("not found")).Once()
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: accountID.Address()}).Return(horizon.Account{
+		Balances: []horizon.Balance{
+			{
+				Balance:            "1000.0000000",
+				SellingLiabilities: "abc",
+				Asset:              base.Asset{Type: "native"},
+			},
+		},
+	}, nil).Once()
+
+	bc := BalanceCollector{HorizonClient: hc}
+
+	_, err := bc.GetBalance(accountID, state.NativeAsset)
+	assert.EqualError(t, err, "getting account details of GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36: not found")
+
+	_, err = bc.GetBalance(accountID, state.NativeAsset)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "parsing native balance of GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36: parsing selling liabilities:")
+}
@@ -0,0 +1,40 @@
+package horizon
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent"
+)
+
+var _ agent.IssuerFlagsCollector = &IssuerFlagsCollector{}
+
+// IssuerFlagsCollector implements an agent's interface for collecting the
+// flags of an asset's issuer by querying Horizon's accounts endpoint.
+type IssuerFlagsCollector struct {
+	HorizonClient horizonclient.ClientInterface
+}
+
+// GetIssuerFlags queries Horizon for the flags of the given issuer account.
+func (h *IssuerFlagsCollector) GetIssuerFlags(issuer *keypair.FromAddress) (xdr.AccountFlags, error) {
+	account, err := h.HorizonClient.AccountDetail(horizonclient.AccountRequest{AccountID: issuer.Address()})
+	if err != nil {
+		return 0, fmt.Errorf("getting account details of %s: %w", issuer.Address(), err)
+	}
+	var flags xdr.AccountFlags
+	if account.Flags.AuthRequired {
+		flags |= xdr.AccountFlagsAuthRequiredFlag
+	}
+	if account.Flags.AuthRevocable {
+		flags |= xdr.AccountFlagsAuthRevocableFlag
+	}
+	if account.Flags.AuthImmutable {
+		flags |= xdr.AccountFlagsAuthImmutableFlag
+	}
+	if account.Flags.AuthClawbackEnabled {
+		flags |= xdr.AccountFlagsAuthClawbackEnabledFlag
+	}
+	return flags, nil
+}
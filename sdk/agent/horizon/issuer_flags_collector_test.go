@@ -0,0 +1,37 @@
+package horizon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerFlagsCollector(t *testing.T) {
+	issuer := keypair.MustParseAddress("GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+
+	hc := &horizonclient.MockClient{}
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: issuer.Address()}).Return(horizon.Account{
+		Flags: horizon.AccountFlags{AuthRequired: true, AuthRevocable: true, AuthClawbackEnabled: true},
+	}, nil).Once()
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: issuer.Address()}).Return(horizon.Account{}, nil).Once()
+	hc.On("AccountDetail", horizonclient.AccountRequest{AccountID: issuer.Address()}).Return(horizon.Account{}, errors.New("not found")).Once()
+
+	c := IssuerFlagsCollector{HorizonClient: hc}
+
+	flags, err := c.GetIssuerFlags(issuer)
+	require.NoError(t, err)
+	assert.Equal(t, xdr.AccountFlagsAuthRequiredFlag|xdr.AccountFlagsAuthRevocableFlag|xdr.AccountFlagsAuthClawbackEnabledFlag, flags)
+
+	flags, err = c.GetIssuerFlags(issuer)
+	require.NoError(t, err)
+	assert.Equal(t, xdr.AccountFlags(0), flags)
+
+	_, err = c.GetIssuerFlags(issuer)
+	assert.EqualError(t, err, "getting account details of GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3: not found")
+}
@@ -2,12 +2,15 @@ package horizon
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"strconv"
 	"sync"
 
 	"github.com/stellar/go/clients/horizonclient"
 	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/toid"
 	"github.com/stellar/starlight/sdk/agent"
 )
 
@@ -16,22 +19,33 @@ var _ agent.Streamer = &Streamer{}
 // Streamer implements the agent's interface for streaming transactions that
 // affect a set of accounts, by using the streaming endpoints of Horizon's API
 // to collect new transactions as they occur.
+//
+// Errors streaming are given to the ErrorHandler if set, and logged to the
+// Logger if set.
 type Streamer struct {
 	HorizonClient horizonclient.ClientInterface
 	ErrorHandler  func(error)
+	Logger        agent.Logger
 }
 
 // StreamTx streams transactions that affect the given accounts, sending each
 // transaction to the txs channel returned. StreamTx can be stopped by calling
-// the cancel function returned. If multiple accounts are given the same
-// transaction it may be broadcasted in duplicate if the transaction affects more
-// than one account being monitored. The given cursor suppors resuming a
-// previous stream.
+// the cancel function returned. The given cursor supports resuming a previous
+// stream.
+//
+// The transactions of each account are streamed separately and merged, and a
+// transaction that affects more than one of the accounts is sent only once.
+// The cursor of each streamed transaction is the earliest point that all
+// accounts have been streamed up to, so resuming from it may stream some
+// transactions again but will not miss any. An empty cursor streams each
+// account from its first transaction, and until every account has streamed a
+// transaction the cursor of streamed transactions remains empty. A cursor of
+// "now" is resolved to the end of the latest ledger ingested by Horizon.
+//
+// Ledgers that close while streaming the accounts are reported with a
+// StreamedTransaction that only has the ledger's sequence and close time.
 //
-// TODO: Improve StreamTx so that it only streams transactions that affect the
-// given accounts. At the moment, to reduce complexity and due to limitations in
-// Horizon, it streams all network transactions. See
-// https://github.com/stellar/go/issues/3874.
+// If no accounts are given all network transactions are streamed.
 func (h *Streamer) StreamTx(cursor string, accounts ...*keypair.FromAddress) (txs <-chan agent.StreamedTransaction, cancel func()) {
 	// txsCh is the channel that streamed transactions will be written to.
 	txsCh := make(chan agent.StreamedTransaction)
@@ -39,11 +53,22 @@ func (h *Streamer) StreamTx(cursor string, accounts ...*keypair.FromAddress) (tx
 	// cancelCh will be used to signal the streamer to stop.
 	cancelCh := make(chan struct{})
 
+	addresses := make([]string, len(accounts))
+	for i, a := range accounts {
+		addresses[i] = a.Address()
+	}
+	h.log().Info("streaming txs", "cursor", cursor, "accounts", addresses)
+
 	// Start a streamer that will write txs and stop when
 	// signaled to cancel.
 	go func() {
 		defer close(txsCh)
-		h.streamTx(cursor, txsCh, cancelCh)
+		defer h.log().Info("streaming txs stopped", "accounts", addresses)
+		if len(accounts) == 0 {
+			h.streamAllTx(cursor, txsCh, cancelCh)
+		} else {
+			h.streamAccountsTx(cursor, accounts, txsCh, cancelCh)
+		}
 	}()
 
 	cancelOnce := sync.Once{}
@@ -55,45 +80,252 @@ func (h *Streamer) StreamTx(cursor string, accounts ...*keypair.FromAddress) (tx
 	return txsCh, cancel
 }
 
-func (h *Streamer) streamTx(cursor string, txs chan<- agent.StreamedTransaction, cancel <-chan struct{}) {
+func (h *Streamer) streamAllTx(cursor string, txs chan<- agent.StreamedTransaction, cancel <-chan struct{}) {
+	req := horizonclient.TransactionRequest{Cursor: cursor}
+	h.streamTx(req, cancel, func(tx horizon.Transaction) bool {
+		txOrderID, err := strconv.ParseInt(tx.PagingToken(), 10, 64)
+		if err != nil {
+			h.handleError(err)
+			return false
+		}
+		select {
+		case <-cancel:
+			return false
+		case txs <- streamedTx(tx, tx.PagingToken(), txOrderID):
+			return true
+		}
+	})
+}
+
+func (h *Streamer) streamAccountsTx(cursor string, accounts []*keypair.FromAddress, txs chan<- agent.StreamedTransaction, cancel <-chan struct{}) {
+	// done is closed when merging stops, either because the stream was
+	// canceled or an error occurred, to stop the account streams.
+	done := make(chan struct{})
+	defer close(done)
+
+	type accountTx struct {
+		index int
+		tx    horizon.Transaction
+	}
+	// cursors holds the transaction order ID that each account has been
+	// streamed up to, and known holds whether each is known. If the starting cursor is
+	// not a transaction order ID, such as an empty cursor, the cursor of each
+	// account is unknown until the account's first transaction is streamed.
+	cursor = h.resolveCursor(cursor)
+	cursors := make([]int64, len(accounts))
+	known := make([]bool, len(accounts))
+	if startTxOrderID, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+		for i := range cursors {
+			cursors[i] = startTxOrderID
+			known[i] = true
+		}
+	}
+
+	ledgers := make(chan horizon.Ledger)
+	go h.streamLedgers(done, func(l horizon.Ledger) bool {
+		select {
+		case <-done:
+			return false
+		case ledgers <- l:
+			return true
+		}
+	})
+
+	accountTxs := make(chan accountTx)
+	for i, a := range accounts {
+		i := i
+		req := horizonclient.TransactionRequest{ForAccount: a.Address(), Cursor: cursor}
+		go h.streamTx(req, done, func(tx horizon.Transaction) bool {
+			select {
+			case <-done:
+				return false
+			case accountTxs <- accountTx{index: i, tx: tx}:
+				return true
+			}
+		})
+	}
+
+	// seen holds the transactions already sent that could still be streamed
+	// for another account.
+	seen := map[int64]struct{}{}
+
+	for {
+		var atx accountTx
+		select {
+		case <-cancel:
+			return
+		case l := <-ledgers:
+			select {
+			case <-cancel:
+				return
+			case txs <- agent.StreamedTransaction{LedgerSequence: uint32(l.Sequence), LedgerCloseTime: l.ClosedAt}:
+			}
+			continue
+		case atx = <-accountTxs:
+		}
+
+		txOrderID, err := strconv.ParseInt(atx.tx.PagingToken(), 10, 64)
+		if err != nil {
+			h.handleError(err)
+			return
+		}
+		if !known[atx.index] || txOrderID > cursors[atx.index] {
+			cursors[atx.index] = txOrderID
+			known[atx.index] = true
+		}
+
+		_, duplicate := seen[txOrderID]
+
+		// Transactions at or before the earliest cursor have been streamed
+		// for every account and will not be streamed again. While the cursor
+		// of any account is unknown, the earliest cursor is unknown and the
+		// starting cursor is the only safe point to resume from.
+		minCursor, minCursorKnown := int64(0), true
+		for i, c := range cursors {
+			if !known[i] {
+				minCursorKnown = false
+				break
+			}
+			if i == 0 || c < minCursor {
+				minCursor = c
+			}
+		}
+		if minCursorKnown {
+			for id := range seen {
+				if id <= minCursor {
+					delete(seen, id)
+				}
+			}
+		}
+
+		if duplicate {
+			continue
+		}
+		if !minCursorKnown || txOrderID > minCursor {
+			seen[txOrderID] = struct{}{}
+		}
+
+		txCursor := cursor
+		if minCursorKnown {
+			txCursor = strconv.FormatInt(minCursor, 10)
+		}
+		select {
+		case <-cancel:
+			return
+		case txs <- streamedTx(atx.tx, txCursor, txOrderID):
+		}
+	}
+}
+
+// resolveCursor resolves a cursor of "now" to the transaction order ID at the
+// end of the latest ledger ingested by Horizon, so that the point each account
+// has been streamed up to is known from the start. Any other cursor, or a
+// cursor that cannot be resolved, is returned unchanged.
+func (h *Streamer) resolveCursor(cursor string) string {
+	if cursor != "now" {
+		return cursor
+	}
+	root, err := h.HorizonClient.Root()
+	if err != nil {
+		h.handleError(fmt.Errorf("resolving cursor now: %w", err))
+		return cursor
+	}
+	return strconv.FormatInt(toid.New(root.HorizonSequence+1, 0, 0).ToInt64()-1, 10)
+}
+
+// streamTx streams the transactions matching the request, calling send with
+// each transaction. If send returns false streaming stops. If an error occurs
+// streaming is resumed from the last transaction sent. Streaming stops when
+// cancel is closed.
+func (h *Streamer) streamTx(req horizonclient.TransactionRequest, cancel <-chan struct{}, send func(tx horizon.Transaction) bool) {
 	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
 	go func() {
-		<-cancel
-		ctxCancel()
+		select {
+		case <-cancel:
+			ctxCancel()
+		case <-ctx.Done():
+		}
 	}()
 	for {
-		req := horizonclient.TransactionRequest{
-			Cursor: cursor,
-		}
+		stopped := false
 		err := h.HorizonClient.StreamTransactions(ctx, req, func(tx horizon.Transaction) {
-			pagingToken := tx.PagingToken()
-			txOrderID, err := strconv.ParseInt(pagingToken, 10, 64)
-			if err != nil {
+			if stopped {
+				return
+			}
+			if !send(tx) {
+				stopped = true
 				ctxCancel()
-				if h.ErrorHandler != nil {
-					h.ErrorHandler(err)
-				}
 				return
 			}
-			cursor = pagingToken
-			streamedTx := agent.StreamedTransaction{
-				Cursor:             cursor,
-				TransactionOrderID: txOrderID,
-				TransactionXDR:     tx.EnvelopeXdr,
-				ResultXDR:          tx.ResultXdr,
-				ResultMetaXDR:      tx.ResultMetaXdr,
+			req.Cursor = tx.PagingToken()
+		})
+		if err == nil || stopped || ctx.Err() != nil {
+			break
+		}
+		h.handleError(err)
+		h.log().Info("resuming streaming txs", "account", req.ForAccount, "cursor", req.Cursor)
+	}
+}
+
+// streamLedgers streams the ledgers that close from now on, calling send with
+// each ledger. If send returns false streaming stops. If an error occurs
+// streaming is resumed from the last ledger sent. Streaming stops when cancel
+// is closed.
+func (h *Streamer) streamLedgers(cancel <-chan struct{}, send func(l horizon.Ledger) bool) {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+	go func() {
+		select {
+		case <-cancel:
+			ctxCancel()
+		case <-ctx.Done():
+		}
+	}()
+	req := horizonclient.LedgerRequest{Cursor: "now"}
+	for {
+		stopped := false
+		err := h.HorizonClient.StreamLedgers(ctx, req, func(l horizon.Ledger) {
+			if stopped {
+				return
 			}
-			select {
-			case <-cancel:
+			if !send(l) {
+				stopped = true
 				ctxCancel()
-			case txs <- streamedTx:
+				return
 			}
+			req.Cursor = l.PagingToken()
 		})
-		if err == nil {
+		if err == nil || stopped || ctx.Err() != nil {
 			break
 		}
-		if h.ErrorHandler != nil {
-			h.ErrorHandler(err)
-		}
+		h.handleError(err)
+		h.log().Info("resuming streaming ledgers", "cursor", req.Cursor)
+	}
+}
+
+func (h *Streamer) handleError(err error) {
+	h.log().Warn("error streaming txs", "error", err)
+	if h.ErrorHandler != nil {
+		h.ErrorHandler(err)
+	}
+}
+
+func (h *Streamer) log() agent.Logger {
+	if h.Logger == nil {
+		return agent.NewTextLogger(io.Discard)
+	}
+	return h.Logger
+}
+
+func streamedTx(tx horizon.Transaction, cursor string, txOrderID int64) agent.StreamedTransaction {
+	return agent.StreamedTransaction{
+		Cursor:             cursor,
+		TransactionOrderID: txOrderID,
+		LedgerSequence:     uint32(tx.Ledger),
+		LedgerCloseTime:    tx.LedgerCloseTime,
+		TransactionXDR:     tx.EnvelopeXdr,
+		ResultXDR:          tx.ResultXdr,
+		ResultMetaXDR:      tx.ResultMetaXdr,
 	}
 }
@@ -3,11 +3,14 @@ package horizon
 import (
 	"context"
 	"errors"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stellar/go/clients/horizonclient"
 	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/toid"
 	"github.com/stellar/starlight/sdk/agent"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -17,7 +20,6 @@ func TestStreamer_StreamTx_longBlock(t *testing.T) {
 	client := &horizonclient.MockClient{}
 	h := Streamer{HorizonClient: client}
 
-	accountA := keypair.MustRandom()
 	client.On(
 		"StreamTransactions",
 		mock.Anything,
@@ -27,17 +29,19 @@ func TestStreamer_StreamTx_longBlock(t *testing.T) {
 		ctx := args[0].(context.Context)
 		handler := args[2].(horizonclient.TransactionHandler)
 		handler(horizon.Transaction{
-			PT:            "1",
-			EnvelopeXdr:   "a-txxdr",
-			ResultXdr:     "a-resultxdr",
-			ResultMetaXdr: "a-resultmetaxdr",
+			PT:              "1",
+			Ledger:          2,
+			LedgerCloseTime: time.Unix(3, 0).UTC(),
+			EnvelopeXdr:     "a-txxdr",
+			ResultXdr:       "a-resultxdr",
+			ResultMetaXdr:   "a-resultmetaxdr",
 		})
 		// Simulate long block on new data from Horizon.
 		<-ctx.Done()
 	})
 
 	t.Log("Streaming...")
-	txsCh, cancel := h.StreamTx("", accountA.FromAddress())
+	txsCh, cancel := h.StreamTx("")
 
 	// Pull streamed transactions into slice.
 	t.Log("Pulling some transactions from stream...")
@@ -51,6 +55,8 @@ func TestStreamer_StreamTx_longBlock(t *testing.T) {
 			{
 				Cursor:             "1",
 				TransactionOrderID: 1,
+				LedgerSequence:     2,
+				LedgerCloseTime:    time.Unix(3, 0).UTC(),
 				TransactionXDR:     "a-txxdr",
 				ResultXDR:          "a-resultxdr",
 				ResultMetaXDR:      "a-resultmetaxdr",
@@ -78,7 +84,6 @@ func TestStreamer_StreamTx_manyTxs(t *testing.T) {
 	client := &horizonclient.MockClient{}
 	h := Streamer{HorizonClient: client}
 
-	accountB := keypair.MustRandom()
 	client.On(
 		"StreamTransactions",
 		mock.Anything,
@@ -104,7 +109,7 @@ func TestStreamer_StreamTx_manyTxs(t *testing.T) {
 	})
 
 	t.Log("Streaming...")
-	txsCh, cancel := h.StreamTx("", accountB.FromAddress())
+	txsCh, cancel := h.StreamTx("")
 
 	// Pull streamed transactions into slice.
 	t.Log("Pulling some transactions from stream...")
@@ -159,8 +164,6 @@ func TestHorizonStreamer_StreamTx_error(t *testing.T) {
 		},
 	}
 
-	accountB := keypair.MustRandom()
-
 	// Simulate an error occuring while streaming.
 	client.On(
 		"StreamTransactions",
@@ -196,7 +199,7 @@ func TestHorizonStreamer_StreamTx_error(t *testing.T) {
 	}).Once()
 
 	t.Log("Streaming...")
-	txsCh, cancel := h.StreamTx("", accountB.FromAddress())
+	txsCh, cancel := h.StreamTx("")
 
 	// Pull streamed transactions into slice.
 	t.Log("Pulling some transactions from stream...")
@@ -236,3 +239,204 @@ func TestHorizonStreamer_StreamTx_error(t *testing.T) {
 	_, open := <-txsCh
 	assert.False(t, open, "txs channel not closed but should be after cancel called")
 }
+
+func TestStreamer_StreamTx_accounts(t *testing.T) {
+	client := &horizonclient.MockClient{}
+	h := Streamer{HorizonClient: client}
+	client.On("StreamLedgers", mock.Anything, horizonclient.LedgerRequest{Cursor: "now"}, mock.Anything).
+		Return(nil).Run(func(args mock.Arguments) { <-args[0].(context.Context).Done() })
+
+	accountA := keypair.MustRandom()
+	accountB := keypair.MustRandom()
+
+	// Stream transactions 1, 2 and 4 for account A, and 2 and 3 for account B,
+	// so that transaction 2 is streamed for both accounts.
+	aSent2 := make(chan struct{})
+	bSent3 := make(chan struct{})
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: accountA.Address(), Cursor: "0"},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		handler := args[2].(horizonclient.TransactionHandler)
+		handler(horizon.Transaction{PT: "1", EnvelopeXdr: "1-txxdr"})
+		handler(horizon.Transaction{PT: "2", EnvelopeXdr: "2-txxdr"})
+		close(aSent2)
+		<-bSent3
+		handler(horizon.Transaction{PT: "4", EnvelopeXdr: "4-txxdr"})
+		<-ctx.Done()
+	})
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: accountB.Address(), Cursor: "0"},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		handler := args[2].(horizonclient.TransactionHandler)
+		<-aSent2
+		handler(horizon.Transaction{PT: "2", EnvelopeXdr: "2-txxdr"})
+		handler(horizon.Transaction{PT: "3", EnvelopeXdr: "3-txxdr"})
+		close(bSent3)
+		<-ctx.Done()
+	})
+
+	t.Log("Streaming...")
+	txsCh, cancel := h.StreamTx("0", accountA.FromAddress(), accountB.FromAddress())
+
+	// Pull streamed transactions into slice.
+	t.Log("Pulling some transactions from stream...")
+	txs := []agent.StreamedTransaction{}
+	txs = append(txs, <-txsCh, <-txsCh, <-txsCh, <-txsCh)
+
+	// Check that each transaction is streamed once, with the cursor of the
+	// account that has been streamed the least.
+	assert.Equal(
+		t,
+		[]agent.StreamedTransaction{
+			{Cursor: "0", TransactionOrderID: 1, TransactionXDR: "1-txxdr"},
+			{Cursor: "0", TransactionOrderID: 2, TransactionXDR: "2-txxdr"},
+			{Cursor: "2", TransactionOrderID: 3, TransactionXDR: "3-txxdr"},
+			{Cursor: "3", TransactionOrderID: 4, TransactionXDR: "4-txxdr"},
+		},
+		txs,
+	)
+
+	// Cancel streaming, and check that multiple cancels are okay.
+	t.Log("Canceling...")
+	cancel()
+	cancel()
+
+	// Check that the transaction stream channel is closed.
+	_, open := <-txsCh
+	assert.False(t, open, "txs channel not closed but should be after cancel called")
+}
+
+func TestStreamer_StreamTx_accountsWithoutCursor(t *testing.T) {
+	client := &horizonclient.MockClient{}
+	h := Streamer{HorizonClient: client}
+	client.On("StreamLedgers", mock.Anything, horizonclient.LedgerRequest{Cursor: "now"}, mock.Anything).
+		Return(nil).Run(func(args mock.Arguments) { <-args[0].(context.Context).Done() })
+
+	accountA := keypair.MustRandom()
+	accountB := keypair.MustRandom()
+
+	aSent10 := make(chan struct{})
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: accountA.Address()},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		handler := args[2].(horizonclient.TransactionHandler)
+		handler(horizon.Transaction{PT: "10", EnvelopeXdr: "10-txxdr"})
+		close(aSent10)
+		<-ctx.Done()
+	})
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: accountB.Address()},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		handler := args[2].(horizonclient.TransactionHandler)
+		<-aSent10
+		handler(horizon.Transaction{PT: "5", EnvelopeXdr: "5-txxdr"})
+		handler(horizon.Transaction{PT: "12", EnvelopeXdr: "12-txxdr"})
+		<-ctx.Done()
+	})
+
+	txsCh, cancel := h.StreamTx("", accountA.FromAddress(), accountB.FromAddress())
+	defer cancel()
+
+	// Check that the cursor stays empty until account B has streamed a
+	// transaction, since account B's earlier transactions may not have been
+	// streamed yet.
+	assert.Equal(
+		t,
+		[]agent.StreamedTransaction{
+			{Cursor: "", TransactionOrderID: 10, TransactionXDR: "10-txxdr"},
+			{Cursor: "5", TransactionOrderID: 5, TransactionXDR: "5-txxdr"},
+			{Cursor: "10", TransactionOrderID: 12, TransactionXDR: "12-txxdr"},
+		},
+		[]agent.StreamedTransaction{<-txsCh, <-txsCh, <-txsCh},
+	)
+}
+
+func TestStreamer_StreamTx_accountsFromNow(t *testing.T) {
+	client := &horizonclient.MockClient{}
+	h := Streamer{HorizonClient: client}
+	client.On("StreamLedgers", mock.Anything, horizonclient.LedgerRequest{Cursor: "now"}, mock.Anything).
+		Return(nil).Run(func(args mock.Arguments) { <-args[0].(context.Context).Done() })
+
+	accountA := keypair.MustRandom()
+	accountB := keypair.MustRandom()
+
+	// The cursor now is resolved to the end of the latest ledger.
+	client.On("Root").Return(horizon.Root{HorizonSequence: 5}, nil)
+	cursor := strconv.FormatInt(toid.New(6, 0, 0).ToInt64()-1, 10)
+	txOrderID := toid.New(6, 1, 0).ToInt64()
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: accountA.Address(), Cursor: cursor},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		handler := args[2].(horizonclient.TransactionHandler)
+		handler(horizon.Transaction{PT: strconv.FormatInt(txOrderID, 10), EnvelopeXdr: "txxdr"})
+		<-ctx.Done()
+	})
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: accountB.Address(), Cursor: cursor},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		<-ctx.Done()
+	})
+
+	txsCh, cancel := h.StreamTx("now", accountA.FromAddress(), accountB.FromAddress())
+	defer cancel()
+
+	// Check that the cursor is where account B started streaming from.
+	assert.Equal(
+		t,
+		agent.StreamedTransaction{Cursor: cursor, TransactionOrderID: txOrderID, TransactionXDR: "txxdr"},
+		<-txsCh,
+	)
+}
+
+func TestStreamer_StreamTx_accountsLedgers(t *testing.T) {
+	client := &horizonclient.MockClient{}
+	h := Streamer{HorizonClient: client}
+
+	account := keypair.MustRandom()
+	closedAt := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	client.On("StreamLedgers", mock.Anything, horizonclient.LedgerRequest{Cursor: "now"}, mock.Anything).
+		Return(nil).Run(func(args mock.Arguments) {
+		ctx := args[0].(context.Context)
+		handler := args[2].(horizonclient.LedgerHandler)
+		handler(horizon.Ledger{Sequence: 7, ClosedAt: closedAt})
+		<-ctx.Done()
+	})
+	client.On(
+		"StreamTransactions",
+		mock.Anything,
+		horizonclient.TransactionRequest{ForAccount: account.Address(), Cursor: "0"},
+		mock.Anything,
+	).Return(nil).Run(func(args mock.Arguments) {
+		<-args[0].(context.Context).Done()
+	})
+
+	txsCh, cancel := h.StreamTx("0", account.FromAddress())
+	defer cancel()
+
+	// Check that closed ledgers are reported without a transaction.
+	assert.Equal(t, agent.StreamedTransaction{LedgerSequence: 7, LedgerCloseTime: closedAt}, <-txsCh)
+}
@@ -3,14 +3,19 @@ package agent
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent/submit"
+	"github.com/stellar/starlight/sdk/agent/trace"
 	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
 )
 
 var ingestingFinished = errors.New("ingesting finished")
 
-func (a *Agent) ingest() error {
-	tx, ok := <-a.streamerTransactions
+func (a *Agent) ingest(txs <-chan StreamedTransaction) (err error) {
+	tx, ok := <-txs
 	if !ok {
 		return ingestingFinished
 	}
@@ -18,13 +23,45 @@ func (a *Agent) ingest() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	txHash, err := hashTx(tx.TransactionXDR, a.networkPassphrase)
-	if err != nil {
+	// If the channel was reset while waiting for the transaction, the
+	// transaction is from the stream of a channel that no longer exists.
+	if a.channel == nil || txs != a.streamerTransactions {
+		return ingestingFinished
+	}
+
+	// A streamed transaction without a transaction reports a ledger that
+	// closed, which may end the observation period of a scheduled close.
+	a.observeLedger(tx)
+	if tx.TransactionXDR == "" {
+		a.closeIfReady()
+		return nil
+	}
+
+	txHash, hashErr := hashTx(tx.TransactionXDR, a.networkPassphrase)
+
+	// Trace the ingestion of a transaction the agent submitted as part of its
+	// submission, otherwise as a new trace.
+	parent := trace.SpanContext{}
+	if hashErr == nil {
+		parent = a.submittedTxSpans[txHash]
+		delete(a.submittedTxSpans, txHash)
+	}
+	span := trace.Start(a.tracer, "tx.ingest", parent)
+	span.SetAttributes("cursor", tx.Cursor)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if err = hashErr; err != nil {
 		err = fmt.Errorf("ingesting tx (cursor=%s): hashing tx: %w", tx.Cursor, err)
 		a.events <- ErrorEvent{Err: err}
 		return err
 	}
-	fmt.Fprintf(a.logWriter, "ingesting cursor: %s tx: %s\n", tx.Cursor, txHash)
+	a.log().Debug("ingesting tx", "cursor", tx.Cursor, "tx", txHash)
+	span.SetAttributes("tx", txHash)
 
 	stateBefore, err := a.channel.State()
 	if err != nil {
@@ -32,10 +69,22 @@ func (a *Agent) ingest() error {
 		a.events <- ErrorEvent{Err: err}
 		return err
 	}
-	fmt.Fprintf(a.logWriter, "state before: %v\n", stateBefore)
 
+	observed, err := a.observeTx(tx)
+	if err != nil {
+		err = fmt.Errorf("ingesting tx (cursor=%s hash=%s): %w", tx.Cursor, txHash, err)
+		a.events <- ErrorEvent{Err: err}
+		return err
+	}
+
+	// Resume from the transaction when streaming restarts, whether or not it
+	// is ingested successfully, since ingesting it again will not change the
+	// outcome.
+	a.streamerCursor = tx.Cursor
 	defer a.takeSnapshot()
 
+	compromisesBefore := len(a.channel.Compromises())
+
 	err = a.channel.IngestTx(tx.TransactionOrderID, tx.TransactionXDR, tx.ResultXDR, tx.ResultMetaXDR)
 	if err != nil {
 		err = fmt.Errorf("ingesting tx (cursor=%s hash=%s): ingesting xdr: %w", tx.Cursor, txHash, err)
@@ -49,11 +98,24 @@ func (a *Agent) ingest() error {
 		a.events <- ErrorEvent{Err: err}
 		return err
 	}
-	fmt.Fprintf(a.logWriter, "state after: %v\n", stateAfter)
+
+	if a.metrics != nil {
+		var lag time.Duration
+		if !tx.LedgerCloseTime.IsZero() {
+			lag = time.Since(tx.LedgerCloseTime)
+		}
+		a.metrics.TxIngested(lag)
+		a.metrics.ChannelState(stateAfter)
+	}
+
+	span.SetAttributes("state", stateAfter.String())
+
+	if stateAfter != stateBefore {
+		a.log().Info("channel state changed", "from", stateBefore, "to", stateAfter)
+	}
 
 	if a.events != nil {
 		if stateAfter != stateBefore {
-			fmt.Fprintf(a.logWriter, "writing event: %v\n", stateAfter)
 			switch stateAfter {
 			case state.StateOpen:
 				a.events <- OpenedEvent{a.channel.OpenAgreement()}
@@ -62,23 +124,110 @@ func (a *Agent) ingest() error {
 			case state.StateClosingWithOutdatedState:
 				a.events <- ClosingWithOutdatedStateEvent{}
 			case state.StateClosed:
-				a.streamerCancel()
 				a.events <- ClosedEvent{}
 			}
 		}
 	}
 
+	a.closeFailed(observed, stateAfter)
+
+	compromises := a.channel.Compromises()[compromisesBefore:]
+	for _, c := range compromises {
+		a.log().Warn("channel account compromised", "compromised_account", c.ChannelAccount, "reason", c.Reason)
+		if a.events != nil {
+			a.events <- ChannelCompromisedEvent{Compromise: c}
+		}
+	}
+	if len(compromises) > 0 && a.closeOnCompromise && stateAfter == state.StateOpen {
+		a.log().Warn("force closing compromised channel")
+		err = a.submitDeclaration(span.SpanContext())
+		if err != nil {
+			a.sendErrorEvent(fmt.Errorf("force closing compromised channel: %w", err))
+		}
+	}
+
+	if stateAfter != stateBefore {
+		switch stateAfter {
+		case state.StateClosing:
+			a.scheduleClose(tx)
+		case state.StateClosed:
+			a.stopScheduledClose()
+			a.streamerCancel()
+			a.submittedTxSpans = nil
+		}
+	}
+	a.closeIfReady()
+
 	return nil
 }
 
-func (a *Agent) ingestLoop() {
+// observeTx sends a ChannelTxObservedEvent if the transaction is one of the
+// channel's transactions, and returns the event. If the transaction is not one
+// of the channel's transactions the event returned is empty.
+//
+// Must be called with the mutex locked.
+func (a *Agent) observeTx(tx StreamedTransaction) (ChannelTxObservedEvent, error) {
+	ct, err := a.channel.RecognizeTx(tx.TransactionXDR)
+	if err != nil {
+		return ChannelTxObservedEvent{}, fmt.Errorf("recognizing tx: %w", err)
+	}
+	if ct.Type == txbuild.TransactionTypeUnrecognized {
+		return ChannelTxObservedEvent{}, nil
+	}
+	var result xdr.TransactionResult
+	err = xdr.SafeUnmarshalBase64(tx.ResultXDR, &result)
+	if err != nil {
+		return ChannelTxObservedEvent{}, fmt.Errorf("parsing the result xdr: %w", err)
+	}
+	a.log().Info("observed channel tx", "tx_type", ct.Type, "tx", ct.Hash.String(), "successful", result.Successful())
+	observed := ChannelTxObservedEvent{
+		Tx:                 ct,
+		Successful:         result.Successful(),
+		ResultCodes:        submit.ResultCodes(result),
+		TransactionOrderID: tx.TransactionOrderID,
+		LedgerSequence:     tx.LedgerSequence,
+		LedgerCloseTime:    tx.LedgerCloseTime,
+	}
+	if a.events != nil {
+		a.events <- observed
+	}
+	return observed, nil
+}
+
+// closeFailed sends a CloseFailedEvent if the observed transaction is a
+// declaration or close that failed, and reschedules the close if the channel
+// is still closing after a failed close.
+//
+// Must be called with the mutex locked.
+func (a *Agent) closeFailed(observed ChannelTxObservedEvent, stateAfter state.State) {
+	if observed.Successful {
+		return
+	}
+	switch observed.Tx.Type {
+	case txbuild.TransactionTypeDeclaration, txbuild.TransactionTypeClose:
+	default:
+		return
+	}
+	a.log().Warn("channel close tx failed", "tx_type", observed.Tx.Type, "tx", observed.Tx.Hash.String(), "result_codes", observed.ResultCodes)
+	if a.events != nil {
+		a.events <- CloseFailedEvent{Tx: observed.Tx, ResultCodes: observed.ResultCodes}
+	}
+	if observed.Tx.Type == txbuild.TransactionTypeClose && stateAfter == state.StateClosing {
+		a.stopScheduledClose()
+		a.log().Info("rescheduling close tx", "retry_in", a.closeRetryInterval)
+		a.closeTimer = time.AfterFunc(a.closeRetryInterval, a.scheduledClose)
+	}
+}
+
+func (a *Agent) ingestLoop(txs <-chan StreamedTransaction) {
 	for {
-		err := a.ingest()
-		if err != nil {
-			fmt.Fprintf(a.logWriter, "error ingesting: %v\n", err)
-		}
+		err := a.ingest(txs)
 		if errors.Is(err, ingestingFinished) {
+			a.logWithLock().Debug("ingesting finished")
 			break
 		}
+		if err != nil {
+			a.logWithLock().Error("error ingesting", "error", err)
+		}
 	}
 }
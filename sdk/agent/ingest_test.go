@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestChannels returns the channels of a local initiator and remote
+// responder that have agreed to open.
+func newTestChannels(t *testing.T) (localChannel, remoteChannel *state.Channel) {
+	localSigner := keypair.MustRandom()
+	remoteSigner := keypair.MustRandom()
+	localChannelAccount := keypair.MustRandom().FromAddress()
+	remoteChannelAccount := keypair.MustRandom().FromAddress()
+	localChannel = state.NewChannel(state.Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            true,
+		LocalSigner:          localSigner,
+		RemoteSigner:         remoteSigner.FromAddress(),
+		LocalChannelAccount:  localChannelAccount,
+		RemoteChannelAccount: remoteChannelAccount,
+	})
+	remoteChannel = state.NewChannel(state.Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            false,
+		LocalSigner:          remoteSigner,
+		RemoteSigner:         localSigner.FromAddress(),
+		LocalChannelAccount:  remoteChannelAccount,
+		RemoteChannelAccount: localChannelAccount,
+	})
+	open, err := localChannel.ProposeOpen(state.OpenParams{
+		ObservationPeriodTime:      1,
+		ObservationPeriodLedgerGap: 1,
+		Asset:                      state.NativeAsset,
+		ExpiresAt:                  time.Now().Add(time.Minute),
+		StartingSequence:           101,
+	})
+	require.NoError(t, err)
+	open, err = remoteChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	_, err = localChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	return localChannel, remoteChannel
+}
+
+func TestAgent_observeTx(t *testing.T) {
+	localChannel, _ := newTestChannels(t)
+
+	events := make(chan interface{}, 1)
+	agent := &Agent{
+		networkPassphrase: network.TestNetworkPassphrase,
+		logWriter:         io.Discard,
+		events:            events,
+		channel:           localChannel,
+	}
+
+	declTx, _, err := localChannel.CloseTxs()
+	require.NoError(t, err)
+	declTxHash, err := declTx.Hash(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+
+	// A fee bump of a failed declaration is observed with the inner hash and
+	// the failure's result codes.
+	feeAccount := keypair.MustRandom()
+	declTxFeeBump, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      declTx,
+		BaseFee:    txnbuild.MinBaseFee,
+		FeeAccount: feeAccount.Address(),
+	})
+	require.NoError(t, err)
+	declTxFeeBumpHash, err := declTxFeeBump.Hash(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	declTxFeeBumpXDR, err := declTxFeeBump.Base64()
+	require.NoError(t, err)
+	failedResultXDR, err := txbuildtest.BuildResultXDR(false)
+	require.NoError(t, err)
+	closeTime := time.Unix(1_600_000_000, 0).UTC()
+	_, err = agent.observeTx(StreamedTransaction{
+		TransactionOrderID: 4294971393,
+		LedgerSequence:     1,
+		LedgerCloseTime:    closeTime,
+		TransactionXDR:     declTxFeeBumpXDR,
+		ResultXDR:          failedResultXDR,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ChannelTxObservedEvent{
+		Tx: state.ChannelTx{
+			Type:            txbuild.TransactionTypeDeclaration,
+			IterationNumber: 1,
+			Hash:            declTxHash,
+			FeeBumpHash:     declTxFeeBumpHash,
+		},
+		Successful:         false,
+		ResultCodes:        []string{"tx_failed"},
+		TransactionOrderID: 4294971393,
+		LedgerSequence:     1,
+		LedgerCloseTime:    closeTime,
+	}, <-events)
+
+	// Unrecognized txs are not observed.
+	otherTx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{AccountID: keypair.MustRandom().Address(), Sequence: 1},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations:    []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: 2}},
+	})
+	require.NoError(t, err)
+	otherTxXDR, err := otherTx.Base64()
+	require.NoError(t, err)
+	_, err = agent.observeTx(StreamedTransaction{TransactionXDR: otherTxXDR, ResultXDR: failedResultXDR})
+	require.NoError(t, err)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event: %#v", e)
+	default:
+	}
+}
+
+func TestAgent_ingest_closeOnCompromise(t *testing.T) {
+	localChannel, remoteChannel := newTestChannels(t)
+	details := localChannel.OpenAgreement().Envelope.Details
+	localChannelAccount := localChannel.LocalChannelAccount().Address
+	remoteChannelAccount := remoteChannel.LocalChannelAccount().Address
+
+	// Ingest the open tx so that the channel is open.
+	openTx, err := localChannel.OpenTx()
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	successResultXDR, err := txbuildtest.BuildResultXDR(true)
+	require.NoError(t, err)
+	openResultMetaXDR, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+		InitiatorSigner:         details.ProposingSigner.Address(),
+		ResponderSigner:         details.ConfirmingSigner.Address(),
+		InitiatorChannelAccount: localChannelAccount.Address(),
+		ResponderChannelAccount: remoteChannelAccount.Address(),
+		StartSequence:           details.StartingSequence,
+		Asset:                   txnbuild.NativeAsset{},
+	})
+	require.NoError(t, err)
+	err = localChannel.IngestTx(1, openTxXDR, successResultXDR, openResultMetaXDR)
+	require.NoError(t, err)
+
+	events := make(chan interface{}, 1)
+	submittedTxs := make(chan *txnbuild.Transaction, 1)
+	txs := make(chan StreamedTransaction, 1)
+	agent := &Agent{
+		networkPassphrase: network.TestNetworkPassphrase,
+		closeOnCompromise: true,
+		submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			submittedTxs <- tx
+			return nil
+		}),
+		logWriter:            io.Discard,
+		events:               events,
+		channel:              localChannel,
+		streamerTransactions: txs,
+	}
+
+	// Ingest a tx that adds a signer to the remote channel account.
+	otherSigner := keypair.MustRandom().Address()
+	setOptionsTx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{AccountID: remoteChannelAccount.Address(), Sequence: 1},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: otherSigner, Weight: 1}},
+		},
+	})
+	require.NoError(t, err)
+	setOptionsTxXDR, err := setOptionsTx.Base64()
+	require.NoError(t, err)
+	setOptionsResultMetaXDR, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{
+		{
+			Type: xdr.LedgerEntryTypeAccount,
+			Account: &xdr.AccountEntry{
+				AccountId: xdr.MustAddress(remoteChannelAccount.Address()),
+				SeqNum:    1,
+				Signers: []xdr.Signer{
+					{Key: xdr.MustSigner(details.ProposingSigner.Address()), Weight: 1},
+					{Key: xdr.MustSigner(details.ConfirmingSigner.Address()), Weight: 1},
+					{Key: xdr.MustSigner(otherSigner), Weight: 1},
+				},
+				Thresholds: xdr.Thresholds{0, 2, 2, 2},
+			},
+		},
+	})
+	require.NoError(t, err)
+	txs <- StreamedTransaction{
+		Cursor:             "2",
+		TransactionOrderID: 2,
+		TransactionXDR:     setOptionsTxXDR,
+		ResultXDR:          successResultXDR,
+		ResultMetaXDR:      setOptionsResultMetaXDR,
+	}
+	err = agent.ingest(txs)
+	require.NoError(t, err)
+
+	// Expect the compromise to be reported and the channel force closed.
+	assert.Equal(t, ChannelCompromisedEvent{
+		Compromise: state.Compromise{
+			ChannelAccount:     remoteChannelAccount.Address(),
+			TransactionOrderID: 2,
+			Reason:             "unexpected signer found on channel account",
+		},
+	}, <-events)
+	declTx, _, err := localChannel.CloseTxs()
+	require.NoError(t, err)
+	assert.Equal(t, declTx, <-submittedTxs)
+}
+
+// newClosingTestChannel returns the channel of a local initiator that has
+// ingested its open tx and declaration tx, and the close tx of the channel.
+func newClosingTestChannel(t *testing.T) (*state.Channel, *txnbuild.Transaction) {
+	localChannel, remoteChannel := newTestChannels(t)
+	details := localChannel.OpenAgreement().Envelope.Details
+	localChannelAccount := localChannel.LocalChannelAccount().Address
+	remoteChannelAccount := remoteChannel.LocalChannelAccount().Address
+
+	openTx, err := localChannel.OpenTx()
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	successResultXDR, err := txbuildtest.BuildResultXDR(true)
+	require.NoError(t, err)
+	openResultMetaXDR, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+		InitiatorSigner:         details.ProposingSigner.Address(),
+		ResponderSigner:         details.ConfirmingSigner.Address(),
+		InitiatorChannelAccount: localChannelAccount.Address(),
+		ResponderChannelAccount: remoteChannelAccount.Address(),
+		StartSequence:           details.StartingSequence,
+		Asset:                   txnbuild.NativeAsset{},
+	})
+	require.NoError(t, err)
+	err = localChannel.IngestTx(1, openTxXDR, successResultXDR, openResultMetaXDR)
+	require.NoError(t, err)
+	declTx, closeTx, err := localChannel.CloseTxs()
+	require.NoError(t, err)
+	declTxXDR, err := declTx.Base64()
+	require.NoError(t, err)
+	emptyResultMetaXDR, err := txbuildtest.BuildResultMetaXDR(nil)
+	require.NoError(t, err)
+	err = localChannel.IngestTx(2, declTxXDR, successResultXDR, emptyResultMetaXDR)
+	require.NoError(t, err)
+	return localChannel, closeTx
+}
+
+func TestAgent_ingest_failedClose(t *testing.T) {
+	localChannel, closeTx := newClosingTestChannel(t)
+	failedResultXDR, err := txbuildtest.BuildResultXDR(false)
+	require.NoError(t, err)
+	emptyResultMetaXDR, err := txbuildtest.BuildResultMetaXDR(nil)
+	require.NoError(t, err)
+
+	// Ingest a failed close tx.
+	events := make(chan interface{}, 2)
+	txs := make(chan StreamedTransaction, 1)
+	agent := &Agent{
+		networkPassphrase:    network.TestNetworkPassphrase,
+		logWriter:            io.Discard,
+		events:               events,
+		channel:              localChannel,
+		streamerTransactions: txs,
+		streamerCancel: func() {
+			t.Fatal("streaming cancelled after a failed close")
+		},
+		closeRetryInterval: time.Hour,
+	}
+	defer agent.stopScheduledClose()
+	closeTxXDR, err := closeTx.Base64()
+	require.NoError(t, err)
+	txs <- StreamedTransaction{
+		Cursor:             "3",
+		TransactionOrderID: 3,
+		TransactionXDR:     closeTxXDR,
+		ResultXDR:          failedResultXDR,
+		ResultMetaXDR:      emptyResultMetaXDR,
+	}
+	err = agent.ingest(txs)
+	require.NoError(t, err)
+
+	// Expect the failure to be reported, the channel to still be closing,
+	// and the close to be rescheduled.
+	observed, ok := (<-events).(ChannelTxObservedEvent)
+	require.True(t, ok)
+	assert.Equal(t, txbuild.TransactionTypeClose, observed.Tx.Type)
+	assert.False(t, observed.Successful)
+	assert.Equal(t, CloseFailedEvent{Tx: observed.Tx, ResultCodes: []string{"tx_failed"}}, <-events)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event: %#v", e)
+	default:
+	}
+	s, err := localChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, state.StateClosing, s)
+	assert.NotNil(t, agent.closeTimer)
+}
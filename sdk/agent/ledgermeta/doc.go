@@ -0,0 +1,9 @@
+// Package ledgermeta contains a Streamer that implements the sdk/agent
+// interface for streaming transactions by reading LedgerCloseMeta, such as
+// those written by stellar-core to its metadata output stream, or exported to a
+// directory by a ledger exporter like Galexie. Reading ledger meta directly
+// removes the dependency on Horizon or Stellar RPC for ingestion, and supports
+// replaying historical ledgers offline.
+//
+// Versions 0, 1, and 2 of LedgerCloseMeta are supported.
+package ledgermeta
@@ -0,0 +1,221 @@
+package ledgermeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stellar/go/xdr"
+)
+
+// LedgerSource is a source of ledgers.
+type LedgerSource interface {
+	// Open returns a reader that reads the ledgers available in the source,
+	// in order, starting with the given ledger sequence. Ledgers before the
+	// sequence are skipped.
+	Open(start uint32) (LedgerReader, error)
+}
+
+// LedgerReader reads ledgers in order.
+type LedgerReader interface {
+	// Read returns the next ledger, or io.EOF if there are no more ledgers
+	// available.
+	Read() (xdr.LedgerCloseMeta, error)
+
+	// Close releases any resources held by the reader.
+	Close() error
+}
+
+var _ LedgerSource = &FramedSource{}
+
+// FramedSource is a LedgerSource that reads LedgerCloseMeta from a reader
+// where each ledger is encoded as a framed XDR record, which is the format
+// stellar-core writes to its metadata output stream. The reader is read
+// sequentially and is never rewound, so opening the source again continues
+// where the last reader stopped.
+type FramedSource struct {
+	Reader io.Reader
+}
+
+// Open returns a reader of the ledgers in the source starting with the given
+// sequence.
+func (s *FramedSource) Open(start uint32) (LedgerReader, error) {
+	return &framedReader{r: s.Reader, start: start}, nil
+}
+
+type framedReader struct {
+	r     io.Reader
+	start uint32
+}
+
+func (f *framedReader) Read() (xdr.LedgerCloseMeta, error) {
+	for {
+		var header uint32
+		err := binary.Read(f.r, binary.BigEndian, &header)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xdr.LedgerCloseMeta{}, io.EOF
+			}
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("reading frame header: %w", err)
+		}
+		frame := make([]byte, header&0x7fffffff)
+		_, err = io.ReadFull(f.r, frame)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("reading frame: %w", err)
+		}
+		var lcm xdr.LedgerCloseMeta
+		err = lcm.UnmarshalBinary(frame)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("decoding ledger close meta: %w", err)
+		}
+		if lcm.LedgerSequence() < f.start {
+			continue
+		}
+		return lcm, nil
+	}
+}
+
+func (f *framedReader) Close() error {
+	return nil
+}
+
+var _ LedgerSource = &DirectorySource{}
+
+// DirectorySource is a LedgerSource that reads ledgers from files in a
+// directory, laid out in the style of the Galexie ledger exporter. Each file
+// contains a LedgerCloseMetaBatch, and the file name contains the sequence of
+// the first and optionally last ledger in the batch after a double dash, such
+// as "FFFFFFFF--0-9.xdr" or "FFFFFFF5--10.xdr". Files may be in
+// subdirectories, and are read in the order of the ledgers they contain.
+type DirectorySource struct {
+	Dir string
+
+	// Decompress, if set, is called with the name and contents of each file,
+	// and returns a reader of the decompressed contents. It can be used to
+	// read files that have been compressed, for example with zstd.
+	Decompress func(name string, r io.Reader) (io.Reader, error)
+}
+
+type batchFile struct {
+	path  string
+	start uint32
+	end   uint32
+}
+
+// Open returns a reader of the ledgers in the directory starting with the
+// given sequence. Files added to the directory after the reader is opened are
+// not read by the reader.
+func (s *DirectorySource) Open(start uint32) (LedgerReader, error) {
+	files := []batchFile{}
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		first, last, ok := parseBatchFileName(d.Name())
+		if !ok || last < start {
+			return nil
+		}
+		files = append(files, batchFile{path: path, start: first, end: last})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing ledger files in %s: %w", s.Dir, err)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].start < files[j].start
+	})
+	return &directoryReader{source: s, files: files, start: start}, nil
+}
+
+// parseBatchFileName parses the first and last ledger sequence from the name
+// of a batch file.
+func parseBatchFileName(name string) (first, last uint32, ok bool) {
+	i := strings.Index(name, "--")
+	if i < 0 {
+		return 0, 0, false
+	}
+	name = name[i+2:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	parts := strings.SplitN(name, "-", 2)
+	f, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	l := f
+	if len(parts) == 2 {
+		l, err = strconv.ParseUint(parts[1], 10, 32)
+		if err != nil || l < f {
+			return 0, 0, false
+		}
+	}
+	return uint32(f), uint32(l), true
+}
+
+type directoryReader struct {
+	source  *DirectorySource
+	files   []batchFile
+	start   uint32
+	ledgers []xdr.LedgerCloseMeta
+}
+
+func (d *directoryReader) Read() (xdr.LedgerCloseMeta, error) {
+	for {
+		for len(d.ledgers) > 0 {
+			lcm := d.ledgers[0]
+			d.ledgers = d.ledgers[1:]
+			if lcm.LedgerSequence() < d.start {
+				continue
+			}
+			return lcm, nil
+		}
+		if len(d.files) == 0 {
+			return xdr.LedgerCloseMeta{}, io.EOF
+		}
+		f := d.files[0]
+		d.files = d.files[1:]
+		batch, err := d.readBatch(f.path)
+		if err != nil {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("reading ledger file %s: %w", f.path, err)
+		}
+		d.ledgers = batch.LedgerCloseMetas
+	}
+}
+
+func (d *directoryReader) readBatch(path string) (xdr.LedgerCloseMetaBatch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return xdr.LedgerCloseMetaBatch{}, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if d.source.Decompress != nil {
+		r, err = d.source.Decompress(filepath.Base(path), f)
+		if err != nil {
+			return xdr.LedgerCloseMetaBatch{}, fmt.Errorf("decompressing: %w", err)
+		}
+	}
+	batch := xdr.LedgerCloseMetaBatch{}
+	_, err = xdr.Unmarshal(r, &batch)
+	if err != nil {
+		return xdr.LedgerCloseMetaBatch{}, fmt.Errorf("decoding ledger close meta batch: %w", err)
+	}
+	return batch, nil
+}
+
+func (d *directoryReader) Close() error {
+	d.files = nil
+	d.ledgers = nil
+	return nil
+}
@@ -0,0 +1,32 @@
+package ledgermeta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatchFileName(t *testing.T) {
+	testCases := []struct {
+		name  string
+		first uint32
+		last  uint32
+		ok    bool
+	}{
+		{"FFFFFFFF--0-9.xdr", 0, 9, true},
+		{"FFFFFFF5--10-19.xdr.zstd", 10, 19, true},
+		{"FFFFFF9F--96.xdr.zstd", 96, 96, true},
+		{"FFFFFFF5--19-10.xdr", 0, 0, false},
+		{"FFFFFFF5--a-10.xdr", 0, 0, false},
+		{"ledgers.xdr", 0, 0, false},
+		{".config.json", 0, 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, last, ok := parseBatchFileName(tc.name)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.first, first)
+			assert.Equal(t, tc.last, last)
+		})
+	}
+}
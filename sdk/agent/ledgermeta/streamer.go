@@ -0,0 +1,254 @@
+package ledgermeta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/toid"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent"
+)
+
+var _ agent.Streamer = &Streamer{}
+
+// Streamer implements the agent's interface for streaming transactions that
+// affect a set of accounts, by reading ledgers from a LedgerSource and
+// extracting the transactions in each ledger.
+type Streamer struct {
+	NetworkPassphrase string
+	Source            LedgerSource
+	ErrorHandler      func(error)
+
+	// PollInterval is the time between reopening the source once all
+	// available ledgers have been read, to follow new ledgers as they are
+	// written. If not set the stream ends once all available ledgers have
+	// been read, which is useful for replaying historical ledgers.
+	PollInterval time.Duration
+}
+
+// StreamTx streams transactions that affect the given accounts, sending each
+// transaction to the txs channel returned. StreamTx can be stopped by calling
+// the cancel function returned. The given cursor supports resuming a previous
+// stream, and is the transaction order ID of the last transaction streamed.
+// If the cursor is empty streaming starts from the first ledger in the source.
+//
+// Transactions are matched to the accounts by searching their envelope and
+// meta for the accounts. If no accounts are given all transactions are
+// streamed. Ledgers that contain no transactions to stream are reported with
+// a StreamedTransaction that only has the ledger's sequence and close time.
+func (s *Streamer) StreamTx(cursor string, accounts ...*keypair.FromAddress) (txs <-chan agent.StreamedTransaction, cancel func()) {
+	// txsCh is the channel that streamed transactions will be written to.
+	txsCh := make(chan agent.StreamedTransaction)
+
+	// cancelCh will be used to signal the streamer to stop.
+	cancelCh := make(chan struct{})
+
+	// Start a streamer that will write txs and stop when
+	// signaled to cancel.
+	go func() {
+		defer close(txsCh)
+		s.streamTx(cursor, accounts, txsCh, cancelCh)
+	}()
+
+	cancelOnce := sync.Once{}
+	cancel = func() {
+		cancelOnce.Do(func() {
+			close(cancelCh)
+		})
+	}
+	return txsCh, cancel
+}
+
+func (s *Streamer) streamTx(cursor string, accounts []*keypair.FromAddress, txs chan<- agent.StreamedTransaction, cancel <-chan struct{}) {
+	var after int64
+	var start uint32
+	if cursor != "" {
+		var err error
+		after, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			s.handleError(fmt.Errorf("parsing cursor %q: %w", cursor, err))
+			return
+		}
+		start = uint32(toid.Parse(after).LedgerSequence)
+	}
+
+	accountKeys := make([][]byte, 0, len(accounts))
+	for _, a := range accounts {
+		key, err := strkey.Decode(strkey.VersionByteAccountID, a.Address())
+		if err != nil {
+			s.handleError(err)
+			return
+		}
+		accountKeys = append(accountKeys, key)
+	}
+
+	wait := func() bool {
+		if s.PollInterval == 0 {
+			return false
+		}
+		select {
+		case <-cancel:
+			return false
+		case <-time.After(s.PollInterval):
+			return true
+		}
+	}
+
+	for {
+		reader, err := s.Source.Open(start)
+		if err != nil {
+			s.handleError(fmt.Errorf("opening ledger source: %w", err))
+			if !wait() {
+				return
+			}
+			continue
+		}
+		stopped := s.streamLedgers(reader, &start, &after, accountKeys, txs, cancel)
+		reader.Close()
+		if stopped || !wait() {
+			return
+		}
+	}
+}
+
+// streamLedgers sends the transactions in the ledgers read from the reader
+// that are after the given transaction order ID and affect the accounts,
+// advancing after past each transaction sent and start past each ledger
+// completed, so that reopening the source continues where streaming stopped.
+// Ledgers after the given transaction order ID that have no transactions to
+// send are reported without a transaction. It returns true if the stream was
+// canceled.
+func (s *Streamer) streamLedgers(reader LedgerReader, start *uint32, after *int64, accountKeys [][]byte, txs chan<- agent.StreamedTransaction, cancel <-chan struct{}) (canceled bool) {
+	for {
+		lcm, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return false
+		}
+		if err != nil {
+			s.handleError(fmt.Errorf("reading ledger: %w", err))
+			return false
+		}
+		ledgerTxs, err := transactions(s.NetworkPassphrase, lcm, accountKeys)
+		if err != nil {
+			s.handleError(fmt.Errorf("reading transactions of ledger %d: %w", lcm.LedgerSequence(), err))
+			return false
+		}
+		sent := false
+		for _, tx := range ledgerTxs {
+			if tx.TransactionOrderID <= *after {
+				continue
+			}
+			select {
+			case <-cancel:
+				return true
+			case txs <- tx:
+				*after = tx.TransactionOrderID
+				sent = true
+			}
+		}
+		if !sent && lcm.LedgerSequence() > uint32(toid.Parse(*after).LedgerSequence) {
+			header := lcm.LedgerHeaderHistoryEntry().Header
+			select {
+			case <-cancel:
+				return true
+			case txs <- agent.StreamedTransaction{
+				LedgerSequence:  uint32(header.LedgerSeq),
+				LedgerCloseTime: time.Unix(int64(header.ScpValue.CloseTime), 0).UTC(),
+			}:
+			}
+		}
+		*start = lcm.LedgerSequence() + 1
+	}
+}
+
+func (s *Streamer) handleError(err error) {
+	if s.ErrorHandler != nil {
+		s.ErrorHandler(err)
+	}
+}
+
+// transactions returns the transactions in the ledger, in the order they were
+// applied, that reference any of the account keys in their envelope or meta.
+// If no account keys are given all transactions are returned.
+func transactions(networkPassphrase string, lcm xdr.LedgerCloseMeta, accountKeys [][]byte) ([]agent.StreamedTransaction, error) {
+	// Versions 1 and 2 are written by stellar-core since Soroban, and differ
+	// from version 0 in how the tx set is structured.
+	if lcm.V < 0 || lcm.V > 2 {
+		return nil, fmt.Errorf("unsupported ledger close meta version %d", lcm.V)
+	}
+	header := lcm.LedgerHeaderHistoryEntry().Header
+	closeTime := time.Unix(int64(header.ScpValue.CloseTime), 0).UTC()
+
+	// The tx set is not in apply order, so index the envelopes by hash to
+	// match them to the results which are in apply order.
+	txSet := lcm.TransactionEnvelopes()
+	envelopes := make(map[xdr.Hash]xdr.TransactionEnvelope, len(txSet))
+	for _, env := range txSet {
+		hash, err := network.HashTransactionInEnvelope(env, networkPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("hashing transaction: %w", err)
+		}
+		envelopes[hash] = env
+	}
+
+	var txs []agent.StreamedTransaction
+	for i := 0; i < lcm.CountTransactions(); i++ {
+		result := lcm.TransactionResultPair(i)
+		env, ok := envelopes[result.TransactionHash]
+		if !ok {
+			return nil, fmt.Errorf("transaction %x not found in transaction set", result.TransactionHash)
+		}
+		envBytes, err := env.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("encoding transaction: %w", err)
+		}
+		metaBytes, err := lcm.TxApplyProcessing(i).MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("encoding transaction meta: %w", err)
+		}
+		if !containsAny(accountKeys, envBytes, metaBytes) {
+			continue
+		}
+		resultBytes, err := result.Result.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("encoding transaction result: %w", err)
+		}
+		txOrderID := toid.New(int32(header.LedgerSeq), int32(i+1), 0).ToInt64()
+		txs = append(txs, agent.StreamedTransaction{
+			Cursor:             strconv.FormatInt(txOrderID, 10),
+			TransactionOrderID: txOrderID,
+			LedgerSequence:     uint32(header.LedgerSeq),
+			LedgerCloseTime:    closeTime,
+			TransactionXDR:     base64.StdEncoding.EncodeToString(envBytes),
+			ResultXDR:          base64.StdEncoding.EncodeToString(resultBytes),
+			ResultMetaXDR:      base64.StdEncoding.EncodeToString(metaBytes),
+		})
+	}
+	return txs, nil
+}
+
+// containsAny returns true if any of the keys are contained in any of the
+// encoded values, or if no keys are given. Searching the encoded XDR for the
+// account keys avoids decoding the contents of every transaction.
+func containsAny(keys [][]byte, values ...[]byte) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, v := range values {
+		for _, key := range keys {
+			if bytes.Contains(v, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,451 @@
+package ledgermeta
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTx returns a transaction envelope with the given source account and
+// sequence number.
+func testTx(t *testing.T, source *keypair.FromAddress, seqNum int64) xdr.TransactionEnvelope {
+	t.Helper()
+	return xdr.TransactionEnvelope{
+		Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+		V1: &xdr.TransactionV1Envelope{
+			Tx: xdr.Transaction{
+				SourceAccount: xdr.MustMuxedAddress(source.Address()),
+				Fee:           100,
+				SeqNum:        xdr.SequenceNumber(seqNum),
+				Operations: []xdr.Operation{
+					{
+						Body: xdr.OperationBody{
+							Type:           xdr.OperationTypeBumpSequence,
+							BumpSequenceOp: &xdr.BumpSequenceOp{BumpTo: xdr.SequenceNumber(seqNum)},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// testLedger returns a ledger containing the given transactions. The
+// transactions are placed into the transaction set in reverse order to
+// check that transactions are ordered by their apply order.
+func testLedger(t *testing.T, seq uint32, closeTime time.Time, envs ...xdr.TransactionEnvelope) xdr.LedgerCloseMeta {
+	t.Helper()
+	txSet := make([]xdr.TransactionEnvelope, len(envs))
+	processing := make([]xdr.TransactionResultMeta, len(envs))
+	for i, env := range envs {
+		txSet[len(envs)-1-i] = env
+		hash, err := network.HashTransactionInEnvelope(env, network.TestNetworkPassphrase)
+		require.NoError(t, err)
+		processing[i] = xdr.TransactionResultMeta{
+			Result: xdr.TransactionResultPair{
+				TransactionHash: hash,
+				Result: xdr.TransactionResult{
+					FeeCharged: 100,
+					Result: xdr.TransactionResultResult{
+						Code:    xdr.TransactionResultCodeTxSuccess,
+						Results: &[]xdr.OperationResult{},
+					},
+				},
+			},
+			TxApplyProcessing: xdr.TransactionMeta{
+				V:  2,
+				V2: &xdr.TransactionMetaV2{},
+			},
+		}
+	}
+	return xdr.LedgerCloseMeta{
+		V: 0,
+		V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{
+				Header: xdr.LedgerHeader{
+					LedgerSeq: xdr.Uint32(seq),
+					ScpValue: xdr.StellarValue{
+						CloseTime: xdr.TimePoint(closeTime.Unix()),
+					},
+				},
+			},
+			TxSet:        xdr.TransactionSet{Txs: txSet},
+			TxProcessing: processing,
+		},
+	}
+}
+
+// testLedgerV1 returns a ledger containing the given transactions, in the
+// version 1 ledger close meta format written by stellar-core since Soroban,
+// with the transactions split across two tx set components.
+func testLedgerV1(t *testing.T, seq uint32, closeTime time.Time, envs ...xdr.TransactionEnvelope) xdr.LedgerCloseMeta {
+	t.Helper()
+	v0 := testLedger(t, seq, closeTime, envs...).MustV0()
+	return xdr.LedgerCloseMeta{
+		V: 1,
+		V1: &xdr.LedgerCloseMetaV1{
+			LedgerHeader: v0.LedgerHeader,
+			TxSet:        testGeneralizedTxSet(v0.TxSet.Txs),
+			TxProcessing: v0.TxProcessing,
+		},
+	}
+}
+
+// testLedgerV2 is testLedgerV1 in the version 2 ledger close meta format
+// written by stellar-core since protocol 23.
+func testLedgerV2(t *testing.T, seq uint32, closeTime time.Time, envs ...xdr.TransactionEnvelope) xdr.LedgerCloseMeta {
+	t.Helper()
+	v0 := testLedger(t, seq, closeTime, envs...).MustV0()
+	processing := make([]xdr.TransactionResultMetaV1, len(v0.TxProcessing))
+	for i, trm := range v0.TxProcessing {
+		processing[i] = xdr.TransactionResultMetaV1{
+			Result:            trm.Result,
+			TxApplyProcessing: trm.TxApplyProcessing,
+		}
+	}
+	return xdr.LedgerCloseMeta{
+		V: 2,
+		V2: &xdr.LedgerCloseMetaV2{
+			LedgerHeader: v0.LedgerHeader,
+			TxSet:        testGeneralizedTxSet(v0.TxSet.Txs),
+			TxProcessing: processing,
+		},
+	}
+}
+
+func testGeneralizedTxSet(txs []xdr.TransactionEnvelope) xdr.GeneralizedTransactionSet {
+	half := len(txs) / 2
+	components := []xdr.TxSetComponent{
+		{
+			Type:                  xdr.TxSetComponentTypeTxsetCompTxsMaybeDiscountedFee,
+			TxsMaybeDiscountedFee: &xdr.TxSetComponentTxsMaybeDiscountedFee{Txs: txs[:half]},
+		},
+		{
+			Type:                  xdr.TxSetComponentTypeTxsetCompTxsMaybeDiscountedFee,
+			TxsMaybeDiscountedFee: &xdr.TxSetComponentTxsMaybeDiscountedFee{Txs: txs[half:]},
+		},
+	}
+	return xdr.GeneralizedTransactionSet{
+		V: 1,
+		V1TxSet: &xdr.TransactionSetV1{
+			Phases: []xdr.TransactionPhase{{V: 0, V0Components: &components}},
+		},
+	}
+}
+
+func writeFramed(t *testing.T, ledgers ...xdr.LedgerCloseMeta) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	for _, l := range ledgers {
+		err := xdr.MarshalFramed(&buf, l)
+		require.NoError(t, err)
+	}
+	return buf.Bytes()
+}
+
+func writeBatch(t *testing.T, path string, ledgers ...xdr.LedgerCloseMeta) {
+	t.Helper()
+	batch := xdr.LedgerCloseMetaBatch{
+		StartSequence:    xdr.Uint32(ledgers[0].LedgerSequence()),
+		EndSequence:      xdr.Uint32(ledgers[len(ledgers)-1].LedgerSequence()),
+		LedgerCloseMetas: ledgers,
+	}
+	buf := bytes.Buffer{}
+	_, err := xdr.Marshal(&buf, batch)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func TestStreamer_StreamTx_framed(t *testing.T) {
+	account1 := keypair.MustRandom().FromAddress()
+	account2 := keypair.MustRandom().FromAddress()
+	closeTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tx1 := testTx(t, account1, 1)
+	tx2 := testTx(t, account2, 1)
+	tx3 := testTx(t, account1, 2)
+	data := writeFramed(t,
+		testLedger(t, 2, closeTime, tx1, tx2),
+		testLedger(t, 3, closeTime.Add(5*time.Second)),
+		testLedger(t, 4, closeTime.Add(10*time.Second), tx3),
+	)
+
+	streamer := Streamer{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Source:            &FramedSource{Reader: bytes.NewReader(data)},
+		ErrorHandler:      func(err error) { t.Error(err) },
+	}
+	txsCh, cancel := streamer.StreamTx("", account1)
+	defer cancel()
+
+	tx1XDR, err := xdr.MarshalBase64(tx1)
+	require.NoError(t, err)
+	tx3XDR, err := xdr.MarshalBase64(tx3)
+	require.NoError(t, err)
+
+	tx, ok := <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, "8589938688", tx.Cursor)
+	assert.Equal(t, int64(8589938688), tx.TransactionOrderID)
+	assert.Equal(t, uint32(2), tx.LedgerSequence)
+	assert.Equal(t, closeTime, tx.LedgerCloseTime)
+	assert.Equal(t, tx1XDR, tx.TransactionXDR)
+	assert.Equal(t, "AAAAAAAAAGQAAAAAAAAAAAAAAAA=", tx.ResultXDR)
+	assert.Equal(t, "AAAAAgAAAAAAAAAAAAAAAA==", tx.ResultMetaXDR)
+
+	// Ledgers without transactions for the account are reported without a
+	// transaction.
+	tx, ok = <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, agent.StreamedTransaction{
+		LedgerSequence:  3,
+		LedgerCloseTime: closeTime.Add(5 * time.Second),
+	}, tx)
+
+	tx, ok = <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, "17179873280", tx.Cursor)
+	assert.Equal(t, uint32(4), tx.LedgerSequence)
+	assert.Equal(t, closeTime.Add(10*time.Second), tx.LedgerCloseTime)
+	assert.Equal(t, tx3XDR, tx.TransactionXDR)
+
+	// Without a poll interval the stream ends when the source is exhausted.
+	_, ok = <-txsCh
+	assert.False(t, ok)
+}
+
+func TestStreamer_StreamTx_applyOrder(t *testing.T) {
+	account1 := keypair.MustRandom().FromAddress()
+	account2 := keypair.MustRandom().FromAddress()
+	closeTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tx1 := testTx(t, account1, 1)
+	tx2 := testTx(t, account2, 1)
+	data := writeFramed(t, testLedger(t, 2, closeTime, tx1, tx2))
+
+	streamer := Streamer{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Source:            &FramedSource{Reader: bytes.NewReader(data)},
+		ErrorHandler:      func(err error) { t.Error(err) },
+	}
+	txsCh, cancel := streamer.StreamTx("")
+	defer cancel()
+
+	tx2XDR, err := xdr.MarshalBase64(tx2)
+	require.NoError(t, err)
+
+	cursors := []string{}
+	for tx := range txsCh {
+		cursors = append(cursors, tx.Cursor)
+		if tx.TransactionXDR == tx2XDR {
+			assert.Equal(t, int64(8589942784), tx.TransactionOrderID)
+		}
+	}
+	assert.Equal(t, []string{"8589938688", "8589942784"}, cursors)
+}
+
+func TestStreamer_StreamTx_wrongNetwork(t *testing.T) {
+	account := keypair.MustRandom().FromAddress()
+	data := writeFramed(t, testLedger(t, 2, time.Now(), testTx(t, account, 1)))
+
+	errs := []error{}
+	streamer := Streamer{
+		NetworkPassphrase: network.PublicNetworkPassphrase,
+		Source:            &FramedSource{Reader: bytes.NewReader(data)},
+		ErrorHandler:      func(err error) { errs = append(errs, err) },
+	}
+	txsCh, cancel := streamer.StreamTx("")
+	defer cancel()
+
+	_, ok := <-txsCh
+	assert.False(t, ok)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "reading transactions of ledger 2: transaction")
+	assert.Contains(t, errs[0].Error(), "not found in transaction set")
+}
+
+func TestStreamer_StreamTx_directory(t *testing.T) {
+	account1 := keypair.MustRandom().FromAddress()
+	account2 := keypair.MustRandom().FromAddress()
+	closeTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tx1 := testTx(t, account1, 1)
+	tx2 := testTx(t, account2, 1)
+	tx3 := testTx(t, account1, 2)
+	tx4 := testTx(t, account2, 2)
+
+	dir := t.TempDir()
+	writeBatch(t, filepath.Join(dir, "FFFFFFFF--0-63999", "FFFFFFFD--2-3.xdr"),
+		testLedger(t, 2, closeTime, tx1),
+		testLedger(t, 3, closeTime.Add(5*time.Second), tx2),
+	)
+	writeBatch(t, filepath.Join(dir, "FFFFFFFF--0-63999", "FFFFFFFB--4-5.xdr"),
+		testLedger(t, 4, closeTime.Add(10*time.Second), tx3),
+		testLedger(t, 5, closeTime.Add(15*time.Second), tx4),
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".config.json"), []byte("{}"), 0o644))
+
+	streamer := Streamer{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Source:            &DirectorySource{Dir: dir},
+		ErrorHandler:      func(err error) { t.Error(err) },
+	}
+
+	// Streaming from a cursor skips ledgers and transactions at or before
+	// the cursor.
+	txsCh, cancel := streamer.StreamTx("12884905984", account1, account2)
+	defer cancel()
+
+	tx3XDR, err := xdr.MarshalBase64(tx3)
+	require.NoError(t, err)
+	tx4XDR, err := xdr.MarshalBase64(tx4)
+	require.NoError(t, err)
+
+	tx, ok := <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, "17179873280", tx.Cursor)
+	assert.Equal(t, tx3XDR, tx.TransactionXDR)
+	tx, ok = <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, "21474840576", tx.Cursor)
+	assert.Equal(t, tx4XDR, tx.TransactionXDR)
+	_, ok = <-txsCh
+	assert.False(t, ok)
+}
+
+func TestStreamer_StreamTx_directoryV1V2(t *testing.T) {
+	account1 := keypair.MustRandom().FromAddress()
+	account2 := keypair.MustRandom().FromAddress()
+	closeTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tx1 := testTx(t, account1, 1)
+	tx2 := testTx(t, account2, 1)
+	tx3 := testTx(t, account1, 2)
+
+	dir := t.TempDir()
+	writeBatch(t, filepath.Join(dir, "FFFFFFFD--2-3.xdr"),
+		testLedgerV1(t, 2, closeTime, tx1, tx2),
+		testLedgerV2(t, 3, closeTime.Add(5*time.Second), tx3),
+	)
+
+	streamer := Streamer{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Source:            &DirectorySource{Dir: dir},
+		ErrorHandler:      func(err error) { t.Error(err) },
+	}
+	txsCh, cancel := streamer.StreamTx("")
+	defer cancel()
+
+	txXDRs := []string{}
+	cursors := []string{}
+	for tx := range txsCh {
+		txXDRs = append(txXDRs, tx.TransactionXDR)
+		cursors = append(cursors, tx.Cursor)
+	}
+	tx1XDR, err := xdr.MarshalBase64(tx1)
+	require.NoError(t, err)
+	tx2XDR, err := xdr.MarshalBase64(tx2)
+	require.NoError(t, err)
+	tx3XDR, err := xdr.MarshalBase64(tx3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{tx1XDR, tx2XDR, tx3XDR}, txXDRs)
+	assert.Equal(t, []string{"8589938688", "8589942784", "12884905984"}, cursors)
+}
+
+func TestStreamer_StreamTx_directoryFollow(t *testing.T) {
+	account := keypair.MustRandom().FromAddress()
+	closeTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tx1 := testTx(t, account, 1)
+	tx2 := testTx(t, account, 2)
+
+	dir := t.TempDir()
+	writeBatch(t, filepath.Join(dir, "FFFFFFFD--2.xdr"), testLedger(t, 2, closeTime, tx1))
+
+	streamer := Streamer{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Source:            &DirectorySource{Dir: dir},
+		ErrorHandler:      func(err error) { t.Error(err) },
+		PollInterval:      time.Millisecond,
+	}
+	txsCh, cancel := streamer.StreamTx("", account)
+	defer cancel()
+
+	tx, ok := <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, "8589938688", tx.Cursor)
+
+	// Ledgers written after the stream has caught up are streamed.
+	writeBatch(t, filepath.Join(dir, "FFFFFFFC--3.xdr"), testLedger(t, 3, closeTime, tx2))
+	tx, ok = <-txsCh
+	require.True(t, ok)
+	assert.Equal(t, "12884905984", tx.Cursor)
+
+	cancel()
+	_, ok = <-txsCh
+	assert.False(t, ok)
+}
+
+// replaySource is a LedgerSource that ignores the start sequence and reads all
+// of its ledgers each time it is opened.
+type replaySource []xdr.LedgerCloseMeta
+
+func (s replaySource) Open(start uint32) (LedgerReader, error) {
+	return &replayReader{ledgers: s}, nil
+}
+
+type replayReader struct {
+	ledgers []xdr.LedgerCloseMeta
+}
+
+func (r *replayReader) Read() (xdr.LedgerCloseMeta, error) {
+	if len(r.ledgers) == 0 {
+		return xdr.LedgerCloseMeta{}, io.EOF
+	}
+	lcm := r.ledgers[0]
+	r.ledgers = r.ledgers[1:]
+	return lcm, nil
+}
+
+func (r *replayReader) Close() error {
+	return nil
+}
+
+func TestStreamer_StreamTx_reopenKeepsProgress(t *testing.T) {
+	account := keypair.MustRandom().FromAddress()
+	closeTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	streamer := Streamer{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Source: replaySource{
+			testLedger(t, 2, closeTime, testTx(t, account, 1)),
+			testLedger(t, 3, closeTime, testTx(t, account, 2)),
+		},
+		ErrorHandler: func(err error) { t.Error(err) },
+		PollInterval: time.Millisecond,
+	}
+	txsCh, cancel := streamer.StreamTx("", account)
+	defer cancel()
+
+	assert.Equal(t, "8589938688", (<-txsCh).Cursor)
+	assert.Equal(t, "12884905984", (<-txsCh).Cursor)
+
+	// Reopening the source reads the ledgers again, but the transactions
+	// already streamed are not streamed again.
+	select {
+	case tx := <-txsCh:
+		t.Errorf("unexpected tx streamed again: %s", tx.Cursor)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
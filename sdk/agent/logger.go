@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger logs messages at levels, with fields given as alternating keys and
+// values, such as "iteration", 3. It is implemented by *slog.Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// NewTextLogger returns a Logger that writes each message to w as a line of
+// key=value pairs, for use where a *slog.Logger is not available.
+func NewTextLogger(w io.Writer) Logger {
+	return &textLogger{w: w}
+}
+
+// loggerOrWriter returns the logger if set, otherwise a text logger writing to
+// the writer if set, otherwise a logger that discards messages.
+func loggerOrWriter(logger Logger, w io.Writer) Logger {
+	if logger != nil {
+		return logger
+	}
+	if w == nil {
+		w = io.Discard
+	}
+	return NewTextLogger(w)
+}
+
+type textLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *textLogger) Debug(msg string, args ...interface{}) { l.log("DEBUG", msg, args) }
+func (l *textLogger) Info(msg string, args ...interface{})  { l.log("INFO", msg, args) }
+func (l *textLogger) Warn(msg string, args ...interface{})  { l.log("WARN", msg, args) }
+func (l *textLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args) }
+
+func (l *textLogger) log(level, msg string, args []interface{}) {
+	if l.w == io.Discard {
+		return
+	}
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "time=%s level=%s msg=%s", time.Now().UTC().Format(time.RFC3339Nano), level, quoteLogValue(msg))
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " !BADKEY=%s", quoteLogValue(fmt.Sprint(args[i])))
+			break
+		}
+		fmt.Fprintf(&b, " %v=%s", args[i], quoteLogValue(fmt.Sprint(args[i+1])))
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, b.String())
+}
+
+func quoteLogValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// fieldsLogger is a Logger that adds fields to every message logged.
+type fieldsLogger struct {
+	logger Logger
+	fields []interface{}
+}
+
+func (l fieldsLogger) Debug(msg string, args ...interface{}) { l.logger.Debug(msg, l.with(args)...) }
+func (l fieldsLogger) Info(msg string, args ...interface{})  { l.logger.Info(msg, l.with(args)...) }
+func (l fieldsLogger) Warn(msg string, args ...interface{})  { l.logger.Warn(msg, l.with(args)...) }
+func (l fieldsLogger) Error(msg string, args ...interface{}) { l.logger.Error(msg, l.with(args)...) }
+
+func (l fieldsLogger) with(args []interface{}) []interface{} {
+	all := make([]interface{}, 0, len(l.fields)+len(args))
+	all = append(all, l.fields...)
+	return append(all, args...)
+}
+
+// log returns the agent's logger with fields identifying the channel: the
+// local channel account, the other participant's channel account, and the
+// iteration of the latest authorized agreement.
+//
+// Must be called with the mutex locked.
+func (a *Agent) log() Logger {
+	var fields []interface{}
+	if a.channelAccountKey != nil {
+		fields = append(fields, "channel_account", a.channelAccountKey.Address())
+	}
+	if a.otherChannelAccount != nil {
+		fields = append(fields, "peer", a.otherChannelAccount.Address())
+	}
+	if a.channel != nil {
+		fields = append(fields, "iteration", a.channel.LatestCloseAgreement().Envelope.Details.IterationNumber)
+	}
+	logger := a.logger
+	if logger == nil {
+		logger = loggerOrWriter(nil, nil)
+	}
+	return fieldsLogger{logger: logger, fields: fields}
+}
+
+// logWithLock is log for use when the mutex is not locked.
+func (a *Agent) logWithLock() Logger {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.log()
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type logRecord struct {
+	level string
+	msg   string
+	args  []interface{}
+}
+
+type recordingLogger struct {
+	records []logRecord
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) {
+	l.records = append(l.records, logRecord{"DEBUG", msg, args})
+}
+
+func (l *recordingLogger) Info(msg string, args ...interface{}) {
+	l.records = append(l.records, logRecord{"INFO", msg, args})
+}
+
+func (l *recordingLogger) Warn(msg string, args ...interface{}) {
+	l.records = append(l.records, logRecord{"WARN", msg, args})
+}
+
+func (l *recordingLogger) Error(msg string, args ...interface{}) {
+	l.records = append(l.records, logRecord{"ERROR", msg, args})
+}
+
+func TestTextLogger(t *testing.T) {
+	b := strings.Builder{}
+	l := NewTextLogger(&b)
+
+	l.Info("payment sent", "amount", 100, "memo", "two words")
+	l.Error("error", "error", errors.New(`bad "thing"`), "dangling")
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, `^time=\S+ level=INFO msg="payment sent" amount=100 memo="two words"$`, lines[0])
+	assert.Regexp(t, `^time=\S+ level=ERROR msg=error error="bad \\"thing\\"" !BADKEY=dangling$`, lines[1])
+}
+
+func TestAgent_log(t *testing.T) {
+	localChannelAccount := keypair.MustRandom().FromAddress()
+	remoteChannelAccount := keypair.MustRandom().FromAddress()
+	logger := &recordingLogger{}
+	a := NewAgent(Config{
+		ChannelAccountKey: localChannelAccount,
+		Logger:            logger,
+	})
+	assert.Equal(t, logger, a.Config().Logger)
+
+	a.log().Info("before connecting", "key", "value")
+	a.otherChannelAccount = remoteChannelAccount
+	a.logWithLock().Warn("after connecting")
+
+	assert.Equal(t, []logRecord{
+		{"INFO", "before connecting", []interface{}{"channel_account", localChannelAccount.Address(), "key", "value"}},
+		{"WARN", "after connecting", []interface{}{"channel_account", localChannelAccount.Address(), "peer", remoteChannelAccount.Address()}},
+	}, logger.records)
+}
+
+func TestAgent_logWriter(t *testing.T) {
+	b := strings.Builder{}
+	a := NewAgent(Config{LogWriter: &b})
+	a.log().Debug("message")
+	assert.Contains(t, b.String(), "level=DEBUG msg=message\n")
+}
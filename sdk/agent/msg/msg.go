@@ -8,6 +8,7 @@ package msg
 import (
 	"encoding/gob"
 	"io"
+	"time"
 
 	"github.com/stellar/go/keypair"
 	"github.com/stellar/starlight/sdk/state"
@@ -21,10 +22,31 @@ const (
 	TypeHello           Type = 10
 	TypeOpenRequest     Type = 20
 	TypeOpenResponse    Type = 21
+	TypeOpenReject      Type = 22
 	TypePaymentRequest  Type = 30
 	TypePaymentResponse Type = 31
+	TypePaymentReject   Type = 32
 	TypeCloseRequest    Type = 40
 	TypeCloseResponse   Type = 41
+	TypeCloseReject     Type = 42
+)
+
+// RejectReason is a code indicating why a request was rejected by the
+// participant receiving it.
+type RejectReason int
+
+const (
+	RejectReasonUnspecified                        RejectReason = 0
+	RejectReasonInvalid                            RejectReason = 1
+	RejectReasonChannelState                       RejectReason = 2
+	RejectReasonUnderfunded                        RejectReason = 3
+	RejectReasonNotAccepted                        RejectReason = 4
+	RejectReasonAssetNotAccepted                   RejectReason = 10
+	RejectReasonObservationPeriodTimeTooShort      RejectReason = 11
+	RejectReasonObservationPeriodTimeTooLong       RejectReason = 12
+	RejectReasonObservationPeriodLedgerGapTooShort RejectReason = 13
+	RejectReasonObservationPeriodLedgerGapTooLong  RejectReason = 14
+	RejectReasonExpiryTooFar                       RejectReason = 15
 )
 
 // Message is a message that can be transmitted to support two participants in a
@@ -33,16 +55,50 @@ const (
 type Message struct {
 	Type Type
 
+	// TraceParent is the span context of the operation that sent the message,
+	// in the W3C Trace Context traceparent format, so that the participant
+	// receiving it can trace its processing as part of the same trace. It is
+	// empty if the operation is not traced.
+	TraceParent string
+
 	Hello *Hello
 
 	OpenRequest  *state.OpenEnvelope
 	OpenResponse *state.OpenSignatures
+	OpenReject   *OpenReject
 
 	PaymentRequest  *state.CloseEnvelope
 	PaymentResponse *state.CloseSignatures
+	PaymentReject   *Reject
 
 	CloseRequest  *state.CloseEnvelope
 	CloseResponse *state.CloseSignatures
+	CloseReject   *Reject
+}
+
+// Reject can be used to signal to another participant that a request they
+// sent will not be confirmed, and why.
+type Reject struct {
+	Reason  RejectReason
+	Message string
+}
+
+// OpenReject can be used to signal to another participant that an open
+// request they sent will not be confirmed, and why. It optionally contains a
+// counter-proposal with open parameters that the rejecting participant would
+// accept.
+type OpenReject struct {
+	Reject
+	CounterProposal *OpenCounterProposal
+}
+
+// OpenCounterProposal contains the parameters of an open that a participant
+// would accept in place of an open they rejected.
+type OpenCounterProposal struct {
+	ObservationPeriodTime      time.Duration
+	ObservationPeriodLedgerGap uint32
+	Asset                      state.Asset
+	ExpiresAt                  time.Time
 }
 
 // Hello can be used to signal to another participant a minimal amount of
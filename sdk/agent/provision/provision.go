@@ -0,0 +1,315 @@
+// Package provision contains a Provisioner that creates, funds, verifies, and
+// retires the channel accounts used by an agent.
+package provision
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild"
+)
+
+// ErrAccountNotFound is returned by an AccountCollector when the account does
+// not exist.
+var ErrAccountNotFound = errors.New("account not found")
+
+// AccountCollector gets the signers and trustlines of an account.
+type AccountCollector interface {
+	// GetAccount returns the account, or ErrAccountNotFound if the account
+	// does not exist.
+	GetAccount(account *keypair.FromAddress) (Account, error)
+}
+
+// Account is the signers and trustlines of an account.
+type Account struct {
+	MasterWeight    byte
+	LowThreshold    byte
+	MediumThreshold byte
+	HighThreshold   byte
+
+	// Signers are the weights of the account's signers, excluding the master
+	// key, keyed by the signer's address.
+	Signers map[string]int32
+
+	// TrustLines are whether the account's trustline for each asset is
+	// authorized, keyed by the canonical form of the asset.
+	TrustLines map[state.Asset]bool
+}
+
+// Provisioner provisions channel accounts so that they are ready to be used
+// by an agent. A provisioned channel account is sponsored by the creator, has
+// the creator's account as its only signer, and holds a trustline for the
+// channel's asset and a balance that is deposited into the channel at open.
+//
+// Provisioning is idempotent. If the channel account already exists, the
+// steps that have already been completed are skipped, so that provisioning
+// that was interrupted can be resumed by provisioning the same account again.
+type Provisioner struct {
+	NetworkPassphrase string
+
+	// Creator is the account that creates, sponsors, and funds the channel
+	// accounts, and that is a signer of the channel accounts. CreatorSigner
+	// signs transactions for the creator.
+	Creator       *keypair.FromAddress
+	CreatorSigner *keypair.Full
+
+	SequenceNumberCollector agent.SequenceNumberCollector
+	BalanceCollector        agent.BalanceCollector
+	AccountCollector        AccountCollector
+	Submitter               agent.Submitter
+
+	LogWriter io.Writer
+}
+
+// Provision creates the channel account if it does not exist, adds a
+// trustline for the asset if the asset is not native and the account does
+// not have one, and pays the asset from the creator to the channel account
+// until its balance is at least the amount. The channel account is verified
+// before it is changed and once it is provisioned, and an error is returned
+// if the channel account is not controlled by the creator alone.
+//
+// The channel account's key is only used to sign the transaction that
+// creates the account.
+func (p *Provisioner) Provision(channelAccount *keypair.Full, asset state.Asset, amt int64) error {
+	account, err := p.AccountCollector.GetAccount(channelAccount.FromAddress())
+	if errors.Is(err, ErrAccountNotFound) {
+		p.logf("channel account %s not found, creating", channelAccount.Address())
+		err = p.create(channelAccount, asset)
+		if err != nil {
+			return err
+		}
+		account, err = p.AccountCollector.GetAccount(channelAccount.FromAddress())
+	}
+	if err != nil {
+		return fmt.Errorf("getting channel account %s: %w", channelAccount.Address(), err)
+	}
+	err = p.verifySigners(account)
+	if err != nil {
+		return fmt.Errorf("verifying channel account %s: %w", channelAccount.Address(), err)
+	}
+
+	if !asset.IsNative() {
+		if _, ok := account.TrustLines[state.Asset(asset.StringCanonical())]; !ok {
+			p.logf("channel account %s has no trustline for %s, adding", channelAccount.Address(), asset.StringCanonical())
+			err = p.addTrustLine(channelAccount.FromAddress(), asset)
+			if err != nil {
+				return err
+			}
+			account, err = p.AccountCollector.GetAccount(channelAccount.FromAddress())
+			if err != nil {
+				return fmt.Errorf("getting channel account %s: %w", channelAccount.Address(), err)
+			}
+		}
+		authorized, ok := account.TrustLines[state.Asset(asset.StringCanonical())]
+		if !ok {
+			return fmt.Errorf("verifying channel account %s: trustline for %s not found", channelAccount.Address(), asset.StringCanonical())
+		}
+		if !authorized {
+			return fmt.Errorf("verifying channel account %s: trustline for %s not authorized", channelAccount.Address(), asset.StringCanonical())
+		}
+	}
+
+	balance, err := p.BalanceCollector.GetBalance(channelAccount.FromAddress(), asset)
+	if err != nil {
+		return fmt.Errorf("getting balance of channel account %s: %w", channelAccount.Address(), err)
+	}
+	if balance < amt {
+		p.logf("channel account %s has balance %d, funding %d", channelAccount.Address(), balance, amt-balance)
+		err = p.fund(channelAccount.FromAddress(), asset, amt-balance)
+		if err != nil {
+			return err
+		}
+		balance, err = p.BalanceCollector.GetBalance(channelAccount.FromAddress(), asset)
+		if err != nil {
+			return fmt.Errorf("getting balance of channel account %s: %w", channelAccount.Address(), err)
+		}
+		if balance < amt {
+			return fmt.Errorf("verifying channel account %s: balance %d less than %d", channelAccount.Address(), balance, amt)
+		}
+	}
+
+	p.logf("channel account %s provisioned", channelAccount.Address())
+	return nil
+}
+
+// Retire tears down the channel account once its channel has closed, paying
+// its balance to the creator, removing its trustline if the asset is not
+// native, and merging it into the creator so that the reserves sponsored by
+// the creator are released. The channel account is verified before it is
+// retired, and an error is returned if the channel account is not controlled
+// by the creator alone, such as when its channel has not closed.
+//
+// Retiring is idempotent. If the channel account does not exist it has
+// already been retired and nothing is done.
+func (p *Provisioner) Retire(channelAccount *keypair.FromAddress, asset state.Asset) error {
+	account, err := p.AccountCollector.GetAccount(channelAccount)
+	if errors.Is(err, ErrAccountNotFound) {
+		p.logf("channel account %s not found, already retired", channelAccount.Address())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting channel account %s: %w", channelAccount.Address(), err)
+	}
+	err = p.verifySigners(account)
+	if err != nil {
+		return fmt.Errorf("verifying channel account %s: %w", channelAccount.Address(), err)
+	}
+
+	var balance int64
+	if !asset.IsNative() {
+		balance, err = p.BalanceCollector.GetBalance(channelAccount, asset)
+		if err != nil {
+			return fmt.Errorf("getting balance of channel account %s: %w", channelAccount.Address(), err)
+		}
+	}
+	seqNum, err := p.SequenceNumberCollector.GetSequenceNumber(channelAccount)
+	if err != nil {
+		return fmt.Errorf("getting sequence number of channel account %s: %w", channelAccount.Address(), err)
+	}
+	tx, err := txbuild.RetireChannelAccount(txbuild.RetireChannelAccountParams{
+		ChannelAccount: channelAccount,
+		Owner:          p.Creator,
+		SequenceNumber: seqNum + 1,
+		Asset:          asset.Asset(),
+		AssetBalance:   balance,
+	})
+	if err != nil {
+		return fmt.Errorf("building tx to retire channel account: %w", err)
+	}
+	tx, err = tx.Sign(p.NetworkPassphrase, p.CreatorSigner)
+	if err != nil {
+		return fmt.Errorf("signing tx to retire channel account: %w", err)
+	}
+	err = p.Submitter.SubmitTx(tx)
+	if err != nil {
+		return fmt.Errorf("submitting tx to retire channel account: %w", err)
+	}
+
+	_, err = p.AccountCollector.GetAccount(channelAccount)
+	if !errors.Is(err, ErrAccountNotFound) {
+		return fmt.Errorf("verifying channel account %s retired: account still exists", channelAccount.Address())
+	}
+	p.logf("channel account %s retired", channelAccount.Address())
+	return nil
+}
+
+// verifySigners verifies that the creator is the only signer of the account
+// and can sign all transactions for it.
+func (p *Provisioner) verifySigners(account Account) error {
+	if account.MasterWeight != 0 {
+		return fmt.Errorf("master key has weight %d", account.MasterWeight)
+	}
+	if len(account.Signers) != 1 || account.Signers[p.Creator.Address()] == 0 {
+		return fmt.Errorf("creator is not the only signer")
+	}
+	weight := account.Signers[p.Creator.Address()]
+	if int32(account.LowThreshold) > weight || int32(account.MediumThreshold) > weight || int32(account.HighThreshold) > weight {
+		return fmt.Errorf("creator signer weight %d less than thresholds", weight)
+	}
+	return nil
+}
+
+func (p *Provisioner) create(channelAccount *keypair.Full, asset state.Asset) error {
+	seqNum, err := p.SequenceNumberCollector.GetSequenceNumber(p.Creator)
+	if err != nil {
+		return fmt.Errorf("getting sequence number of creator: %w", err)
+	}
+	tx, err := txbuild.CreateChannelAccount(txbuild.CreateChannelAccountParams{
+		Creator:        p.Creator,
+		ChannelAccount: channelAccount.FromAddress(),
+		SequenceNumber: seqNum + 1,
+		Asset:          asset.Asset(),
+	})
+	if err != nil {
+		return fmt.Errorf("building tx to create channel account: %w", err)
+	}
+	tx, err = tx.Sign(p.NetworkPassphrase, p.CreatorSigner, channelAccount)
+	if err != nil {
+		return fmt.Errorf("signing tx to create channel account: %w", err)
+	}
+	err = p.Submitter.SubmitTx(tx)
+	if err != nil {
+		return fmt.Errorf("submitting tx to create channel account: %w", err)
+	}
+	return nil
+}
+
+func (p *Provisioner) addTrustLine(channelAccount *keypair.FromAddress, asset state.Asset) error {
+	tx, err := p.buildTx(
+		&txnbuild.BeginSponsoringFutureReserves{
+			SponsoredID: channelAccount.Address(),
+		},
+		&txnbuild.ChangeTrust{
+			Line:          asset.Asset().(txnbuild.CreditAsset).MustToChangeTrustAsset(),
+			Limit:         amount.StringFromInt64(math.MaxInt64),
+			SourceAccount: channelAccount.Address(),
+		},
+		&txnbuild.EndSponsoringFutureReserves{
+			SourceAccount: channelAccount.Address(),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("building tx to add trustline: %w", err)
+	}
+	err = p.Submitter.SubmitTx(tx)
+	if err != nil {
+		return fmt.Errorf("submitting tx to add trustline: %w", err)
+	}
+	return nil
+}
+
+func (p *Provisioner) fund(channelAccount *keypair.FromAddress, asset state.Asset, amt int64) error {
+	tx, err := p.buildTx(&txnbuild.Payment{
+		Destination: channelAccount.Address(),
+		Amount:      amount.StringFromInt64(amt),
+		Asset:       asset.Asset(),
+	})
+	if err != nil {
+		return fmt.Errorf("building tx to fund channel account: %w", err)
+	}
+	err = p.Submitter.SubmitTx(tx)
+	if err != nil {
+		return fmt.Errorf("submitting tx to fund channel account: %w", err)
+	}
+	return nil
+}
+
+// buildTx builds and signs a transaction from the creator containing the
+// operations. Operations with the channel account as their source are
+// authorized by the creator's signature since the creator is the channel
+// account's signer.
+func (p *Provisioner) buildTx(ops ...txnbuild.Operation) (*txnbuild.Transaction, error) {
+	seqNum, err := p.SequenceNumberCollector.GetSequenceNumber(p.Creator)
+	if err != nil {
+		return nil, fmt.Errorf("getting sequence number of creator: %w", err)
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{
+			AccountID: p.Creator.Address(),
+			Sequence:  seqNum + 1,
+		},
+		BaseFee: 0,
+		Preconditions: txnbuild.Preconditions{
+			TimeBounds: txnbuild.NewTimeout(300),
+		},
+		Operations: ops,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx.Sign(p.NetworkPassphrase, p.CreatorSigner)
+}
+
+func (p *Provisioner) logf(format string, args ...interface{}) {
+	if p.LogWriter == nil {
+		return
+	}
+	fmt.Fprintf(p.LogWriter, format+"\n", args...)
+}
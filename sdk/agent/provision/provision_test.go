@@ -0,0 +1,295 @@
+package provision
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNetwork holds the state of a single channel account and applies the
+// operations of submitted transactions to it.
+type fakeNetwork struct {
+	t             *testing.T
+	creator       *keypair.FromAddress
+	account       *Account
+	balance       int64
+	seqNum        int64
+	channelSeqNum int64
+	submitted     []*txnbuild.Transaction
+}
+
+func (n *fakeNetwork) GetAccount(account *keypair.FromAddress) (Account, error) {
+	if n.account == nil {
+		return Account{}, ErrAccountNotFound
+	}
+	return *n.account, nil
+}
+
+func (n *fakeNetwork) GetBalance(account *keypair.FromAddress, asset state.Asset) (int64, error) {
+	return n.balance, nil
+}
+
+func (n *fakeNetwork) GetSequenceNumber(account *keypair.FromAddress) (int64, error) {
+	if account.Equal(n.creator) {
+		return n.seqNum, nil
+	}
+	return n.channelSeqNum, nil
+}
+
+func (n *fakeNetwork) SubmitTx(tx *txnbuild.Transaction) error {
+	seqNum := &n.channelSeqNum
+	if tx.SourceAccount().AccountID == n.creator.Address() {
+		seqNum = &n.seqNum
+	}
+	assert.Equal(n.t, *seqNum+1, tx.SequenceNumber())
+	*seqNum = tx.SequenceNumber()
+	n.submitted = append(n.submitted, tx)
+	for _, op := range tx.Operations() {
+		switch op := op.(type) {
+		case *txnbuild.CreateAccount:
+			n.account = &Account{MasterWeight: 1, Signers: map[string]int32{}, TrustLines: map[state.Asset]bool{}}
+		case *txnbuild.SetOptions:
+			n.account.MasterWeight = byte(*op.MasterWeight)
+			n.account.LowThreshold = byte(*op.LowThreshold)
+			n.account.MediumThreshold = byte(*op.MediumThreshold)
+			n.account.HighThreshold = byte(*op.HighThreshold)
+			n.account.Signers[op.Signer.Address] = int32(op.Signer.Weight)
+		case *txnbuild.ChangeTrust:
+			asset, err := op.Line.ToXDR()
+			require.NoError(n.t, err)
+			if op.Limit == "0" {
+				delete(n.account.TrustLines, state.Asset(asset.ToAsset().StringCanonical()))
+			} else {
+				n.account.TrustLines[state.Asset(asset.ToAsset().StringCanonical())] = true
+			}
+		case *txnbuild.Payment:
+			if op.Destination == n.creator.Address() {
+				n.balance -= int64(amount.MustParse(op.Amount))
+			} else {
+				n.balance += int64(amount.MustParse(op.Amount))
+			}
+		case *txnbuild.AccountMerge:
+			n.account = nil
+		}
+	}
+	return nil
+}
+
+func newProvisioner(n *fakeNetwork, creatorSigner *keypair.Full) (*Provisioner, *bytes.Buffer) {
+	logs := &bytes.Buffer{}
+	return &Provisioner{
+		NetworkPassphrase:       network.TestNetworkPassphrase,
+		Creator:                 creatorSigner.FromAddress(),
+		CreatorSigner:           creatorSigner,
+		SequenceNumberCollector: n,
+		BalanceCollector:        n,
+		AccountCollector:        n,
+		Submitter:               n,
+		LogWriter:               logs,
+	}, logs
+}
+
+func opTypes(tx *txnbuild.Transaction) []string {
+	types := []string{}
+	for _, op := range tx.Operations() {
+		o, _ := op.BuildXDR()
+		types = append(types, o.Body.Type.String())
+	}
+	return types
+}
+
+func TestProvisioner_Provision_create(t *testing.T) {
+	creator := keypair.MustRandom()
+	channelAccount := keypair.MustRandom()
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	n := &fakeNetwork{t: t, creator: creator.FromAddress(), seqNum: 100}
+	p, _ := newProvisioner(n, creator)
+
+	err := p.Provision(channelAccount, asset, 1000)
+	require.NoError(t, err)
+
+	require.Len(t, n.submitted, 2)
+	assert.Equal(t, []string{
+		"OperationTypeBeginSponsoringFutureReserves",
+		"OperationTypeCreateAccount",
+		"OperationTypeSetOptions",
+		"OperationTypeChangeTrust",
+		"OperationTypeEndSponsoringFutureReserves",
+	}, opTypes(n.submitted[0]))
+	assert.Len(t, n.submitted[0].Signatures(), 2)
+	assert.Equal(t, []string{"OperationTypePayment"}, opTypes(n.submitted[1]))
+	assert.Equal(t, int64(1000), n.balance)
+
+	// Provisioning again is a no-op.
+	err = p.Provision(channelAccount, asset, 1000)
+	require.NoError(t, err)
+	assert.Len(t, n.submitted, 2)
+}
+
+func TestProvisioner_Provision_resume(t *testing.T) {
+	creator := keypair.MustRandom()
+	channelAccount := keypair.MustRandom()
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+
+	// The account was created for the native asset and partly funded.
+	n := &fakeNetwork{
+		t:       t,
+		creator: creator.FromAddress(),
+		seqNum:  100,
+		account: &Account{
+			LowThreshold:    1,
+			MediumThreshold: 1,
+			HighThreshold:   1,
+			Signers:         map[string]int32{creator.Address(): 1},
+			TrustLines:      map[state.Asset]bool{},
+		},
+		balance: 400,
+	}
+	p, logs := newProvisioner(n, creator)
+
+	err := p.Provision(channelAccount, asset, 1000)
+	require.NoError(t, err)
+
+	require.Len(t, n.submitted, 2)
+	assert.Equal(t, []string{
+		"OperationTypeBeginSponsoringFutureReserves",
+		"OperationTypeChangeTrust",
+		"OperationTypeEndSponsoringFutureReserves",
+	}, opTypes(n.submitted[0]))
+	assert.Len(t, n.submitted[0].Signatures(), 1)
+	assert.Equal(t, []string{"OperationTypePayment"}, opTypes(n.submitted[1]))
+	assert.Equal(t, int64(1000), n.balance)
+	assert.Equal(t, "channel account "+channelAccount.Address()+" has no trustline for "+string(asset)+", adding\n"+
+		"channel account "+channelAccount.Address()+" has balance 400, funding 600\n"+
+		"channel account "+channelAccount.Address()+" provisioned\n", logs.String())
+}
+
+func TestProvisioner_Provision_invalid(t *testing.T) {
+	creator := keypair.MustRandom()
+	channelAccount := keypair.MustRandom()
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+
+	testCases := []struct {
+		name    string
+		account Account
+		wantErr string
+	}{
+		{
+			name: "master key not disabled",
+			account: Account{
+				MasterWeight: 1,
+				Signers:      map[string]int32{creator.Address(): 1},
+			},
+			wantErr: "master key has weight 1",
+		},
+		{
+			name: "other signer",
+			account: Account{
+				Signers: map[string]int32{creator.Address(): 1, keypair.MustRandom().Address(): 1},
+			},
+			wantErr: "creator is not the only signer",
+		},
+		{
+			name: "thresholds too high",
+			account: Account{
+				LowThreshold:    2,
+				MediumThreshold: 2,
+				HighThreshold:   2,
+				Signers:         map[string]int32{creator.Address(): 1},
+			},
+			wantErr: "creator signer weight 1 less than thresholds",
+		},
+		{
+			name: "trustline not authorized",
+			account: Account{
+				Signers:    map[string]int32{creator.Address(): 1},
+				TrustLines: map[state.Asset]bool{asset: false},
+			},
+			wantErr: "trustline for " + string(asset) + " not authorized",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			account := tc.account
+			n := &fakeNetwork{t: t, creator: creator.FromAddress(), account: &account}
+			p, _ := newProvisioner(n, creator)
+
+			err := p.Provision(channelAccount, asset, 1000)
+			assert.EqualError(t, err, "verifying channel account "+channelAccount.Address()+": "+tc.wantErr)
+			assert.Empty(t, n.submitted)
+		})
+	}
+}
+
+func TestProvisioner_Retire(t *testing.T) {
+	creator := keypair.MustRandom()
+	channelAccount := keypair.MustRandom()
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+
+	// The channel has closed and control of the channel account has returned
+	// to the creator.
+	n := &fakeNetwork{
+		t:             t,
+		creator:       creator.FromAddress(),
+		seqNum:        100,
+		channelSeqNum: 205,
+		account: &Account{
+			LowThreshold:    1,
+			MediumThreshold: 1,
+			HighThreshold:   1,
+			Signers:         map[string]int32{creator.Address(): 1},
+			TrustLines:      map[state.Asset]bool{asset: true},
+		},
+		balance: 400,
+	}
+	p, logs := newProvisioner(n, creator)
+
+	err := p.Retire(channelAccount.FromAddress(), asset)
+	require.NoError(t, err)
+
+	require.Len(t, n.submitted, 1)
+	assert.Equal(t, channelAccount.Address(), n.submitted[0].SourceAccount().AccountID)
+	assert.Equal(t, []string{
+		"OperationTypePayment",
+		"OperationTypeChangeTrust",
+		"OperationTypeAccountMerge",
+	}, opTypes(n.submitted[0]))
+	assert.Equal(t, int64(0), n.balance)
+	assert.Nil(t, n.account)
+
+	// Retiring again is a no-op.
+	err = p.Retire(channelAccount.FromAddress(), asset)
+	require.NoError(t, err)
+	assert.Len(t, n.submitted, 1)
+	assert.Equal(t, "channel account "+channelAccount.Address()+" retired\n"+
+		"channel account "+channelAccount.Address()+" not found, already retired\n", logs.String())
+}
+
+func TestProvisioner_Retire_channelNotClosed(t *testing.T) {
+	creator := keypair.MustRandom()
+	channelAccount := keypair.MustRandom()
+
+	// The other participant's signer is still a signer of the channel account.
+	n := &fakeNetwork{
+		t:       t,
+		creator: creator.FromAddress(),
+		account: &Account{
+			LowThreshold:    2,
+			MediumThreshold: 2,
+			HighThreshold:   2,
+			Signers:         map[string]int32{creator.Address(): 1, keypair.MustRandom().Address(): 1},
+		},
+	}
+	p, _ := newProvisioner(n, creator)
+
+	err := p.Retire(channelAccount.FromAddress(), state.NativeAsset)
+	assert.EqualError(t, err, "verifying channel account "+channelAccount.Address()+": creator is not the only signer")
+	assert.Empty(t, n.submitted)
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stellar/starlight/sdk/agent/msg"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+// reject sends the reject message to the remote participant, and returns an
+// error describing the rejection so that it is also surfaced locally.
+func (a *Agent) reject(send *msg.Encoder, m msg.Message) error {
+	var r *msg.Reject
+	switch m.Type {
+	case msg.TypeOpenReject:
+		r = &m.OpenReject.Reject
+	case msg.TypePaymentReject:
+		r = m.PaymentReject
+	case msg.TypeCloseReject:
+		r = m.CloseReject
+	default:
+		return fmt.Errorf("rejecting with unrecognized message type %d", m.Type)
+	}
+	a.log().Info("rejecting", "type", m.Type, "reason", r.Reason, "message", r.Message)
+	err := send.Encode(m)
+	if err != nil {
+		return fmt.Errorf("encoding reject to send back: %w", err)
+	}
+	return fmt.Errorf("rejected: %s", r.Message)
+}
+
+func (a *Agent) rejectOpen(send *msg.Encoder, r msg.OpenReject) error {
+	return a.reject(send, msg.Message{
+		Type:       msg.TypeOpenReject,
+		OpenReject: &r,
+	})
+}
+
+// rejectPayment rejects a payment proposed by the other participant, recording
+// the rejection in the channel so that the next payment is expected to use the
+// iteration after the rejected payment, which the other participant discards.
+//
+// Must be called with the mutex locked.
+func (a *Agent) rejectPayment(send *msg.Encoder, ce state.CloseEnvelope, r msg.Reject) error {
+	a.channel.RejectPayment(ce)
+	a.takeSnapshot()
+	return a.reject(send, msg.Message{
+		Type:          msg.TypePaymentReject,
+		PaymentReject: &r,
+	})
+}
+
+// checkOpenPolicy checks that the details of a proposed open are acceptable to
+// the agent. If they are not, an open reject is returned describing why, and
+// containing a counter-proposal the agent would accept. If they are
+// acceptable, nil is returned.
+//
+// The reason and message describe the first limit the open fails, while the
+// counter-proposal corrects every limit the open fails.
+func (a *Agent) checkOpenPolicy(d state.OpenDetails) *msg.OpenReject {
+	var reason msg.RejectReason
+	var message string
+	fail := func(r msg.RejectReason, m string) {
+		if reason == msg.RejectReasonUnspecified {
+			reason = r
+			message = m
+		}
+	}
+	cp := msg.OpenCounterProposal{
+		ObservationPeriodTime:      d.ObservationPeriodTime,
+		ObservationPeriodLedgerGap: d.ObservationPeriodLedgerGap,
+		Asset:                      d.Asset,
+		ExpiresAt:                  d.ExpiresAt,
+	}
+
+	maxExpiresAt := time.Now().Add(a.maxOpenExpiry)
+	if d.ExpiresAt.After(maxExpiresAt) {
+		fail(msg.RejectReasonExpiryTooFar, fmt.Sprintf("open expires at %v, after max of %v", d.ExpiresAt, maxExpiresAt))
+		cp.ExpiresAt = time.Now().Add(a.maxOpenExpiry / 2)
+	}
+	if a.maxObservationPeriodLedgerGap != 0 && d.ObservationPeriodLedgerGap > a.maxObservationPeriodLedgerGap {
+		fail(msg.RejectReasonObservationPeriodLedgerGapTooLong, fmt.Sprintf("observation period ledger gap %d is more than max %d", d.ObservationPeriodLedgerGap, a.maxObservationPeriodLedgerGap))
+		cp.ObservationPeriodLedgerGap = a.maxObservationPeriodLedgerGap
+	}
+	if d.ObservationPeriodLedgerGap < a.minObservationPeriodLedgerGap {
+		fail(msg.RejectReasonObservationPeriodLedgerGapTooShort, fmt.Sprintf("observation period ledger gap %d is less than min %d", d.ObservationPeriodLedgerGap, a.minObservationPeriodLedgerGap))
+		cp.ObservationPeriodLedgerGap = a.minObservationPeriodLedgerGap
+	}
+	if a.maxObservationPeriodTime != 0 && d.ObservationPeriodTime > a.maxObservationPeriodTime {
+		fail(msg.RejectReasonObservationPeriodTimeTooLong, fmt.Sprintf("observation period time %v is more than max %v", d.ObservationPeriodTime, a.maxObservationPeriodTime))
+		cp.ObservationPeriodTime = a.maxObservationPeriodTime
+	}
+	if d.ObservationPeriodTime < a.minObservationPeriodTime {
+		fail(msg.RejectReasonObservationPeriodTimeTooShort, fmt.Sprintf("observation period time %v is less than min %v", d.ObservationPeriodTime, a.minObservationPeriodTime))
+		cp.ObservationPeriodTime = a.minObservationPeriodTime
+	}
+	if len(a.acceptedAssets) > 0 && !assetAccepted(a.acceptedAssets, d.Asset) {
+		fail(msg.RejectReasonAssetNotAccepted, fmt.Sprintf("asset %s is not accepted", d.Asset.StringCanonical()))
+		cp.Asset = a.acceptedAssets[0]
+	}
+
+	if reason == msg.RejectReasonUnspecified {
+		return nil
+	}
+	return &msg.OpenReject{
+		Reject:          msg.Reject{Reason: reason, Message: message},
+		CounterProposal: &cp,
+	}
+}
+
+func assetAccepted(accepted []state.Asset, asset state.Asset) bool {
+	for _, a := range accepted {
+		if a.StringCanonical() == asset.StringCanonical() {
+			return true
+		}
+	}
+	return false
+}
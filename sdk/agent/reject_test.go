@@ -0,0 +1,604 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/agent/msg"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_rejects(t *testing.T) {
+	localChannelAccount := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	localSigner := keypair.MustParseFull("SCBMAMOPWKL2YHWELK63VLAY2R74A6GTLLD4ON223B7K5KZ37MUR6IDF")
+	remoteChannelAccount := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+	remoteSigner := keypair.MustParseFull("SBM7D2IIDSRX5Y3VMTMTXXPB6AIB4WYGZBC2M64U742BNOK32X6SW4NF")
+
+	localTransactionsStream := make(chan StreamedTransaction)
+	remoteTransactionsStream := make(chan StreamedTransaction)
+	sequenceNumberCollector := sequenceNumberCollector(func(accountID *keypair.FromAddress) (int64, error) {
+		if accountID.Equal(localChannelAccount) {
+			return 28037546508288, nil
+		}
+		if accountID.Equal(remoteChannelAccount) {
+			return 28054726377472, nil
+		}
+		return 0, fmt.Errorf("unknown channel account")
+	})
+
+	// Setup the local agent.
+	localEvents := make(chan interface{}, 1)
+	localAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector: balanceCollectorFunc(func(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+			return 100_0000000, nil
+		}),
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			return nil
+		}),
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return localTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    localChannelAccount.FromAddress(),
+		ChannelAccountSigner: localSigner,
+		LogWriter:            io.Discard,
+		Events:               localEvents,
+	})
+
+	// Setup the remote agent, that will only accept opens with an observation
+	// period of at least one minute, and that believes the local has no funds.
+	remoteEvents := make(chan interface{}, 1)
+	remoteAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		AcceptedAssets:             []state.Asset{state.NativeAsset},
+		MinObservationPeriodTime:   time.Minute,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector: balanceCollectorFunc(func(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+			return 0, nil
+		}),
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			return nil
+		}),
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return remoteTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    remoteChannelAccount.FromAddress(),
+		ChannelAccountSigner: remoteSigner,
+		LogWriter:            io.Discard,
+		Events:               remoteEvents,
+	})
+
+	// Connect the two agents.
+	type ReadWriter struct {
+		io.Reader
+		io.Writer
+	}
+	localMsgs := bytes.Buffer{}
+	remoteMsgs := bytes.Buffer{}
+	localAgent.conn = ReadWriter{
+		Reader: &remoteMsgs,
+		Writer: &localMsgs,
+	}
+	remoteAgent.conn = ReadWriter{
+		Reader: &localMsgs,
+		Writer: &remoteMsgs,
+	}
+	err := localAgent.hello()
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = remoteAgent.hello()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	<-localEvents
+	<-remoteEvents
+
+	// Open the channel with an observation period the remote rejects.
+	err = localAgent.Open(state.NativeAsset)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.EqualError(t, err, "handling message: handling message 20: rejected: observation period time 20s is less than min 1m0s")
+	assert.Nil(t, remoteAgent.channel)
+	{
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.IsType(t, ErrorEvent{}, remoteEvent)
+	}
+
+	// Expect the local to receive the rejection with a counter-proposal.
+	err = localAgent.receive()
+	require.NoError(t, err)
+	assert.Nil(t, localAgent.channel)
+	var counterProposal msg.OpenCounterProposal
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		rejectedEvent, ok := localEvent.(OpenRejectedEvent)
+		require.True(t, ok)
+		assert.Equal(t, msg.RejectReasonObservationPeriodTimeTooShort, rejectedEvent.Reason)
+		require.NotNil(t, rejectedEvent.CounterProposal)
+		assert.Equal(t, time.Minute, rejectedEvent.CounterProposal.ObservationPeriodTime)
+		assert.Equal(t, uint32(1), rejectedEvent.CounterProposal.ObservationPeriodLedgerGap)
+		assert.Equal(t, state.NativeAsset, rejectedEvent.CounterProposal.Asset)
+		counterProposal = *rejectedEvent.CounterProposal
+	}
+
+	// Open the channel with an asset the remote rejects.
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	err = localAgent.OpenWithCounterProposal(msg.OpenCounterProposal{
+		ObservationPeriodTime:      time.Minute,
+		ObservationPeriodLedgerGap: 1,
+		Asset:                      asset,
+		ExpiresAt:                  time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.EqualError(t, err, "handling message: handling message 20: rejected: asset "+asset.StringCanonical()+" is not accepted")
+	<-remoteEvents
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		rejectedEvent, ok := localEvent.(OpenRejectedEvent)
+		require.True(t, ok)
+		assert.Equal(t, msg.RejectReasonAssetNotAccepted, rejectedEvent.Reason)
+		require.NotNil(t, rejectedEvent.CounterProposal)
+		assert.Equal(t, state.NativeAsset, rejectedEvent.CounterProposal.Asset)
+	}
+
+	// Open the channel with the counter-proposal which the remote accepts.
+	err = localAgent.OpenWithCounterProposal(counterProposal)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, localAgent.channel.OpenAgreement().Envelope.Details.ObservationPeriodTime)
+
+	// Ingest the open tx, as if it was processed on network.
+	openTx, err := localAgent.channel.OpenTx()
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	openTxStreamed := StreamedTransaction{
+		TransactionXDR: openTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+				InitiatorSigner:         localSigner.Address(),
+				ResponderSigner:         remoteSigner.Address(),
+				InitiatorChannelAccount: localChannelAccount.Address(),
+				ResponderChannelAccount: remoteChannelAccount.Address(),
+				StartSequence:           28037546508289,
+				Asset:                   txnbuild.NativeAsset{},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	localTransactionsStream <- openTxStreamed
+	remoteTransactionsStream <- openTxStreamed
+	assert.IsType(t, ChannelTxObservedEvent{}, <-localEvents)
+	assert.IsType(t, ChannelTxObservedEvent{}, <-remoteEvents)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.IsType(t, OpenedEvent{}, localEvent)
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.IsType(t, OpenedEvent{}, remoteEvent)
+	}
+
+	// Make a payment that the remote rejects as underfunded.
+	err = localAgent.Payment(50_0000000)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.Error(t, err)
+	<-remoteEvents
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		rejectedEvent, ok := localEvent.(PaymentRejectedEvent)
+		require.True(t, ok)
+		assert.Equal(t, msg.RejectReasonUnderfunded, rejectedEvent.Reason)
+		assert.Equal(t, int64(50_0000000), rejectedEvent.CloseAgreement.Envelope.Details.PaymentAmount)
+	}
+	_, ok := localAgent.channel.LatestUnauthorizedCloseAgreement()
+	assert.False(t, ok)
+
+	// Make a payment that the remote accepts after the rejected payment.
+	remoteAgent.balanceCollector = balanceCollectorFunc(func(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+		return 100_0000000, nil
+	})
+	err = localAgent.Payment(50_0000000)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.IsType(t, PaymentSentEvent{}, localEvent)
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.IsType(t, PaymentReceivedEvent{}, remoteEvent)
+	}
+}
+
+func TestAgent_checkOpenPolicy_firstFailingLimit(t *testing.T) {
+	a := &Agent{
+		maxOpenExpiry:            5 * time.Minute,
+		minObservationPeriodTime: 10 * time.Second,
+		acceptedAssets:           []state.Asset{state.NativeAsset},
+	}
+
+	// An open that fails several limits is rejected with the reason of the
+	// first, and a counter-proposal that corrects them all.
+	reject := a.checkOpenPolicy(state.OpenDetails{
+		ObservationPeriodTime: time.Second,
+		Asset:                 state.Asset("ABCD:GABCDEFGHIJKLMNOPQRSTUVWXYZ234567ABCDEFGHIJKLMNOPQRSTUVW"),
+		ExpiresAt:             time.Now().Add(time.Minute),
+	})
+	require.NotNil(t, reject)
+	assert.Equal(t, msg.RejectReasonObservationPeriodTimeTooShort, reject.Reason)
+	assert.Equal(t, "observation period time 1s is less than min 10s", reject.Message)
+	require.NotNil(t, reject.CounterProposal)
+	assert.Equal(t, 10*time.Second, reject.CounterProposal.ObservationPeriodTime)
+	assert.Equal(t, state.NativeAsset, reject.CounterProposal.Asset)
+
+	reject = a.checkOpenPolicy(state.OpenDetails{
+		ObservationPeriodTime: 10 * time.Second,
+		Asset:                 state.NativeAsset,
+		ExpiresAt:             time.Now().Add(time.Minute),
+	})
+	assert.Nil(t, reject)
+}
+
+type acceptPolicyFuncs struct {
+	open    func(p OpenProposal) error
+	payment func(p PaymentProposal) error
+	record  func(p PaymentProposal)
+}
+
+func (f acceptPolicyFuncs) AcceptOpen(p OpenProposal) error {
+	return f.open(p)
+}
+
+func (f acceptPolicyFuncs) AcceptPayment(p PaymentProposal) error {
+	return f.payment(p)
+}
+
+func (f acceptPolicyFuncs) RecordPayment(p PaymentProposal) {
+	if f.record != nil {
+		f.record(p)
+	}
+}
+
+func TestAgent_acceptPolicy(t *testing.T) {
+	localChannelAccount := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	localSigner := keypair.MustParseFull("SCBMAMOPWKL2YHWELK63VLAY2R74A6GTLLD4ON223B7K5KZ37MUR6IDF")
+	remoteChannelAccount := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+	remoteSigner := keypair.MustParseFull("SBM7D2IIDSRX5Y3VMTMTXXPB6AIB4WYGZBC2M64U742BNOK32X6SW4NF")
+
+	localTransactionsStream := make(chan StreamedTransaction)
+	remoteTransactionsStream := make(chan StreamedTransaction)
+	sequenceNumberCollector := sequenceNumberCollector(func(accountID *keypair.FromAddress) (int64, error) {
+		if accountID.Equal(localChannelAccount) {
+			return 28037546508288, nil
+		}
+		if accountID.Equal(remoteChannelAccount) {
+			return 28054726377472, nil
+		}
+		return 0, fmt.Errorf("unknown channel account")
+	})
+	balanceCollector := balanceCollectorFunc(func(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+		return 100_0000000, nil
+	})
+	submitter := submitterFunc(func(tx *txnbuild.Transaction) error {
+		return nil
+	})
+
+	// Setup the local agent.
+	localEvents := make(chan interface{}, 1)
+	localAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		SequenceNumberCollector:    sequenceNumberCollector,
+		BalanceCollector:           balanceCollector,
+		Submitter:                  submitter,
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return localTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    localChannelAccount.FromAddress(),
+		ChannelAccountSigner: localSigner,
+		LogWriter:            io.Discard,
+		Events:               localEvents,
+	})
+
+	// Setup the remote agent with a policy that rejects the first open, and
+	// payments with memos that are not "ok".
+	openProposals := []OpenProposal{}
+	paymentProposals := []PaymentProposal{}
+	recordedPayments := []PaymentProposal{}
+	remoteEvents := make(chan interface{}, 1)
+	remoteAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		AcceptPolicy: acceptPolicyFuncs{
+			open: func(p OpenProposal) error {
+				openProposals = append(openProposals, p)
+				if len(openProposals) == 1 {
+					return fmt.Errorf("not yet")
+				}
+				return nil
+			},
+			payment: func(p PaymentProposal) error {
+				paymentProposals = append(paymentProposals, p)
+				if string(p.Details.Memo) != "ok" {
+					return fmt.Errorf("memo is not ok")
+				}
+				return nil
+			},
+			record: func(p PaymentProposal) {
+				recordedPayments = append(recordedPayments, p)
+			},
+		},
+		SequenceNumberCollector: sequenceNumberCollector,
+		BalanceCollector:        balanceCollector,
+		Submitter:               submitter,
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return remoteTransactionsStream, func() {}
+		}),
+		ChannelAccountKey:    remoteChannelAccount.FromAddress(),
+		ChannelAccountSigner: remoteSigner,
+		LogWriter:            io.Discard,
+		Events:               remoteEvents,
+	})
+
+	// Connect the two agents.
+	type ReadWriter struct {
+		io.Reader
+		io.Writer
+	}
+	localMsgs := bytes.Buffer{}
+	remoteMsgs := bytes.Buffer{}
+	localAgent.conn = ReadWriter{
+		Reader: &remoteMsgs,
+		Writer: &localMsgs,
+	}
+	remoteAgent.conn = ReadWriter{
+		Reader: &localMsgs,
+		Writer: &remoteMsgs,
+	}
+	err := localAgent.hello()
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = remoteAgent.hello()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	<-localEvents
+	<-remoteEvents
+
+	// Open the channel which the policy rejects.
+	err = localAgent.Open(state.NativeAsset)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.EqualError(t, err, "handling message: handling message 20: rejected: open not accepted: not yet")
+	assert.Nil(t, remoteAgent.channel)
+	<-remoteEvents
+	require.Len(t, openProposals, 1)
+	assert.True(t, localChannelAccount.Equal(openProposals[0].ChannelAccount))
+	assert.Equal(t, localSigner.Address(), openProposals[0].Signer.Address())
+	assert.Equal(t, state.NativeAsset, openProposals[0].Details.Asset)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		rejectedEvent, ok := localEvent.(OpenRejectedEvent)
+		require.True(t, ok)
+		assert.Equal(t, msg.RejectReasonNotAccepted, rejectedEvent.Reason)
+		assert.Equal(t, "open not accepted: not yet", rejectedEvent.Message)
+		assert.Nil(t, rejectedEvent.CounterProposal)
+	}
+
+	// Open the channel again which the policy accepts.
+	err = localAgent.Open(state.NativeAsset)
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	require.Len(t, openProposals, 2)
+
+	// Ingest the open tx, as if it was processed on network.
+	openTx, err := localAgent.channel.OpenTx()
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	openTxStreamed := StreamedTransaction{
+		TransactionXDR: openTxXDR,
+		ResultXDR: func() string {
+			r, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+			return r
+		}(),
+		ResultMetaXDR: func() string {
+			r, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+				InitiatorSigner:         localSigner.Address(),
+				ResponderSigner:         remoteSigner.Address(),
+				InitiatorChannelAccount: localChannelAccount.Address(),
+				ResponderChannelAccount: remoteChannelAccount.Address(),
+				StartSequence:           28037546508289,
+				Asset:                   txnbuild.NativeAsset{},
+			})
+			require.NoError(t, err)
+			return r
+		}(),
+	}
+	localTransactionsStream <- openTxStreamed
+	remoteTransactionsStream <- openTxStreamed
+	assert.IsType(t, ChannelTxObservedEvent{}, <-localEvents)
+	assert.IsType(t, ChannelTxObservedEvent{}, <-remoteEvents)
+	<-localEvents
+	<-remoteEvents
+
+	// Make a payment which the policy rejects.
+	err = localAgent.PaymentWithMemo(10_0000000, []byte("not ok"))
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.EqualError(t, err, "handling message: handling message 30: rejected: payment not accepted: memo is not ok")
+	<-remoteEvents
+	require.Len(t, paymentProposals, 1)
+	assert.Equal(t, state.NativeAsset, paymentProposals[0].Asset)
+	assert.Equal(t, int64(10_0000000), paymentProposals[0].Details.PaymentAmount)
+	assert.Equal(t, int64(0), remoteAgent.channel.LatestCloseAgreement().Envelope.Details.Balance)
+	assert.Equal(t, paymentProposals[0].Details.IterationNumber, remoteAgent.channel.Snapshot().LatestRejectedIterationNumber)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		rejectedEvent, ok := localEvent.(PaymentRejectedEvent)
+		require.True(t, ok)
+		assert.Equal(t, msg.RejectReasonNotAccepted, rejectedEvent.Reason)
+		assert.Equal(t, "payment not accepted: memo is not ok", rejectedEvent.Message)
+	}
+
+	// Make a payment which the policy accepts, but that is invalid because its
+	// amount is changed after it was signed, and so is not recorded.
+	err = localAgent.PaymentWithMemo(10_0000000, []byte("ok"))
+	require.NoError(t, err)
+	{
+		m := msg.Message{}
+		require.NoError(t, msg.NewDecoder(&localMsgs).Decode(&m))
+		m.PaymentRequest.Details.PaymentAmount = 20_0000000
+		require.NoError(t, msg.NewEncoder(&localMsgs).Encode(m))
+	}
+	err = remoteAgent.receive()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected: confirming payment")
+	<-remoteEvents
+	require.Len(t, paymentProposals, 2)
+	assert.Empty(t, recordedPayments)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		rejectedEvent, ok := localEvent.(PaymentRejectedEvent)
+		require.True(t, ok)
+		assert.Equal(t, msg.RejectReasonInvalid, rejectedEvent.Reason)
+	}
+
+	// Make a payment which the policy accepts, using the iteration after the
+	// rejected payments.
+	err = localAgent.PaymentWithMemo(10_0000000, []byte("ok"))
+	require.NoError(t, err)
+	err = remoteAgent.receive()
+	require.NoError(t, err)
+	assert.Equal(t, paymentProposals[1].Details.IterationNumber+1, remoteAgent.channel.LatestCloseAgreement().Envelope.Details.IterationNumber)
+	err = localAgent.receive()
+	require.NoError(t, err)
+	{
+		localEvent, ok := <-localEvents
+		require.True(t, ok)
+		assert.IsType(t, PaymentSentEvent{}, localEvent)
+		remoteEvent, ok := <-remoteEvents
+		require.True(t, ok)
+		assert.IsType(t, PaymentReceivedEvent{}, remoteEvent)
+	}
+	assert.Len(t, paymentProposals, 3)
+	require.Len(t, recordedPayments, 1)
+	assert.Equal(t, int64(10_0000000), recordedPayments[0].Details.PaymentAmount)
+}
+
+func TestAgent_acceptPolicy_proposerOpen(t *testing.T) {
+	localChannelAccount := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	localSigner := keypair.MustParseFull("SCBMAMOPWKL2YHWELK63VLAY2R74A6GTLLD4ON223B7K5KZ37MUR6IDF")
+	remoteChannelAccount := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+	remoteSigner := keypair.MustParseFull("SBM7D2IIDSRX5Y3VMTMTXXPB6AIB4WYGZBC2M64U742BNOK32X6SW4NF").FromAddress()
+
+	// Setup the local agent with a policy that only accepts native asset
+	// channels.
+	openProposals := []OpenProposal{}
+	localAgent := NewAgent(Config{
+		ObservationPeriodTime:      20 * time.Second,
+		ObservationPeriodLedgerGap: 1,
+		MaxOpenExpiry:              5 * time.Minute,
+		NetworkPassphrase:          network.TestNetworkPassphrase,
+		AcceptPolicy: acceptPolicyFuncs{
+			open: func(p OpenProposal) error {
+				openProposals = append(openProposals, p)
+				if !p.Details.Asset.IsNative() {
+					return fmt.Errorf("asset not accepted")
+				}
+				return nil
+			},
+		},
+		SequenceNumberCollector: sequenceNumberCollector(func(accountID *keypair.FromAddress) (int64, error) {
+			return 28037546508288, nil
+		}),
+		Streamer: streamerFunc(func(cursor string, accounts ...*keypair.FromAddress) (transactions <-chan StreamedTransaction, cancel func()) {
+			return make(chan StreamedTransaction), func() {}
+		}),
+		ChannelAccountKey:    localChannelAccount.FromAddress(),
+		ChannelAccountSigner: localSigner,
+		LogWriter:            io.Discard,
+	})
+	localMsgs := bytes.Buffer{}
+	localAgent.conn = &localMsgs
+	localAgent.otherChannelAccount = remoteChannelAccount
+	localAgent.otherChannelAccountSigner = remoteSigner
+
+	// Opening a channel the policy rejects is not proposed.
+	err := localAgent.Open(state.Asset("ABCD:GDUMPLH5FAH4C5QHUIAGGNQN3QEGY5QIIK7RV2IGYEPTVXHPOCGM4AVY"))
+	require.EqualError(t, err, "open not accepted: asset not accepted")
+	assert.Nil(t, localAgent.channel)
+	assert.Zero(t, localMsgs.Len())
+	require.Len(t, openProposals, 1)
+	assert.True(t, remoteChannelAccount.Equal(openProposals[0].ChannelAccount))
+	assert.True(t, remoteSigner.Equal(openProposals[0].Signer))
+	assert.Equal(t, localSigner.Address(), openProposals[0].Details.ProposingSigner.Address())
+	assert.True(t, remoteSigner.Equal(openProposals[0].Details.ConfirmingSigner))
+	assert.Equal(t, int64(28037546508289), openProposals[0].Details.StartingSequence)
+
+	// Opening a channel the policy accepts is proposed.
+	err = localAgent.Open(state.NativeAsset)
+	require.NoError(t, err)
+	assert.NotNil(t, localAgent.channel)
+	assert.NotZero(t, localMsgs.Len())
+	require.Len(t, openProposals, 2)
+	assert.Equal(t, state.NativeAsset, openProposals[1].Details.Asset)
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/stellar/starlight/sdk/state"
+)
+
+// Status is a summary of the agent's channel at a moment in time.
+type Status struct {
+	// State is the state of the channel, which is state.StateNone if the
+	// agent has no channel.
+	State state.State
+
+	Initiator bool
+	Asset     state.Asset
+
+	// Balance is the balance of the latest authorized close agreement. It is
+	// the amount owing from the initiator to the responder if positive, or
+	// from the responder to the initiator if negative.
+	Balance         int64
+	IterationNumber int64
+
+	LocalChannelAccount  state.ChannelAccount
+	RemoteChannelAccount state.ChannelAccount
+
+	// SendCapacity is the largest payment the agent can propose, and
+	// ReceiveCapacity is the largest payment the other participant can
+	// propose.
+	SendCapacity    int64
+	ReceiveCapacity int64
+
+	// LatestCloseAgreement is the latest close agreement signed by both
+	// participants, and UnauthorizedCloseAgreement is the agreement that has
+	// been proposed and is yet to be signed by both, if any.
+	LatestCloseAgreement       state.CloseAgreement
+	UnauthorizedCloseAgreement *state.CloseAgreement
+}
+
+// Status returns a summary of the agent's channel.
+func (a *Agent) Status() (Status, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.channel == nil {
+		return Status{State: state.StateNone}, nil
+	}
+
+	cs, err := a.channel.State()
+	if err != nil {
+		return Status{}, fmt.Errorf("getting channel state: %w", err)
+	}
+	send, receive := a.channel.Capacity()
+	latest := a.channel.LatestCloseAgreement()
+	s := Status{
+		State:                cs,
+		Initiator:            a.channel.IsInitiator(),
+		Asset:                a.channel.OpenAgreement().Envelope.Details.Asset,
+		Balance:              a.channel.Balance(),
+		IterationNumber:      latest.Envelope.Details.IterationNumber,
+		LocalChannelAccount:  a.channel.LocalChannelAccount(),
+		RemoteChannelAccount: a.channel.RemoteChannelAccount(),
+		SendCapacity:         send,
+		ReceiveCapacity:      receive,
+		LatestCloseAgreement: latest,
+	}
+	if unauthorized, ok := a.channel.LatestUnauthorizedCloseAgreement(); ok {
+		s.UnauthorizedCloseAgreement = &unauthorized
+	}
+	return s, nil
+}
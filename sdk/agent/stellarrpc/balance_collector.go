@@ -0,0 +1,67 @@
+package stellarrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+var _ agent.BalanceCollector = &BalanceCollector{}
+
+// BalanceCollector implements an agent's interface for collecting balances by
+// getting the account or trustline ledger entry with getLedgerEntries.
+type BalanceCollector struct {
+	Client *Client
+}
+
+// GetBalance gets the balance of the given asset on the given account. The
+// balance is the balance available for spending, which is the balance less any
+// selling liabilities. If the account does not hold the asset the balance is
+// zero.
+func (r *BalanceCollector) GetBalance(accountID *keypair.FromAddress, asset state.Asset) (int64, error) {
+	accountXDR, err := xdr.AddressToAccountId(accountID.Address())
+	if err != nil {
+		return 0, fmt.Errorf("parsing account %s: %w", accountID.Address(), err)
+	}
+	ctx := context.Background()
+
+	if asset.IsNative() {
+		key := xdr.LedgerKey{}
+		err = key.SetAccount(accountXDR)
+		if err != nil {
+			return 0, fmt.Errorf("building ledger key of %s: %w", accountID.Address(), err)
+		}
+		data, ok, err := getLedgerEntry(ctx, r.Client, key)
+		if err != nil {
+			return 0, fmt.Errorf("getting account entry of %s: %w", accountID.Address(), err)
+		}
+		if !ok {
+			return 0, fmt.Errorf("getting account entry of %s: account not found", accountID.Address())
+		}
+		account := data.MustAccount()
+		return int64(account.Balance - account.Liabilities().Selling), nil
+	}
+
+	assetXDR, err := asset.Asset().ToXDR()
+	if err != nil {
+		return 0, fmt.Errorf("encoding asset %s: %w", asset, err)
+	}
+	key := xdr.LedgerKey{}
+	err = key.SetTrustline(accountXDR, assetXDR.ToTrustLineAsset())
+	if err != nil {
+		return 0, fmt.Errorf("building ledger key of %s %s trustline: %w", accountID.Address(), asset, err)
+	}
+	data, ok, err := getLedgerEntry(ctx, r.Client, key)
+	if err != nil {
+		return 0, fmt.Errorf("getting %s trustline entry of %s: %w", asset, accountID.Address(), err)
+	}
+	if !ok {
+		return 0, nil
+	}
+	trustLine := data.MustTrustLine()
+	return int64(trustLine.Balance - trustLine.Liabilities().Selling), nil
+}
@@ -0,0 +1,126 @@
+package stellarrpc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ledgerEntriesHandler returns a getLedgerEntries handler that responds with
+// the entries for the keys requested that are in entries.
+func ledgerEntriesHandler(t *testing.T, entries map[string]xdr.LedgerEntryData) func(params json.RawMessage) (interface{}, *Error) {
+	return func(params json.RawMessage) (interface{}, *Error) {
+		p := struct {
+			Keys []string `json:"keys"`
+		}{}
+		require.NoError(t, json.Unmarshal(params, &p))
+		resp := GetLedgerEntriesResponse{LatestLedger: 10}
+		for _, k := range p.Keys {
+			data, ok := entries[k]
+			if !ok {
+				continue
+			}
+			dataXDR, err := xdr.MarshalBase64(data)
+			require.NoError(t, err)
+			resp.Entries = append(resp.Entries, LedgerEntry{KeyXDR: k, DataXDR: dataXDR, LastModifiedLedgerSeq: 9})
+		}
+		return resp, nil
+	}
+}
+
+func TestBalanceCollector_GetBalance(t *testing.T) {
+	account := keypair.MustRandom().FromAddress()
+	asset := state.Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	otherAsset := state.Asset("EFGH:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+
+	accountKey := xdr.LedgerKey{}
+	require.NoError(t, accountKey.SetAccount(xdr.MustAddress(account.Address())))
+	accountKeyXDR, err := xdr.MarshalBase64(accountKey)
+	require.NoError(t, err)
+
+	assetXDR, err := asset.Asset().ToXDR()
+	require.NoError(t, err)
+	trustLineKey := xdr.LedgerKey{}
+	require.NoError(t, trustLineKey.SetTrustline(xdr.MustAddress(account.Address()), assetXDR.ToTrustLineAsset()))
+	trustLineKeyXDR, err := xdr.MarshalBase64(trustLineKey)
+	require.NoError(t, err)
+
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getLedgerEntries": ledgerEntriesHandler(t, map[string]xdr.LedgerEntryData{
+			accountKeyXDR: {
+				Type: xdr.LedgerEntryTypeAccount,
+				Account: &xdr.AccountEntry{
+					AccountId: xdr.MustAddress(account.Address()),
+					Balance:   100_0000000,
+					SeqNum:    123,
+				},
+			},
+			trustLineKeyXDR: {
+				Type: xdr.LedgerEntryTypeTrustline,
+				TrustLine: &xdr.TrustLineEntry{
+					AccountId: xdr.MustAddress(account.Address()),
+					Asset:     assetXDR.ToTrustLineAsset(),
+					Balance:   20_0000000,
+					Ext: xdr.TrustLineEntryExt{
+						V: 1,
+						V1: &xdr.TrustLineEntryV1{
+							Liabilities: xdr.Liabilities{Buying: 1_0000000, Selling: 5_0000000},
+						},
+					},
+				},
+			},
+		}),
+	})
+	bc := BalanceCollector{Client: s.Client()}
+
+	balance, err := bc.GetBalance(account, state.NativeAsset)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100_0000000), balance)
+
+	balance, err = bc.GetBalance(account, asset)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15_0000000), balance)
+
+	balance, err = bc.GetBalance(account, otherAsset)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), balance)
+
+	otherAccount := keypair.MustRandom().FromAddress()
+	_, err = bc.GetBalance(otherAccount, state.NativeAsset)
+	assert.EqualError(t, err, "getting account entry of "+otherAccount.Address()+": account not found")
+}
+
+func TestSequenceNumberCollector_GetSequenceNumber(t *testing.T) {
+	account := keypair.MustRandom().FromAddress()
+
+	accountKey := xdr.LedgerKey{}
+	require.NoError(t, accountKey.SetAccount(xdr.MustAddress(account.Address())))
+	accountKeyXDR, err := xdr.MarshalBase64(accountKey)
+	require.NoError(t, err)
+
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getLedgerEntries": ledgerEntriesHandler(t, map[string]xdr.LedgerEntryData{
+			accountKeyXDR: {
+				Type: xdr.LedgerEntryTypeAccount,
+				Account: &xdr.AccountEntry{
+					AccountId: xdr.MustAddress(account.Address()),
+					SeqNum:    123,
+				},
+			},
+		}),
+	})
+	snc := SequenceNumberCollector{Client: s.Client()}
+
+	seqNum, err := snc.GetSequenceNumber(account)
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), seqNum)
+
+	otherAccount := keypair.MustRandom().FromAddress()
+	_, err = snc.GetSequenceNumber(otherAccount)
+	assert.EqualError(t, err, "getting account entry of "+otherAccount.Address()+": account not found")
+}
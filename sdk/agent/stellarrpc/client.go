@@ -0,0 +1,254 @@
+package stellarrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Client is a client for the Stellar RPC JSON-RPC API.
+type Client struct {
+	// URL is the URL of the Stellar RPC server.
+	URL string
+
+	// HTTPClient is the client used to make requests, and if not set defaults
+	// to http.DefaultClient.
+	HTTPClient *http.Client
+
+	id int64
+}
+
+// Error is an error returned by the Stellar RPC server.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+}
+
+// call calls the method with the params, decoding the result into result.
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	reqBody, err := json.Marshal(request{
+		JSONRPC: "2.0",
+		ID:      atomic.AddInt64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding %s request: %w", method, err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("building %s request: %w", method, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("calling %s: %w", method, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("calling %s: unexpected status %s", method, httpResp.Status)
+	}
+
+	resp := response{}
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("decoding %s response: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("calling %s: %w", method, resp.Error)
+	}
+	err = json.Unmarshal(resp.Result, result)
+	if err != nil {
+		return fmt.Errorf("decoding %s result: %w", method, err)
+	}
+	return nil
+}
+
+// unixTime is a time encoded as the number of seconds since the unix epoch,
+// either as a JSON number or string.
+type unixTime time.Time
+
+func (t unixTime) MarshalJSON() ([]byte, error) {
+	if time.Time(t).IsZero() {
+		return []byte("0"), nil
+	}
+	return []byte(strconv.FormatInt(time.Time(t).Unix(), 10)), nil
+}
+
+func (t *unixTime) UnmarshalJSON(b []byte) error {
+	s := string(bytes.Trim(b, `"`))
+	if s == "" || s == "null" || s == "0" {
+		*t = unixTime{}
+		return nil
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing unix time %s: %w", s, err)
+	}
+	*t = unixTime(time.Unix(sec, 0).UTC())
+	return nil
+}
+
+// Transaction statuses returned by getTransaction and getTransactions.
+const (
+	TransactionStatusSuccess  = "SUCCESS"
+	TransactionStatusNotFound = "NOT_FOUND"
+	TransactionStatusFailed   = "FAILED"
+)
+
+// Transaction is a transaction returned by getTransaction and
+// getTransactions.
+type Transaction struct {
+	Status           string   `json:"status"`
+	TxHash           string   `json:"txHash"`
+	Ledger           uint32   `json:"ledger"`
+	CreatedAt        unixTime `json:"createdAt"`
+	ApplicationOrder int32    `json:"applicationOrder"`
+	FeeBump          bool     `json:"feeBump"`
+	EnvelopeXDR      string   `json:"envelopeXdr"`
+	ResultXDR        string   `json:"resultXdr"`
+	ResultMetaXDR    string   `json:"resultMetaXdr"`
+}
+
+// LedgerCloseTime returns the close time of the ledger the transaction was
+// included in.
+func (t Transaction) LedgerCloseTime() time.Time {
+	return time.Time(t.CreatedAt)
+}
+
+// GetTransaction gets the transaction with the given hash.
+func (c *Client) GetTransaction(ctx context.Context, hash string) (Transaction, error) {
+	params := struct {
+		Hash string `json:"hash"`
+	}{Hash: hash}
+	result := Transaction{}
+	err := c.call(ctx, "getTransaction", params, &result)
+	return result, err
+}
+
+// GetTransactionsRequest contains the parameters of getTransactions. Only one
+// of StartLedger or Cursor should be set.
+type GetTransactionsRequest struct {
+	StartLedger uint32
+	Cursor      string
+	Limit       uint
+}
+
+// GetTransactionsResponse is the result of getTransactions.
+type GetTransactionsResponse struct {
+	Transactions          []Transaction `json:"transactions"`
+	LatestLedger          uint32        `json:"latestLedger"`
+	LatestLedgerCloseTime unixTime      `json:"latestLedgerCloseTimestamp"`
+	OldestLedger          uint32        `json:"oldestLedger"`
+	Cursor                string        `json:"cursor"`
+}
+
+// GetTransactions gets transactions in the order they were executed.
+func (c *Client) GetTransactions(ctx context.Context, r GetTransactionsRequest) (GetTransactionsResponse, error) {
+	type pagination struct {
+		Cursor string `json:"cursor,omitempty"`
+		Limit  uint   `json:"limit,omitempty"`
+	}
+	params := struct {
+		StartLedger uint32      `json:"startLedger,omitempty"`
+		Pagination  *pagination `json:"pagination,omitempty"`
+	}{StartLedger: r.StartLedger}
+	if r.Cursor != "" || r.Limit != 0 {
+		params.Pagination = &pagination{Cursor: r.Cursor, Limit: r.Limit}
+	}
+	result := GetTransactionsResponse{}
+	err := c.call(ctx, "getTransactions", params, &result)
+	return result, err
+}
+
+// Send transaction statuses returned by sendTransaction.
+const (
+	SendTransactionStatusPending       = "PENDING"
+	SendTransactionStatusDuplicate     = "DUPLICATE"
+	SendTransactionStatusTryAgainLater = "TRY_AGAIN_LATER"
+	SendTransactionStatusError         = "ERROR"
+)
+
+// SendTransactionResponse is the result of sendTransaction.
+type SendTransactionResponse struct {
+	Status         string `json:"status"`
+	Hash           string `json:"hash"`
+	LatestLedger   uint32 `json:"latestLedger"`
+	ErrorResultXDR string `json:"errorResultXdr"`
+}
+
+// SendTransaction sends the transaction XDR to the network.
+func (c *Client) SendTransaction(ctx context.Context, xdr string) (SendTransactionResponse, error) {
+	params := struct {
+		Transaction string `json:"transaction"`
+	}{Transaction: xdr}
+	result := SendTransactionResponse{}
+	err := c.call(ctx, "sendTransaction", params, &result)
+	return result, err
+}
+
+// LedgerEntry is a ledger entry returned by getLedgerEntries.
+type LedgerEntry struct {
+	KeyXDR                string `json:"key"`
+	DataXDR               string `json:"xdr"`
+	LastModifiedLedgerSeq uint32 `json:"lastModifiedLedgerSeq"`
+}
+
+// GetLedgerEntriesResponse is the result of getLedgerEntries.
+type GetLedgerEntriesResponse struct {
+	Entries      []LedgerEntry `json:"entries"`
+	LatestLedger uint32        `json:"latestLedger"`
+}
+
+// GetLedgerEntries gets the ledger entries for the base64 encoded ledger keys.
+// Entries that do not exist are not included in the response.
+func (c *Client) GetLedgerEntries(ctx context.Context, keys ...string) (GetLedgerEntriesResponse, error) {
+	params := struct {
+		Keys []string `json:"keys"`
+	}{Keys: keys}
+	result := GetLedgerEntriesResponse{}
+	err := c.call(ctx, "getLedgerEntries", params, &result)
+	return result, err
+}
+
+// GetLatestLedgerResponse is the result of getLatestLedger.
+type GetLatestLedgerResponse struct {
+	ID              string `json:"id"`
+	ProtocolVersion uint32 `json:"protocolVersion"`
+	Sequence        uint32 `json:"sequence"`
+}
+
+// GetLatestLedger gets the latest ledger known to the server.
+func (c *Client) GetLatestLedger(ctx context.Context) (GetLatestLedgerResponse, error) {
+	result := GetLatestLedgerResponse{}
+	err := c.call(ctx, "getLatestLedger", nil, &result)
+	return result, err
+}
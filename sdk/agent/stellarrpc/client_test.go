@@ -0,0 +1,92 @@
+package stellarrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is a stand-in for a Stellar RPC server that responds to methods
+// using handler funcs, and records the requests it receives.
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]func(params json.RawMessage) (interface{}, *Error)
+	requests []request
+}
+
+func newTestServer(t *testing.T, handlers map[string]func(params json.RawMessage) (interface{}, *Error)) *testServer {
+	s := &testServer{handlers: handlers}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      int64           `json:"id"`
+			Method  string          `json:"method"`
+			Params  json.RawMessage `json:"params"`
+		}{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, request{JSONRPC: req.JSONRPC, ID: req.ID, Method: req.Method, Params: req.Params})
+		handler, ok := s.handlers[req.Method]
+		s.mu.Unlock()
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if !ok {
+			resp["error"] = Error{Code: -32601, Message: "method not found"}
+		} else if result, rpcErr := handler(req.Params); rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) Client() *Client {
+	return &Client{URL: s.URL}
+}
+
+func (s *testServer) Requests() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+func TestClient_call(t *testing.T) {
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getLatestLedger": func(params json.RawMessage) (interface{}, *Error) {
+			return map[string]interface{}{"id": "abc", "protocolVersion": 19, "sequence": 123}, nil
+		},
+	})
+	c := s.Client()
+
+	latest, err := c.GetLatestLedger(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, GetLatestLedgerResponse{ID: "abc", ProtocolVersion: 19, Sequence: 123}, latest)
+
+	_, err = c.GetTransaction(context.Background(), "hash")
+	assert.EqualError(t, err, "calling getTransaction: rpc error -32601: method not found")
+
+	requests := s.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "2.0", requests[0].JSONRPC)
+	assert.Equal(t, "getLatestLedger", requests[0].Method)
+	assert.Equal(t, "getTransaction", requests[1].Method)
+	assert.JSONEq(t, `{"hash":"hash"}`, string(requests[1].Params.(json.RawMessage)))
+	assert.NotEqual(t, requests[0].ID, requests[1].ID)
+}
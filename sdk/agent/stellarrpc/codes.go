@@ -0,0 +1,20 @@
+package stellarrpc
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent/submit"
+)
+
+// resultErr returns an error describing the failed transaction result,
+// including the result codes of the transaction, and of the inner transaction
+// if the transaction is a fee bump.
+func resultErr(resultXDR string) error {
+	var r xdr.TransactionResult
+	err := xdr.SafeUnmarshalBase64(resultXDR, &r)
+	if err != nil {
+		return fmt.Errorf("transaction failed: decoding result: %w", err)
+	}
+	return &submit.ResultError{Codes: submit.ResultCodes(r)}
+}
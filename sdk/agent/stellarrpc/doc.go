@@ -0,0 +1,4 @@
+// Package stellarrpc contains types that implement a variety of interfaces
+// defined by the sdk/agent and its sub-packages, providing the functionality of
+// those interfaces by calling the Stellar RPC JSON-RPC API.
+package stellarrpc
@@ -0,0 +1,33 @@
+package stellarrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+)
+
+// getLedgerEntry gets the ledger entry for the key, returning false if the
+// entry does not exist.
+func getLedgerEntry(ctx context.Context, c *Client, key xdr.LedgerKey) (xdr.LedgerEntryData, bool, error) {
+	keyXDR, err := xdr.MarshalBase64(key)
+	if err != nil {
+		return xdr.LedgerEntryData{}, false, fmt.Errorf("encoding ledger key: %w", err)
+	}
+	resp, err := c.GetLedgerEntries(ctx, keyXDR)
+	if err != nil {
+		return xdr.LedgerEntryData{}, false, err
+	}
+	for _, e := range resp.Entries {
+		if e.KeyXDR != keyXDR {
+			continue
+		}
+		var data xdr.LedgerEntryData
+		err = xdr.SafeUnmarshalBase64(e.DataXDR, &data)
+		if err != nil {
+			return xdr.LedgerEntryData{}, false, fmt.Errorf("decoding ledger entry: %w", err)
+		}
+		return data, true, nil
+	}
+	return xdr.LedgerEntryData{}, false, nil
+}
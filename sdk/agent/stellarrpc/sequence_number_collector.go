@@ -0,0 +1,40 @@
+package stellarrpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent"
+)
+
+var _ agent.SequenceNumberCollector = &SequenceNumberCollector{}
+
+// SequenceNumberCollector implements an agent's interface for collecting the
+// current sequence number by getting the account ledger entry with
+// getLedgerEntries.
+type SequenceNumberCollector struct {
+	Client *Client
+}
+
+// GetSequenceNumber gets the sequence number of the given account.
+func (r *SequenceNumberCollector) GetSequenceNumber(accountID *keypair.FromAddress) (int64, error) {
+	accountXDR, err := xdr.AddressToAccountId(accountID.Address())
+	if err != nil {
+		return 0, fmt.Errorf("parsing account %s: %w", accountID.Address(), err)
+	}
+	key := xdr.LedgerKey{}
+	err = key.SetAccount(accountXDR)
+	if err != nil {
+		return 0, fmt.Errorf("building ledger key of %s: %w", accountID.Address(), err)
+	}
+	data, ok, err := getLedgerEntry(context.Background(), r.Client, key)
+	if err != nil {
+		return 0, fmt.Errorf("getting account entry of %s: %w", accountID.Address(), err)
+	}
+	if !ok {
+		return 0, fmt.Errorf("getting account entry of %s: account not found", accountID.Address())
+	}
+	return int64(data.MustAccount().SeqNum), nil
+}
@@ -0,0 +1,232 @@
+package stellarrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/toid"
+	"github.com/stellar/starlight/sdk/agent"
+)
+
+var _ agent.Streamer = &Streamer{}
+
+const defaultStreamLimit = 100
+
+// Streamer implements the agent's interface for streaming transactions that
+// affect a set of accounts, by polling the Stellar RPC getTransactions method
+// for new transactions as they occur.
+type Streamer struct {
+	Client       *Client
+	ErrorHandler func(error)
+
+	// PollInterval is the time between polls once all available transactions
+	// have been streamed, and if not set defaults to one second.
+	PollInterval time.Duration
+
+	// Limit is the number of transactions requested per poll, and if not set
+	// defaults to 100.
+	Limit uint
+}
+
+// StreamTx streams transactions that affect the given accounts, sending each
+// transaction to the txs channel returned. StreamTx can be stopped by calling
+// the cancel function returned. The given cursor supports resuming a previous
+// stream. If the cursor is empty or "now" streaming starts from the latest
+// ledger.
+//
+// An empty cursor does not stream from the beginning as it does with the
+// horizon and ledgermeta Streamers, because Stellar RPC only retains recent
+// ledgers and streaming all of them to find the accounts' transactions would
+// be slow. Transactions submitted after StreamTx is called are still streamed.
+//
+// Stellar RPC does not support filtering transactions by account, so all
+// transactions are retrieved and those that do not reference any of the
+// accounts in their envelope or meta are discarded. If no accounts are given
+// all transactions are streamed. Once all available transactions have been
+// streamed, the latest ledger is reported with a StreamedTransaction that only
+// has the ledger's sequence and close time, if no transaction was streamed
+// from it.
+func (r *Streamer) StreamTx(cursor string, accounts ...*keypair.FromAddress) (txs <-chan agent.StreamedTransaction, cancel func()) {
+	// txsCh is the channel that streamed transactions will be written to.
+	txsCh := make(chan agent.StreamedTransaction)
+
+	// cancelCh will be used to signal the streamer to stop.
+	cancelCh := make(chan struct{})
+
+	// Start a streamer that will write txs and stop when
+	// signaled to cancel.
+	go func() {
+		defer close(txsCh)
+		r.streamTx(cursor, accounts, txsCh, cancelCh)
+	}()
+
+	cancelOnce := sync.Once{}
+	cancel = func() {
+		cancelOnce.Do(func() {
+			close(cancelCh)
+		})
+	}
+	return txsCh, cancel
+}
+
+func (r *Streamer) streamTx(cursor string, accounts []*keypair.FromAddress, txs chan<- agent.StreamedTransaction, cancel <-chan struct{}) {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+	go func() {
+		select {
+		case <-cancel:
+			ctxCancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pollInterval := r.PollInterval
+	if pollInterval == 0 {
+		pollInterval = defaultPollInterval
+	}
+	limit := r.Limit
+	if limit == 0 {
+		limit = defaultStreamLimit
+	}
+
+	accountKeys := make([][]byte, 0, len(accounts))
+	for _, a := range accounts {
+		key, err := strkey.Decode(strkey.VersionByteAccountID, a.Address())
+		if err != nil {
+			r.handleError(err)
+			return
+		}
+		accountKeys = append(accountKeys, key)
+	}
+
+	wait := func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(pollInterval):
+			return true
+		}
+	}
+
+	if cursor == "now" {
+		cursor = ""
+	}
+	// ledger is the latest ledger that a transaction has been streamed from
+	// or that has been reported.
+	var ledger uint32
+
+	req := GetTransactionsRequest{Cursor: cursor, Limit: limit}
+	for {
+		if req.Cursor == "" && req.StartLedger == 0 {
+			latest, err := r.Client.GetLatestLedger(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				r.handleError(err)
+				if !wait() {
+					return
+				}
+				continue
+			}
+			req.StartLedger = latest.Sequence
+		}
+
+		resp, err := r.Client.GetTransactions(ctx, req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			r.handleError(err)
+			if !wait() {
+				return
+			}
+			continue
+		}
+
+		for _, tx := range resp.Transactions {
+			if !affectsAccounts(tx, accountKeys) {
+				continue
+			}
+			txOrderID := toid.New(int32(tx.Ledger), tx.ApplicationOrder, 0).ToInt64()
+			streamedTx := agent.StreamedTransaction{
+				Cursor:             strconv.FormatInt(txOrderID, 10),
+				TransactionOrderID: txOrderID,
+				LedgerSequence:     tx.Ledger,
+				LedgerCloseTime:    tx.LedgerCloseTime(),
+				TransactionXDR:     tx.EnvelopeXDR,
+				ResultXDR:          tx.ResultXDR,
+				ResultMetaXDR:      tx.ResultMetaXDR,
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case txs <- streamedTx:
+				ledger = tx.Ledger
+			}
+		}
+
+		// Continue from the end of the page, or if the server does not
+		// return a cursor, from the last transaction.
+		if resp.Cursor != "" {
+			req = GetTransactionsRequest{Cursor: resp.Cursor, Limit: limit}
+		} else if len(resp.Transactions) > 0 {
+			last := resp.Transactions[len(resp.Transactions)-1]
+			lastTxOrderID := toid.New(int32(last.Ledger), last.ApplicationOrder, 0).ToInt64()
+			req = GetTransactionsRequest{Cursor: strconv.FormatInt(lastTxOrderID, 10), Limit: limit}
+		}
+		if uint(len(resp.Transactions)) < limit {
+			if resp.LatestLedger > ledger {
+				ledger = resp.LatestLedger
+				select {
+				case <-ctx.Done():
+					return
+				case txs <- agent.StreamedTransaction{
+					LedgerSequence:  resp.LatestLedger,
+					LedgerCloseTime: time.Time(resp.LatestLedgerCloseTime),
+				}:
+				}
+			}
+			if !wait() {
+				return
+			}
+		}
+	}
+}
+
+func (r *Streamer) handleError(err error) {
+	if r.ErrorHandler != nil {
+		r.ErrorHandler(err)
+	}
+}
+
+// affectsAccounts returns true if any of the account keys are referenced in
+// the transaction's envelope or meta. The envelope references accounts that
+// are the source of the transaction or its operations, or the destination of
+// its operations, and the meta references accounts that had their account or
+// trustline entries changed. Searching the encoded XDR for the account keys
+// avoids decoding every transaction on the network and works with every
+// version of the meta. If no account keys are given it returns true.
+func affectsAccounts(tx Transaction, accountKeys [][]byte) bool {
+	if len(accountKeys) == 0 {
+		return true
+	}
+	for _, x := range []string{tx.EnvelopeXDR, tx.ResultMetaXDR} {
+		b, err := base64.StdEncoding.DecodeString(x)
+		if err != nil {
+			continue
+		}
+		for _, key := range accountKeys {
+			if bytes.Contains(b, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package stellarrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/toid"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTxXDR(t *testing.T, source *keypair.Full, destination *keypair.FromAddress) string {
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{AccountID: source.Address(), Sequence: 1},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.Payment{Destination: destination.Address(), Amount: "1", Asset: txnbuild.NativeAsset{}},
+		},
+	})
+	require.NoError(t, err)
+	tx, err = tx.Sign(network.TestNetworkPassphrase, source)
+	require.NoError(t, err)
+	txXDR, err := tx.Base64()
+	require.NoError(t, err)
+	return txXDR
+}
+
+func TestStreamer_StreamTx(t *testing.T) {
+	accountA := keypair.MustRandom()
+	accountB := keypair.MustRandom()
+	other := keypair.MustRandom()
+
+	// A tx from account A, a tx between other accounts, and a tx to account
+	// B.
+	txFromA := buildTxXDR(t, accountA, other.FromAddress())
+	txOther := buildTxXDR(t, other, other.FromAddress())
+	txToB := buildTxXDR(t, other, accountB.FromAddress())
+
+	getTransactionsCalls := 0
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getLatestLedger": func(params json.RawMessage) (interface{}, *Error) {
+			return GetLatestLedgerResponse{Sequence: 10}, nil
+		},
+		"getTransactions": func(params json.RawMessage) (interface{}, *Error) {
+			getTransactionsCalls++
+			switch getTransactionsCalls {
+			case 1:
+				assert.JSONEq(t, `{"startLedger":10,"pagination":{"limit":2}}`, string(params))
+				return GetTransactionsResponse{
+					Transactions: []Transaction{
+						{Status: TransactionStatusSuccess, Ledger: 10, ApplicationOrder: 1, CreatedAt: unixTime(time.Unix(100, 0)), EnvelopeXDR: txFromA, ResultXDR: "a-resultxdr"},
+						{Status: TransactionStatusSuccess, Ledger: 10, ApplicationOrder: 2, CreatedAt: unixTime(time.Unix(100, 0)), EnvelopeXDR: txOther},
+					},
+					Cursor: "c1",
+				}, nil
+			case 2:
+				assert.JSONEq(t, `{"pagination":{"cursor":"c1","limit":2}}`, string(params))
+				return nil, &Error{Code: -32603, Message: "unavailable"}
+			case 3:
+				assert.JSONEq(t, `{"pagination":{"cursor":"c1","limit":2}}`, string(params))
+				return GetTransactionsResponse{
+					Transactions: []Transaction{
+						{Status: TransactionStatusFailed, Ledger: 11, ApplicationOrder: 1, CreatedAt: unixTime(time.Unix(105, 0)), EnvelopeXDR: txToB},
+					},
+					Cursor: "c2",
+				}, nil
+			default:
+				assert.JSONEq(t, `{"pagination":{"cursor":"c2","limit":2}}`, string(params))
+				return GetTransactionsResponse{Cursor: "c2"}, nil
+			}
+		},
+	})
+	errorsSeen := make(chan error, 10)
+	streamer := Streamer{
+		Client:       s.Client(),
+		PollInterval: time.Millisecond,
+		Limit:        2,
+		ErrorHandler: func(err error) {
+			errorsSeen <- err
+		},
+	}
+
+	txsCh, cancel := streamer.StreamTx("", accountA.FromAddress(), accountB.FromAddress())
+
+	txs := []agent.StreamedTransaction{<-txsCh, <-txsCh}
+	txOrderIDA := toid.New(10, 1, 0).ToInt64()
+	txOrderIDB := toid.New(11, 1, 0).ToInt64()
+	assert.Equal(
+		t,
+		[]agent.StreamedTransaction{
+			{
+				Cursor:             strconv.FormatInt(txOrderIDA, 10),
+				TransactionOrderID: txOrderIDA,
+				LedgerSequence:     10,
+				LedgerCloseTime:    time.Unix(100, 0).UTC(),
+				TransactionXDR:     txFromA,
+				ResultXDR:          "a-resultxdr",
+			},
+			{
+				Cursor:             strconv.FormatInt(txOrderIDB, 10),
+				TransactionOrderID: txOrderIDB,
+				LedgerSequence:     11,
+				LedgerCloseTime:    time.Unix(105, 0).UTC(),
+				TransactionXDR:     txToB,
+			},
+		},
+		txs,
+	)
+	var rpcErr *Error
+	assert.True(t, errors.As(<-errorsSeen, &rpcErr))
+
+	// Cancel streaming, and check that multiple cancels are okay.
+	cancel()
+	cancel()
+
+	// Check that the transaction stream channel is closed.
+	open := true
+	for open {
+		_, open = <-txsCh
+	}
+	assert.False(t, open, "txs channel not closed but should be after cancel called")
+}
+
+func TestStreamer_StreamTx_cursor(t *testing.T) {
+	account := keypair.MustRandom()
+	txXDR := buildTxXDR(t, account, account.FromAddress())
+	cursor := strconv.FormatInt(toid.New(10, 1, 0).ToInt64(), 10)
+
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getTransactions": func(params json.RawMessage) (interface{}, *Error) {
+			assert.JSONEq(t, `{"pagination":{"cursor":"`+cursor+`","limit":100}}`, string(params))
+			return GetTransactionsResponse{
+				Transactions: []Transaction{
+					{Status: TransactionStatusSuccess, Ledger: 10, ApplicationOrder: 2, EnvelopeXDR: txXDR},
+				},
+			}, nil
+		},
+	})
+	streamer := Streamer{Client: s.Client(), PollInterval: time.Hour}
+
+	txsCh, cancel := streamer.StreamTx(cursor, account.FromAddress())
+	defer cancel()
+
+	tx := <-txsCh
+	assert.Equal(t, toid.New(10, 2, 0).ToInt64(), tx.TransactionOrderID)
+	assert.Equal(t, strconv.FormatInt(tx.TransactionOrderID, 10), tx.Cursor)
+}
+
+func TestStreamer_StreamTx_now(t *testing.T) {
+	account := keypair.MustRandom()
+	txXDR := buildTxXDR(t, account, account.FromAddress())
+
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getLatestLedger": func(params json.RawMessage) (interface{}, *Error) {
+			return GetLatestLedgerResponse{Sequence: 10}, nil
+		},
+		"getTransactions": func(params json.RawMessage) (interface{}, *Error) {
+			assert.JSONEq(t, `{"startLedger":10,"pagination":{"limit":100}}`, string(params))
+			return GetTransactionsResponse{
+				Transactions: []Transaction{
+					{Status: TransactionStatusSuccess, Ledger: 10, ApplicationOrder: 1, EnvelopeXDR: txXDR},
+				},
+			}, nil
+		},
+	})
+	streamer := Streamer{Client: s.Client(), PollInterval: time.Hour}
+
+	txsCh, cancel := streamer.StreamTx("now", account.FromAddress())
+	defer cancel()
+
+	tx := <-txsCh
+	assert.Equal(t, toid.New(10, 1, 0).ToInt64(), tx.TransactionOrderID)
+}
+
+func TestStreamer_StreamTx_ledgers(t *testing.T) {
+	account := keypair.MustRandom()
+	txXDR := buildTxXDR(t, account, account.FromAddress())
+
+	getTransactionsCalls := 0
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"getLatestLedger": func(params json.RawMessage) (interface{}, *Error) {
+			return GetLatestLedgerResponse{Sequence: 10}, nil
+		},
+		"getTransactions": func(params json.RawMessage) (interface{}, *Error) {
+			getTransactionsCalls++
+			switch getTransactionsCalls {
+			case 1:
+				return GetTransactionsResponse{
+					Transactions: []Transaction{
+						{Status: TransactionStatusSuccess, Ledger: 10, ApplicationOrder: 1, EnvelopeXDR: txXDR},
+					},
+					LatestLedger:          10,
+					LatestLedgerCloseTime: unixTime(time.Unix(100, 0)),
+					Cursor:                "c1",
+				}, nil
+			case 2:
+				return GetTransactionsResponse{
+					LatestLedger:          12,
+					LatestLedgerCloseTime: unixTime(time.Unix(110, 0)),
+					Cursor:                "c1",
+				}, nil
+			default:
+				return GetTransactionsResponse{
+					LatestLedger:          12,
+					LatestLedgerCloseTime: unixTime(time.Unix(110, 0)),
+					Cursor:                "c1",
+				}, nil
+			}
+		},
+	})
+	streamer := Streamer{Client: s.Client(), PollInterval: time.Millisecond}
+
+	txsCh, cancel := streamer.StreamTx("", account.FromAddress())
+	defer cancel()
+
+	// The ledger of a streamed transaction is not reported, and later ledgers
+	// are reported once each.
+	tx := <-txsCh
+	assert.Equal(t, toid.New(10, 1, 0).ToInt64(), tx.TransactionOrderID)
+	assert.Equal(t, agent.StreamedTransaction{
+		LedgerSequence:  12,
+		LedgerCloseTime: time.Unix(110, 0).UTC(),
+	}, <-txsCh)
+	select {
+	case tx := <-txsCh:
+		t.Fatalf("unexpected tx streamed: %#v", tx)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,88 @@
+package stellarrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stellar/starlight/sdk/agent/submit"
+)
+
+var _ submit.SubmitTxer = &Submitter{}
+
+const (
+	defaultPollInterval  = time.Second
+	defaultSubmitTimeout = time.Minute
+)
+
+// Submitter implements an submit's interface for submitting transaction XDRs to
+// the network, via the Stellar RPC sendTransaction method. Submitted
+// transactions are polled for with getTransaction until they succeed or fail,
+// or the Timeout passes. Errors polling are retried until the Timeout, since
+// the transaction may still be included in a ledger.
+type Submitter struct {
+	Client *Client
+
+	// PollInterval is the time between polls for the submitted transaction,
+	// and if not set defaults to one second.
+	PollInterval time.Duration
+
+	// Timeout is the maximum time to wait for the submitted transaction to
+	// succeed or fail, and if not set defaults to one minute.
+	Timeout time.Duration
+}
+
+// SubmitTx submits the given xdr as a transaction to Stellar RPC, and waits
+// for it to be included in a ledger.
+func (s *Submitter) SubmitTx(xdr string) error {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = defaultSubmitTimeout
+	}
+	pollInterval := s.PollInterval
+	if pollInterval == 0 {
+		pollInterval = defaultPollInterval
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := s.Client.SendTransaction(ctx, xdr)
+	if err != nil {
+		return fmt.Errorf("submitting tx: %w", err)
+	}
+	switch resp.Status {
+	case SendTransactionStatusPending, SendTransactionStatusDuplicate:
+	case SendTransactionStatusError:
+		return fmt.Errorf("submitting tx %s: %w", resp.Hash, resultErr(resp.ErrorResultXDR))
+	case SendTransactionStatusTryAgainLater:
+		return &submit.Error{
+			Kind: submit.ErrorKindTryAgainLater,
+			Err:  fmt.Errorf("submitting tx %s: status %s", resp.Hash, resp.Status),
+		}
+	default:
+		return fmt.Errorf("submitting tx %s: status %s", resp.Hash, resp.Status)
+	}
+
+	var pollErr error
+	for {
+		tx, err := s.Client.GetTransaction(ctx, resp.Hash)
+		if err == nil {
+			switch tx.Status {
+			case TransactionStatusSuccess:
+				return nil
+			case TransactionStatusFailed:
+				return fmt.Errorf("submitted tx %s: %w", resp.Hash, resultErr(tx.ResultXDR))
+			}
+		} else if ctx.Err() == nil {
+			pollErr = err
+		}
+		select {
+		case <-ctx.Done():
+			if pollErr != nil {
+				return fmt.Errorf("waiting for submitted tx %s: %w (last error getting tx: %v)", resp.Hash, ctx.Err(), pollErr)
+			}
+			return fmt.Errorf("waiting for submitted tx %s: %w", resp.Hash, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package stellarrpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/agent/submit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildResultXDR(t *testing.T, code xdr.TransactionResultCode) string {
+	r := xdr.TransactionResult{Result: xdr.TransactionResultResult{Code: code}}
+	if code == xdr.TransactionResultCodeTxFeeBumpInnerFailed {
+		r.Result.InnerResultPair = &xdr.InnerTransactionResultPair{
+			Result: xdr.InnerTransactionResult{
+				Result: xdr.InnerTransactionResultResult{Code: xdr.TransactionResultCodeTxBadSeq},
+			},
+		}
+	}
+	b64, err := xdr.MarshalBase64(r)
+	require.NoError(t, err)
+	return b64
+}
+
+func TestSubmitter_SubmitTx_success(t *testing.T) {
+	polls := 0
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			assert.JSONEq(t, `{"transaction":"txxdr"}`, string(params))
+			return SendTransactionResponse{Status: SendTransactionStatusPending, Hash: "txhash"}, nil
+		},
+		"getTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			assert.JSONEq(t, `{"hash":"txhash"}`, string(params))
+			polls++
+			if polls == 1 {
+				return map[string]interface{}{"status": TransactionStatusNotFound}, nil
+			}
+			return map[string]interface{}{"status": TransactionStatusSuccess, "ledger": 2, "createdAt": "3"}, nil
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	require.NoError(t, err)
+	assert.Equal(t, 2, polls)
+}
+
+func TestSubmitter_SubmitTx_errorOnSend(t *testing.T) {
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return SendTransactionResponse{
+				Status:         SendTransactionStatusError,
+				Hash:           "txhash",
+				ErrorResultXDR: buildResultXDR(t, xdr.TransactionResultCodeTxBadMinSeqAgeOrGap),
+			}, nil
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	assert.EqualError(t, err, "submitting tx txhash: transaction failed (tx_bad_minseq_age_or_gap)")
+}
+
+func TestSubmitter_SubmitTx_tryAgainLater(t *testing.T) {
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return SendTransactionResponse{Status: SendTransactionStatusTryAgainLater, Hash: "txhash"}, nil
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	assert.EqualError(t, err, "submitting tx txhash: status TRY_AGAIN_LATER")
+	assert.Equal(t, submit.ErrorKindTryAgainLater, submit.Classify(err))
+	assert.True(t, submit.Classify(err).Temporary())
+}
+
+func TestSubmitter_SubmitTx_failedInLedger(t *testing.T) {
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return SendTransactionResponse{Status: SendTransactionStatusDuplicate, Hash: "txhash"}, nil
+		},
+		"getTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return Transaction{
+				Status:    TransactionStatusFailed,
+				ResultXDR: buildResultXDR(t, xdr.TransactionResultCodeTxFeeBumpInnerFailed),
+			}, nil
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	assert.EqualError(t, err, "submitted tx txhash: transaction failed (tx_fee_bump_inner_failed, tx_bad_seq)")
+}
+
+func TestSubmitter_SubmitTx_timeout(t *testing.T) {
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return SendTransactionResponse{Status: SendTransactionStatusPending, Hash: "txhash"}, nil
+		},
+		"getTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return map[string]interface{}{"status": TransactionStatusNotFound}, nil
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond, Timeout: 20 * time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	assert.EqualError(t, err, "waiting for submitted tx txhash: context deadline exceeded")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSubmitter_SubmitTx_pollErrorsRetried(t *testing.T) {
+	polls := 0
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return SendTransactionResponse{Status: SendTransactionStatusPending, Hash: "txhash"}, nil
+		},
+		"getTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			polls++
+			if polls < 3 {
+				return nil, &Error{Code: -32603, Message: "internal error"}
+			}
+			return map[string]interface{}{"status": TransactionStatusSuccess, "ledger": 2, "createdAt": "3"}, nil
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	require.NoError(t, err)
+	assert.Equal(t, 3, polls)
+}
+
+func TestSubmitter_SubmitTx_pollErrorsUntilTimeout(t *testing.T) {
+	s := newTestServer(t, map[string]func(params json.RawMessage) (interface{}, *Error){
+		"sendTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return SendTransactionResponse{Status: SendTransactionStatusPending, Hash: "txhash"}, nil
+		},
+		"getTransaction": func(params json.RawMessage) (interface{}, *Error) {
+			return nil, &Error{Code: -32603, Message: "internal error"}
+		},
+	})
+	submitter := Submitter{Client: s.Client(), PollInterval: time.Millisecond, Timeout: 20 * time.Millisecond}
+
+	err := submitter.SubmitTx("txxdr")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "internal error")
+	assert.NotContains(t, err.Error(), "txxdr")
+}
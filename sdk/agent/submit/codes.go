@@ -0,0 +1,48 @@
+package submit
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+)
+
+// transactionResultCodes maps transaction result codes to the strings used
+// for them by Horizon and stellar-core.
+var transactionResultCodes = map[xdr.TransactionResultCode]string{
+	xdr.TransactionResultCodeTxFeeBumpInnerSuccess: "tx_fee_bump_inner_success",
+	xdr.TransactionResultCodeTxSuccess:             "tx_success",
+	xdr.TransactionResultCodeTxFailed:              "tx_failed",
+	xdr.TransactionResultCodeTxTooEarly:            "tx_too_early",
+	xdr.TransactionResultCodeTxTooLate:             "tx_too_late",
+	xdr.TransactionResultCodeTxMissingOperation:    "tx_missing_operation",
+	xdr.TransactionResultCodeTxBadSeq:              "tx_bad_seq",
+	xdr.TransactionResultCodeTxBadAuth:             "tx_bad_auth",
+	xdr.TransactionResultCodeTxInsufficientBalance: "tx_insufficient_balance",
+	xdr.TransactionResultCodeTxNoAccount:           "tx_no_source_account",
+	xdr.TransactionResultCodeTxInsufficientFee:     "tx_insufficient_fee",
+	xdr.TransactionResultCodeTxBadAuthExtra:        "tx_bad_auth_extra",
+	xdr.TransactionResultCodeTxInternalError:       "tx_internal_error",
+	xdr.TransactionResultCodeTxNotSupported:        "tx_not_supported",
+	xdr.TransactionResultCodeTxFeeBumpInnerFailed:  "tx_fee_bump_inner_failed",
+	xdr.TransactionResultCodeTxBadSponsorship:      "tx_bad_sponsorship",
+	xdr.TransactionResultCodeTxBadMinSeqAgeOrGap:   "tx_bad_minseq_age_or_gap",
+}
+
+func transactionResultCodeString(code xdr.TransactionResultCode) string {
+	if s, ok := transactionResultCodes[code]; ok {
+		return s
+	}
+	return fmt.Sprintf("tx_unknown_%d", int32(code))
+}
+
+// ResultCodes returns the result codes of the transaction result, as the
+// strings used for them by Horizon and stellar-core. For fee bump transactions
+// the codes contain the code of the fee bump transaction followed by the code
+// of the inner transaction.
+func ResultCodes(r xdr.TransactionResult) []string {
+	codes := []string{transactionResultCodeString(r.Result.Code)}
+	if ir, ok := r.Result.GetInnerResultPair(); ok {
+		codes = append(codes, transactionResultCodeString(ir.Result.Result.Code))
+	}
+	return codes
+}
@@ -0,0 +1,228 @@
+package submit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/stellar/go/clients/horizonclient"
+)
+
+// ErrorKind classifies the reason a transaction submission failed.
+type ErrorKind int
+
+const (
+	// ErrorKindUnknown is a failure that could not be classified, such as a
+	// network error.
+	ErrorKindUnknown ErrorKind = iota
+	// ErrorKindFailed is a transaction that was rejected or failed for a
+	// reason that will not change by resubmitting it.
+	ErrorKindFailed
+	// ErrorKindBadSeq is a transaction rejected with tx_bad_seq.
+	ErrorKindBadSeq
+	// ErrorKindTooEarly is a transaction rejected with tx_too_early.
+	ErrorKindTooEarly
+	// ErrorKindTooLate is a transaction rejected with tx_too_late.
+	ErrorKindTooLate
+	// ErrorKindMinSeqAgeOrGap is a transaction rejected with
+	// tx_bad_minseq_age_or_gap, such as a close submitted before the
+	// observation period has passed.
+	ErrorKindMinSeqAgeOrGap
+	// ErrorKindInsufficientFee is a transaction rejected with
+	// tx_insufficient_fee.
+	ErrorKindInsufficientFee
+	// ErrorKindTimeout is a submission that timed out before the
+	// transaction's result was known. The transaction may still succeed.
+	ErrorKindTimeout
+	// ErrorKindTryAgainLater is a transaction that was not accepted because
+	// the network was too busy, such as with the TRY_AGAIN_LATER status of
+	// Stellar RPC, or a Service Unavailable response from Horizon.
+	ErrorKindTryAgainLater
+)
+
+var errorKindStrings = map[ErrorKind]string{
+	ErrorKindUnknown:         "unknown",
+	ErrorKindFailed:          "failed",
+	ErrorKindBadSeq:          "bad_seq",
+	ErrorKindTooEarly:        "too_early",
+	ErrorKindTooLate:         "too_late",
+	ErrorKindMinSeqAgeOrGap:  "bad_minseq_age_or_gap",
+	ErrorKindInsufficientFee: "insufficient_fee",
+	ErrorKindTimeout:         "timeout",
+	ErrorKindTryAgainLater:   "try_again_later",
+}
+
+func (k ErrorKind) String() string {
+	if s, ok := errorKindStrings[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// Temporary returns true if the kind of failure may not occur if the same
+// transaction is submitted again later.
+func (k ErrorKind) Temporary() bool {
+	switch k {
+	case ErrorKindTooEarly, ErrorKindMinSeqAgeOrGap, ErrorKindInsufficientFee, ErrorKindTimeout, ErrorKindTryAgainLater:
+		return true
+	}
+	return false
+}
+
+// resultCodeKinds maps transaction result codes to the kind of failure they
+// indicate. Result codes not in the map indicate ErrorKindFailed.
+var resultCodeKinds = map[string]ErrorKind{
+	"tx_bad_seq":               ErrorKindBadSeq,
+	"tx_too_early":             ErrorKindTooEarly,
+	"tx_too_late":              ErrorKindTooLate,
+	"tx_bad_minseq_age_or_gap": ErrorKindMinSeqAgeOrGap,
+	"tx_insufficient_fee":      ErrorKindInsufficientFee,
+}
+
+// ledgerResultCodes are the result codes of transactions that were included
+// in a ledger and failed, and so were charged their fee. A fee bump that
+// fails in a ledger has the code of its inner transaction, since a fee bump
+// is also rejected with tx_fee_bump_inner_failed when its inner transaction
+// is invalid.
+var ledgerResultCodes = map[string]bool{
+	"tx_failed": true,
+}
+
+// rejectedBeforeLedger returns true if the error from a submission shows that
+// the transaction was rejected before being included in a ledger, and so was
+// not charged its fee. Failures without result codes, such as timeouts, may
+// have been included in a ledger and are not considered rejected.
+func rejectedBeforeLedger(err error) bool {
+	kind, codes := classify(err)
+	if kind == ErrorKindTryAgainLater {
+		return true
+	}
+	if len(codes) == 0 {
+		return false
+	}
+	for _, c := range codes {
+		if ledgerResultCodes[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// ResultError is an error that a SubmitTxer can return when a transaction is
+// rejected or fails, containing the transaction result codes. The codes are
+// the strings used for them by Horizon and stellar-core, such as tx_bad_seq.
+// For fee bump transactions the codes contain the code of the fee bump
+// transaction followed by the code of the inner transaction.
+type ResultError struct {
+	Codes []string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("transaction failed (%s)", strings.Join(e.Codes, ", "))
+}
+
+// Error is the error returned by the Submitter when a submission fails. It
+// classifies the failure so that callers can decide whether to resubmit.
+type Error struct {
+	Kind ErrorKind
+
+	// ResultCodes are the transaction result codes of the failed transaction,
+	// if known.
+	ResultCodes []string
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the kind of failure that the error from a submission
+// indicates. Errors returned by the Submitter are classified when they are
+// created. Other errors are classified by the result codes they contain,
+// either as a ResultError, a Horizon error, or in their message.
+func Classify(err error) ErrorKind {
+	if err == nil {
+		return ErrorKindUnknown
+	}
+	kind, _ := classify(err)
+	return kind
+}
+
+// classify returns the kind of failure and the result codes of the error,
+// which are those of the *Error it wraps if any.
+func classify(err error) (ErrorKind, []string) {
+	var sErr *Error
+	if errors.As(err, &sErr) {
+		return sErr.Kind, sErr.ResultCodes
+	}
+	codes := resultCodes(err)
+	if len(codes) > 0 {
+		// Check the codes from the last, since for fee bumps the last code is
+		// the inner transaction's which is more specific.
+		for i := len(codes) - 1; i >= 0; i-- {
+			if kind, ok := resultCodeKinds[codes[i]]; ok {
+				return kind, codes
+			}
+		}
+		return ErrorKindFailed, codes
+	}
+	if isTimeout(err) {
+		return ErrorKindTimeout, nil
+	}
+	var hErr *horizonclient.Error
+	if errors.As(err, &hErr) && hErr.Problem.Status == http.StatusServiceUnavailable {
+		return ErrorKindTryAgainLater, nil
+	}
+	// Fallback to finding the result codes in the error message for
+	// SubmitTxer implementations that only include them there.
+	msg := err.Error()
+	for code, kind := range resultCodeKinds {
+		if strings.Contains(msg, code) {
+			return kind, []string{code}
+		}
+	}
+	return ErrorKindUnknown, nil
+}
+
+func resultCodes(err error) []string {
+	var rErr *ResultError
+	if errors.As(err, &rErr) {
+		return rErr.Codes
+	}
+	var hErr *horizonclient.Error
+	if errors.As(err, &hErr) {
+		rc, err := hErr.ResultCodes()
+		if err != nil || rc.TransactionCode == "" {
+			return nil
+		}
+		codes := []string{rc.TransactionCode}
+		if rc.InnerTransactionCode != "" {
+			codes = append(codes, rc.InnerTransactionCode)
+		}
+		return codes
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var hErr *horizonclient.Error
+	if errors.As(err, &hErr) && hErr.Problem.Status == http.StatusGatewayTimeout {
+		return true
+	}
+	return false
+}
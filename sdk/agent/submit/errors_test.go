@@ -0,0 +1,82 @@
+package submit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/support/render/problem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	horizonErr := func(status int, codes map[string]interface{}) error {
+		p := problem.P{Status: status}
+		if codes != nil {
+			p.Extras = map[string]interface{}{"result_codes": codes}
+		}
+		return fmt.Errorf("submitting tx: %w", &horizonclient.Error{Problem: p})
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		kind ErrorKind
+	}{
+		{"nil", nil, ErrorKindUnknown},
+		{"unknown", errors.New("connection refused"), ErrorKindUnknown},
+		{"submitter error", &Error{Kind: ErrorKindTooLate, Err: errors.New("too late")}, ErrorKindTooLate},
+		{"wrapped submitter error", fmt.Errorf("submitting: %w", &Error{Kind: ErrorKindBadSeq, Err: errors.New("bad seq")}), ErrorKindBadSeq},
+		{"result error", &ResultError{Codes: []string{"tx_too_early"}}, ErrorKindTooEarly},
+		{"result error inner", &ResultError{Codes: []string{"tx_fee_bump_inner_failed", "tx_bad_minseq_age_or_gap"}}, ErrorKindMinSeqAgeOrGap},
+		{"result error failed", &ResultError{Codes: []string{"tx_failed"}}, ErrorKindFailed},
+		{"horizon error", horizonErr(http.StatusBadRequest, map[string]interface{}{"transaction": "tx_too_late"}), ErrorKindTooLate},
+		{"horizon error inner", horizonErr(http.StatusBadRequest, map[string]interface{}{"transaction": "tx_fee_bump_inner_failed", "inner_transaction": "tx_bad_seq"}), ErrorKindBadSeq},
+		{"horizon error failed", horizonErr(http.StatusBadRequest, map[string]interface{}{"transaction": "tx_failed", "operations": []string{"op_underfunded"}}), ErrorKindFailed},
+		{"horizon timeout", horizonErr(http.StatusGatewayTimeout, nil), ErrorKindTimeout},
+		{"horizon unavailable", horizonErr(http.StatusServiceUnavailable, nil), ErrorKindTryAgainLater},
+		{"deadline exceeded", fmt.Errorf("waiting: %w", context.DeadlineExceeded), ErrorKindTimeout},
+		{"message", errors.New("horizon error: \"Transaction Failed\" (tx_insufficient_fee)"), ErrorKindInsufficientFee},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.kind, Classify(tc.err))
+		})
+	}
+}
+
+func TestRejectedBeforeLedger(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		rejected bool
+	}{
+		{"unknown", errors.New("connection refused"), false},
+		{"timeout", fmt.Errorf("waiting: %w", context.DeadlineExceeded), false},
+		{"rejected", &ResultError{Codes: []string{"tx_bad_seq"}}, true},
+		{"rejected inner", &ResultError{Codes: []string{"tx_fee_bump_inner_failed", "tx_bad_seq"}}, true},
+		{"failed in ledger", &ResultError{Codes: []string{"tx_failed"}}, false},
+		{"failed in ledger inner", &ResultError{Codes: []string{"tx_fee_bump_inner_failed", "tx_failed"}}, false},
+		{"try again later", fmt.Errorf("submitting: %w", &Error{Kind: ErrorKindTryAgainLater, Err: errors.New("busy")}), true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.rejected, rejectedBeforeLedger(tc.err))
+		})
+	}
+}
+
+func TestErrorKind_Temporary(t *testing.T) {
+	assert.False(t, ErrorKindUnknown.Temporary())
+	assert.False(t, ErrorKindFailed.Temporary())
+	assert.False(t, ErrorKindBadSeq.Temporary())
+	assert.True(t, ErrorKindTooEarly.Temporary())
+	assert.False(t, ErrorKindTooLate.Temporary())
+	assert.True(t, ErrorKindMinSeqAgeOrGap.Temporary())
+	assert.True(t, ErrorKindInsufficientFee.Temporary())
+	assert.True(t, ErrorKindTimeout.Temporary())
+	assert.True(t, ErrorKindTryAgainLater.Temporary())
+}
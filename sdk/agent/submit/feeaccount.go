@@ -0,0 +1,364 @@
+package submit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/state"
+)
+
+// FeeAccount is an account that pays the fees of fee bump transactions, and
+// the signers that sign the fee bump transactions for the account.
+type FeeAccount struct {
+	Account *keypair.FromAddress
+	Signers []*keypair.Full
+}
+
+// FeeAccountSelector selects the fee account to pay the fee of a fee bump
+// transaction.
+type FeeAccountSelector interface {
+	// SelectFeeAccount returns the fee account to use for a fee bump of the
+	// transaction that will be charged at most the given fee.
+	SelectFeeAccount(tx *txnbuild.Transaction, fee int64) (FeeAccount, error)
+
+	// ReleaseFeeAccount is called with the fee account selected for a fee
+	// bump of the transaction when the fee bump fails before it is included
+	// in a ledger, and so has not been charged the fee. It is not called for
+	// fee bumps that fail in a ledger, or whose outcome is unknown, such as
+	// when the submission times out.
+	ReleaseFeeAccount(tx *txnbuild.Transaction, a FeeAccount, fee int64)
+}
+
+// BalanceCollector gets the balance of an asset for an account.
+type BalanceCollector interface {
+	GetBalance(account *keypair.FromAddress, asset state.Asset) (int64, error)
+}
+
+// SelectionStrategy is the strategy a FeeAccountPool uses to select a fee
+// account.
+type SelectionStrategy int
+
+const (
+	// SelectRoundRobin selects each fee account in turn.
+	SelectRoundRobin SelectionStrategy = iota
+	// SelectLeastUsed selects the fee account that has been selected the
+	// fewest times.
+	SelectLeastUsed
+)
+
+// LowBalanceEvent occurs when the balance of a fee account in a
+// FeeAccountPool falls below the pool's low balance threshold, either when
+// balances are refreshed or when the account is selected to pay a fee. While
+// the balance is low the account is only selected if no other account has a
+// balance above the threshold.
+type LowBalanceEvent struct {
+	Account   *keypair.FromAddress
+	Balance   int64
+	Threshold int64
+}
+
+// ErrNoFeeAccount indicates that no fee account in a pool has a balance
+// sufficient to pay a fee.
+var ErrNoFeeAccount = errors.New("no fee account with sufficient balance")
+
+var _ FeeAccountSelector = &FeeAccountPool{}
+
+// FeeAccountPool is a FeeAccountSelector that selects fee accounts from a pool
+// of accounts so that fee bumps for many channels do not depend on a single
+// account.
+//
+// If a BalanceCollector is configured the balances of the accounts are
+// monitored, and accounts without a sufficient balance to pay a fee are not
+// selected. Balances are refreshed by calling RefreshBalances, or
+// periodically by calling Monitor, and between refreshes are reduced by the
+// fees of the fee bumps each account is selected for. Fees of fee bumps that
+// are rejected before being included in a ledger are credited back.
+//
+// All functions of the FeeAccountPool are safe to call from multiple
+// goroutines.
+type FeeAccountPool struct {
+	Accounts []FeeAccount
+	Strategy SelectionStrategy
+
+	BalanceCollector    BalanceCollector
+	LowBalanceThreshold int64
+
+	// Events, if set, receives a LowBalanceEvent each time an account's
+	// balance falls below the LowBalanceThreshold. Events for balances that
+	// fall when an account is selected are sent from a goroutine, so that
+	// submissions do not wait for the channel to be received from.
+	Events       chan<- interface{}
+	ErrorHandler func(error)
+
+	// mu is a lock for the mutable fields of this type.
+	mu       sync.Mutex
+	next     int
+	uses     map[string]int
+	balances map[string]int64
+	low      map[string]bool
+}
+
+// SelectFeeAccount returns the fee account to use for a fee bump that will be
+// charged at most the given fee, using the pool's selection strategy.
+// Accounts with low balances are only selected if every account's balance is
+// low. If no account has a sufficient balance to pay the fee, ErrNoFeeAccount
+// is returned.
+func (p *FeeAccountPool) SelectFeeAccount(tx *txnbuild.Transaction, fee int64) (FeeAccount, error) {
+	var a FeeAccount
+	var event *LowBalanceEvent
+	err := func() error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.init()
+
+		if len(p.Accounts) == 0 {
+			return fmt.Errorf("no fee accounts in pool")
+		}
+
+		i, ok := p.selectAccount(func(a FeeAccount) bool {
+			return p.canPay(a, fee) && !p.low[a.Account.Address()]
+		})
+		if !ok {
+			i, ok = p.selectAccount(func(a FeeAccount) bool {
+				return p.canPay(a, fee)
+			})
+		}
+		if !ok {
+			return ErrNoFeeAccount
+		}
+
+		a = p.Accounts[i]
+		address := a.Account.Address()
+		p.uses[address]++
+		if balance, ok := p.balances[address]; ok {
+			balance -= fee
+			p.balances[address] = balance
+			low := balance < p.LowBalanceThreshold
+			if low && !p.low[address] {
+				event = &LowBalanceEvent{
+					Account:   a.Account,
+					Balance:   balance,
+					Threshold: p.LowBalanceThreshold,
+				}
+			}
+			p.low[address] = low
+		}
+		return nil
+	}()
+	if err != nil {
+		return FeeAccount{}, err
+	}
+
+	if event != nil && p.Events != nil {
+		go func(e LowBalanceEvent) {
+			p.Events <- e
+		}(*event)
+	}
+	return a, nil
+}
+
+// ReleaseFeeAccount credits the fee back to the balance of the account, after
+// a fee bump the account was selected for was rejected before being included
+// in a ledger.
+func (p *FeeAccountPool) ReleaseFeeAccount(tx *txnbuild.Transaction, a FeeAccount, fee int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	address := a.Account.Address()
+	if balance, ok := p.balances[address]; ok {
+		balance += fee
+		p.balances[address] = balance
+		p.low[address] = balance < p.LowBalanceThreshold
+	}
+}
+
+// canPay returns true if the account's balance is unknown, or sufficient to
+// pay the fee.
+//
+// Must be called with the mutex locked.
+func (p *FeeAccountPool) canPay(a FeeAccount, fee int64) bool {
+	balance, ok := p.balances[a.Account.Address()]
+	return !ok || balance >= fee
+}
+
+// selectAccount returns the index of the account selected by the strategy
+// from the accounts that are eligible.
+//
+// Must be called with the mutex locked.
+func (p *FeeAccountPool) selectAccount(eligible func(a FeeAccount) bool) (int, bool) {
+	switch p.Strategy {
+	case SelectLeastUsed:
+		selected := -1
+		for i, a := range p.Accounts {
+			if !eligible(a) {
+				continue
+			}
+			if selected == -1 || p.uses[a.Account.Address()] < p.uses[p.Accounts[selected].Account.Address()] {
+				selected = i
+			}
+		}
+		return selected, selected != -1
+	default:
+		for j := 0; j < len(p.Accounts); j++ {
+			i := (p.next + j) % len(p.Accounts)
+			if eligible(p.Accounts[i]) {
+				p.next = i + 1
+				return i, true
+			}
+		}
+		return -1, false
+	}
+}
+
+// Uses returns the number of times each account, keyed by address, has been
+// selected.
+func (p *FeeAccountPool) Uses() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	uses := make(map[string]int, len(p.uses))
+	for a, n := range p.uses {
+		uses[a] = n
+	}
+	return uses
+}
+
+// RefreshBalances gets the native balance of each account in the pool using
+// the BalanceCollector. A LowBalanceEvent is sent for each account with a
+// balance that has fallen below the LowBalanceThreshold since the last
+// refresh. Accounts that the balance could not be retrieved for keep their
+// previous balance.
+func (p *FeeAccountPool) RefreshBalances() error {
+	if p.BalanceCollector == nil {
+		return fmt.Errorf("no balance collector configured")
+	}
+	var errs []error
+	balances := map[string]int64{}
+	for _, a := range p.Accounts {
+		balance, err := p.BalanceCollector.GetBalance(a.Account, state.NativeAsset)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("getting balance of fee account %s: %w", a.Account.Address(), err))
+			continue
+		}
+		balances[a.Account.Address()] = balance
+	}
+
+	var events []LowBalanceEvent
+	func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.init()
+		for _, a := range p.Accounts {
+			address := a.Account.Address()
+			balance, ok := balances[address]
+			if !ok {
+				continue
+			}
+			p.balances[address] = balance
+			low := balance < p.LowBalanceThreshold
+			if low && !p.low[address] {
+				events = append(events, LowBalanceEvent{
+					Account:   a.Account,
+					Balance:   balance,
+					Threshold: p.LowBalanceThreshold,
+				})
+			}
+			p.low[address] = low
+		}
+	}()
+
+	if p.Events != nil {
+		for _, e := range events {
+			p.Events <- e
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Monitor refreshes the balances of the accounts in the pool immediately and
+// then at the given interval, until the returned stop function is called.
+// Errors refreshing balances are passed to the ErrorHandler.
+func (p *FeeAccountPool) Monitor(interval time.Duration) (stop func()) {
+	stopCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := p.RefreshBalances()
+			if err != nil && p.ErrorHandler != nil {
+				p.ErrorHandler(err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	stopOnce := sync.Once{}
+	return func() {
+		stopOnce.Do(func() {
+			close(stopCh)
+		})
+	}
+}
+
+// init initializes the maps of the pool.
+//
+// Must be called with the mutex locked.
+func (p *FeeAccountPool) init() {
+	if p.uses == nil {
+		p.uses = map[string]int{}
+		p.balances = map[string]int64{}
+		p.low = map[string]bool{}
+	}
+}
+
+var _ FeeAccountSelector = &ChannelFeeAccounts{}
+
+// ChannelFeeAccounts is a FeeAccountSelector that sponsors the fees of each
+// channel account separately, by selecting the fee account for a fee bump by
+// the source account of the transaction, which for the transactions of a
+// channel is a channel account. A channel account can pay its own fees by
+// being given a FeeAccount of itself, signed by the channel account's signer.
+//
+// Transactions with a source account that has no fee account use the Default
+// selector, such as a FeeAccountPool shared by all channels, if set.
+type ChannelFeeAccounts struct {
+	// Accounts are the fee accounts keyed by the address of the channel
+	// account they sponsor.
+	Accounts map[string]FeeAccount
+	Default  FeeAccountSelector
+}
+
+// SelectFeeAccount returns the fee account of the transaction's source
+// account, or the fee account selected by the Default selector.
+func (c *ChannelFeeAccounts) SelectFeeAccount(tx *txnbuild.Transaction, fee int64) (FeeAccount, error) {
+	source := tx.SourceAccount().AccountID
+	if a, ok := c.Accounts[source]; ok {
+		return a, nil
+	}
+	if c.Default != nil {
+		return c.Default.SelectFeeAccount(tx, fee)
+	}
+	return FeeAccount{}, fmt.Errorf("no fee account for %s", source)
+}
+
+// ReleaseFeeAccount releases the fee account with the Default selector if it
+// was selected by it.
+func (c *ChannelFeeAccounts) ReleaseFeeAccount(tx *txnbuild.Transaction, a FeeAccount, fee int64) {
+	if _, ok := c.Accounts[tx.SourceAccount().AccountID]; ok {
+		return
+	}
+	if c.Default != nil {
+		c.Default.ReleaseFeeAccount(tx, a, fee)
+	}
+}
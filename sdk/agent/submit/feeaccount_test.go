@@ -0,0 +1,353 @@
+package submit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type balanceCollectorFunc func(*keypair.FromAddress, state.Asset) (int64, error)
+
+func (f balanceCollectorFunc) GetBalance(account *keypair.FromAddress, asset state.Asset) (int64, error) {
+	return f(account, asset)
+}
+
+func newTestFeeAccounts(n int) []FeeAccount {
+	accounts := make([]FeeAccount, n)
+	for i := range accounts {
+		kp := keypair.MustRandom()
+		accounts[i] = FeeAccount{Account: kp.FromAddress(), Signers: []*keypair.Full{kp}}
+	}
+	return accounts
+}
+
+func TestFeeAccountPool_roundRobin(t *testing.T) {
+	accounts := newTestFeeAccounts(3)
+	p := FeeAccountPool{Accounts: accounts}
+
+	for i := 0; i < 6; i++ {
+		a, err := p.SelectFeeAccount(nil, 100)
+		require.NoError(t, err)
+		assert.Equal(t, accounts[i%3].Account.Address(), a.Account.Address())
+	}
+	assert.Equal(t, map[string]int{
+		accounts[0].Account.Address(): 2,
+		accounts[1].Account.Address(): 2,
+		accounts[2].Account.Address(): 2,
+	}, p.Uses())
+}
+
+func TestFeeAccountPool_leastUsed(t *testing.T) {
+	accounts := newTestFeeAccounts(3)
+	balances := map[string]int64{
+		accounts[0].Account.Address(): 1000,
+		accounts[1].Account.Address(): 250,
+		accounts[2].Account.Address(): 1000,
+	}
+	p := FeeAccountPool{
+		Accounts: accounts,
+		Strategy: SelectLeastUsed,
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, asset state.Asset) (int64, error) {
+			assert.Equal(t, state.NativeAsset, asset)
+			return balances[a.Address()], nil
+		}),
+	}
+	require.NoError(t, p.RefreshBalances())
+
+	for i := 0; i < 7; i++ {
+		_, err := p.SelectFeeAccount(nil, 200)
+		require.NoError(t, err)
+	}
+	// The second account only has the balance to pay one fee.
+	assert.Equal(t, map[string]int{
+		accounts[0].Account.Address(): 3,
+		accounts[1].Account.Address(): 1,
+		accounts[2].Account.Address(): 3,
+	}, p.Uses())
+
+	// All accounts have insufficient balance remaining.
+	_, err := p.SelectFeeAccount(nil, 500)
+	assert.ErrorIs(t, err, ErrNoFeeAccount)
+}
+
+func TestFeeAccountPool_lowBalance(t *testing.T) {
+	accounts := newTestFeeAccounts(2)
+	balances := map[string]int64{
+		accounts[0].Account.Address(): 50,
+		accounts[1].Account.Address(): 1000,
+	}
+	events := make(chan interface{}, 10)
+	p := FeeAccountPool{
+		Accounts: accounts,
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+			return balances[a.Address()], nil
+		}),
+		LowBalanceThreshold: 100,
+		Events:              events,
+	}
+	require.NoError(t, p.RefreshBalances())
+	require.Len(t, events, 1)
+	assert.Equal(t, LowBalanceEvent{Account: accounts[0].Account, Balance: 50, Threshold: 100}, <-events)
+
+	// Low balance accounts are not selected while others are not low.
+	for i := 0; i < 3; i++ {
+		a, err := p.SelectFeeAccount(nil, 10)
+		require.NoError(t, err)
+		assert.Equal(t, accounts[1].Account.Address(), a.Account.Address())
+	}
+
+	// Low balance events are only sent when a balance becomes low.
+	balances[accounts[1].Account.Address()] = 20
+	require.NoError(t, p.RefreshBalances())
+	require.Len(t, events, 1)
+	assert.Equal(t, LowBalanceEvent{Account: accounts[1].Account, Balance: 20, Threshold: 100}, <-events)
+
+	// When all are low any account with enough balance is selected.
+	a, err := p.SelectFeeAccount(nil, 30)
+	require.NoError(t, err)
+	assert.Equal(t, accounts[0].Account.Address(), a.Account.Address())
+
+	// Balance errors are returned and the previous balances kept.
+	p.BalanceCollector = balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+		return 0, errors.New("not found")
+	})
+	err = p.RefreshBalances()
+	assert.EqualError(t, err, "getting balance of fee account "+accounts[0].Account.Address()+": not found")
+	a, err = p.SelectFeeAccount(nil, 20)
+	require.NoError(t, err)
+	assert.Equal(t, accounts[1].Account.Address(), a.Account.Address())
+	assert.Len(t, events, 0)
+}
+
+func TestFeeAccountPool_lowBalanceAfterSelect(t *testing.T) {
+	accounts := newTestFeeAccounts(1)
+	events := make(chan interface{}, 10)
+	p := FeeAccountPool{
+		Accounts: accounts,
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+			return 300, nil
+		}),
+		LowBalanceThreshold: 100,
+		Events:              events,
+	}
+	require.NoError(t, p.RefreshBalances())
+	require.Len(t, events, 0)
+
+	// The event is sent when a fee takes the balance below the threshold,
+	// and only once while it stays below.
+	_, err := p.SelectFeeAccount(nil, 150)
+	require.NoError(t, err)
+	_, err = p.SelectFeeAccount(nil, 100)
+	require.NoError(t, err)
+	select {
+	case e := <-events:
+		assert.Equal(t, LowBalanceEvent{Account: accounts[0].Account, Balance: 50, Threshold: 100}, e)
+	case <-time.After(5 * time.Second):
+		t.Fatal("low balance event not sent")
+	}
+	_, err = p.SelectFeeAccount(nil, 10)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	require.Len(t, events, 0)
+}
+
+func TestFeeAccountPool_selectDoesNotWaitForEvents(t *testing.T) {
+	accounts := newTestFeeAccounts(1)
+	events := make(chan interface{})
+	p := FeeAccountPool{
+		Accounts: accounts,
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+			return 300, nil
+		}),
+		LowBalanceThreshold: 100,
+		Events:              events,
+	}
+	require.NoError(t, p.RefreshBalances())
+
+	// Selecting returns while the event is not received.
+	_, err := p.SelectFeeAccount(nil, 250)
+	require.NoError(t, err)
+	assert.Equal(t, LowBalanceEvent{Account: accounts[0].Account, Balance: 50, Threshold: 100}, <-events)
+}
+
+func TestFeeAccountPool_releaseFeeAccount(t *testing.T) {
+	accounts := newTestFeeAccounts(1)
+	p := FeeAccountPool{
+		Accounts: accounts,
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+			return 200, nil
+		}),
+	}
+	require.NoError(t, p.RefreshBalances())
+
+	a, err := p.SelectFeeAccount(nil, 200)
+	require.NoError(t, err)
+	_, err = p.SelectFeeAccount(nil, 200)
+	assert.ErrorIs(t, err, ErrNoFeeAccount)
+
+	// Once released the fee is credited back and the account can pay again.
+	p.ReleaseFeeAccount(nil, a, 200)
+	_, err = p.SelectFeeAccount(nil, 200)
+	require.NoError(t, err)
+}
+
+func TestChannelFeeAccounts(t *testing.T) {
+	sponsors := newTestFeeAccounts(2)
+	pool := &FeeAccountPool{
+		Accounts: sponsors[1:],
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+			return 200, nil
+		}),
+	}
+	require.NoError(t, pool.RefreshBalances())
+
+	sponsored := newTestTx(t, 0)
+	selfSponsoredSigner := keypair.MustRandom()
+	selfSponsored := newTestTxFrom(t, selfSponsoredSigner.Address())
+	other := newTestTx(t, 0)
+
+	c := &ChannelFeeAccounts{
+		Accounts: map[string]FeeAccount{
+			sponsored.SourceAccount().AccountID: sponsors[0],
+			selfSponsored.SourceAccount().AccountID: {
+				Account: selfSponsoredSigner.FromAddress(),
+				Signers: []*keypair.Full{selfSponsoredSigner},
+			},
+		},
+	}
+
+	a, err := c.SelectFeeAccount(sponsored, 200)
+	require.NoError(t, err)
+	assert.Equal(t, sponsors[0].Account.Address(), a.Account.Address())
+	a, err = c.SelectFeeAccount(selfSponsored, 200)
+	require.NoError(t, err)
+	assert.Equal(t, selfSponsoredSigner.Address(), a.Account.Address())
+	_, err = c.SelectFeeAccount(other, 200)
+	assert.EqualError(t, err, "no fee account for "+other.SourceAccount().AccountID)
+
+	// Txs without a fee account of their own are sponsored by the default,
+	// which is released to when the fee bump fails.
+	c.Default = pool
+	a, err = c.SelectFeeAccount(other, 200)
+	require.NoError(t, err)
+	assert.Equal(t, sponsors[1].Account.Address(), a.Account.Address())
+	_, err = c.SelectFeeAccount(other, 200)
+	assert.ErrorIs(t, err, ErrNoFeeAccount)
+	c.ReleaseFeeAccount(other, a, 200)
+	_, err = c.SelectFeeAccount(other, 200)
+	require.NoError(t, err)
+
+	// Releasing a channel's own fee account does not credit the default.
+	c.ReleaseFeeAccount(sponsored, sponsors[0], 200)
+	_, err = c.SelectFeeAccount(other, 200)
+	assert.ErrorIs(t, err, ErrNoFeeAccount)
+}
+
+func TestSubmitter_SubmitTx_feeAccountPoolReleasedOnFailure(t *testing.T) {
+	accounts := newTestFeeAccounts(1)
+	pool := &FeeAccountPool{
+		Accounts: accounts,
+		BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+			return 200, nil
+		}),
+	}
+	require.NoError(t, pool.RefreshBalances())
+	fail := true
+	s := Submitter{
+		SubmitTxer: submitTxerFunc(func(txXDR string) error {
+			if fail {
+				return errors.New("tx_bad_seq")
+			}
+			return nil
+		}),
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		BaseFee:           100,
+		FeeAccounts:       pool,
+	}
+
+	// The fee bump rejected before the ledger does not use up the account's
+	// balance.
+	err := s.SubmitTx(newTestTx(t, 0))
+	require.Error(t, err)
+	fail = false
+	require.NoError(t, s.SubmitTx(newTestTx(t, 0)))
+	err = s.SubmitTx(newTestTx(t, 0))
+	assert.ErrorIs(t, err, ErrNoFeeAccount)
+}
+
+func TestSubmitter_SubmitTx_feeAccountPoolNotReleasedWhenCharged(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{"failed in ledger", &ResultError{Codes: []string{"tx_fee_bump_inner_failed", "tx_failed"}}},
+		{"timeout", context.DeadlineExceeded},
+		{"unknown", errors.New("connection reset")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			accounts := newTestFeeAccounts(1)
+			pool := &FeeAccountPool{
+				Accounts: accounts,
+				BalanceCollector: balanceCollectorFunc(func(a *keypair.FromAddress, _ state.Asset) (int64, error) {
+					return 200, nil
+				}),
+			}
+			require.NoError(t, pool.RefreshBalances())
+			s := Submitter{
+				SubmitTxer: submitTxerFunc(func(txXDR string) error {
+					return tc.err
+				}),
+				NetworkPassphrase: network.TestNetworkPassphrase,
+				BaseFee:           100,
+				FeeAccounts:       pool,
+			}
+
+			// The fee bump may have been charged, so the fee is not credited
+			// back to the account.
+			err := s.SubmitTx(newTestTx(t, 0))
+			require.Error(t, err)
+			err = s.SubmitTx(newTestTx(t, 0))
+			assert.ErrorIs(t, err, ErrNoFeeAccount)
+		})
+	}
+}
+
+func TestSubmitter_SubmitTx_feeAccountPool(t *testing.T) {
+	accounts := newTestFeeAccounts(2)
+	feeSources := []string{}
+	s := Submitter{
+		SubmitTxer: submitTxerFunc(func(txXDR string) error {
+			var env xdr.TransactionEnvelope
+			require.NoError(t, xdr.SafeUnmarshalBase64(txXDR, &env))
+			require.True(t, env.IsFeeBump())
+			feeSource := env.FeeBumpAccount().ToAccountId()
+			feeSources = append(feeSources, feeSource.Address())
+			return nil
+		}),
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		BaseFee:           100,
+		FeeAccounts:       &FeeAccountPool{Accounts: accounts},
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.SubmitTx(newTestTx(t, 0)))
+	}
+	assert.Equal(t, []string{
+		accounts[0].Account.Address(),
+		accounts[1].Account.Address(),
+		accounts[0].Account.Address(),
+	}, feeSources)
+
+	s.FeeAccounts = &FeeAccountPool{}
+	err := s.SubmitTx(newTestTx(t, 0))
+	assert.EqualError(t, err, "selecting fee account: no fee accounts in pool")
+}
@@ -3,13 +3,17 @@
 // The Submitter type can be used to wrap any submission logic, and it will
 // check if the transactions fee is below a threshold that indicates it needs to
 // be fee bumped, and if so, it will wrap it in a fee bump transaction before
-// submission.
+// submission. Failed submissions are classified, and can be retried with fee
+// bumps escalating when fees surge. Fee bumps can be paid by a single fee
+// account, by a pool of fee accounts, or by fee accounts that sponsor each
+// channel account.
 //
 // This package is intended for use in example payment channel implementations.
 package submit
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/stellar/go/clients/horizonclient"
 	"github.com/stellar/go/keypair"
@@ -21,6 +25,63 @@ type SubmitTxer interface {
 	SubmitTx(xdr string) error
 }
 
+// Logger logs messages at levels, with fields given as alternating keys and
+// values. It is implemented by *slog.Logger and agent.Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Debug(msg string, args ...interface{}) {}
+func (discardLogger) Info(msg string, args ...interface{})  {}
+func (discardLogger) Warn(msg string, args ...interface{})  {}
+func (discardLogger) Error(msg string, args ...interface{}) {}
+
+// RetryPolicy configures the retrying of submissions that fail.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts to submit a transaction,
+	// including the first attempt. If zero or one, submissions are not
+	// retried.
+	MaxAttempts int
+
+	// Backoff is the time waited before the first retry, which doubles for
+	// each subsequent retry.
+	Backoff time.Duration
+
+	// MaxBackoff is the maximum time waited before a retry. If zero the time
+	// waited is not limited.
+	MaxBackoff time.Duration
+
+	// Retryable returns true if a failure of the kind should be retried. If
+	// nil, failures of kinds that are temporary are retried.
+	Retryable func(kind ErrorKind) bool
+}
+
+func (p RetryPolicy) retryable(kind ErrorKind) bool {
+	if p.Retryable != nil {
+		return p.Retryable(kind)
+	}
+	return kind.Temporary()
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < retry; i++ {
+		if p.MaxBackoff != 0 && backoff >= p.MaxBackoff {
+			break
+		}
+		backoff *= 2
+	}
+	if p.MaxBackoff != 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
 // Submitter submits transactions to the network via Horizon. If a transaction
 // has a base fee below the submitters base fee, the transaction is wrapped in a
 // fee bump transaction. This means fee-less transactions are wrapped in fee
@@ -28,22 +89,63 @@ type SubmitTxer interface {
 //
 // The BaseFee is the base fee that will be used for any submission where the
 // transaction has a lower base fee.
+//
+// If a submission fails with tx_insufficient_fee and the MaxBaseFee is greater
+// than the BaseFee, the base fee of the fee bump is doubled for each retry, up
+// to the MaxBaseFee. Submissions are only retried as configured by the
+// RetryPolicy. SubmitTx waits for the backoff between retries, and the agent
+// does not hold its lock while a Submitter is submitting.
+//
+// Fee bumps are paid by the FeeAccount, or if FeeAccounts is set, by the
+// account it selects for each fee bump, such as from a FeeAccountPool or a
+// ChannelFeeAccounts. Accounts selected for fee bumps that fail to submit are
+// released back to FeeAccounts.
+//
+// Fee bumps and retries are logged to the Logger if set.
 type Submitter struct {
 	SubmitTxer        SubmitTxer
 	NetworkPassphrase string
 	BaseFee           int64
+	MaxBaseFee        int64
 	FeeAccount        *keypair.FromAddress
 	FeeAccountSigners []*keypair.Full
+	FeeAccounts       FeeAccountSelector
+	RetryPolicy       RetryPolicy
+	Logger            Logger
 }
 
 // SubmitTx submits the transaction. If the transaction has a base fee that is
 // lower than the submitters base fee it is wrapped in a fee bump transaction
-// with the Submitter's FeeAccount as the fee account.
+// with the Submitter's fee account as the fee account.
+//
+// Errors submitting to the network are returned as an *Error that classifies
+// the failure of the last attempt.
 func (s *Submitter) SubmitTx(tx *txnbuild.Transaction) error {
-	if tx.BaseFee() < s.BaseFee {
-		return s.submitTxWithFeeBump(tx)
+	baseFee := s.BaseFee
+	for attempt := 1; ; attempt++ {
+		var err error
+		if tx.BaseFee() < baseFee {
+			err = s.submitTxWithFeeBump(tx, baseFee)
+		} else {
+			err = s.submitTx(tx)
+		}
+		if err == nil {
+			return nil
+		}
+		sErr, ok := err.(*Error)
+		if !ok || attempt >= s.RetryPolicy.MaxAttempts || !s.RetryPolicy.retryable(sErr.Kind) {
+			return err
+		}
+		if sErr.Kind == ErrorKindInsufficientFee && baseFee < s.MaxBaseFee {
+			baseFee *= 2
+			if baseFee > s.MaxBaseFee {
+				baseFee = s.MaxBaseFee
+			}
+		}
+		backoff := s.RetryPolicy.backoff(attempt)
+		s.log().Warn("submission failed, retrying", "attempt", attempt, "kind", sErr.Kind, "result_codes", sErr.ResultCodes, "base_fee", baseFee, "retry_in", backoff)
+		time.Sleep(backoff)
 	}
-	return s.submitTx(tx)
 }
 
 func (s *Submitter) submitTx(tx *txnbuild.Transaction) error {
@@ -53,21 +155,44 @@ func (s *Submitter) submitTx(tx *txnbuild.Transaction) error {
 	}
 	err = s.SubmitTxer.SubmitTx(txeBase64)
 	if err != nil {
-		return fmt.Errorf("submitting tx: %w", buildErr(err))
+		return newError(fmt.Errorf("submitting tx: %w", buildErr(err)))
 	}
 	return nil
 }
 
-func (s *Submitter) submitTxWithFeeBump(tx *txnbuild.Transaction) error {
+func (s *Submitter) feeAccount(tx *txnbuild.Transaction, fee int64) (FeeAccount, error) {
+	if s.FeeAccounts != nil {
+		return s.FeeAccounts.SelectFeeAccount(tx, fee)
+	}
+	return FeeAccount{Account: s.FeeAccount, Signers: s.FeeAccountSigners}, nil
+}
+
+func (s *Submitter) submitTxWithFeeBump(tx *txnbuild.Transaction, baseFee int64) (err error) {
+	// A fee bump is charged for the inner tx's operations plus itself.
+	fee := baseFee * int64(len(tx.Operations())+1)
+	feeAccount, err := s.feeAccount(tx, fee)
+	if err != nil {
+		return fmt.Errorf("selecting fee account: %w", err)
+	}
+	// The fee account is released if the fee bump fails before it is
+	// submitted, or is rejected before being included in a ledger. Fee bumps
+	// that fail in a ledger, or with an unknown outcome, may have been charged.
+	release := true
+	defer func() {
+		if err != nil && release && s.FeeAccounts != nil {
+			s.FeeAccounts.ReleaseFeeAccount(tx, feeAccount, fee)
+		}
+	}()
+	s.log().Debug("fee bumping tx", "base_fee", baseFee, "fee_account", feeAccount.Account.Address())
 	feeBumpTx, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
 		Inner:      tx,
-		BaseFee:    s.BaseFee,
-		FeeAccount: s.FeeAccount.Address(),
+		BaseFee:    baseFee,
+		FeeAccount: feeAccount.Account.Address(),
 	})
 	if err != nil {
 		return fmt.Errorf("building fee bump tx: %w", err)
 	}
-	feeBumpTx, err = feeBumpTx.Sign(s.NetworkPassphrase, s.FeeAccountSigners...)
+	feeBumpTx, err = feeBumpTx.Sign(s.NetworkPassphrase, feeAccount.Signers...)
 	if err != nil {
 		return fmt.Errorf("signing fee bump tx: %w", err)
 	}
@@ -77,12 +202,27 @@ func (s *Submitter) submitTxWithFeeBump(tx *txnbuild.Transaction) error {
 	}
 	err = s.SubmitTxer.SubmitTx(txeBase64)
 	if err != nil {
-		return fmt.Errorf("submitting fee bump tx: %w", buildErr(err))
+		sErr := newError(fmt.Errorf("submitting fee bump tx: %w", buildErr(err)))
+		release = rejectedBeforeLedger(sErr)
+		return sErr
 	}
 
 	return nil
 }
 
+func (s *Submitter) log() Logger {
+	if s.Logger == nil {
+		return discardLogger{}
+	}
+	return s.Logger
+}
+
+// newError returns an *Error classifying the submission error.
+func newError(err error) *Error {
+	kind, codes := classify(err)
+	return &Error{Kind: kind, ResultCodes: codes, Err: err}
+}
+
 func buildErr(err error) error {
 	if hErr := horizonclient.GetError(err); hErr != nil {
 		resultString, rErr := hErr.ResultString()
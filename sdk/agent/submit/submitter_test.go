@@ -0,0 +1,176 @@
+package submit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type submitTxerFunc func(xdr string) error
+
+func (f submitTxerFunc) SubmitTx(xdr string) error {
+	return f(xdr)
+}
+
+func newTestTx(t *testing.T, baseFee int64) *txnbuild.Transaction {
+	t.Helper()
+	return newTestTxWithSource(t, keypair.MustRandom().Address(), baseFee)
+}
+
+func newTestTxFrom(t *testing.T, source string) *txnbuild.Transaction {
+	t.Helper()
+	return newTestTxWithSource(t, source, 0)
+}
+
+func newTestTxWithSource(t *testing.T, source string, baseFee int64) *txnbuild.Transaction {
+	t.Helper()
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{
+			AccountID: source,
+			Sequence:  1,
+		},
+		BaseFee:       baseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations:    []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: 2}},
+	})
+	require.NoError(t, err)
+	return tx
+}
+
+// submittedBaseFee returns the base fee of the submitted tx, or of the fee
+// bump if the tx is a fee bump.
+func submittedBaseFee(t *testing.T, txXDR string) (baseFee int64, feeBump bool) {
+	t.Helper()
+	var env xdr.TransactionEnvelope
+	require.NoError(t, xdr.SafeUnmarshalBase64(txXDR, &env))
+	if env.IsFeeBump() {
+		return env.FeeBumpFee() / int64(len(env.Operations())+1), true
+	}
+	return int64(env.Fee()) / int64(len(env.Operations())), false
+}
+
+func TestSubmitter_SubmitTx_feeBump(t *testing.T) {
+	feeAccount := keypair.MustRandom()
+	submitted := []string{}
+	s := Submitter{
+		SubmitTxer: submitTxerFunc(func(xdr string) error {
+			submitted = append(submitted, xdr)
+			return nil
+		}),
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		BaseFee:           txnbuild.MinBaseFee,
+		FeeAccount:        feeAccount.FromAddress(),
+		FeeAccountSigners: []*keypair.Full{feeAccount},
+	}
+
+	// Txs with a lower base fee are fee bumped.
+	err := s.SubmitTx(newTestTx(t, 0))
+	require.NoError(t, err)
+	require.Len(t, submitted, 1)
+	baseFee, feeBump := submittedBaseFee(t, submitted[0])
+	assert.True(t, feeBump)
+	assert.Equal(t, int64(txnbuild.MinBaseFee), baseFee)
+
+	// Txs with a sufficient base fee are submitted as is.
+	err = s.SubmitTx(newTestTx(t, 200))
+	require.NoError(t, err)
+	require.Len(t, submitted, 2)
+	baseFee, feeBump = submittedBaseFee(t, submitted[1])
+	assert.False(t, feeBump)
+	assert.Equal(t, int64(200), baseFee)
+}
+
+func TestSubmitter_SubmitTx_noRetry(t *testing.T) {
+	feeAccount := keypair.MustRandom()
+	attempts := 0
+	s := Submitter{
+		SubmitTxer: submitTxerFunc(func(xdr string) error {
+			attempts++
+			return &ResultError{Codes: []string{"tx_fee_bump_inner_failed", "tx_bad_seq"}}
+		}),
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		BaseFee:           txnbuild.MinBaseFee,
+		FeeAccount:        feeAccount.FromAddress(),
+		FeeAccountSigners: []*keypair.Full{feeAccount},
+		RetryPolicy:       RetryPolicy{MaxAttempts: 3},
+	}
+
+	err := s.SubmitTx(newTestTx(t, 0))
+	assert.EqualError(t, err, "submitting fee bump tx: transaction failed (tx_fee_bump_inner_failed, tx_bad_seq)")
+	assert.Equal(t, 1, attempts)
+
+	var sErr *Error
+	require.True(t, errors.As(err, &sErr))
+	assert.Equal(t, ErrorKindBadSeq, sErr.Kind)
+	assert.Equal(t, []string{"tx_fee_bump_inner_failed", "tx_bad_seq"}, sErr.ResultCodes)
+	assert.Equal(t, ErrorKindBadSeq, Classify(err))
+}
+
+func TestSubmitter_SubmitTx_retryWithFeeEscalation(t *testing.T) {
+	feeAccount := keypair.MustRandom()
+	baseFees := []int64{}
+	s := Submitter{
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		BaseFee:           100,
+		MaxBaseFee:        300,
+		FeeAccount:        feeAccount.FromAddress(),
+		FeeAccountSigners: []*keypair.Full{feeAccount},
+		RetryPolicy:       RetryPolicy{MaxAttempts: 5},
+	}
+	s.SubmitTxer = submitTxerFunc(func(xdr string) error {
+		baseFee, _ := submittedBaseFee(t, xdr)
+		baseFees = append(baseFees, baseFee)
+		if len(baseFees) < 4 {
+			return &ResultError{Codes: []string{"tx_insufficient_fee"}}
+		}
+		return nil
+	})
+
+	err := s.SubmitTx(newTestTx(t, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{100, 200, 300, 300}, baseFees)
+}
+
+func TestSubmitter_SubmitTx_retryGivesUp(t *testing.T) {
+	feeAccount := keypair.MustRandom()
+	attempts := 0
+	s := Submitter{
+		SubmitTxer: submitTxerFunc(func(xdr string) error {
+			attempts++
+			return &ResultError{Codes: []string{"tx_insufficient_fee"}}
+		}),
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		BaseFee:           100,
+		FeeAccount:        feeAccount.FromAddress(),
+		FeeAccountSigners: []*keypair.Full{feeAccount},
+		RetryPolicy: RetryPolicy{
+			MaxAttempts: 3,
+			Retryable: func(kind ErrorKind) bool {
+				return kind == ErrorKindInsufficientFee
+			},
+		},
+	}
+
+	err := s.SubmitTx(newTestTx(t, 0))
+	assert.EqualError(t, err, "submitting fee bump tx: transaction failed (tx_insufficient_fee)")
+	assert.Equal(t, ErrorKindInsufficientFee, Classify(err))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 1, MaxBackoff: 5}
+	assert.EqualValues(t, 1, p.backoff(1))
+	assert.EqualValues(t, 2, p.backoff(2))
+	assert.EqualValues(t, 4, p.backoff(3))
+	assert.EqualValues(t, 5, p.backoff(4))
+	assert.EqualValues(t, 5, p.backoff(10))
+
+	p = RetryPolicy{Backoff: 1}
+	assert.EqualValues(t, 8, p.backoff(4))
+}
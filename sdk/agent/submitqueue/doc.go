@@ -0,0 +1,10 @@
+// Package submitqueue contains a persistent queue of transactions to submit to
+// the network, that wraps any agent Submitter.
+//
+// Transactions are recorded in a Store when they are queued, submitted
+// asynchronously with the results reported as events, and removed from the
+// Store once their submission completes. If the process stops before a
+// submission completes, the transaction is resubmitted when the queue is next
+// started with the same Store, unless a later declaration or close of the same
+// channel has superseded it.
+package submitqueue
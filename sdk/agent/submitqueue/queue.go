@@ -0,0 +1,512 @@
+package submitqueue
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/agent"
+	"github.com/stellar/starlight/sdk/agent/submit"
+	"github.com/stellar/starlight/sdk/txbuild"
+)
+
+const (
+	// defaultRetryInterval is the time to wait before resubmitting a
+	// transaction that failed for a temporary reason.
+	defaultRetryInterval = 5 * time.Second
+)
+
+// Intent is a transaction that has been queued for submission.
+type Intent struct {
+	Hash           string    `json:"hash"`
+	TransactionXDR string    `json:"transaction_xdr"`
+	QueuedAt       time.Time `json:"queued_at"`
+
+	// Type is the type of the channel's transaction, if it was queued with
+	// SubmitTypedTx, and is empty otherwise. Declarations and closes are
+	// superseded by later declarations and closes of the same channel.
+	Type           txbuild.TransactionType `json:"type,omitempty"`
+	SourceAccount  string                  `json:"source_account"`
+	SequenceNumber int64                   `json:"sequence_number"`
+
+	// MinTime, MinLedger, MinSequenceAge and MinSequenceLedgerGap are the
+	// earliest-valid preconditions of the transaction.
+	MinTime              time.Time     `json:"min_time,omitempty"`
+	MinLedger            uint32        `json:"min_ledger,omitempty"`
+	MinSequenceAge       time.Duration `json:"min_sequence_age,omitempty"`
+	MinSequenceLedgerGap uint32        `json:"min_sequence_ledger_gap,omitempty"`
+
+	// NotBefore is the earliest time the queue will submit the transaction.
+	// It is initially the min time of the transaction, and is deferred when a
+	// submission is retried. The min ledger, min sequence age and min
+	// sequence ledger gap preconditions are not estimated because the queue
+	// does not observe ledgers or when the sequence number was consumed, and
+	// a submission made before they pass fails temporarily and is retried.
+	NotBefore time.Time `json:"not_before"`
+
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// SubmittedEvent occurs when a queued transaction has been submitted
+// successfully.
+type SubmittedEvent struct {
+	Intent Intent
+}
+
+// FailedEvent occurs when a queued transaction failed to submit and will not
+// be retried.
+type FailedEvent struct {
+	Intent Intent
+	Err    error
+}
+
+// Config contains the information that can be supplied to configure the Queue
+// at construction.
+type Config struct {
+	Submitter         agent.Submitter
+	Store             Store
+	NetworkPassphrase string
+
+	// SequenceNumberCollector, if set, is used when the queue is started to
+	// get the sequence numbers of the source accounts of the transactions
+	// recovered from the Store, so that transactions whose sequence number
+	// has already been consumed are dropped instead of resubmitted.
+	SequenceNumberCollector agent.SequenceNumberCollector
+
+	// RetryInterval is the time to wait before resubmitting a transaction
+	// that failed for a temporary reason, and if not set defaults to five
+	// seconds.
+	RetryInterval time.Duration
+
+	// MaxAttempts is the maximum number of attempts to submit a transaction.
+	// If zero, transactions that fail for temporary reasons are retried until
+	// they succeed or fail for another reason.
+	MaxAttempts int
+
+	// Logger, if set, is used to log the queue's activity. A *slog.Logger can
+	// be used.
+	Logger agent.Logger
+
+	// LogWriter, if set and Logger is not set, is written the queue's logs as
+	// lines of key=value pairs.
+	//
+	// Deprecated: Use Logger.
+	LogWriter io.Writer
+
+	Events chan<- interface{}
+}
+
+// NewQueue constructs a new queue with the given config. The queue does not
+// submit transactions until it is started with Start.
+func NewQueue(c Config) *Queue {
+	q := &Queue{
+		submitter:               c.Submitter,
+		store:                   c.Store,
+		networkPassphrase:       c.NetworkPassphrase,
+		sequenceNumberCollector: c.SequenceNumberCollector,
+		retryInterval:           c.RetryInterval,
+		maxAttempts:             c.MaxAttempts,
+		logger:                  c.Logger,
+		events:                  c.Events,
+		inflight:                map[string]bool{},
+		wake:                    make(chan struct{}, 1),
+		stop:                    make(chan struct{}),
+		done:                    make(chan struct{}),
+	}
+	if q.retryInterval == 0 {
+		q.retryInterval = defaultRetryInterval
+	}
+	if q.logger == nil {
+		w := c.LogWriter
+		if w == nil {
+			w = io.Discard
+		}
+		q.logger = agent.NewTextLogger(w)
+	}
+	return q
+}
+
+var _ agent.Submitter = &Queue{}
+var _ agent.TypedSubmitter = &Queue{}
+
+// Queue is an agent Submitter that records transactions in a Store and
+// submits them asynchronously with another Submitter, in the order they were
+// queued, once their min time has passed. Transactions that fail for a
+// temporary reason, such as being submitted before their observation period
+// has passed, are retried. The outcome of each transaction is reported in a
+// SubmittedEvent or FailedEvent, and the transaction is removed from the
+// Store.
+//
+// Transactions that remain in the Store because the process stopped before
+// their submission completed are resubmitted when the queue is next started.
+// Declarations and closes that have been superseded by a later declaration
+// or close of the same channel are dropped instead, as are transactions
+// whose sequence number has been consumed if a SequenceNumberCollector is
+// configured.
+//
+// A transaction that was submitted successfully before the process stopped,
+// but was not yet removed from the Store, and that is not dropped, fails when
+// resubmitted with tx_bad_seq and is reported in a FailedEvent.
+//
+// All functions of the Queue are safe to call from multiple goroutines as they
+// use an internal mutex.
+type Queue struct {
+	submitter               agent.Submitter
+	store                   Store
+	networkPassphrase       string
+	sequenceNumberCollector agent.SequenceNumberCollector
+	retryInterval           time.Duration
+	maxAttempts             int
+
+	logger agent.Logger
+
+	events chan<- interface{}
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// mu is a lock for the mutable fields of this type. It should be locked
+	// when reading or writing any of the mutable fields. The mutable fields are
+	// listed below. If pushing to a chan, such as Events, it is unnecessary to
+	// lock.
+	mu       sync.Mutex
+	intents  []Intent
+	inflight map[string]bool
+	started  bool
+}
+
+// Start loads the intents recorded in the Store, and starts submitting them
+// and any transactions queued.
+func (q *Queue) Start() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started {
+		return fmt.Errorf("queue already started")
+	}
+	stored, err := q.store.Load()
+	if err != nil {
+		return fmt.Errorf("loading intents: %w", err)
+	}
+	if len(stored) > 0 {
+		q.logger.Info("loaded queued txs", "count", len(stored))
+	}
+	stored = q.dropConsumed(stored)
+	intents := stored
+	for _, i := range q.intents {
+		if q.index(intents, i.Hash) == -1 {
+			intents = append(intents, i)
+		}
+	}
+	q.intents = q.dropSuperseded(intents)
+	err = q.store.Save(q.intents)
+	if err != nil {
+		return fmt.Errorf("saving intents: %w", err)
+	}
+	q.started = true
+	go q.loop()
+	return nil
+}
+
+// Stop stops submitting transactions, waiting for any submission in progress
+// to complete. Transactions that have not been submitted remain in the Store.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	started := q.started
+	q.mu.Unlock()
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+	if started {
+		<-q.done
+	}
+}
+
+// SubmitTx records the transaction in the Store and queues it for
+// submission, returning once it is recorded. Errors submitting the
+// transaction are reported in a FailedEvent. If the transaction is already
+// queued it is not queued again.
+func (q *Queue) SubmitTx(tx *txnbuild.Transaction) error {
+	return q.SubmitTypedTx("", tx)
+}
+
+// SubmitTypedTx records the channel's transaction of the given type in the
+// Store and queues it for submission, as SubmitTx does. Queuing a
+// declaration or close drops the queued declarations and closes of the same
+// channel that it supersedes.
+func (q *Queue) SubmitTypedTx(txType txbuild.TransactionType, tx *txnbuild.Transaction) error {
+	hash, err := tx.HashHex(q.networkPassphrase)
+	if err != nil {
+		return fmt.Errorf("hashing tx: %w", err)
+	}
+	txXDR, err := tx.Base64()
+	if err != nil {
+		return fmt.Errorf("encoding tx as base64: %w", err)
+	}
+	intent := newIntent(txType, tx, time.Now())
+	intent.Hash = hash
+	intent.TransactionXDR = txXDR
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.index(q.intents, hash) != -1 {
+		return nil
+	}
+	intents := q.dropSuperseded(append(q.intents[:len(q.intents):len(q.intents)], intent))
+	err = q.store.Save(intents)
+	if err != nil {
+		return fmt.Errorf("saving intents: %w", err)
+	}
+	q.intents = intents
+	q.logger.Info("queued tx", "tx", hash, "type", txType)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the intents of the transactions that are queued and have not
+// been submitted.
+func (q *Queue) Pending() []Intent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Intent(nil), q.intents...)
+}
+
+// newIntent returns an intent for the transaction, without its hash and XDR,
+// recording its type, sequence number and earliest-valid preconditions.
+func newIntent(txType txbuild.TransactionType, tx *txnbuild.Transaction, queuedAt time.Time) Intent {
+	env := tx.ToXDR()
+	intent := Intent{
+		QueuedAt:       queuedAt,
+		Type:           txType,
+		SourceAccount:  tx.SourceAccount().AccountID,
+		SequenceNumber: tx.SequenceNumber(),
+		NotBefore:      earliestValid(tx, queuedAt),
+	}
+	if tb := env.TimeBounds(); tb != nil && tb.MinTime != 0 {
+		intent.MinTime = time.Unix(int64(tb.MinTime), 0).UTC()
+	}
+	if lb := env.LedgerBounds(); lb != nil {
+		intent.MinLedger = uint32(lb.MinLedger)
+	}
+	if age := env.MinSeqAge(); age != nil {
+		intent.MinSequenceAge = time.Duration(*age) * time.Second
+	}
+	if gap := env.MinSeqLedgerGap(); gap != nil {
+		intent.MinSequenceLedgerGap = uint32(*gap)
+	}
+	return intent
+}
+
+// earliestValid returns the earliest time the transaction is valid given its
+// min time, or the time it was queued if later.
+func earliestValid(tx *txnbuild.Transaction, queuedAt time.Time) time.Time {
+	t := queuedAt
+	if tb := tx.ToXDR().TimeBounds(); tb != nil && tb.MinTime != 0 {
+		minTime := time.Unix(int64(tb.MinTime), 0)
+		if minTime.After(t) {
+			t = minTime
+		}
+	}
+	return t
+}
+
+// dropSuperseded returns the intents without the declarations and closes
+// that are superseded by a later declaration or close of the same channel
+// account. A declaration supersedes the declarations and closes with lower
+// sequence numbers, and a close supersedes those before its own declaration,
+// which it depends on. Intents in flight are kept.
+//
+// Must be called with the mutex locked.
+func (q *Queue) dropSuperseded(intents []Intent) []Intent {
+	latest := map[string]int64{}
+	for _, i := range intents {
+		var seq int64
+		switch i.Type {
+		case txbuild.TransactionTypeDeclaration:
+			seq = i.SequenceNumber
+		case txbuild.TransactionTypeClose:
+			seq = i.SequenceNumber - 1
+		default:
+			continue
+		}
+		if seq > latest[i.SourceAccount] {
+			latest[i.SourceAccount] = seq
+		}
+	}
+	kept := make([]Intent, 0, len(intents))
+	for _, i := range intents {
+		superseded := (i.Type == txbuild.TransactionTypeDeclaration || i.Type == txbuild.TransactionTypeClose) &&
+			i.SequenceNumber < latest[i.SourceAccount]
+		if superseded && !q.inflight[i.Hash] {
+			q.logger.Info("dropped superseded queued tx", "tx", i.Hash, "type", i.Type)
+			continue
+		}
+		kept = append(kept, i)
+	}
+	return kept
+}
+
+// dropConsumed returns the intents without those whose sequence number has
+// been consumed by their source account, and so can no longer be submitted.
+// If the queue has no SequenceNumberCollector, or the sequence number of an
+// account cannot be collected, the intents are kept.
+//
+// Must be called with the mutex locked.
+func (q *Queue) dropConsumed(intents []Intent) []Intent {
+	if q.sequenceNumberCollector == nil {
+		return intents
+	}
+	seqs := map[string]int64{}
+	kept := make([]Intent, 0, len(intents))
+	for _, i := range intents {
+		seq, ok := seqs[i.SourceAccount]
+		if !ok && i.SourceAccount != "" {
+			account, err := keypair.ParseAddress(i.SourceAccount)
+			if err == nil {
+				seq, err = q.sequenceNumberCollector.GetSequenceNumber(account)
+			}
+			if err != nil {
+				q.logger.Warn("error getting sequence number of queued tx source", "account", i.SourceAccount, "error", err)
+				seq = 0
+			}
+			seqs[i.SourceAccount] = seq
+		}
+		if seq != 0 && i.SequenceNumber <= seq {
+			q.logger.Info("dropped consumed queued tx", "tx", i.Hash, "type", i.Type, "sequence_number", i.SequenceNumber)
+			continue
+		}
+		kept = append(kept, i)
+	}
+	return kept
+}
+
+func (q *Queue) loop() {
+	defer close(q.done)
+	defer q.logger.Debug("submit queue stopped")
+	q.logger.Debug("submit queue started")
+	for {
+		intent, wait, ok := q.next(time.Now())
+		if ok {
+			err := q.submitTx(intent)
+			q.complete(intent, err)
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+			continue
+		}
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timerC = timer.C
+		}
+		select {
+		case <-q.stop:
+		case <-q.wake:
+		case <-timerC:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+	}
+}
+
+// next returns the first intent that is due to be submitted at the given
+// time and marks it in flight, or if none are due the time to wait until the
+// next intent is due. If there are no intents the wait is zero.
+func (q *Queue) next(now time.Time) (intent Intent, wait time.Duration, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, i := range q.intents {
+		if q.inflight[i.Hash] {
+			continue
+		}
+		if !i.NotBefore.After(now) {
+			q.inflight[i.Hash] = true
+			return i, 0, true
+		}
+		if w := i.NotBefore.Sub(now); wait == 0 || w < wait {
+			wait = w
+		}
+	}
+	return Intent{}, wait, false
+}
+
+func (q *Queue) submitTx(intent Intent) error {
+	genericTx, err := txnbuild.TransactionFromXDR(intent.TransactionXDR)
+	if err != nil {
+		return fmt.Errorf("decoding tx: %w", err)
+	}
+	tx, ok := genericTx.Transaction()
+	if !ok {
+		return fmt.Errorf("decoding tx: not a transaction")
+	}
+	q.logger.Info("submitting queued tx", "tx", intent.Hash, "type", intent.Type, "attempt", intent.Attempts+1)
+	return q.submitter.SubmitTx(tx)
+}
+
+// complete records the result of submitting the intent's transaction, and
+// removes the intent from the queue unless the submission failed for a
+// temporary reason and can be retried.
+func (q *Queue) complete(intent Intent, err error) {
+	var event interface{}
+	func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		delete(q.inflight, intent.Hash)
+		i := q.index(q.intents, intent.Hash)
+		if i == -1 {
+			return
+		}
+		intent = q.intents[i]
+		intent.Attempts++
+		if err == nil {
+			q.logger.Info("submitted queued tx", "tx", intent.Hash)
+			q.intents = append(q.intents[:i:i], q.intents[i+1:]...)
+			event = SubmittedEvent{Intent: intent}
+		} else if kind := submit.Classify(err); kind.Temporary() && (q.maxAttempts == 0 || intent.Attempts < q.maxAttempts) {
+			q.logger.Warn("queued tx failed temporarily", "tx", intent.Hash, "kind", kind, "retry_in", q.retryInterval)
+			intent.LastError = err.Error()
+			intent.NotBefore = time.Now().Add(q.retryInterval)
+			q.intents[i] = intent
+		} else {
+			q.logger.Error("queued tx failed", "tx", intent.Hash, "error", err)
+			intent.LastError = err.Error()
+			q.intents = append(q.intents[:i:i], q.intents[i+1:]...)
+			event = FailedEvent{Intent: intent, Err: fmt.Errorf("submitting queued tx %s: %w", intent.Hash, err)}
+		}
+		saveErr := q.store.Save(q.intents)
+		if saveErr != nil {
+			q.logger.Error("error saving intents", "error", saveErr)
+		}
+	}()
+
+	if event != nil && q.events != nil {
+		q.events <- event
+	}
+}
+
+// index returns the index of the intent with the hash, or -1 if not found.
+func (q *Queue) index(intents []Intent, hash string) int {
+	for i, intent := range intents {
+		if intent.Hash == hash {
+			return i
+		}
+	}
+	return -1
+}
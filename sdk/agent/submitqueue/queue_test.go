@@ -0,0 +1,404 @@
+package submitqueue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/starlight/sdk/txbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sequenceNumberCollectorFunc func(account *keypair.FromAddress) (int64, error)
+
+func (f sequenceNumberCollectorFunc) GetSequenceNumber(account *keypair.FromAddress) (int64, error) {
+	return f(account)
+}
+
+type submitterFunc func(tx *txnbuild.Transaction) error
+
+func (f submitterFunc) SubmitTx(tx *txnbuild.Transaction) error {
+	return f(tx)
+}
+
+func newTestTx(t *testing.T, preconditions txnbuild.Preconditions) *txnbuild.Transaction {
+	t.Helper()
+	return newTestChannelTx(t, keypair.MustRandom().FromAddress(), 2, preconditions)
+}
+
+// newTestChannelTx returns a tx of the account with the sequence number.
+func newTestChannelTx(t *testing.T, account *keypair.FromAddress, seqNum int64, preconditions txnbuild.Preconditions) *txnbuild.Transaction {
+	t.Helper()
+	if preconditions.TimeBounds == (txnbuild.TimeBounds{}) {
+		preconditions.TimeBounds = txnbuild.NewInfiniteTimeout()
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{
+			AccountID: account.Address(),
+			Sequence:  seqNum,
+		},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: preconditions,
+		Operations:    []txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: 2}},
+	})
+	require.NoError(t, err)
+	return tx
+}
+
+func hashHex(t *testing.T, tx *txnbuild.Transaction) string {
+	t.Helper()
+	hash, err := tx.HashHex(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	return hash
+}
+
+// newTestIntent returns an intent for the tx as it would be recorded by a queue
+// that stopped before its submission completed.
+func newTestIntent(t *testing.T, tx *txnbuild.Transaction) Intent {
+	t.Helper()
+	return newTestTypedIntent(t, "", tx)
+}
+
+func newTestTypedIntent(t *testing.T, txType txbuild.TransactionType, tx *txnbuild.Transaction) Intent {
+	t.Helper()
+	txXDR, err := tx.Base64()
+	require.NoError(t, err)
+	intent := newIntent(txType, tx, time.Now())
+	intent.Hash = hashHex(t, tx)
+	intent.TransactionXDR = txXDR
+	return intent
+}
+
+func TestQueue_submitTx(t *testing.T) {
+	store := &MemoryStore{}
+	events := make(chan interface{}, 10)
+	var storedDuringSubmit []Intent
+	submitting := make(chan struct{})
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			<-submitting
+			var err error
+			storedDuringSubmit, err = store.Load()
+			require.NoError(t, err)
+			return nil
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Events:            events,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	// SubmitTx returns once the tx is recorded, without waiting for it to be
+	// submitted.
+	tx := newTestTx(t, txnbuild.Preconditions{})
+	require.NoError(t, q.SubmitTx(tx))
+	require.Len(t, q.Pending(), 1)
+	close(submitting)
+
+	// The tx is recorded while it is submitted, and removed once submitted.
+	e := (<-events).(SubmittedEvent)
+	require.Len(t, storedDuringSubmit, 1)
+	assert.Equal(t, hashHex(t, tx), storedDuringSubmit[0].Hash)
+	assert.Equal(t, hashHex(t, tx), e.Intent.Hash)
+	assert.Equal(t, 1, e.Intent.Attempts)
+	assert.Empty(t, q.Pending())
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+func TestQueue_submitTxRetries(t *testing.T) {
+	attempts := 0
+	events := make(chan interface{}, 10)
+	store := &MemoryStore{}
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("horizon error: \"Transaction Failed\" (tx_bad_minseq_age_or_gap)")
+			}
+			return errors.New("horizon error: \"Transaction Failed\" (tx_bad_seq)")
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		RetryInterval:     time.Millisecond,
+		Events:            events,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	// Temporary failures are retried by the queue, and other failures are
+	// reported in an event instead of returned.
+	tx := newTestTx(t, txnbuild.Preconditions{})
+	require.NoError(t, q.SubmitTx(tx))
+	e := (<-events).(FailedEvent)
+	assert.Equal(t, hashHex(t, tx), e.Intent.Hash)
+	assert.Equal(t, 3, e.Intent.Attempts)
+	assert.EqualError(t, e.Err, "submitting queued tx "+hashHex(t, tx)+": horizon error: \"Transaction Failed\" (tx_bad_seq)")
+	assert.Empty(t, q.Pending())
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+func TestQueue_submitTypedTxRecordsTypeAndPreconditions(t *testing.T) {
+	store := &MemoryStore{}
+	q := NewQueue(Config{
+		Submitter:         submitterFunc(func(tx *txnbuild.Transaction) error { return nil }),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+	})
+
+	// The queue is not started so that the tx remains recorded.
+	account := keypair.MustRandom().FromAddress()
+	minTime := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	tx := newTestChannelTx(t, account, 104, txnbuild.Preconditions{
+		TimeBounds:                 txnbuild.NewTimebounds(minTime.Unix(), 0),
+		LedgerBounds:               &txnbuild.LedgerBounds{MinLedger: 7},
+		MinSequenceNumberAge:       10,
+		MinSequenceNumberLedgerGap: 3,
+	})
+	require.NoError(t, q.SubmitTypedTx(txbuild.TransactionTypeClose, tx))
+
+	stored, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	i := stored[0]
+	assert.Equal(t, hashHex(t, tx), i.Hash)
+	assert.Equal(t, txbuild.TransactionTypeClose, i.Type)
+	assert.Equal(t, account.Address(), i.SourceAccount)
+	assert.Equal(t, int64(104), i.SequenceNumber)
+	assert.Equal(t, minTime, i.MinTime)
+	assert.Equal(t, uint32(7), i.MinLedger)
+	assert.Equal(t, 10*time.Second, i.MinSequenceAge)
+	assert.Equal(t, uint32(3), i.MinSequenceLedgerGap)
+}
+
+func TestQueue_submitTypedTxDropsSuperseded(t *testing.T) {
+	store := &MemoryStore{}
+	q := NewQueue(Config{
+		Submitter:         submitterFunc(func(tx *txnbuild.Transaction) error { return nil }),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+	})
+
+	account := keypair.MustRandom().FromAddress()
+	other := keypair.MustRandom().FromAddress()
+	open := newTestChannelTx(t, account, 101, txnbuild.Preconditions{})
+	decl1 := newTestChannelTx(t, account, 103, txnbuild.Preconditions{})
+	close1 := newTestChannelTx(t, account, 104, txnbuild.Preconditions{})
+	otherDecl1 := newTestChannelTx(t, other, 103, txnbuild.Preconditions{})
+	decl2 := newTestChannelTx(t, account, 105, txnbuild.Preconditions{})
+	require.NoError(t, q.SubmitTypedTx(txbuild.TransactionTypeOpen, open))
+	require.NoError(t, q.SubmitTypedTx(txbuild.TransactionTypeDeclaration, decl1))
+	require.NoError(t, q.SubmitTypedTx(txbuild.TransactionTypeClose, close1))
+	require.NoError(t, q.SubmitTypedTx(txbuild.TransactionTypeDeclaration, otherDecl1))
+
+	// A close does not supersede its own declaration.
+	require.Len(t, q.Pending(), 4)
+
+	// A later declaration supersedes the earlier declaration and close of the
+	// same channel.
+	require.NoError(t, q.SubmitTypedTx(txbuild.TransactionTypeDeclaration, decl2))
+	pending := q.Pending()
+	require.Len(t, pending, 3)
+	assert.Equal(t, hashHex(t, open), pending[0].Hash)
+	assert.Equal(t, hashHex(t, otherDecl1), pending[1].Hash)
+	assert.Equal(t, hashHex(t, decl2), pending[2].Hash)
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, pending, stored)
+}
+
+func TestQueue_restart(t *testing.T) {
+	store := FileStore{Path: filepath.Join(t.TempDir(), "queue.json")}
+
+	// The txs were recorded by a queue that stopped before their submissions
+	// completed.
+	tx1 := newTestTx(t, txnbuild.Preconditions{})
+	tx2 := newTestTx(t, txnbuild.Preconditions{})
+	require.NoError(t, store.Save([]Intent{newTestIntent(t, tx1), newTestIntent(t, tx2)}))
+
+	// The queue resubmits the recorded txs in order when started.
+	submitted := make(chan string, 2)
+	events := make(chan interface{}, 10)
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			submitted <- hashHex(t, tx)
+			return nil
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Events:            events,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	assert.Equal(t, hashHex(t, tx1), <-submitted)
+	assert.Equal(t, hashHex(t, tx2), <-submitted)
+	e := (<-events).(SubmittedEvent)
+	assert.Equal(t, hashHex(t, tx1), e.Intent.Hash)
+	e = (<-events).(SubmittedEvent)
+	assert.Equal(t, hashHex(t, tx2), e.Intent.Hash)
+	assert.Empty(t, q.Pending())
+	stored, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+}
+
+func TestQueue_restartDropsSupersededAndConsumed(t *testing.T) {
+	store := &MemoryStore{}
+
+	// The txs were recorded by a queue that stopped before their submissions
+	// completed. The first channel's later declaration and close supersede its
+	// earlier ones, and the second channel's declaration was already consumed.
+	account := keypair.MustRandom().FromAddress()
+	other := keypair.MustRandom().FromAddress()
+	decl1 := newTestChannelTx(t, account, 103, txnbuild.Preconditions{})
+	close1 := newTestChannelTx(t, account, 104, txnbuild.Preconditions{})
+	decl2 := newTestChannelTx(t, account, 105, txnbuild.Preconditions{})
+	close2 := newTestChannelTx(t, account, 106, txnbuild.Preconditions{})
+	otherDecl1 := newTestChannelTx(t, other, 103, txnbuild.Preconditions{})
+	require.NoError(t, store.Save([]Intent{
+		newTestTypedIntent(t, txbuild.TransactionTypeDeclaration, decl1),
+		newTestTypedIntent(t, txbuild.TransactionTypeClose, close1),
+		newTestTypedIntent(t, txbuild.TransactionTypeDeclaration, decl2),
+		newTestTypedIntent(t, txbuild.TransactionTypeClose, close2),
+		newTestTypedIntent(t, txbuild.TransactionTypeDeclaration, otherDecl1),
+	}))
+
+	submitted := make(chan string, 5)
+	events := make(chan interface{}, 10)
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			submitted <- hashHex(t, tx)
+			return nil
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		SequenceNumberCollector: sequenceNumberCollectorFunc(func(a *keypair.FromAddress) (int64, error) {
+			if a.Equal(other) {
+				return 103, nil
+			}
+			return 102, nil
+		}),
+		Events: events,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	// Only the latest declaration and close are resubmitted.
+	assert.Equal(t, hashHex(t, decl2), <-submitted)
+	assert.Equal(t, hashHex(t, close2), <-submitted)
+	<-events
+	<-events
+	assert.Empty(t, submitted)
+	assert.Empty(t, q.Pending())
+}
+
+func TestQueue_restartRetries(t *testing.T) {
+	store := &MemoryStore{}
+	tx := newTestTx(t, txnbuild.Preconditions{})
+	require.NoError(t, store.Save([]Intent{newTestIntent(t, tx)}))
+
+	attempts := 0
+	events := make(chan interface{}, 10)
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("horizon error: \"Transaction Failed\" (tx_bad_minseq_age_or_gap)")
+			}
+			return errors.New("horizon error: \"Transaction Failed\" (tx_bad_seq)")
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		RetryInterval:     time.Millisecond,
+		Events:            events,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	e := (<-events).(FailedEvent)
+	assert.Equal(t, hashHex(t, tx), e.Intent.Hash)
+	assert.Equal(t, 3, e.Intent.Attempts)
+	assert.Equal(t, "horizon error: \"Transaction Failed\" (tx_bad_seq)", e.Intent.LastError)
+	assert.EqualError(t, e.Err, "submitting queued tx "+hashHex(t, tx)+": horizon error: \"Transaction Failed\" (tx_bad_seq)")
+	assert.Empty(t, q.Pending())
+}
+
+func TestQueue_restartMaxAttempts(t *testing.T) {
+	store := &MemoryStore{}
+	require.NoError(t, store.Save([]Intent{newTestIntent(t, newTestTx(t, txnbuild.Preconditions{}))}))
+
+	attempts := 0
+	events := make(chan interface{}, 10)
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			attempts++
+			return errors.New("horizon error: \"Transaction Failed\" (tx_insufficient_fee)")
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		RetryInterval:     time.Millisecond,
+		MaxAttempts:       2,
+		Events:            events,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	e := (<-events).(FailedEvent)
+	assert.Equal(t, 2, e.Intent.Attempts)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestQueue_restartWaitsForMinTime(t *testing.T) {
+	start := time.Now()
+	store := &MemoryStore{}
+	tx := newTestTx(t, txnbuild.Preconditions{
+		TimeBounds: txnbuild.NewTimebounds(start.Add(2*time.Second).Unix(), 0),
+	})
+	require.NoError(t, store.Save([]Intent{newTestIntent(t, tx)}))
+
+	submitted := make(chan time.Time, 1)
+	q := NewQueue(Config{
+		Submitter: submitterFunc(func(tx *txnbuild.Transaction) error {
+			submitted <- time.Now()
+			return nil
+		}),
+		Store:             store,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+	})
+	defer q.Stop()
+	require.NoError(t, q.Start())
+
+	submittedAt := <-submitted
+	assert.GreaterOrEqual(t, submittedAt.Sub(start), time.Second)
+}
+
+func TestEarliestValid(t *testing.T) {
+	queuedAt := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tx := newTestTx(t, txnbuild.Preconditions{})
+	assert.Equal(t, queuedAt, earliestValid(tx, queuedAt))
+
+	tx = newTestTx(t, txnbuild.Preconditions{
+		TimeBounds: txnbuild.NewTimebounds(queuedAt.Add(time.Minute).Unix(), 0),
+	})
+	assert.Equal(t, queuedAt.Add(time.Minute), earliestValid(tx, queuedAt).UTC())
+
+	// The min sequence age and ledger gap are not estimated from the time the
+	// tx is queued, because the sequence number may have been consumed long
+	// before.
+	tx = newTestTx(t, txnbuild.Preconditions{
+		MinSequenceNumberAge:       10,
+		MinSequenceNumberLedgerGap: 3,
+	})
+	assert.Equal(t, queuedAt, earliestValid(tx, queuedAt))
+}
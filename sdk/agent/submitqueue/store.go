@@ -0,0 +1,98 @@
+package submitqueue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store stores the intents of a Queue so that they survive a restart.
+type Store interface {
+	// Load returns the stored intents.
+	Load() ([]Intent, error)
+
+	// Save replaces the stored intents.
+	Save(intents []Intent) error
+}
+
+var _ Store = FileStore{}
+
+// FileStore is a Store that stores intents as JSON in a file. Saves are
+// atomic, by writing to a temporary file in the same directory that is then
+// renamed to the file.
+type FileStore struct {
+	Path string
+}
+
+// Load returns the intents stored in the file, or no intents if the file does
+// not exist.
+func (s FileStore) Load() ([]Intent, error) {
+	b, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", s.Path, err)
+	}
+	intents := []Intent{}
+	err = json.Unmarshal(b, &intents)
+	if err != nil {
+		return nil, fmt.Errorf("json decoding file %s: %w", s.Path, err)
+	}
+	return intents, nil
+}
+
+// Save writes the intents to the file.
+func (s FileStore) Save(intents []Intent) error {
+	b, err := json.MarshalIndent(intents, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json encoding intents: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temp file for %s: %w", s.Path, err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing temp file for %s: %w", s.Path, err)
+	}
+	err = os.Rename(f.Name(), s.Path)
+	if err != nil {
+		return fmt.Errorf("renaming temp file to %s: %w", s.Path, err)
+	}
+	return nil
+}
+
+var _ Store = &MemoryStore{}
+
+// MemoryStore is a Store that stores intents in memory. It is useful for
+// tests, and for using a Queue for asynchronous submission without
+// persistence.
+type MemoryStore struct {
+	mu      sync.Mutex
+	intents []Intent
+}
+
+// Load returns the stored intents.
+func (s *MemoryStore) Load() ([]Intent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Intent(nil), s.intents...), nil
+}
+
+// Save replaces the stored intents.
+func (s *MemoryStore) Save(intents []Intent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intents = append([]Intent(nil), intents...)
+	return nil
+}
@@ -0,0 +1,44 @@
+package submitqueue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s := FileStore{Path: filepath.Join(dir, "queue.json")}
+
+	intents, err := s.Load()
+	require.NoError(t, err)
+	assert.Empty(t, intents)
+
+	now := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	want := []Intent{
+		{Hash: "a", TransactionXDR: "AAAA", QueuedAt: now, NotBefore: now.Add(time.Minute), Attempts: 1, LastError: "timeout"},
+		{Hash: "b", TransactionXDR: "BBBB", QueuedAt: now, NotBefore: now},
+	}
+	require.NoError(t, s.Save(want))
+	intents, err = s.Load()
+	require.NoError(t, err)
+	assert.Equal(t, want, intents)
+
+	require.NoError(t, s.Save(nil))
+	intents, err = s.Load()
+	require.NoError(t, err)
+	assert.Empty(t, intents)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, os.WriteFile(s.Path, []byte("{"), 0o644))
+	_, err = s.Load()
+	assert.EqualError(t, err, "json decoding file "+s.Path+": unexpected end of JSON input")
+}
@@ -19,7 +19,7 @@ func (a *Agent) ServeTCP(addr string) error {
 	if err != nil {
 		return fmt.Errorf("accepting incoming connection: %w", err)
 	}
-	fmt.Fprintf(a.logWriter, "accepted connection from %v\n", conn.RemoteAddr())
+	a.logWithLock().Info("accepted connection", "remote_addr", conn.RemoteAddr().String())
 	a.conn = conn
 	err = a.hello()
 	if err != nil {
@@ -40,7 +40,7 @@ func (a *Agent) ConnectTCP(addr string) error {
 	if err != nil {
 		return fmt.Errorf("connecting to %s: %w", addr, err)
 	}
-	fmt.Fprintf(a.logWriter, "connected to %v\n", conn.RemoteAddr())
+	a.logWithLock().Info("connected to remote", "remote_addr", conn.RemoteAddr().String())
 	a.conn = conn
 	err = a.hello()
 	if err != nil {
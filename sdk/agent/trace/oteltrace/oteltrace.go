@@ -0,0 +1,114 @@
+// Package oteltrace contains a trace.Tracer that exports the spans of agents
+// to OpenTelemetry.
+//
+// The package is a separate module from the sdk so that only applications
+// that export to OpenTelemetry depend on it.
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stellar/starlight/sdk/agent/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is a trace.Tracer that starts spans with an OpenTelemetry tracer.
+//
+// The agent passes parents to the Tracer as span contexts and not as Go
+// contexts, and so parents are given to OpenTelemetry as remote span contexts.
+type Tracer struct {
+	tracer oteltrace.Tracer
+}
+
+var _ trace.Tracer = &Tracer{}
+
+// NewTracer creates a Tracer that starts spans with the OpenTelemetry tracer.
+func NewTracer(t oteltrace.Tracer) *Tracer {
+	return &Tracer{tracer: t}
+}
+
+// Start implements trace.Tracer.
+func (t *Tracer) Start(name string, parent trace.SpanContext) trace.Span {
+	ctx := context.Background()
+	if parent.IsValid() {
+		ctx = oteltrace.ContextWithRemoteSpanContext(ctx, toOTel(parent))
+	}
+	_, span := t.tracer.Start(ctx, name)
+	return otelSpan{span: span}
+}
+
+func toOTel(sc trace.SpanContext) oteltrace.SpanContext {
+	flags := oteltrace.TraceFlags(0)
+	if sc.Sampled {
+		flags = oteltrace.FlagsSampled
+	}
+	return oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID(sc.TraceID),
+		SpanID:     oteltrace.SpanID(sc.SpanID),
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
+
+func fromOTel(sc oteltrace.SpanContext) trace.SpanContext {
+	if !sc.IsValid() {
+		return trace.SpanContext{}
+	}
+	return trace.SpanContext{
+		TraceID: trace.TraceID(sc.TraceID()),
+		SpanID:  trace.SpanID(sc.SpanID()),
+		Sampled: sc.IsSampled(),
+	}
+}
+
+type otelSpan struct {
+	span oteltrace.Span
+}
+
+func (s otelSpan) SpanContext() trace.SpanContext {
+	return fromOTel(s.span.SpanContext())
+}
+
+func (s otelSpan) SetAttributes(args ...interface{}) {
+	attrs := make([]attribute.KeyValue, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs = append(attrs, toAttribute(fmt.Sprint(args[i]), args[i+1]))
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
+
+// toAttribute converts a value to an attribute, keeping the type of values of
+// the types OpenTelemetry supports, and formatting values of other types as
+// strings.
+func toAttribute(k string, v interface{}) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(k, v)
+	case bool:
+		return attribute.Bool(k, v)
+	case int:
+		return attribute.Int(k, v)
+	case int64:
+		return attribute.Int64(k, v)
+	case int32:
+		return attribute.Int64(k, int64(v))
+	case uint32:
+		return attribute.Int64(k, int64(v))
+	case float64:
+		return attribute.Float64(k, v)
+	default:
+		return attribute.String(k, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,68 @@
+package oteltrace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stellar/starlight/sdk/agent/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider.Tracer("test"))
+
+	root := tracer.Start("payment", trace.SpanContext{})
+	require.True(t, root.SpanContext().IsValid())
+	assert.True(t, root.SpanContext().Sampled)
+	root.SetAttributes("amount", int64(10), "memo", "abc", "iteration", uint32(3), "state", trace.TraceID{})
+
+	child := tracer.Start("payment.finalize", root.SpanContext())
+	assert.Equal(t, root.SpanContext().TraceID, child.SpanContext().TraceID)
+	child.RecordError(errors.New("failed"))
+	child.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "payment.finalize", spans[0].Name())
+	assert.Equal(t, trace.SpanID(spans[1].SpanContext().SpanID()), trace.SpanID(spans[0].Parent().SpanID()))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "failed", spans[0].Status().Description)
+	require.Len(t, spans[0].Events(), 1)
+
+	assert.Equal(t, "payment", spans[1].Name())
+	assert.False(t, spans[1].Parent().IsValid())
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.Int64("amount", 10),
+		attribute.String("memo", "abc"),
+		attribute.Int64("iteration", 3),
+		attribute.String("state", trace.TraceID{}.String()),
+	}, spans[1].Attributes())
+}
+
+func TestTracer_remoteParent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider.Tracer("test"))
+
+	parent, err := trace.ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	require.NoError(t, err)
+
+	span := tracer.Start("payment.confirm", parent)
+	assert.Equal(t, parent.TraceID, span.SpanContext().TraceID)
+	assert.NotEqual(t, parent.SpanID, span.SpanContext().SpanID)
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.True(t, spans[0].Parent().IsRemote())
+	assert.Equal(t, parent.SpanID, trace.SpanID(spans[0].Parent().SpanID()))
+}
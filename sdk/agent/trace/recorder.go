@@ -0,0 +1,123 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is a span that has ended, as recorded by a Recorder.
+type RecordedSpan struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+	Errors      []error
+}
+
+// Duration returns the time from the start to the end of the span.
+func (s RecordedSpan) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Recorder is a Tracer that records spans in memory when they end, for use in
+// tests and for inspecting traces without a tracing system. All spans are
+// sampled.
+//
+// All functions of the Recorder are safe to call from multiple goroutines.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+var _ Tracer = &Recorder{}
+
+// NewRecorder creates a Recorder with no recorded spans.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start implements Tracer.
+func (r *Recorder) Start(name string, parent SpanContext) Span {
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: NewSpanID(), Sampled: true}
+	if !parent.IsValid() {
+		sc.TraceID = NewTraceID()
+	}
+	return &recorderSpan{
+		recorder: r,
+		span: RecordedSpan{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  map[string]interface{}{},
+		},
+	}
+}
+
+// Spans returns the spans that have ended, in the order they ended.
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// SpansNamed returns the spans that have ended with the name, in the order
+// they ended.
+func (r *Recorder) SpansNamed(name string) []RecordedSpan {
+	var spans []RecordedSpan
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+type recorderSpan struct {
+	recorder *Recorder
+
+	mu    sync.Mutex
+	span  RecordedSpan
+	ended bool
+}
+
+func (s *recorderSpan) SpanContext() SpanContext {
+	return s.span.SpanContext
+}
+
+func (s *recorderSpan) SetAttributes(args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		s.span.Attributes[fmt.Sprint(args[i])] = args[i+1]
+	}
+}
+
+func (s *recorderSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.span.Errors = append(s.span.Errors, err)
+}
+
+func (s *recorderSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.span.End = time.Now()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.spans = append(s.recorder.spans, s.span)
+}
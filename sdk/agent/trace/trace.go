@@ -0,0 +1,151 @@
+// Package trace contains types for tracing the activity of agents, such as the
+// lifecycle of a payment across both participants, with spans that can be
+// exported to a tracing system.
+//
+// Span contexts are propagated between participants in the W3C Trace Context
+// traceparent format, so that a Tracer can be implemented by adapting a
+// tracing system. The oteltrace package, in its own module so that the sdk
+// does not depend on OpenTelemetry, contains a Tracer that exports spans to
+// OpenTelemetry, and the Recorder records spans in memory.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() TraceID {
+	t := TraceID{}
+	_, _ = rand.Read(t[:])
+	return t
+}
+
+// NewSpanID returns a random span ID.
+func NewSpanID() SpanID {
+	s := SpanID{}
+	_, _ = rand.Read(s[:])
+	return s
+}
+
+// SpanContext identifies a span and the trace it is part of. The zero value
+// identifies no span, and is used as the parent of spans that start a trace.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid returns true if the span context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// TraceParent returns the span context in the W3C Trace Context traceparent
+// format, or an empty string if the span context is not valid.
+func (sc SpanContext) TraceParent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceParent parses a span context in the W3C Trace Context traceparent
+// format. An empty string is parsed as the zero value.
+func ParseTraceParent(s string) (SpanContext, error) {
+	if s == "" {
+		return SpanContext{}, nil
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, fmt.Errorf("traceparent %q invalid", s)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("traceparent %q invalid", s)
+	}
+	sc := SpanContext{}
+	if err := decodeHex(parts[1], sc.TraceID[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("traceparent %q trace id: %w", s, err)
+	}
+	if err := decodeHex(parts[2], sc.SpanID[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("traceparent %q span id: %w", s, err)
+	}
+	flags := [1]byte{}
+	if err := decodeHex(parts[3], flags[:]); err != nil {
+		return SpanContext{}, fmt.Errorf("traceparent %q flags: %w", s, err)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("traceparent %q has zero id", s)
+	}
+	return sc, nil
+}
+
+func decodeHex(s string, b []byte) error {
+	if len(s) != hex.EncodedLen(len(b)) {
+		return fmt.Errorf("length %d, expected %d", len(s), hex.EncodedLen(len(b)))
+	}
+	if strings.ToLower(s) != s {
+		return fmt.Errorf("not lowercase hex")
+	}
+	_, err := hex.Decode(b, []byte(s))
+	return err
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span with the name. The span is a child of the parent if
+	// the parent is valid, otherwise the span starts a new trace.
+	Start(name string, parent SpanContext) Span
+}
+
+// Span is an operation being traced. End must be called when the operation
+// completes.
+type Span interface {
+	SpanContext() SpanContext
+
+	// SetAttributes sets attributes of the span given as alternating keys and
+	// values, such as "iteration", 3.
+	SetAttributes(args ...interface{})
+
+	// RecordError records that the operation failed with the error.
+	RecordError(err error)
+
+	End()
+}
+
+// Start starts a span with the tracer, or if the tracer is nil returns a span
+// that records nothing.
+func Start(t Tracer, name string, parent SpanContext) Span {
+	if t == nil {
+		return noopSpan{}
+	}
+	return t.Start(name, parent)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext          { return SpanContext{} }
+func (noopSpan) SetAttributes(args ...interface{}) {}
+func (noopSpan) RecordError(err error)             {}
+func (noopSpan) End()                              {}
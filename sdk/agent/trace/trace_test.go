@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanContext_traceParentRoundTrip(t *testing.T) {
+	sc := SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Sampled: true}
+	s := sc.TraceParent()
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, s)
+
+	parsed, err := ParseTraceParent(s)
+	require.NoError(t, err)
+	assert.Equal(t, sc, parsed)
+
+	sc.Sampled = false
+	parsed, err = ParseTraceParent(sc.TraceParent())
+	require.NoError(t, err)
+	assert.Equal(t, sc, parsed)
+}
+
+func TestSpanContext_traceParentZero(t *testing.T) {
+	assert.Equal(t, "", SpanContext{}.TraceParent())
+
+	parsed, err := ParseTraceParent("")
+	require.NoError(t, err)
+	assert.Equal(t, SpanContext{}, parsed)
+}
+
+func TestParseTraceParent_invalid(t *testing.T) {
+	testCases := []string{
+		"00",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	}
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			_, err := ParseTraceParent(tc)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseTraceParent_futureVersion(t *testing.T) {
+	sc, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+}
+
+func TestStart_nilTracer(t *testing.T) {
+	span := Start(nil, "name", SpanContext{})
+	span.SetAttributes("key", "value")
+	span.RecordError(errors.New("error"))
+	span.End()
+	assert.False(t, span.SpanContext().IsValid())
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+
+	parent := r.Start("parent", SpanContext{})
+	child := r.Start("child", parent.SpanContext())
+	child.SetAttributes("key", "value", "dangling")
+	child.RecordError(errors.New("error"))
+	child.End()
+	child.SetAttributes("after", "end")
+	child.End()
+	parent.End()
+
+	spans := r.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, parent.SpanContext(), spans[0].Parent)
+	assert.Equal(t, parent.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+	assert.NotEqual(t, parent.SpanContext().SpanID, spans[0].SpanContext.SpanID)
+	assert.Equal(t, map[string]interface{}{"key": "value"}, spans[0].Attributes)
+	assert.Equal(t, []error{errors.New("error")}, spans[0].Errors)
+	assert.GreaterOrEqual(t, int64(spans[0].Duration()), int64(0))
+
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Equal(t, SpanContext{}, spans[1].Parent)
+	assert.True(t, spans[1].SpanContext.IsValid())
+	assert.True(t, spans[1].SpanContext.Sampled)
+
+	assert.Equal(t, spans[:1], r.SpansNamed("child"))
+	assert.Empty(t, r.SpansNamed("other"))
+}
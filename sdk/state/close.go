@@ -202,3 +202,36 @@ func (c *Channel) ConfirmClose(ce CloseEnvelope) (closeAgreement CloseAgreement,
 	c.latestUnauthorizedCloseAgreement = CloseAgreement{}
 	return c.latestAuthorizedCloseAgreement, nil
 }
+
+// FinalizeClose finalizes a close, making it authorized, by attaching the
+// close signatures to the agreement as the confirmers signatures. The proposer
+// of a close calls this once with the confirmers signatures when the confirmer
+// provides them. This can only be used to finalize the most recent
+// unauthorized close agreement proposed with ProposeClose.
+func (c *Channel) FinalizeClose(cs CloseSignatures) (closeAgreement CloseAgreement, err error) {
+	ca := c.latestUnauthorizedCloseAgreement
+	if ca.Envelope.Empty() {
+		return CloseAgreement{}, fmt.Errorf("no unauthorized close agreement to finalize")
+	}
+	if ca.Envelope.Details.ObservationPeriodTime != 0 || ca.Envelope.Details.ObservationPeriodLedgerGap != 0 {
+		return CloseAgreement{}, fmt.Errorf("unauthorized close agreement is not a coordinated close")
+	}
+
+	txs := ca.Transactions
+
+	// If remote has not signed the txs or signatures is invalid, error as is invalid.
+	verifyInputs := []signatureVerificationInput{
+		{TransactionHash: txs.DeclarationHash, Signature: cs.Declaration, Signer: c.remoteSigner},
+		{TransactionHash: txs.CloseHash, Signature: cs.Close, Signer: c.remoteSigner},
+	}
+	err = verifySignatures(verifyInputs)
+	if err != nil {
+		return CloseAgreement{}, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	// The new close agreement is valid and authorized, store and promote it.
+	ca.Envelope.ConfirmerSignatures = cs
+	c.latestAuthorizedCloseAgreement = ca
+	c.latestUnauthorizedCloseAgreement = CloseAgreement{}
+	return c.latestAuthorizedCloseAgreement, nil
+}
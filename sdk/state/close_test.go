@@ -278,6 +278,115 @@ func TestChannel_ProposeAndConfirmCoordinatedClose(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestChannel_FinalizeClose(t *testing.T) {
+	localSigner := keypair.MustRandom()
+	remoteSigner := keypair.MustRandom()
+	localChannelAccount := keypair.MustRandom().FromAddress()
+	remoteChannelAccount := keypair.MustRandom().FromAddress()
+
+	senderChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            true,
+		MaxOpenExpiry:        10 * time.Second,
+		LocalSigner:          localSigner,
+		RemoteSigner:         remoteSigner.FromAddress(),
+		LocalChannelAccount:  localChannelAccount,
+		RemoteChannelAccount: remoteChannelAccount,
+	})
+	receiverChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            false,
+		MaxOpenExpiry:        10 * time.Second,
+		LocalSigner:          remoteSigner,
+		RemoteSigner:         localSigner.FromAddress(),
+		LocalChannelAccount:  remoteChannelAccount,
+		RemoteChannelAccount: localChannelAccount,
+	})
+
+	// Open channel.
+	{
+		m, err := senderChannel.ProposeOpen(OpenParams{
+			Asset:                      NativeAsset,
+			ExpiresAt:                  time.Now().Add(5 * time.Second),
+			ObservationPeriodTime:      10,
+			ObservationPeriodLedgerGap: 10,
+			StartingSequence:           101,
+		})
+		require.NoError(t, err)
+		m, err = receiverChannel.ConfirmOpen(m.Envelope)
+		require.NoError(t, err)
+		_, err = senderChannel.FinalizeOpen(m.Envelope.ConfirmerSignatures)
+		require.NoError(t, err)
+
+		ftx, err := senderChannel.OpenTx()
+		require.NoError(t, err)
+		ftxXDR, err := ftx.Base64()
+		require.NoError(t, err)
+
+		successResultXDR, err := txbuildtest.BuildResultXDR(true)
+		require.NoError(t, err)
+		resultMetaXDR, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+			InitiatorSigner:         localSigner.Address(),
+			ResponderSigner:         remoteSigner.Address(),
+			InitiatorChannelAccount: localChannelAccount.Address(),
+			ResponderChannelAccount: remoteChannelAccount.Address(),
+			StartSequence:           101,
+			Asset:                   txnbuild.NativeAsset{},
+		})
+		require.NoError(t, err)
+
+		err = senderChannel.IngestTx(1, ftxXDR, successResultXDR, resultMetaXDR)
+		require.NoError(t, err)
+		err = receiverChannel.IngestTx(1, ftxXDR, successResultXDR, resultMetaXDR)
+		require.NoError(t, err)
+	}
+	senderChannel.UpdateLocalChannelAccountBalance(200)
+	receiverChannel.UpdateRemoteChannelAccountBalance(200)
+
+	// Finalizing before anything is proposed errors.
+	_, err := senderChannel.FinalizeClose(CloseSignatures{})
+	require.EqualError(t, err, "no unauthorized close agreement to finalize")
+
+	// Finalizing a payment as a close errors.
+	ca, err := senderChannel.ProposePayment(100)
+	require.NoError(t, err)
+	ca, err = receiverChannel.ConfirmPayment(ca.Envelope)
+	require.NoError(t, err)
+	_, err = senderChannel.FinalizeClose(ca.Envelope.ConfirmerSignatures)
+	require.EqualError(t, err, "unauthorized close agreement is not a coordinated close")
+	_, err = senderChannel.FinalizePayment(ca.Envelope.ConfirmerSignatures)
+	require.NoError(t, err)
+
+	// Coordinated close.
+	ca, err = senderChannel.ProposeClose()
+	require.NoError(t, err)
+	ca, err = receiverChannel.ConfirmClose(ca.Envelope)
+	require.NoError(t, err)
+
+	// Pretend that confirmer did not sign any tx.
+	_, err = senderChannel.FinalizeClose(CloseSignatures{})
+	require.EqualError(t, err, "invalid signature: signature verification failed")
+
+	// Pretend that the confirmer signed the txs invalidly.
+	_, err = senderChannel.FinalizeClose(CloseSignatures{
+		Declaration: ca.Envelope.ConfirmerSignatures.Close,
+		Close:       ca.Envelope.ConfirmerSignatures.Declaration,
+	})
+	require.EqualError(t, err, "invalid signature: signature verification failed")
+
+	// Valid confirmer signatures accepted by proposer.
+	finalized, err := senderChannel.FinalizeClose(ca.Envelope.ConfirmerSignatures)
+	require.NoError(t, err)
+	assert.Equal(t, ca.Envelope, finalized.Envelope)
+	assert.Equal(t, receiverChannel.LatestCloseAgreement().Envelope, senderChannel.LatestCloseAgreement().Envelope)
+	_, ok := senderChannel.LatestUnauthorizedCloseAgreement()
+	assert.False(t, ok)
+
+	// Finalizing a second time errors.
+	_, err = senderChannel.FinalizeClose(ca.Envelope.ConfirmerSignatures)
+	require.EqualError(t, err, "no unauthorized close agreement to finalize")
+}
+
 func TestChannel_ProposeAndConfirmCoordinatedClose_rejectIfChannelNotOpen(t *testing.T) {
 	localSigner := keypair.MustRandom()
 	remoteSigner := keypair.MustRandom()
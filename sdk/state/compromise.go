@@ -0,0 +1,164 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+)
+
+// Compromise is a change to one of the channel accounts, or to its trustline
+// for the channel's asset, that was observed after the channel opened and
+// leaves the account in a state other than the state validated at open. For
+// example, a signer being added or the trustline being deauthorized.
+//
+// A compromised channel account may no longer be controlled by both
+// participants, or its balance may no longer be available for the close, and
+// so participants should close the channel.
+type Compromise struct {
+	ChannelAccount     string
+	TransactionOrderID int64
+	Reason             string
+}
+
+// Compromises returns the compromises of the channel accounts that have been
+// observed since the channel opened, in the order they were ingested.
+func (c *Channel) Compromises() []Compromise {
+	return append([]Compromise(nil), c.compromises...)
+}
+
+// ingestTxMetaToValidateChannelAccounts uses the transaction result meta data
+// from a transaction response to validate that the channel accounts and their
+// trustlines remain in the state that was validated when the open transaction
+// was ingested. Any deviation is recorded as a compromise. Transactions
+// ingested before the open is validated, or after the channel is closed, are
+// not validated because the channel accounts are not expected to be in that
+// state.
+func (c *Channel) ingestTxMetaToValidateChannelAccounts(txOrderID int64, resultMetaXDR string) error {
+	if !c.openExecutedAndValidated {
+		return nil
+	}
+	// The close transaction removes signers from the channel accounts, so
+	// changes once closed are expected. If the state cannot be determined the
+	// channel is not known to be closed and changes are validated.
+	cs, err := c.State()
+	if err == nil && (cs == StateClosed || cs == StateClosedWithOutdatedState) {
+		return nil
+	}
+
+	changes, err := operationChanges(resultMetaXDR)
+	if err != nil {
+		return fmt.Errorf("parsing the result meta xdr: %w", err)
+	}
+
+	channelAsset := c.openAgreement.Envelope.Details.Asset
+	for _, change := range changes {
+		var address string
+		var reason error
+		switch change.Type {
+		case xdr.LedgerEntryChangeTypeLedgerEntryCreated, xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+			entry := change.Created
+			if entry == nil {
+				entry = change.Updated
+			}
+			switch entry.Data.Type {
+			case xdr.LedgerEntryTypeAccount:
+				address = entry.Data.Account.AccountId.Address()
+				reason = c.validateChannelAccountEntry(entry.Data.Account)
+			case xdr.LedgerEntryTypeTrustline:
+				if channelAsset.IsNative() || !channelAsset.EqualTrustLineAsset(entry.Data.TrustLine.Asset) {
+					continue
+				}
+				address = entry.Data.TrustLine.AccountId.Address()
+				reason = validateChannelTrustLineEntry(entry.Data.TrustLine)
+			}
+		case xdr.LedgerEntryChangeTypeLedgerEntryRemoved:
+			switch change.Removed.Type {
+			case xdr.LedgerEntryTypeAccount:
+				address = change.Removed.Account.AccountId.Address()
+				reason = fmt.Errorf("channel account removed")
+			case xdr.LedgerEntryTypeTrustline:
+				if channelAsset.IsNative() || !channelAsset.EqualTrustLineAsset(change.Removed.TrustLine.Asset) {
+					continue
+				}
+				address = change.Removed.TrustLine.AccountId.Address()
+				reason = fmt.Errorf("trustline removed")
+			}
+		}
+		if reason == nil {
+			continue
+		}
+		if address != c.localChannelAccount.Address.Address() && address != c.remoteChannelAccount.Address.Address() {
+			continue
+		}
+		c.addCompromise(Compromise{
+			ChannelAccount:     address,
+			TransactionOrderID: txOrderID,
+			Reason:             reason.Error(),
+		})
+	}
+	return nil
+}
+
+// addCompromise records the compromise, unless it has already been recorded,
+// such as when a transaction is ingested more than once.
+func (c *Channel) addCompromise(compromise Compromise) {
+	for _, existing := range c.compromises {
+		if existing == compromise {
+			return
+		}
+	}
+	c.compromises = append(c.compromises, compromise)
+}
+
+// validateChannelAccountEntry validates the channel account has thresholds
+// equal to the number of signers, so that all signers are required to sign all
+// transactions, and that its only signers are the initiator's and responder's
+// signers with equal weight.
+func (c *Channel) validateChannelAccountEntry(ea *xdr.AccountEntry) error {
+	const requiredSignerWeight = 1
+	const requiredNumOfSigners = 2
+	const requiredThresholds = requiredNumOfSigners * requiredSignerWeight
+
+	// Thresholds are: Master Key, Low, Medium, High.
+	if ea.Thresholds != (xdr.Thresholds{0, requiredThresholds, requiredThresholds, requiredThresholds}) {
+		participant := "responder"
+		if ea.AccountId.Address() == c.initiatorChannelAccount().Address.Address() {
+			participant = "initiator"
+		}
+		return fmt.Errorf("incorrect %s channel account thresholds found", participant)
+	}
+
+	var initiatorSignerCorrect, responderSignerCorrect bool
+	for _, signer := range ea.Signers {
+		address, err := signer.Key.GetAddress()
+		if err != nil {
+			return fmt.Errorf("parsing channel account signer keys: %w", err)
+		}
+
+		if address == c.initiatorSigner().Address() {
+			initiatorSignerCorrect = signer.Weight == requiredSignerWeight
+		} else if address == c.responderSigner().Address() {
+			responderSignerCorrect = signer.Weight == requiredSignerWeight
+		} else {
+			return fmt.Errorf("unexpected signer found on channel account")
+		}
+	}
+	if !initiatorSignerCorrect || !responderSignerCorrect {
+		return fmt.Errorf("signer not found or incorrect weight")
+	}
+	return nil
+}
+
+// validateChannelTrustLineEntry validates the channel account's trustline for
+// the channel's asset is authorized, and that clawback is not enabled so that
+// the issuer cannot take the balance of the channel account.
+func validateChannelTrustLineEntry(te *xdr.TrustLineEntry) error {
+	flags := xdr.TrustLineFlags(te.Flags)
+	if !flags.IsAuthorized() {
+		return fmt.Errorf("trustline not authorized")
+	}
+	if flags&xdr.TrustLineFlagsTrustlineClawbackEnabledFlag != 0 {
+		return fmt.Errorf("trustline clawback enabled")
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannel_IngestTx_compromises(t *testing.T) {
+	asset := Asset("ABCD:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	assetXDR, err := asset.Asset().ToXDR()
+	require.NoError(t, err)
+	otherAsset := Asset("EFGH:GDQNY3PBOJOKYZSRMK2S7LHHGWZIUISD4QORETLMXEWXBI7KFZZMKTL3")
+	otherAssetXDR, err := otherAsset.Asset().ToXDR()
+	require.NoError(t, err)
+
+	initiatorChannel, responderChannel, openTx := newOpenedChannelsWithAsset(t, asset)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+	resultXDR, err := txbuildtest.BuildResultXDR(true)
+	require.NoError(t, err)
+
+	initiatorChannelAccount := initiatorChannel.localChannelAccount.Address.Address()
+	responderChannelAccount := responderChannel.localChannelAccount.Address.Address()
+	validSigners := []xdr.Signer{
+		{Key: xdr.MustSigner(initiatorChannel.localSigner.Address()), Weight: 1},
+		{Key: xdr.MustSigner(responderChannel.localSigner.Address()), Weight: 1},
+	}
+	validThresholds := xdr.Thresholds{0, 2, 2, 2}
+
+	testCases := []struct {
+		name            string
+		change          xdr.LedgerEntryChange
+		wantCompromised string
+		wantReason      string
+	}{
+		{
+			name: "valid account",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId:  xdr.MustAddress(responderChannelAccount),
+						Signers:    validSigners,
+						Thresholds: validThresholds,
+					},
+				}},
+			},
+		},
+		{
+			name: "other account",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type:    xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{AccountId: xdr.MustAddress(keypair.MustRandom().Address())},
+				}},
+			},
+		},
+		{
+			name: "signer added",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId:  xdr.MustAddress(responderChannelAccount),
+						Signers:    append([]xdr.Signer{{Key: xdr.MustSigner(keypair.MustRandom().Address()), Weight: 1}}, validSigners...),
+						Thresholds: validThresholds,
+					},
+				}},
+			},
+			wantCompromised: responderChannelAccount,
+			wantReason:      "unexpected signer found on channel account",
+		},
+		{
+			name: "thresholds changed",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId:  xdr.MustAddress(initiatorChannelAccount),
+						Signers:    validSigners,
+						Thresholds: xdr.Thresholds{0, 1, 1, 1},
+					},
+				}},
+			},
+			wantCompromised: initiatorChannelAccount,
+			wantReason:      "incorrect initiator channel account thresholds found",
+		},
+		{
+			name: "responder thresholds changed",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId:  xdr.MustAddress(responderChannelAccount),
+						Signers:    validSigners,
+						Thresholds: xdr.Thresholds{0, 1, 1, 1},
+					},
+				}},
+			},
+			wantCompromised: responderChannelAccount,
+			wantReason:      "incorrect responder channel account thresholds found",
+		},
+		{
+			name: "trustline deauthorized",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeTrustline,
+					TrustLine: &xdr.TrustLineEntry{
+						AccountId: xdr.MustAddress(responderChannelAccount),
+						Asset:     assetXDR.ToTrustLineAsset(),
+						Flags:     xdr.Uint32(xdr.TrustLineFlagsAuthorizedToMaintainLiabilitiesFlag),
+					},
+				}},
+			},
+			wantCompromised: responderChannelAccount,
+			wantReason:      "trustline not authorized",
+		},
+		{
+			name: "trustline clawback enabled",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeTrustline,
+					TrustLine: &xdr.TrustLineEntry{
+						AccountId: xdr.MustAddress(responderChannelAccount),
+						Asset:     assetXDR.ToTrustLineAsset(),
+						Flags:     xdr.Uint32(xdr.TrustLineFlagsAuthorizedFlag | xdr.TrustLineFlagsTrustlineClawbackEnabledFlag),
+					},
+				}},
+			},
+			wantCompromised: responderChannelAccount,
+			wantReason:      "trustline clawback enabled",
+		},
+		{
+			name: "other trustline deauthorized",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated,
+				Updated: &xdr.LedgerEntry{Data: xdr.LedgerEntryData{
+					Type: xdr.LedgerEntryTypeTrustline,
+					TrustLine: &xdr.TrustLineEntry{
+						AccountId: xdr.MustAddress(responderChannelAccount),
+						Asset:     otherAssetXDR.ToTrustLineAsset(),
+					},
+				}},
+			},
+		},
+		{
+			name: "trustline removed",
+			change: xdr.LedgerEntryChange{
+				Type: xdr.LedgerEntryChangeTypeLedgerEntryRemoved,
+				Removed: &xdr.LedgerKey{
+					Type: xdr.LedgerEntryTypeTrustline,
+					TrustLine: &xdr.LedgerKeyTrustLine{
+						AccountId: xdr.MustAddress(initiatorChannelAccount),
+						Asset:     assetXDR.ToTrustLineAsset(),
+					},
+				},
+			},
+			wantCompromised: initiatorChannelAccount,
+			wantReason:      "trustline removed",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			txOrderID := int64(i + 2)
+			compromisesBefore := initiatorChannel.Compromises()
+			meta := xdr.TransactionMeta{
+				V: 2,
+				V2: &xdr.TransactionMetaV2{
+					Operations: []xdr.OperationMeta{{Changes: xdr.LedgerEntryChanges{tc.change}}},
+				},
+			}
+			metaXDR, err := xdr.MarshalBase64(meta)
+			require.NoError(t, err)
+
+			// Ingesting the same tx twice records a compromise once.
+			for j := 0; j < 2; j++ {
+				err = initiatorChannel.IngestTx(txOrderID, openTxXDR, resultXDR, metaXDR)
+				require.NoError(t, err)
+			}
+
+			compromises := initiatorChannel.Compromises()
+			if tc.wantCompromised == "" {
+				assert.Equal(t, compromisesBefore, compromises)
+				return
+			}
+			require.Len(t, compromises, len(compromisesBefore)+1)
+			assert.Equal(t, Compromise{
+				ChannelAccount:     tc.wantCompromised,
+				TransactionOrderID: txOrderID,
+				Reason:             tc.wantReason,
+			}, compromises[len(compromises)-1])
+		})
+	}
+
+	// Compromises are retained in snapshots.
+	compromises := initiatorChannel.Compromises()
+	require.Len(t, compromises, 6)
+	restored := NewChannelFromSnapshot(Config{
+		NetworkPassphrase:    initiatorChannel.networkPassphrase,
+		MaxOpenExpiry:        initiatorChannel.maxOpenExpiry,
+		Initiator:            true,
+		LocalSigner:          initiatorChannel.localSigner,
+		RemoteSigner:         initiatorChannel.remoteSigner,
+		LocalChannelAccount:  initiatorChannel.localChannelAccount.Address,
+		RemoteChannelAccount: initiatorChannel.remoteChannelAccount.Address,
+	}, initiatorChannel.Snapshot())
+	assert.Equal(t, compromises, restored.Compromises())
+}
+
+func TestChannel_IngestTx_compromisesNotRecordedAfterClose(t *testing.T) {
+	initiatorChannel, _, _ := newOpenedChannels(t)
+
+	_, closeTx, err := initiatorChannel.CloseTxs()
+	require.NoError(t, err)
+	closeTxXDR, err := closeTx.Base64()
+	require.NoError(t, err)
+	resultXDR, err := txbuildtest.BuildResultXDR(true)
+	require.NoError(t, err)
+
+	// The close tx removes the remote signer from the channel accounts.
+	metaXDR, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{
+		{
+			Type: xdr.LedgerEntryTypeAccount,
+			Account: &xdr.AccountEntry{
+				AccountId: xdr.MustAddress(initiatorChannel.localChannelAccount.Address.Address()),
+				SeqNum:    xdr.SequenceNumber(closeTx.SequenceNumber()),
+				Signers: []xdr.Signer{
+					{Key: xdr.MustSigner(initiatorChannel.localSigner.Address()), Weight: 1},
+				},
+				Thresholds: xdr.Thresholds{0, 1, 1, 1},
+			},
+		},
+	})
+	require.NoError(t, err)
+	err = initiatorChannel.IngestTx(2, closeTxXDR, resultXDR, metaXDR)
+	require.NoError(t, err)
+
+	cs, err := initiatorChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, StateClosed, cs)
+	assert.Empty(t, initiatorChannel.Compromises())
+}
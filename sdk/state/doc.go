@@ -15,7 +15,7 @@ through states that are based on network activity, such as open and close.
 The Open, Payment, and Close operations are broken up into three steps:
 - Propose: Called by the payer to create the agreement.
 - Confirm: Called by the payee to confirm the agreement.
-- Finalize*: Called by the payer to finalize the agreement with the payees
+- Finalize: Called by the payer to finalize the agreement with the payees
 signatures.
 
   +-----------+      +-----------+
@@ -26,13 +26,9 @@ signatures.
         +----------------->+
         |               Confirm
         +<-----------------+
-    Finalize*              |
+     Finalize              |
         |                  |
 
-* Note that the Open and Close processes do not have a Finalize operation, and the
-Confirm is used in its place at this time. A Finalize operation is likely to be
-added in the future.
-
 None of the primitives in this package are threadsafe and synchronization
 must be provided by the caller if the package is used in a concurrent
 context.
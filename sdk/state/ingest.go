@@ -5,11 +5,15 @@ import (
 
 	"github.com/stellar/go/txnbuild"
 	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/txbuild"
 )
 
 // IngestTx accepts any transaction that has been seen as successful or
 // unsuccessful on the network. The function updates the internal state of the
 // channel if the transaction relates to one of the channel's channel accounts.
+// A declaration or close that failed does not progress the state of the
+// channel, so a channel stays open after a failed declaration and stays closing
+// after a failed close.
 //
 // The txOrderID is an identifier that orders transactions as they were
 // executed on the Stellar network.
@@ -52,19 +56,35 @@ func (c *Channel) IngestTx(txOrderID int64, txXDR, resultXDR, resultMetaXDR stri
 		return fmt.Errorf("transaction unrecognized")
 	}
 
+	var txResult xdr.TransactionResult
+	err = xdr.SafeUnmarshalBase64(resultXDR, &txResult)
+	if err != nil {
+		return fmt.Errorf("parsing the result xdr: %w", err)
+	}
+
 	// Ingest the transaction and update channel state if valid.
-	c.ingestTxToUpdateInitiatorChannelAccountSequence(tx)
+	c.ingestTxToUpdateInitiatorChannelAccountSequence(tx, txResult.Successful())
 
 	err = c.ingestTxToUpdateUnauthorizedCloseAgreement(tx)
 	if err != nil {
 		return err
 	}
 
+	err = c.ingestTxToAuthorizeDiscardedCloseAgreement(tx)
+	if err != nil {
+		return err
+	}
+
 	err = c.ingestTxMetaToUpdateBalances(txOrderID, resultMetaXDR)
 	if err != nil {
 		return err
 	}
 
+	err = c.ingestTxMetaToValidateChannelAccounts(txOrderID, resultMetaXDR)
+	if err != nil {
+		return err
+	}
+
 	err = c.ingestOpenTx(tx, resultXDR, resultMetaXDR)
 	if err != nil {
 		return err
@@ -73,7 +93,7 @@ func (c *Channel) IngestTx(txOrderID int64, txXDR, resultXDR, resultMetaXDR stri
 	return nil
 }
 
-func (c *Channel) ingestTxToUpdateInitiatorChannelAccountSequence(tx *txnbuild.Transaction) {
+func (c *Channel) ingestTxToUpdateInitiatorChannelAccountSequence(tx *txnbuild.Transaction, successful bool) {
 	// If the transaction's source account is not the initiator's channel
 	// account, return.
 	if tx.SourceAccount().AccountID != c.initiatorChannelAccount().Address.Address() {
@@ -85,6 +105,16 @@ func (c *Channel) ingestTxToUpdateInitiatorChannelAccountSequence(tx *txnbuild.T
 		return
 	}
 
+	// If the transaction is a declaration or close that failed, return. The
+	// transaction consumed its sequence number but its operations were not
+	// applied, so the channel has not progressed towards closing.
+	if !successful {
+		switch txbuild.SequenceNumberToTransactionType(c.openAgreement.Envelope.Details.StartingSequence, tx.SourceAccount().Sequence) {
+		case txbuild.TransactionTypeDeclaration, txbuild.TransactionTypeClose:
+			return
+		}
+	}
+
 	c.setInitiatorChannelAccountSequence(tx.SourceAccount().Sequence)
 }
 
@@ -151,13 +181,83 @@ func (c *Channel) ingestTxToUpdateUnauthorizedCloseAgreement(tx *txnbuild.Transa
 	return nil
 }
 
+// ingestTxToAuthorizeDiscardedCloseAgreement uses the signatures in the
+// transaction to authorize a close agreement that was discarded after the
+// remote participant rejected it, if the transaction is the agreement's
+// declaration. The remote participant holds the local participant's
+// signatures for discarded agreements, and by submitting the declaration of
+// one has authorized it, so the channel must close with it. The declaration
+// carries the remote participant's signature for the close transaction as an
+// extra signer, which gives the local participant what it needs to submit the
+// close.
+func (c *Channel) ingestTxToAuthorizeDiscardedCloseAgreement(tx *txnbuild.Transaction) error {
+	// If the transaction's source account is not the initiator's channel
+	// account, then the transaction is not a part of a close agreement.
+	if tx.SourceAccount().AccountID != c.initiatorChannelAccount().Address.Address() {
+		return nil
+	}
+
+	c.pruneDiscardedCloseAgreements()
+	if len(c.discardedCloseAgreements) == 0 {
+		return nil
+	}
+
+	txHash, err := tx.Hash(c.networkPassphrase)
+	if err != nil {
+		return fmt.Errorf("hashing tx: %w", err)
+	}
+
+	for _, ca := range c.discardedCloseAgreements {
+		ce := ca.Envelope
+		txs, err := c.closeTxs(c.openAgreement.Envelope.Details, ce.Details)
+		if err != nil {
+			return fmt.Errorf("building txs for discarded close agreement: %w", err)
+		}
+		if txHash != txs.DeclarationHash {
+			continue
+		}
+
+		// Look for the signatures on the tx that are required to authorize the
+		// discarded close agreement.
+		for _, sig := range tx.Signatures() {
+			err = c.remoteSigner.Verify(txs.DeclarationHash[:], sig.Signature)
+			if err == nil {
+				ce.ConfirmerSignatures.Declaration = sig.Signature
+				break
+			}
+		}
+		for _, sig := range tx.Signatures() {
+			err = c.remoteSigner.Verify(txs.CloseHash[:], sig.Signature)
+			if err == nil {
+				ce.ConfirmerSignatures.Close = sig.Signature
+				break
+			}
+		}
+		err = verifySignatures([]signatureVerificationInput{
+			{TransactionHash: txs.DeclarationHash, Signature: ce.ConfirmerSignatures.Declaration, Signer: c.remoteSigner},
+			{TransactionHash: txs.CloseHash, Signature: ce.ConfirmerSignatures.Close, Signer: c.remoteSigner},
+		})
+		if err != nil {
+			return fmt.Errorf("authorizing discarded close agreement: invalid signature: %w", err)
+		}
+
+		c.latestAuthorizedCloseAgreement = CloseAgreement{
+			Envelope:     ce,
+			Transactions: txs,
+		}
+		c.pruneDiscardedCloseAgreements()
+		return nil
+	}
+
+	return nil
+}
+
 // ingestTxMetaToUpdateBalances uses the transaction result meta data
 // from a transaction response to update local and remote channel account
 // balances.
 func (c *Channel) ingestTxMetaToUpdateBalances(txOrderID int64, resultMetaXDR string) error {
 	// If not a valid resultMetaXDR string, return.
-	var txMeta xdr.TransactionMeta
-	err := xdr.SafeUnmarshalBase64(resultMetaXDR, &txMeta)
+	changes, err := operationChanges(resultMetaXDR)
 	if err != nil {
 		return fmt.Errorf("parsing the result meta xdr: %w", err)
 	}
@@ -166,59 +266,66 @@ func (c *Channel) ingestTxMetaToUpdateBalances(txOrderID int64, resultMetaXDR st
 
 	// Find ledger changes for the channel accounts' balances,
 	// if any, and then update.
-	for _, o := range txMeta.V2.Operations {
-		for _, change := range o.Changes {
-			var entry *xdr.LedgerEntry
-			switch change.Type {
-			case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
-				entry = change.Created
-			case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
-				entry = change.Updated
-			default:
+	for _, change := range changes {
+		var entry *xdr.LedgerEntry
+		switch change.Type {
+		case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+			entry = change.Created
+		case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+			entry = change.Updated
+		default:
+			continue
+		}
+
+		var ledgerEntryAddress string
+		var ledgerEntryAvailableBalance int64
+
+		if channelAsset.IsNative() {
+			account, ok := entry.Data.GetAccount()
+			if !ok {
 				continue
 			}
-
-			var ledgerEntryAddress string
-			var ledgerEntryAvailableBalance int64
-
-			if channelAsset.IsNative() {
-				account, ok := entry.Data.GetAccount()
-				if !ok {
-					continue
-				}
-				ledgerEntryAddress = account.AccountId.Address()
-				liabilities := account.Liabilities()
-				ledgerEntryAvailableBalance = int64(account.Balance - liabilities.Buying)
-			} else {
-				tl, ok := entry.Data.GetTrustLine()
-				if !ok {
-					continue
-				}
-				if !channelAsset.EqualTrustLineAsset(tl.Asset) {
-					continue
-				}
-				ledgerEntryAddress = tl.AccountId.Address()
-				liabilities := tl.Liabilities()
-				ledgerEntryAvailableBalance = int64(tl.Balance - liabilities.Selling)
+			ledgerEntryAddress = account.AccountId.Address()
+			liabilities := account.Liabilities()
+			ledgerEntryAvailableBalance = AvailableBalance(int64(account.Balance), int64(liabilities.Selling))
+		} else {
+			tl, ok := entry.Data.GetTrustLine()
+			if !ok {
+				continue
 			}
+			if !channelAsset.EqualTrustLineAsset(tl.Asset) {
+				continue
+			}
+			ledgerEntryAddress = tl.AccountId.Address()
+			liabilities := tl.Liabilities()
+			ledgerEntryAvailableBalance = AvailableBalance(int64(tl.Balance), int64(liabilities.Selling))
+		}
 
-			switch ledgerEntryAddress {
-			case c.localChannelAccount.Address.Address():
-				if txOrderID > c.localChannelAccount.LastSeenTransactionOrderID {
-					c.UpdateLocalChannelAccountBalance(ledgerEntryAvailableBalance)
-					c.localChannelAccount.LastSeenTransactionOrderID = txOrderID
-				}
-			case c.remoteChannelAccount.Address.Address():
-				if txOrderID > c.remoteChannelAccount.LastSeenTransactionOrderID {
-					c.UpdateRemoteChannelAccountBalance(ledgerEntryAvailableBalance)
-					c.remoteChannelAccount.LastSeenTransactionOrderID = txOrderID
-				}
+		switch ledgerEntryAddress {
+		case c.localChannelAccount.Address.Address():
+			if txOrderID > c.localChannelAccount.LastSeenTransactionOrderID {
+				c.UpdateLocalChannelAccountBalance(ledgerEntryAvailableBalance)
+				c.localChannelAccount.LastSeenTransactionOrderID = txOrderID
+			}
+		case c.remoteChannelAccount.Address.Address():
+			if txOrderID > c.remoteChannelAccount.LastSeenTransactionOrderID {
+				c.UpdateRemoteChannelAccountBalance(ledgerEntryAvailableBalance)
+				c.remoteChannelAccount.LastSeenTransactionOrderID = txOrderID
 			}
 		}
 	}
 	return nil
 }
 
+// AvailableBalance returns the balance of an account or trustline that is
+// available for spending, which is the balance less its selling liabilities.
+// Selling liabilities are the sum of the amounts of the account's offers
+// selling the asset, and so are the most the balance could be reduced by if
+// the offers were consumed.
+func AvailableBalance(balance, sellingLiabilities int64) int64 {
+	return balance - sellingLiabilities
+}
+
 // ingestOpenTx accepts a transaction, resultXDR, and resultMetaXDR. The
 // method returns with no error if either 1. the resultXDR shows the transaction
 // was unsuccessful, or 2. the transaction is not the open transaction this
@@ -254,53 +361,42 @@ func (c *Channel) ingestOpenTx(tx *txnbuild.Transaction, resultXDR string, resul
 		return nil
 	}
 
-	const requiredSignerWeight = 1
-	const requiredNumOfSigners = 2
-	const requiredThresholds = requiredNumOfSigners * requiredSignerWeight
-
 	// If not a valid resultMetaXDR string, return error.
-	var txMeta xdr.TransactionMeta
-	err = xdr.SafeUnmarshalBase64(resultMetaXDR, &txMeta)
+	changes, err := operationChanges(resultMetaXDR)
 	if err != nil {
 		return fmt.Errorf("parsing the result meta xdr: %w", err)
 	}
-	txMetaV2, ok := txMeta.GetV2()
-	if !ok {
-		return fmt.Errorf("result meta version unrecognized")
-	}
 
 	// Find channel account ledger changes. Grabs the latest entry, which gives
 	// the latest ledger entry state.
 	var initiatorChannelAccountEntry, responderChannelAccountEntry *xdr.AccountEntry
 	var initiatorChannelAccountTrustlineEntry, responderChannelAccountTrustlineEntry *xdr.TrustLineEntry
-	for _, o := range txMetaV2.Operations {
-		for _, change := range o.Changes {
-			var entry *xdr.LedgerEntry
-			switch change.Type {
-			case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
-				entry = change.Created
-			case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
-				entry = change.Updated
-			default:
+	for _, change := range changes {
+		var entry *xdr.LedgerEntry
+		switch change.Type {
+		case xdr.LedgerEntryChangeTypeLedgerEntryCreated:
+			entry = change.Created
+		case xdr.LedgerEntryChangeTypeLedgerEntryUpdated:
+			entry = change.Updated
+		default:
+			continue
+		}
+
+		switch entry.Data.Type {
+		case xdr.LedgerEntryTypeTrustline:
+			if !c.openAgreement.Envelope.Details.Asset.EqualTrustLineAsset(entry.Data.TrustLine.Asset) {
 				continue
 			}
-
-			switch entry.Data.Type {
-			case xdr.LedgerEntryTypeTrustline:
-				if !c.openAgreement.Envelope.Details.Asset.EqualTrustLineAsset(entry.Data.TrustLine.Asset) {
-					continue
-				}
-				if entry.Data.TrustLine.AccountId.Address() == c.initiatorChannelAccount().Address.Address() {
-					initiatorChannelAccountTrustlineEntry = entry.Data.TrustLine
-				} else if entry.Data.TrustLine.AccountId.Address() == c.responderChannelAccount().Address.Address() {
-					responderChannelAccountTrustlineEntry = entry.Data.TrustLine
-				}
-			case xdr.LedgerEntryTypeAccount:
-				if entry.Data.Account.AccountId.Address() == c.initiatorChannelAccount().Address.Address() {
-					initiatorChannelAccountEntry = entry.Data.Account
-				} else if entry.Data.Account.AccountId.Address() == c.responderChannelAccount().Address.Address() {
-					responderChannelAccountEntry = entry.Data.Account
-				}
+			if entry.Data.TrustLine.AccountId.Address() == c.initiatorChannelAccount().Address.Address() {
+				initiatorChannelAccountTrustlineEntry = entry.Data.TrustLine
+			} else if entry.Data.TrustLine.AccountId.Address() == c.responderChannelAccount().Address.Address() {
+				responderChannelAccountTrustlineEntry = entry.Data.TrustLine
+			}
+		case xdr.LedgerEntryTypeAccount:
+			if entry.Data.Account.AccountId.Address() == c.initiatorChannelAccount().Address.Address() {
+				initiatorChannelAccountEntry = entry.Data.Account
+			} else if entry.Data.Account.AccountId.Address() == c.responderChannelAccount().Address.Address() {
+				responderChannelAccountEntry = entry.Data.Account
 			}
 		}
 	}
@@ -320,34 +416,9 @@ func (c *Channel) ingestOpenTx(tx *txnbuild.Transaction, resultXDR string, resul
 
 	channelAccounts := [2]*xdr.AccountEntry{initiatorChannelAccountEntry, responderChannelAccountEntry}
 	for _, ea := range channelAccounts {
-		// Validate the channel account thresholds are equal to the number of
-		// signers so that all signers are required to sign all transactions.
-		// Thresholds are: Master Key, Low, Medium, High.
-		if ea.Thresholds != (xdr.Thresholds{0, requiredThresholds, requiredThresholds, requiredThresholds}) {
-			c.openExecutedWithError = fmt.Errorf("incorrect initiator channel account thresholds found")
-			return nil
-		}
-
-		// Validate the channel account has the correct signers and signer weights.
-		var initiatorSignerCorrect, responderSignerCorrect bool
-		for _, signer := range ea.Signers {
-			address, err := signer.Key.GetAddress()
-			if err != nil {
-				c.openExecutedWithError = fmt.Errorf("parsing open transaction channel account signer keys: %w", err)
-				return nil
-			}
-
-			if address == c.initiatorSigner().Address() {
-				initiatorSignerCorrect = signer.Weight == requiredSignerWeight
-			} else if address == c.responderSigner().Address() {
-				responderSignerCorrect = signer.Weight == requiredSignerWeight
-			} else {
-				c.openExecutedWithError = fmt.Errorf("unexpected signer found on channel account")
-				return nil
-			}
-		}
-		if !initiatorSignerCorrect || !responderSignerCorrect {
-			c.openExecutedWithError = fmt.Errorf("signer not found or incorrect weight")
+		err = c.validateChannelAccountEntry(ea)
+		if err != nil {
+			c.openExecutedWithError = err
 			return nil
 		}
 	}
@@ -362,9 +433,9 @@ func (c *Channel) ingestOpenTx(tx *txnbuild.Transaction, resultXDR string, resul
 				return nil
 			}
 
-			// Validate trustline is authorized.
-			if !xdr.TrustLineFlags(te.Flags).IsAuthorized() {
-				c.openExecutedWithError = fmt.Errorf("trustline not authorized")
+			err = validateChannelTrustLineEntry(te)
+			if err != nil {
+				c.openExecutedWithError = err
 				return nil
 			}
 		}
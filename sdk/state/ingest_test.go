@@ -2,6 +2,7 @@ package state
 
 import (
 	"encoding/base64"
+	"fmt"
 	"testing"
 	"time"
 
@@ -182,6 +183,92 @@ func TestChannel_IngestTx_latestUnauthorizedDeclTx(t *testing.T) {
 	assert.Equal(t, initiatorChannel.LatestCloseAgreement(), responderChannel.LatestCloseAgreement())
 }
 
+func TestChannel_IngestTx_discardedDeclTx(t *testing.T) {
+	// Setup
+	initiatorSigner := keypair.MustRandom()
+	responderSigner := keypair.MustRandom()
+	initiatorChannelAccount := keypair.MustRandom().FromAddress()
+	responderChannelAccount := keypair.MustRandom().FromAddress()
+	initiatorConfig := Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            true,
+		LocalSigner:          initiatorSigner,
+		RemoteSigner:         responderSigner.FromAddress(),
+		LocalChannelAccount:  initiatorChannelAccount,
+		RemoteChannelAccount: responderChannelAccount,
+	}
+	initiatorChannel := NewChannel(initiatorConfig)
+	responderChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            false,
+		LocalSigner:          responderSigner,
+		RemoteSigner:         initiatorSigner.FromAddress(),
+		LocalChannelAccount:  responderChannelAccount,
+		RemoteChannelAccount: initiatorChannelAccount,
+	})
+	open, err := initiatorChannel.ProposeOpen(OpenParams{
+		ObservationPeriodTime:      1,
+		ObservationPeriodLedgerGap: 1,
+		ExpiresAt:                  time.Now().Add(time.Minute),
+		StartingSequence:           1,
+	})
+	require.NoError(t, err)
+	open, err = responderChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	_, err = initiatorChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	initiatorChannel.UpdateLocalChannelAccountBalance(100)
+	initiatorChannel.UpdateRemoteChannelAccountBalance(100)
+	responderChannel.UpdateLocalChannelAccountBalance(100)
+	responderChannel.UpdateRemoteChannelAccountBalance(100)
+
+	// Mock initiatorChannel ingested open tx successfully.
+	initiatorChannel.openExecutedAndValidated = true
+	responderChannel.openExecutedAndValidated = true
+	initiatorChannel.initiatorChannelAccount().SequenceNumber = 1
+
+	// To prevent xdr parsing error.
+	placeholderXDR := "AAAAAgAAAAIAAAADABArWwAAAAAAAAAAWPnYf+6kQN3t44vgesQdWh4JOOPj7aer852I7RJhtzAAAAAWg8TZOwANrPwAAAAKAAAAAAAAAAAAAAAAAAAAAAEAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAACAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAABABArWwAAAAAAAAAAWPnYf+6kQN3t44vgesQdWh4JOOPj7aer852I7RJhtzAAAAAWg8TZOwANrPwAAAALAAAAAAAAAAAAAAAAAAAAAAEAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAACAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAABAAAABAAAAAMAD/39AAAAAAAAAAD49aUpVx7fhJPK6wDdlPJgkA1HkAi85qUL1tii8YSZzQAAABdjSVwcAA/8sgAAAAEAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAEAECtbAAAAAAAAAAD49aUpVx7fhJPK6wDdlPJgkA1HkAi85qUL1tii8YSZzQAAABee5CYcAA/8sgAAAAEAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAMAECtbAAAAAAAAAABY+dh/7qRA3e3ji+B6xB1aHgk44+Ptp6vznYjtEmG3MAAAABaDxNk7AA2s/AAAAAsAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAABAAAAAAAAAAAAAAAAAAAAAAAAAAIAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAEAECtbAAAAAAAAAABY+dh/7qRA3e3ji+B6xB1aHgk44+Ptp6vznYjtEmG3MAAAABZIKg87AA2s/AAAAAsAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAABAAAAAAAAAAAAAAAAAAAAAAAAAAIAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAA="
+
+	// Propose a payment that the responder signs but tells the initiator it
+	// rejects, so that the initiator discards it.
+	close, err := initiatorChannel.ProposePayment(8)
+	require.NoError(t, err)
+	_, err = responderChannel.ConfirmPayment(close.Envelope)
+	require.NoError(t, err)
+	_, ok := initiatorChannel.DiscardUnauthorizedCloseAgreement()
+	require.True(t, ok)
+	assert.Equal(t, int64(0), initiatorChannel.Balance())
+
+	// The initiator keeps the discarded agreement across a snapshot.
+	initiatorChannel = NewChannelFromSnapshot(initiatorConfig, initiatorChannel.Snapshot())
+
+	// The responder broadcasts the declaration tx of the rejected payment.
+	declTx, _, err := responderChannel.CloseTxs()
+	require.NoError(t, err)
+	declTxXDR, err := declTx.Base64()
+	require.NoError(t, err)
+	validResultXDR := "AAAAAAAAAGQAAAAAAAAAAQAAAAAAAAABAAAAAAAAAAA="
+	err = initiatorChannel.IngestTx(1, declTxXDR, validResultXDR, placeholderXDR)
+	require.NoError(t, err)
+
+	// The initiator sees the channel closing with the rejected payment, and
+	// not closed, and can submit the close tx for it.
+	cs, err := initiatorChannel.State()
+	require.NoError(t, err)
+	require.Equal(t, StateClosing, cs)
+	assert.Equal(t, int64(8), initiatorChannel.Balance())
+	assert.Equal(t, responderChannel.LatestCloseAgreement(), initiatorChannel.LatestCloseAgreement())
+	_, closeTx, err := initiatorChannel.CloseTxs()
+	require.NoError(t, err)
+	_, responderCloseTx, err := responderChannel.CloseTxs()
+	require.NoError(t, err)
+	assert.Equal(t, responderCloseTx.Signatures(), closeTx.Signatures())
+	assert.Empty(t, initiatorChannel.Snapshot().DiscardedCloseAgreements)
+}
+
 func TestChannel_IngestTx_latestAuthorizedDeclTx(t *testing.T) {
 	// Setup
 	initiatorSigner := keypair.MustRandom()
@@ -239,6 +326,87 @@ func TestChannel_IngestTx_latestAuthorizedDeclTx(t *testing.T) {
 	require.Equal(t, StateClosing, cs)
 }
 
+func TestChannel_IngestTx_failedDeclAndCloseTx(t *testing.T) {
+	// Setup
+	initiatorSigner := keypair.MustRandom()
+	responderSigner := keypair.MustRandom()
+	initiatorChannelAccount := keypair.MustRandom().FromAddress()
+	responderChannelAccount := keypair.MustRandom().FromAddress()
+	initiatorChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            true,
+		LocalSigner:          initiatorSigner,
+		RemoteSigner:         responderSigner.FromAddress(),
+		LocalChannelAccount:  initiatorChannelAccount,
+		RemoteChannelAccount: responderChannelAccount,
+	})
+	responderChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            false,
+		LocalSigner:          responderSigner,
+		RemoteSigner:         initiatorSigner.FromAddress(),
+		LocalChannelAccount:  responderChannelAccount,
+		RemoteChannelAccount: initiatorChannelAccount,
+	})
+	open, err := initiatorChannel.ProposeOpen(OpenParams{
+		ObservationPeriodTime:      1,
+		ObservationPeriodLedgerGap: 1,
+		ExpiresAt:                  time.Now().Add(time.Minute),
+		StartingSequence:           1,
+	})
+	require.NoError(t, err)
+	open, err = responderChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	_, err = initiatorChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+
+	// Mock initiatorChannel ingested open tx successfully.
+	initiatorChannel.openExecutedAndValidated = true
+	initiatorChannel.initiatorChannelAccount().SequenceNumber = 1
+
+	// To prevent xdr parsing error.
+	placeholderXDR := "AAAAAgAAAAIAAAADABArWwAAAAAAAAAAWPnYf+6kQN3t44vgesQdWh4JOOPj7aer852I7RJhtzAAAAAWg8TZOwANrPwAAAAKAAAAAAAAAAAAAAAAAAAAAAEAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAACAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAABABArWwAAAAAAAAAAWPnYf+6kQN3t44vgesQdWh4JOOPj7aer852I7RJhtzAAAAAWg8TZOwANrPwAAAALAAAAAAAAAAAAAAAAAAAAAAEAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAACAAAAAAAAAAEAAAAAAAAAAAAAAAAAAAABAAAABAAAAAMAD/39AAAAAAAAAAD49aUpVx7fhJPK6wDdlPJgkA1HkAi85qUL1tii8YSZzQAAABdjSVwcAA/8sgAAAAEAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAEAECtbAAAAAAAAAAD49aUpVx7fhJPK6wDdlPJgkA1HkAi85qUL1tii8YSZzQAAABee5CYcAA/8sgAAAAEAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAMAECtbAAAAAAAAAABY+dh/7qRA3e3ji+B6xB1aHgk44+Ptp6vznYjtEmG3MAAAABaDxNk7AA2s/AAAAAsAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAABAAAAAAAAAAAAAAAAAAAAAAAAAAIAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAEAECtbAAAAAAAAAABY+dh/7qRA3e3ji+B6xB1aHgk44+Ptp6vznYjtEmG3MAAAABZIKg87AA2s/AAAAAsAAAAAAAAAAAAAAAAAAAAAAQAAAAAAAAAAAAABAAAAAAAAAAAAAAAAAAAAAAAAAAIAAAAAAAAAAQAAAAAAAAAAAAAAAAAAAAA="
+	successResultXDR, err := txbuildtest.BuildResultXDR(true)
+	require.NoError(t, err)
+	failedResultXDR, err := txbuildtest.BuildResultXDR(false)
+	require.NoError(t, err)
+
+	declTx, closeTx, err := responderChannel.CloseTxs()
+	require.NoError(t, err)
+	declTxXDR, err := declTx.Base64()
+	require.NoError(t, err)
+	closeTxXDR, err := closeTx.Base64()
+	require.NoError(t, err)
+
+	// A failed declTx leaves the channel open.
+	err = initiatorChannel.IngestTx(1, declTxXDR, failedResultXDR, placeholderXDR)
+	require.NoError(t, err)
+	cs, err := initiatorChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, StateOpen, cs)
+
+	err = initiatorChannel.IngestTx(2, declTxXDR, successResultXDR, placeholderXDR)
+	require.NoError(t, err)
+	cs, err = initiatorChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, StateClosing, cs)
+
+	// A failed closeTx leaves the channel closing.
+	err = initiatorChannel.IngestTx(3, closeTxXDR, failedResultXDR, placeholderXDR)
+	require.NoError(t, err)
+	cs, err = initiatorChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, StateClosing, cs)
+
+	err = initiatorChannel.IngestTx(4, closeTxXDR, successResultXDR, placeholderXDR)
+	require.NoError(t, err)
+	cs, err = initiatorChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, StateClosed, cs)
+}
+
 func TestChannel_IngestTx_oldDeclTx(t *testing.T) {
 	// Setup
 	initiatorSigner := keypair.MustRandom()
@@ -530,7 +698,7 @@ func TestChannel_IngestTx_updateBalancesNative_withLiabilities(t *testing.T) {
 	type TestCase struct {
 		channelAccount    *keypair.FromAddress
 		balance           xdr.Int64
-		buying            xdr.Int64
+		selling           xdr.Int64
 		wantBalanceLocal  int64
 		wantBalanceRemote int64
 	}
@@ -549,8 +717,8 @@ func TestChannel_IngestTx_updateBalancesNative_withLiabilities(t *testing.T) {
 		initiatorChannel.UpdateRemoteChannelAccountBalance(0)
 		ale, err := xdr.NewAccountEntryExt(1, xdr.AccountEntryExtensionV1{
 			Liabilities: xdr.Liabilities{
-				Buying:  tc.buying,
-				Selling: 100,
+				Buying:  100,
+				Selling: tc.selling,
 			},
 		})
 		require.NoError(t, err)
@@ -982,6 +1150,24 @@ func TestChannel_IngestTx_updateState_nonNativeAsset(t *testing.T) {
 	cs, err = initiatorChannel.State()
 	require.NoError(t, err)
 	assert.Equal(t, StateError, cs)
+
+	// Trustline with clawback enabled.
+	resultMetaXDR, err = txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+		InitiatorSigner:         initiatorSigner.Address(),
+		ResponderSigner:         responderSigner.Address(),
+		InitiatorChannelAccount: initiatorChannelAccount.Address(),
+		ResponderChannelAccount: responderChannelAccount.Address(),
+		StartSequence:           24936580120577,
+		Asset:                   asset.Asset(),
+		TrustLineFlag:           xdr.TrustLineFlagsAuthorizedFlag | xdr.TrustLineFlagsTrustlineClawbackEnabledFlag,
+	})
+	require.NoError(t, err)
+	err = initiatorChannel.IngestTx(9, openTxXDR, validResultXDR, resultMetaXDR)
+	require.NoError(t, err)
+	assert.EqualError(t, initiatorChannel.openExecutedWithError, "trustline clawback enabled")
+	cs, err = initiatorChannel.State()
+	require.NoError(t, err)
+	assert.Equal(t, StateError, cs)
 }
 
 func TestChannel_IngestTx_updateState_invalid_initiatorChannelAccountHasExtraSigner(t *testing.T) {
@@ -1524,3 +1710,143 @@ func TestChannel_IngestTx_ingestOldTransactions(t *testing.T) {
 	err = initiatorChannel.IngestTx(1, oldCloseXDR, validResultXDR, placeholderXDR)
 	require.EqualError(t, err, "channel has been closed")
 }
+
+func TestChannel_IngestTx_metaVersions(t *testing.T) {
+	for _, version := range []int32{0, 1, 2, 3, 4} {
+		t.Run(fmt.Sprint(version), func(t *testing.T) {
+			initiatorChannel, responderChannel, openTx := newOpenedChannels(t)
+			initiatorChannel.openExecutedAndValidated = false
+			initiatorChannel.initiatorChannelAccount().SequenceNumber = 0
+			openTxXDR, err := openTx.Base64()
+			require.NoError(t, err)
+			validResultXDR, err := txbuildtest.BuildResultXDR(true)
+			require.NoError(t, err)
+
+			// The open tx is validated with the version of meta. Meta version 0
+			// cannot be generated for the open since zero selects the default.
+			if version != 0 {
+				resultMetaXDR, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+					InitiatorSigner:         initiatorChannel.localSigner.Address(),
+					ResponderSigner:         responderChannel.localSigner.Address(),
+					InitiatorChannelAccount: initiatorChannel.localChannelAccount.Address.Address(),
+					ResponderChannelAccount: responderChannel.localChannelAccount.Address.Address(),
+					StartSequence:           openTx.SequenceNumber(),
+					Asset:                   txnbuild.NativeAsset{},
+					MetaVersion:             version,
+				})
+				require.NoError(t, err)
+				err = initiatorChannel.IngestTx(1, openTxXDR, validResultXDR, resultMetaXDR)
+				require.NoError(t, err)
+				require.NoError(t, initiatorChannel.openExecutedWithError)
+				cs, err := initiatorChannel.State()
+				require.NoError(t, err)
+				assert.Equal(t, StateOpen, cs)
+			}
+
+			// Balances are updated from the version of meta.
+			resultMetaXDR, err := txbuildtest.BuildResultMetaXDRVersion(version, []xdr.LedgerEntryData{
+				{
+					Type: xdr.LedgerEntryTypeAccount,
+					Account: &xdr.AccountEntry{
+						AccountId: xdr.MustAddress(initiatorChannel.localChannelAccount.Address.Address()),
+						Balance:   123,
+					},
+				},
+			})
+			require.NoError(t, err)
+			err = initiatorChannel.IngestTx(2, openTxXDR, validResultXDR, resultMetaXDR)
+			require.NoError(t, err)
+			assert.Equal(t, int64(123), initiatorChannel.localChannelAccount.Balance)
+		})
+	}
+}
+
+func TestChannel_IngestTx_updateBalances_availableBalance(t *testing.T) {
+	initiatorSigner := keypair.MustRandom()
+	responderSigner := keypair.MustRandom()
+
+	initiatorChannelAccount := keypair.MustParseAddress("GBTIPOMXZUUPVVII2EO4533MP5DUKVMACBRQ73HVW3CZRUUIOESIDZ4O")
+	responderChannelAccount := keypair.MustParseAddress("GDPR4IOSNLZS2HNE2PM7E2WJOUFCPATP3O4LGXJNE3K5HO42L7HSL6SO")
+
+	validResultXDR, err := txbuildtest.BuildResultXDR(true)
+	require.NoError(t, err)
+
+	for _, asset := range []Asset{NativeAsset, Asset("TEST:GAOWNZMMFW25MWBAWKRYBMIEKY2KKEWKOINP2IDTRYOQ4DOEW26NV437")} {
+		t.Run(string(asset), func(t *testing.T) {
+			initiatorChannel := NewChannel(Config{
+				NetworkPassphrase:    network.TestNetworkPassphrase,
+				MaxOpenExpiry:        time.Hour,
+				Initiator:            true,
+				LocalSigner:          initiatorSigner,
+				RemoteSigner:         responderSigner.FromAddress(),
+				LocalChannelAccount:  initiatorChannelAccount,
+				RemoteChannelAccount: responderChannelAccount,
+			})
+			responderChannel := NewChannel(Config{
+				NetworkPassphrase:    network.TestNetworkPassphrase,
+				MaxOpenExpiry:        time.Hour,
+				Initiator:            false,
+				LocalSigner:          responderSigner,
+				RemoteSigner:         initiatorSigner.FromAddress(),
+				LocalChannelAccount:  responderChannelAccount,
+				RemoteChannelAccount: initiatorChannelAccount,
+			})
+			open, err := initiatorChannel.ProposeOpen(OpenParams{
+				ObservationPeriodTime:      1,
+				ObservationPeriodLedgerGap: 1,
+				Asset:                      asset,
+				ExpiresAt:                  time.Now().Add(time.Minute),
+				StartingSequence:           1,
+			})
+			require.NoError(t, err)
+			open, err = responderChannel.ConfirmOpen(open.Envelope)
+			require.NoError(t, err)
+			_, err = initiatorChannel.ConfirmOpen(open.Envelope)
+			require.NoError(t, err)
+
+			placeholderTx, _, err := initiatorChannel.CloseTxs()
+			require.NoError(t, err)
+			placeholderXDR, err := placeholderTx.Base64()
+			require.NoError(t, err)
+
+			// The available balance is the same as calculated from the same
+			// balances collected from Horizon.
+			for i, b := range txbuildtest.BalancesWithLiabilities {
+				liabilities := xdr.Liabilities{
+					Buying:  xdr.Int64(b.BuyingLiabilities),
+					Selling: xdr.Int64(b.SellingLiabilities),
+				}
+				var entry xdr.LedgerEntryData
+				if asset.IsNative() {
+					ext, err := xdr.NewAccountEntryExt(1, xdr.AccountEntryExtensionV1{Liabilities: liabilities})
+					require.NoError(t, err)
+					entry = xdr.LedgerEntryData{
+						Type: xdr.LedgerEntryTypeAccount,
+						Account: &xdr.AccountEntry{
+							AccountId: xdr.MustAddress(initiatorChannelAccount.Address()),
+							Balance:   xdr.Int64(b.Balance),
+							Ext:       ext,
+						},
+					}
+				} else {
+					ext, err := xdr.NewTrustLineEntryExt(1, xdr.TrustLineEntryV1{Liabilities: liabilities})
+					require.NoError(t, err)
+					entry = xdr.LedgerEntryData{
+						Type: xdr.LedgerEntryTypeTrustline,
+						TrustLine: &xdr.TrustLineEntry{
+							AccountId: xdr.MustAddress(initiatorChannelAccount.Address()),
+							Asset:     xdr.MustNewCreditAsset(asset.Code(), asset.Issuer()).ToTrustLineAsset(),
+							Balance:   xdr.Int64(b.Balance),
+							Ext:       ext,
+						},
+					}
+				}
+				meta, err := txbuildtest.BuildResultMetaXDR([]xdr.LedgerEntryData{entry})
+				require.NoError(t, err)
+				err = initiatorChannel.IngestTx(int64(i+1), placeholderXDR, validResultXDR, meta)
+				require.NoError(t, err)
+				assert.Equal(t, b.Available, initiatorChannel.localChannelAccount.Balance)
+			}
+		})
+	}
+}
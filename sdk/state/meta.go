@@ -0,0 +1,47 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+)
+
+// operationChanges returns the ledger entry changes of the operations of a
+// transaction from the base64 encoded transaction result meta XDR, for any
+// version of the meta up to and including V4. The changes include Soroban
+// entries, such as contract data and TTLs, and restored changes, which are
+// not used by the channel.
+func operationChanges(resultMetaXDR string) ([]xdr.LedgerEntryChange, error) {
+	var txMeta xdr.TransactionMeta
+	err := xdr.SafeUnmarshalBase64(resultMetaXDR, &txMeta)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling result meta: %w", err)
+	}
+
+	var changes []xdr.LedgerEntryChange
+	switch txMeta.V {
+	case 0:
+		for _, o := range txMeta.MustOperations() {
+			changes = append(changes, o.Changes...)
+		}
+	case 1:
+		for _, o := range txMeta.MustV1().Operations {
+			changes = append(changes, o.Changes...)
+		}
+	case 2:
+		for _, o := range txMeta.MustV2().Operations {
+			changes = append(changes, o.Changes...)
+		}
+	case 3:
+		for _, o := range txMeta.MustV3().Operations {
+			changes = append(changes, o.Changes...)
+		}
+	case 4:
+		for _, o := range txMeta.MustV4().Operations {
+			changes = append(changes, o.Changes...)
+		}
+	default:
+		return nil, fmt.Errorf("result meta version %d unrecognized", txMeta.V)
+	}
+	return changes, nil
+}
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationChanges(t *testing.T) {
+	led := []xdr.LedgerEntryData{
+		{
+			Type: xdr.LedgerEntryTypeAccount,
+			Account: &xdr.AccountEntry{
+				AccountId: xdr.MustAddress("GAKDNXUGEIRGESAXOPUHU4GOWLVYGQFJVHQOGFXKBXDGZ7AKMPPSDDPV"),
+				Balance:   xdr.Int64(100),
+			},
+		},
+		{
+			Type: xdr.LedgerEntryTypeTrustline,
+			TrustLine: &xdr.TrustLineEntry{
+				AccountId: xdr.MustAddress("GAKDNXUGEIRGESAXOPUHU4GOWLVYGQFJVHQOGFXKBXDGZ7AKMPPSDDPV"),
+				Balance:   xdr.Int64(200),
+			},
+		},
+	}
+
+	for _, version := range []int32{0, 1, 2, 3, 4} {
+		t.Run(fmt.Sprint(version), func(t *testing.T) {
+			m, err := txbuildtest.BuildResultMetaXDRVersion(version, led)
+			require.NoError(t, err)
+
+			changes, err := operationChanges(m)
+			require.NoError(t, err)
+			require.Len(t, changes, len(led))
+			for i, change := range changes {
+				if created, ok := change.GetCreated(); ok {
+					assert.Equal(t, led[i], created.Data)
+				} else if updated, ok := change.GetUpdated(); ok {
+					assert.Equal(t, led[i], updated.Data)
+				} else {
+					assert.Fail(t, "change didn't contain a created or updated")
+				}
+			}
+		})
+	}
+}
+
+func TestOperationChanges_soroban(t *testing.T) {
+	account := xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeAccount,
+		Account: &xdr.AccountEntry{
+			AccountId: xdr.MustAddress("GAKDNXUGEIRGESAXOPUHU4GOWLVYGQFJVHQOGFXKBXDGZ7AKMPPSDDPV"),
+			Balance:   xdr.Int64(100),
+		},
+	}
+	sym := xdr.ScSymbol("balance")
+	contractID := xdr.ContractId{1}
+	contractData := xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeContractData,
+		ContractData: &xdr.ContractDataEntry{
+			Contract:   xdr.ScAddress{Type: xdr.ScAddressTypeScAddressTypeContract, ContractId: &contractID},
+			Key:        xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &sym},
+			Durability: xdr.ContractDataDurabilityPersistent,
+			Val:        xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &sym},
+		},
+	}
+	ttl := xdr.LedgerEntryData{
+		Type: xdr.LedgerEntryTypeTtl,
+		Ttl:  &xdr.TtlEntry{LiveUntilLedgerSeq: 100},
+	}
+	errorCode := xdr.Uint32(7)
+	errorVal := xdr.ScVal{
+		Type:  xdr.ScValTypeScvError,
+		Error: &xdr.ScError{Type: xdr.ScErrorTypeSceContract, ContractCode: &errorCode},
+	}
+
+	// A SAC transaction whose operation restores and updates contract entries
+	// alongside the account, and emits an event carrying an error value.
+	meta := xdr.TransactionMeta{
+		V: 4,
+		V4: &xdr.TransactionMetaV4{
+			Operations: []xdr.OperationMetaV2{{
+				Changes: xdr.LedgerEntryChanges{
+					{Type: xdr.LedgerEntryChangeTypeLedgerEntryRestored, Restored: &xdr.LedgerEntry{Data: ttl}},
+					{Type: xdr.LedgerEntryChangeTypeLedgerEntryState, State: &xdr.LedgerEntry{Data: contractData}},
+					{Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated, Updated: &xdr.LedgerEntry{Data: contractData}},
+					{Type: xdr.LedgerEntryChangeTypeLedgerEntryUpdated, Updated: &xdr.LedgerEntry{Data: account}},
+				},
+				Events: []xdr.ContractEvent{{
+					ContractId: &contractID,
+					Type:       xdr.ContractEventTypeContract,
+					Body: xdr.ContractEventBody{V0: &xdr.ContractEventV0{
+						Topics: []xdr.ScVal{errorVal, {Type: xdr.ScValTypeScvSymbol, Sym: &sym}},
+						Data:   errorVal,
+					}},
+				}},
+			}},
+		},
+	}
+	m, err := xdr.MarshalBase64(meta)
+	require.NoError(t, err)
+
+	changes, err := operationChanges(m)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	assert.Equal(t, ttl, changes[0].Restored.Data)
+	assert.Equal(t, contractData, changes[2].Updated.Data)
+	assert.Equal(t, account, changes[3].Updated.Data)
+}
+
+func TestOperationChanges_invalid(t *testing.T) {
+	encode := func(words ...uint32) string {
+		b := make([]byte, 0, 4*len(words))
+		for _, w := range words {
+			b = append(b, byte(w>>24), byte(w>>16), byte(w>>8), byte(w))
+		}
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	testCases := []struct {
+		name string
+		meta string
+	}{
+		{"not base64", "!"},
+		{"empty", ""},
+		{"future version", encode(5)},
+		{"truncated", encode(2, 0)},
+		{"length exceeds input", encode(2, 0, 0xffffffff)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := operationChanges(tc.meta)
+			assert.ErrorContains(t, err, "unmarshaling result meta: ")
+		})
+	}
+}
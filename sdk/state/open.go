@@ -328,10 +328,11 @@ func (c *Channel) validateOpen(m OpenEnvelope) error {
 	return nil
 }
 
-// ConfirmOpen confirms an open that was proposed.  ConfirmPayment confirms the
-// agreement. The responder to the open process calls this once to sign and
-// store the agreement. The initiator of the open process calls this once with a
-// copy of the agreement signed by the destination to store the destination's signatures.
+// ConfirmOpen confirms an open that was proposed. The responder to the open
+// process calls this once to sign and store the agreement. The initiator of the
+// open process may call this once with a copy of the agreement signed by the
+// destination to store the destination's signatures, although FinalizeOpen is
+// the preferred way to do so.
 func (c *Channel) ConfirmOpen(m OpenEnvelope) (open OpenAgreement, err error) {
 	err = c.validateOpen(m)
 	if err != nil {
@@ -381,3 +382,32 @@ func (c *Channel) ConfirmOpen(m OpenEnvelope) (open OpenAgreement, err error) {
 	c.latestAuthorizedCloseAgreement = c.openAgreement.CloseAgreement()
 	return c.openAgreement, nil
 }
+
+// FinalizeOpen finalizes an open, making it authorized, by attaching the open
+// signatures to the agreement as the confirmers signatures. The proposer of an
+// open calls this once with the confirmers signatures when the confirmer
+// provides them. This can only be used to finalize an open that was proposed
+// by the local participant and that is not yet authorized.
+func (c *Channel) FinalizeOpen(s OpenSignatures) (open OpenAgreement, err error) {
+	if c.openAgreement.Envelope.Empty() {
+		return OpenAgreement{}, fmt.Errorf("no open agreement to finalize")
+	}
+	if c.openAgreement.Envelope.HasAllSignatures() {
+		return OpenAgreement{}, fmt.Errorf("cannot finalize open if channel is already opened")
+	}
+	if !c.openAgreement.Envelope.Details.ProposingSigner.Equal(c.localSigner.FromAddress()) {
+		return OpenAgreement{}, fmt.Errorf("cannot finalize open not proposed by local")
+	}
+
+	// If remote has not signed the txs or signatures is invalid, error as is invalid.
+	err = s.Verify(c.openAgreement.Transactions, c.openAgreement.CloseTransactions, c.remoteSigner)
+	if err != nil {
+		return OpenAgreement{}, fmt.Errorf("not signed by remote: %w", err)
+	}
+
+	// All signatures are present that would be required to submit all
+	// transactions in the open.
+	c.openAgreement.Envelope.ConfirmerSignatures = s
+	c.latestAuthorizedCloseAgreement = c.openAgreement.CloseAgreement()
+	return c.openAgreement, nil
+}
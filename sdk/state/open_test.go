@@ -382,6 +382,90 @@ func TestChannel_ConfirmOpen_signatureChecks(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestChannel_FinalizeOpen(t *testing.T) {
+	localSigner := keypair.MustRandom()
+	remoteSigner := keypair.MustRandom()
+	localChannelAccount := keypair.MustRandom().FromAddress()
+	remoteChannelAccount := keypair.MustRandom().FromAddress()
+
+	responderChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            false,
+		LocalSigner:          localSigner,
+		RemoteSigner:         remoteSigner.FromAddress(),
+		LocalChannelAccount:  localChannelAccount,
+		RemoteChannelAccount: remoteChannelAccount,
+		MaxOpenExpiry:        2 * time.Hour,
+	})
+	initiatorChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            true,
+		LocalSigner:          remoteSigner,
+		RemoteSigner:         localSigner.FromAddress(),
+		LocalChannelAccount:  remoteChannelAccount,
+		RemoteChannelAccount: localChannelAccount,
+		MaxOpenExpiry:        2 * time.Hour,
+	})
+
+	// Finalizing before anything is proposed errors.
+	_, err := initiatorChannel.FinalizeOpen(OpenSignatures{})
+	require.EqualError(t, err, "no open agreement to finalize")
+
+	oa, err := initiatorChannel.ProposeOpen(OpenParams{
+		ObservationPeriodLedgerGap: 10,
+		Asset:                      NativeAsset,
+		ExpiresAt:                  time.Now().Add(5 * time.Minute),
+		StartingSequence:           101,
+	})
+	require.NoError(t, err)
+	oa, err = responderChannel.ConfirmOpen(oa.Envelope)
+	require.NoError(t, err)
+
+	// The confirmer cannot finalize an open it did not propose.
+	_, err = responderChannel.FinalizeOpen(oa.Envelope.ProposerSignatures)
+	require.EqualError(t, err, "cannot finalize open if channel is already opened")
+
+	// Pretend that confirmer did not sign any tx.
+	_, err = initiatorChannel.FinalizeOpen(OpenSignatures{})
+	require.EqualError(t, err, "not signed by remote: verifying declaration signed: signature verification failed")
+
+	// Pretend that the confirmer did not sign a tx.
+	sigs := oa.Envelope.ConfirmerSignatures
+	sigs.Open = nil
+	_, err = initiatorChannel.FinalizeOpen(sigs)
+	require.EqualError(t, err, "not signed by remote: verifying open signed: signature verification failed")
+	sigs = oa.Envelope.ConfirmerSignatures
+	sigs.Declaration = nil
+	_, err = initiatorChannel.FinalizeOpen(sigs)
+	require.EqualError(t, err, "not signed by remote: verifying declaration signed: signature verification failed")
+	sigs = oa.Envelope.ConfirmerSignatures
+	sigs.Close = nil
+	_, err = initiatorChannel.FinalizeOpen(sigs)
+	require.EqualError(t, err, "not signed by remote: verifying close signed: signature verification failed")
+
+	// Pretend that the proposer's own signatures are provided.
+	_, err = initiatorChannel.FinalizeOpen(oa.Envelope.ProposerSignatures)
+	require.EqualError(t, err, "not signed by remote: verifying declaration signed: signature verification failed")
+
+	// Valid confirmer signatures accepted by proposer.
+	finalized, err := initiatorChannel.FinalizeOpen(oa.Envelope.ConfirmerSignatures)
+	require.NoError(t, err)
+	assert.True(t, finalized.Envelope.HasAllSignatures())
+	assert.Equal(t, oa.Envelope, finalized.Envelope)
+	assert.Equal(t, responderChannel.LatestCloseAgreement().Envelope, initiatorChannel.LatestCloseAgreement().Envelope)
+
+	// Both participants produce the same open tx.
+	initiatorOpenTx, err := initiatorChannel.OpenTx()
+	require.NoError(t, err)
+	responderOpenTx, err := responderChannel.OpenTx()
+	require.NoError(t, err)
+	assert.Equal(t, initiatorOpenTx, responderOpenTx)
+
+	// Finalizing a second time errors.
+	_, err = initiatorChannel.FinalizeOpen(oa.Envelope.ConfirmerSignatures)
+	require.EqualError(t, err, "cannot finalize open if channel is already opened")
+}
+
 func TestChannel_OpenTx(t *testing.T) {
 	localSigner := keypair.MustRandom()
 	remoteSigner := keypair.MustRandom()
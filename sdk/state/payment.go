@@ -258,7 +258,9 @@ func (c *Channel) validatePayment(ce CloseEnvelope) (err error) {
 		return fmt.Errorf("cannot confirm payment after an accepted coordinated close")
 	}
 
-	// If the new close agreement details are incorrect, error.
+	// If the new close agreement details are incorrect, error. The iteration
+	// number skips the iteration of the latest payment the local participant
+	// rejected, which the proposer discarded, but no others.
 	if ce.Details.IterationNumber != c.nextIterationNumber() {
 		return fmt.Errorf("invalid payment iteration number, got: %d want: %d", ce.Details.IterationNumber, c.nextIterationNumber())
 	}
@@ -364,6 +366,19 @@ func (c *Channel) ConfirmPayment(ce CloseEnvelope) (closeAgreement CloseAgreemen
 	return c.latestAuthorizedCloseAgreement, nil
 }
 
+// RejectPayment records that the local participant rejected a payment proposed
+// by the remote participant, which the remote participant discards, so that
+// the next payment is expected to use the iteration number after it. The
+// rejection is only recorded if the payment uses the next iteration number, so
+// that the remote participant cannot skip iterations by proposing payments
+// that are rejected.
+func (c *Channel) RejectPayment(ce CloseEnvelope) {
+	if ce.Details.IterationNumber != c.nextIterationNumber() {
+		return
+	}
+	c.latestRejectedIterationNumber = ce.Details.IterationNumber
+}
+
 // FinalizePayment finalizes a payment, making it authorized, by attaching the
 // close signatures to the agreement as the confirmers signatures. The proposer
 // of a payment calls this once with the confirmers signatures when the
@@ -2027,3 +2027,168 @@ func TestChannel_ConfirmPayment_validatePaymentAmount(t *testing.T) {
 	ca, err = initiatorChannel.ConfirmPayment(ca.Envelope)
 	require.NoError(t, err)
 }
+
+func TestChannel_DiscardUnauthorizedCloseAgreement(t *testing.T) {
+	localSigner := keypair.MustRandom()
+	remoteSigner := keypair.MustRandom()
+	localChannelAccount := keypair.MustRandom().FromAddress()
+	remoteChannelAccount := keypair.MustRandom().FromAddress()
+
+	responderChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            false,
+		LocalSigner:          localSigner,
+		RemoteSigner:         remoteSigner.FromAddress(),
+		LocalChannelAccount:  localChannelAccount,
+		RemoteChannelAccount: remoteChannelAccount,
+		MaxOpenExpiry:        2 * time.Hour,
+	})
+	initiatorChannel := NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            true,
+		LocalSigner:          remoteSigner,
+		RemoteSigner:         localSigner.FromAddress(),
+		LocalChannelAccount:  remoteChannelAccount,
+		RemoteChannelAccount: localChannelAccount,
+		MaxOpenExpiry:        2 * time.Hour,
+	})
+
+	// Put channel into the Open state.
+	{
+		m, err := initiatorChannel.ProposeOpen(OpenParams{
+			ObservationPeriodLedgerGap: 10,
+			Asset:                      NativeAsset,
+			ExpiresAt:                  time.Now().Add(5 * time.Minute),
+			StartingSequence:           101,
+		})
+		require.NoError(t, err)
+		m, err = responderChannel.ConfirmOpen(m.Envelope)
+		require.NoError(t, err)
+		_, err = initiatorChannel.FinalizeOpen(m.Envelope.ConfirmerSignatures)
+		require.NoError(t, err)
+
+		ftx, err := initiatorChannel.OpenTx()
+		require.NoError(t, err)
+		ftxXDR, err := ftx.Base64()
+		require.NoError(t, err)
+
+		successResultXDR, err := txbuildtest.BuildResultXDR(true)
+		require.NoError(t, err)
+		resultMetaXDR, err := txbuildtest.BuildOpenResultMetaXDR(txbuildtest.OpenResultMetaParams{
+			InitiatorSigner:         remoteSigner.Address(),
+			ResponderSigner:         localSigner.Address(),
+			InitiatorChannelAccount: remoteChannelAccount.Address(),
+			ResponderChannelAccount: localChannelAccount.Address(),
+			StartSequence:           101,
+			Asset:                   txnbuild.NativeAsset{},
+		})
+		require.NoError(t, err)
+
+		err = responderChannel.IngestTx(1, ftxXDR, successResultXDR, resultMetaXDR)
+		require.NoError(t, err)
+		err = initiatorChannel.IngestTx(1, ftxXDR, successResultXDR, resultMetaXDR)
+		require.NoError(t, err)
+	}
+	initiatorChannel.UpdateLocalChannelAccountBalance(200)
+	responderChannel.UpdateRemoteChannelAccountBalance(100)
+
+	// Discarding when there is nothing to discard is a no-op.
+	_, ok := initiatorChannel.DiscardUnauthorizedCloseAgreement()
+	assert.False(t, ok)
+
+	// Propose a payment the responder cannot accept, which the responder
+	// rejects.
+	ca, err := initiatorChannel.ProposePayment(150)
+	require.NoError(t, err)
+	_, err = responderChannel.ConfirmPayment(ca.Envelope)
+	require.ErrorIs(t, err, ErrUnderfunded)
+	responderChannel.RejectPayment(ca.Envelope)
+
+	// Another payment cannot be proposed while the first is unfinished.
+	_, err = initiatorChannel.ProposePayment(50)
+	require.EqualError(t, err, "cannot start a new payment while an unfinished one exists")
+
+	// Discard the rejected payment.
+	discarded, ok := initiatorChannel.DiscardUnauthorizedCloseAgreement()
+	assert.True(t, ok)
+	assert.Equal(t, ca, discarded)
+	_, ok = initiatorChannel.LatestUnauthorizedCloseAgreement()
+	assert.False(t, ok)
+
+	// A new payment is proposed with the next iteration number, so that it
+	// supersedes the discarded payment the responder holds signatures for,
+	// including after the channel is restored from a snapshot.
+	initiatorChannel = NewChannelFromSnapshot(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            true,
+		LocalSigner:          remoteSigner,
+		RemoteSigner:         localSigner.FromAddress(),
+		LocalChannelAccount:  remoteChannelAccount,
+		RemoteChannelAccount: localChannelAccount,
+		MaxOpenExpiry:        2 * time.Hour,
+	}, initiatorChannel.Snapshot())
+	ca, err = initiatorChannel.ProposePayment(50)
+	require.NoError(t, err)
+	assert.Equal(t, discarded.Envelope.Details.IterationNumber+1, ca.Envelope.Details.IterationNumber)
+
+	// The responder expects the iteration after the rejected payment,
+	// including after the channel is restored from a snapshot, and does not
+	// accept a payment reusing an authorized iteration or skipping ahead.
+	responderChannel = NewChannelFromSnapshot(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		Initiator:            false,
+		LocalSigner:          localSigner,
+		RemoteSigner:         remoteSigner.FromAddress(),
+		LocalChannelAccount:  localChannelAccount,
+		RemoteChannelAccount: remoteChannelAccount,
+		MaxOpenExpiry:        2 * time.Hour,
+	}, responderChannel.Snapshot())
+	stale := ca.Envelope
+	stale.Details.IterationNumber = 1
+	_, err = responderChannel.ConfirmPayment(stale)
+	require.EqualError(t, err, "validating payment: invalid payment iteration number, got: 1 want: 3")
+	skipped := ca.Envelope
+	skipped.Details.IterationNumber = 10
+	_, err = responderChannel.ConfirmPayment(skipped)
+	require.EqualError(t, err, "validating payment: invalid payment iteration number, got: 10 want: 3")
+
+	// Rejecting a payment that skips ahead does not change the iteration the
+	// responder expects.
+	responderChannel.RejectPayment(skipped)
+
+	ca, err = responderChannel.ConfirmPayment(ca.Envelope)
+	require.NoError(t, err)
+	_, err = initiatorChannel.FinalizePayment(ca.Envelope.ConfirmerSignatures)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), initiatorChannel.Balance())
+	assert.Equal(t, int64(50), responderChannel.Balance())
+}
+
+func TestChannel_Capacity(t *testing.T) {
+	initiatorChannel, responderChannel, _ := newOpenedChannels(t)
+
+	send, receive := initiatorChannel.Capacity()
+	assert.Equal(t, int64(1_000_0000000), send)
+	assert.Equal(t, int64(1_000_0000000), receive)
+
+	// Initiator pays responder.
+	ca, err := initiatorChannel.ProposePayment(100)
+	require.NoError(t, err)
+	ca, err = responderChannel.ConfirmPayment(ca.Envelope)
+	require.NoError(t, err)
+	_, err = initiatorChannel.FinalizePayment(ca.Envelope.ConfirmerSignatures)
+	require.NoError(t, err)
+
+	send, receive = initiatorChannel.Capacity()
+	assert.Equal(t, int64(1_000_0000000-100), send)
+	assert.Equal(t, int64(1_000_0000000+100), receive)
+	send, receive = responderChannel.Capacity()
+	assert.Equal(t, int64(1_000_0000000+100), send)
+	assert.Equal(t, int64(1_000_0000000-100), receive)
+
+	// Payments up to the capacity can be proposed, and over it cannot.
+	_, err = responderChannel.ProposePayment(send + 1)
+	assert.ErrorIs(t, err, ErrUnderfunded)
+	_, err = responderChannel.ProposePayment(send)
+	assert.NoError(t, err)
+}
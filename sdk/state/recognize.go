@@ -0,0 +1,137 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/txbuild"
+)
+
+// ChannelTx is a transaction recognized as one of the channel's transactions.
+type ChannelTx struct {
+	Type txbuild.TransactionType
+
+	// IterationNumber is the iteration of a declaration or close
+	// transaction, and zero for other types of transactions.
+	IterationNumber int64
+
+	// Hash is the hash of the transaction, or of the inner transaction if the
+	// transaction is a fee bump, which is the hash the channel's agreements
+	// refer to.
+	Hash TransactionHash
+
+	// FeeBumpHash is the hash of the fee bump transaction if the transaction
+	// is a fee bump, otherwise it is zero.
+	FeeBumpHash TransactionHash
+}
+
+// RecognizeTx returns the type of channel transaction that the transaction is.
+// Fee bump transactions are recognized by their inner transaction. If the
+// transaction is not one of the channel's transactions the type is
+// TransactionTypeUnrecognized.
+//
+// The open transaction is recognized by its hash. Declaration and close
+// transactions are recognized by their sequence number since the transactions
+// of past iterations are not retained, which is consistent with how the
+// channel's state is derived from the initiator's channel account sequence
+// number. Withdrawals are transactions with operations that move funds out of
+// either channel account.
+func (c *Channel) RecognizeTx(txXDR string) (ChannelTx, error) {
+	gtx, err := txnbuild.TransactionFromXDR(txXDR)
+	if err != nil {
+		return ChannelTx{}, fmt.Errorf("parsing transaction xdr: %w", err)
+	}
+	ct := ChannelTx{Type: txbuild.TransactionTypeUnrecognized}
+	var tx *txnbuild.Transaction
+	if feeBump, ok := gtx.FeeBump(); ok {
+		ct.FeeBumpHash, err = feeBump.Hash(c.networkPassphrase)
+		if err != nil {
+			return ChannelTx{}, fmt.Errorf("hashing fee bump transaction: %w", err)
+		}
+		tx = feeBump.InnerTransaction()
+	} else if transaction, ok := gtx.Transaction(); ok {
+		tx = transaction
+	} else {
+		return ChannelTx{}, fmt.Errorf("transaction unrecognized")
+	}
+	ct.Hash, err = tx.Hash(c.networkPassphrase)
+	if err != nil {
+		return ChannelTx{}, fmt.Errorf("hashing transaction: %w", err)
+	}
+
+	// If the channel has no open agreement, no transactions are the
+	// channel's.
+	if c.openAgreement.Envelope.Empty() {
+		return ct, nil
+	}
+
+	if tx.SourceAccount().AccountID == c.initiatorChannelAccount().Address.Address() {
+		startSeq := c.openAgreement.Envelope.Details.StartingSequence
+		seq := tx.SourceAccount().Sequence
+		switch t := txbuild.SequenceNumberToTransactionType(startSeq, seq); t {
+		case txbuild.TransactionTypeOpen:
+			openTx, err := c.OpenTx()
+			if err != nil {
+				return ChannelTx{}, fmt.Errorf("creating open tx: %w", err)
+			}
+			openHash, err := openTx.Hash(c.networkPassphrase)
+			if err != nil {
+				return ChannelTx{}, fmt.Errorf("hashing open tx: %w", err)
+			}
+			if ct.Hash == openHash {
+				ct.Type = txbuild.TransactionTypeOpen
+				return ct, nil
+			}
+		case txbuild.TransactionTypeDeclaration, txbuild.TransactionTypeClose:
+			ct.Type = t
+			ct.IterationNumber = txbuild.SequenceNumberToIterationNumber(startSeq, seq)
+			return ct, nil
+		}
+	}
+
+	if c.isWithdrawal(tx) {
+		ct.Type = txbuild.TransactionTypeWithdrawal
+	}
+	return ct, nil
+}
+
+// isWithdrawal returns true if the transaction contains operations that move
+// funds out of either channel account.
+func (c *Channel) isWithdrawal(tx *txnbuild.Transaction) bool {
+	for _, op := range tx.Operations() {
+		switch op.(type) {
+		case *txnbuild.Payment,
+			*txnbuild.PathPaymentStrictReceive,
+			*txnbuild.PathPaymentStrictSend,
+			*txnbuild.CreateAccount,
+			*txnbuild.AccountMerge,
+			*txnbuild.CreateClaimableBalance:
+		default:
+			continue
+		}
+		source := op.GetSourceAccount()
+		if source == "" {
+			source = tx.SourceAccount().AccountID
+		}
+		address, err := accountAddress(source)
+		if err != nil {
+			continue
+		}
+		if address == c.localChannelAccount.Address.Address() || address == c.remoteChannelAccount.Address.Address() {
+			return true
+		}
+	}
+	return false
+}
+
+// accountAddress returns the G address of the account or muxed account
+// address.
+func accountAddress(address string) (string, error) {
+	ma, err := xdr.AddressToMuxedAccount(address)
+	if err != nil {
+		return "", err
+	}
+	accountID := ma.ToAccountId()
+	return accountID.Address(), nil
+}
@@ -0,0 +1,315 @@
+package state
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"github.com/stellar/starlight/sdk/txbuild"
+	"github.com/stellar/starlight/sdk/txbuild/txbuildtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOpenedChannels returns an initiator and responder channel that are open,
+// along with the open tx.
+func newOpenedChannels(t testing.TB) (initiatorChannel, responderChannel *Channel, openTx *txnbuild.Transaction) {
+	return newOpenedChannelsWithAsset(t, NativeAsset)
+}
+
+// newOpenedChannelsWithAsset returns an initiator and responder channel that
+// are open for the asset, along with the open tx.
+func newOpenedChannelsWithAsset(t testing.TB, asset Asset) (initiatorChannel, responderChannel *Channel, openTx *txnbuild.Transaction) {
+	initiatorSigner := keypair.MustParseFull("SCBMAMOPWKL2YHWELK63VLAY2R74A6GTLLD4ON223B7K5KZ37MUR6IDF")
+	responderSigner := keypair.MustParseFull("SBM7D2IIDSRX5Y3VMTMTXXPB6AIB4WYGZBC2M64U742BNOK32X6SW4NF")
+	initiatorChannelAccount := keypair.MustParseAddress("GAU4CFXQI6HLK5PPY2JWU3GMRJIIQNLF24XRAHX235F7QTG6BEKLGQ36")
+	responderChannelAccount := keypair.MustParseAddress("GBQNGSEHTFC4YGQ3EXHIL7JQBA6265LFANKFFAYKHM7JFGU5CORROEGO")
+
+	initiatorChannel = NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            true,
+		LocalSigner:          initiatorSigner,
+		RemoteSigner:         responderSigner.FromAddress(),
+		LocalChannelAccount:  initiatorChannelAccount,
+		RemoteChannelAccount: responderChannelAccount,
+	})
+	responderChannel = NewChannel(Config{
+		NetworkPassphrase:    network.TestNetworkPassphrase,
+		MaxOpenExpiry:        time.Hour,
+		Initiator:            false,
+		LocalSigner:          responderSigner,
+		RemoteSigner:         initiatorSigner.FromAddress(),
+		LocalChannelAccount:  responderChannelAccount,
+		RemoteChannelAccount: initiatorChannelAccount,
+	})
+	open, err := initiatorChannel.ProposeOpen(OpenParams{
+		ObservationPeriodTime:      1,
+		ObservationPeriodLedgerGap: 1,
+		ExpiresAt:                  time.Now().Add(time.Minute),
+		StartingSequence:           28037546508289,
+		Asset:                      asset,
+	})
+	require.NoError(t, err)
+	open, err = responderChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	_, err = initiatorChannel.ConfirmOpen(open.Envelope)
+	require.NoError(t, err)
+	initiatorChannel.UpdateLocalChannelAccountBalance(1_000_0000000)
+	initiatorChannel.UpdateRemoteChannelAccountBalance(1_000_0000000)
+	responderChannel.UpdateLocalChannelAccountBalance(1_000_0000000)
+	responderChannel.UpdateRemoteChannelAccountBalance(1_000_0000000)
+
+	openTx, err = initiatorChannel.OpenTx()
+	require.NoError(t, err)
+
+	// Mock the channels ingested the open tx successfully.
+	initiatorChannel.openExecutedAndValidated = true
+	responderChannel.openExecutedAndValidated = true
+	initiatorChannel.initiatorChannelAccount().SequenceNumber = openTx.SequenceNumber()
+	responderChannel.initiatorChannelAccount().SequenceNumber = openTx.SequenceNumber()
+	return initiatorChannel, responderChannel, openTx
+}
+
+func feeBumpXDR(t testing.TB, tx *txnbuild.Transaction) (string, *txnbuild.FeeBumpTransaction) {
+	feeAccount := keypair.MustRandom()
+	feeBump, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      tx,
+		BaseFee:    txnbuild.MinBaseFee,
+		FeeAccount: feeAccount.Address(),
+	})
+	require.NoError(t, err)
+	feeBump, err = feeBump.Sign(network.TestNetworkPassphrase, feeAccount)
+	require.NoError(t, err)
+	feeBumpXDR, err := feeBump.Base64()
+	require.NoError(t, err)
+	return feeBumpXDR, feeBump
+}
+
+func TestChannel_RecognizeTx_open(t *testing.T) {
+	initiatorChannel, responderChannel, openTx := newOpenedChannels(t)
+	openTxHash, err := openTx.Hash(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	openTxXDR, err := openTx.Base64()
+	require.NoError(t, err)
+
+	for _, c := range []*Channel{initiatorChannel, responderChannel} {
+		ct, err := c.RecognizeTx(openTxXDR)
+		require.NoError(t, err)
+		assert.Equal(t, ChannelTx{Type: txbuild.TransactionTypeOpen, Hash: openTxHash}, ct)
+
+		// A fee bump of the open tx is recognized by its inner tx.
+		openFeeBumpXDR, openFeeBump := feeBumpXDR(t, openTx)
+		openFeeBumpHash, err := openFeeBump.Hash(network.TestNetworkPassphrase)
+		require.NoError(t, err)
+		ct, err = c.RecognizeTx(openFeeBumpXDR)
+		require.NoError(t, err)
+		assert.Equal(t, ChannelTx{Type: txbuild.TransactionTypeOpen, Hash: openTxHash, FeeBumpHash: openFeeBumpHash}, ct)
+	}
+}
+
+func TestChannel_RecognizeTx_declarationAndCloseProperty(t *testing.T) {
+	initiatorChannel, responderChannel, _ := newOpenedChannels(t)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		// Make a random payment in a random direction.
+		proposer, confirmer := initiatorChannel, responderChannel
+		if r.Intn(2) == 1 {
+			proposer, confirmer = responderChannel, initiatorChannel
+		}
+		ca, err := proposer.ProposePayment(r.Int63n(10) + 1)
+		require.NoError(t, err)
+		ca, err = confirmer.ConfirmPayment(ca.Envelope)
+		require.NoError(t, err)
+		_, err = proposer.ConfirmPayment(ca.Envelope)
+		require.NoError(t, err)
+		iteration := ca.Envelope.Details.IterationNumber
+
+		// The declaration and close txs of every agreement are recognized by
+		// both participants as belonging to the iteration of the agreement,
+		// whether submitted directly or wrapped in a fee bump.
+		declTx, closeTx, err := proposer.CloseTxs()
+		require.NoError(t, err)
+		for _, tc := range []struct {
+			tx       *txnbuild.Transaction
+			wantType txbuild.TransactionType
+		}{
+			{declTx, txbuild.TransactionTypeDeclaration},
+			{closeTx, txbuild.TransactionTypeClose},
+		} {
+			txHash, err := tc.tx.Hash(network.TestNetworkPassphrase)
+			require.NoError(t, err)
+			txXDR, err := tc.tx.Base64()
+			require.NoError(t, err)
+			txFeeBumpXDR, txFeeBump := feeBumpXDR(t, tc.tx)
+			txFeeBumpHash, err := txFeeBump.Hash(network.TestNetworkPassphrase)
+			require.NoError(t, err)
+
+			for _, c := range []*Channel{initiatorChannel, responderChannel} {
+				ct, err := c.RecognizeTx(txXDR)
+				require.NoError(t, err)
+				assert.Equal(t, ChannelTx{Type: tc.wantType, IterationNumber: iteration, Hash: txHash}, ct)
+
+				ct, err = c.RecognizeTx(txFeeBumpXDR)
+				require.NoError(t, err)
+				assert.Equal(t, ChannelTx{Type: tc.wantType, IterationNumber: iteration, Hash: txHash, FeeBumpHash: txFeeBumpHash}, ct)
+			}
+		}
+	}
+}
+
+func TestChannel_RecognizeTx_withdrawal(t *testing.T) {
+	initiatorChannel, responderChannel, _ := newOpenedChannels(t)
+
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{AccountID: keypair.MustRandom().Address(), Sequence: 1},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.Payment{
+				SourceAccount: responderChannel.localChannelAccount.Address.Address(),
+				Destination:   keypair.MustRandom().Address(),
+				Amount:        "1",
+				Asset:         txnbuild.NativeAsset{},
+			},
+		},
+	})
+	require.NoError(t, err)
+	txHash, err := tx.Hash(network.TestNetworkPassphrase)
+	require.NoError(t, err)
+	txXDR, err := tx.Base64()
+	require.NoError(t, err)
+
+	for _, c := range []*Channel{initiatorChannel, responderChannel} {
+		ct, err := c.RecognizeTx(txXDR)
+		require.NoError(t, err)
+		assert.Equal(t, ChannelTx{Type: txbuild.TransactionTypeWithdrawal, Hash: txHash}, ct)
+	}
+}
+
+func TestChannel_RecognizeTx_unrecognized(t *testing.T) {
+	initiatorChannel, _, openTx := newOpenedChannels(t)
+
+	// A tx of another account.
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{AccountID: keypair.MustRandom().Address(), Sequence: 1},
+		BaseFee:       txnbuild.MinBaseFee,
+		Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.BumpSequence{BumpTo: 2},
+		},
+	})
+	require.NoError(t, err)
+	txXDR, err := tx.Base64()
+	require.NoError(t, err)
+	ct, err := initiatorChannel.RecognizeTx(txXDR)
+	require.NoError(t, err)
+	assert.Equal(t, txbuild.TransactionTypeUnrecognized, ct.Type)
+
+	// A tx of the initiator channel account with the open tx's sequence
+	// number that is not the open tx.
+	tx, err = txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{
+			AccountID: initiatorChannel.initiatorChannelAccount().Address.Address(),
+			Sequence:  openTx.SequenceNumber() - 1,
+		},
+		IncrementSequenceNum: true,
+		BaseFee:              txnbuild.MinBaseFee,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+		Operations: []txnbuild.Operation{
+			&txnbuild.BumpSequence{BumpTo: 2},
+		},
+	})
+	require.NoError(t, err)
+	txXDR, err = tx.Base64()
+	require.NoError(t, err)
+	ct, err = initiatorChannel.RecognizeTx(txXDR)
+	require.NoError(t, err)
+	assert.Equal(t, txbuild.TransactionTypeUnrecognized, ct.Type)
+
+	// Invalid XDR.
+	_, err = initiatorChannel.RecognizeTx("AAAA")
+	require.Error(t, err)
+}
+
+// FuzzChannel_IngestTx ingests txs of the initiator channel account generated
+// with fuzzed sequence numbers, results, balances, and meta versions, and checks that they
+// are recognized consistently with the sequence number and that balances are
+// ingested. The XDR is generated rather than fuzzed directly because the XDR
+// decoder allocates based on untrusted lengths.
+func FuzzChannel_IngestTx(f *testing.F) {
+	f.Add(int64(0), true, false, int64(100), uint8(0))
+	f.Add(int64(0), false, true, int64(100), uint8(0))
+	f.Add(int64(1), true, false, int64(100), uint8(1))
+	f.Add(int64(2), true, false, int64(0), uint8(2))
+	f.Add(int64(3), false, false, int64(100), uint8(3))
+	f.Add(int64(4), true, true, int64(100), uint8(4))
+	f.Add(int64(-1), true, false, int64(100), uint8(4))
+
+	f.Fuzz(func(t *testing.T, seqOffset int64, successful bool, feeBump bool, balance int64, metaVersion uint8) {
+		if seqOffset < -1000 || seqOffset > 1000 || balance < 0 || metaVersion > 4 {
+			t.Skip()
+		}
+		initiatorChannel, responderChannel, openTx := newOpenedChannels(t)
+		initiatorChannelAccount := initiatorChannel.localChannelAccount.Address.Address()
+		seq := openTx.SequenceNumber() + seqOffset
+
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount: &txnbuild.SimpleAccount{AccountID: initiatorChannelAccount, Sequence: seq},
+			BaseFee:       txnbuild.MinBaseFee,
+			Preconditions: txnbuild.Preconditions{TimeBounds: txnbuild.NewInfiniteTimeout()},
+			Operations: []txnbuild.Operation{
+				&txnbuild.BumpSequence{BumpTo: 0},
+			},
+		})
+		require.NoError(t, err)
+		txHash, err := tx.Hash(network.TestNetworkPassphrase)
+		require.NoError(t, err)
+		txXDR, err := tx.Base64()
+		require.NoError(t, err)
+		if feeBump {
+			txXDR, _ = feeBumpXDR(t, tx)
+		}
+		resultXDR, err := txbuildtest.BuildResultXDR(successful)
+		require.NoError(t, err)
+		resultMetaXDR, err := txbuildtest.BuildResultMetaXDRVersion(int32(metaVersion), []xdr.LedgerEntryData{
+			{
+				Type: xdr.LedgerEntryTypeAccount,
+				Account: &xdr.AccountEntry{
+					AccountId: xdr.MustAddress(initiatorChannelAccount),
+					Balance:   xdr.Int64(balance),
+					SeqNum:    xdr.SequenceNumber(seq),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		// The tx is not the open tx, so it is only recognized as a
+		// declaration or close by its sequence number.
+		wantType := txbuild.SequenceNumberToTransactionType(openTx.SequenceNumber(), seq)
+		if wantType == txbuild.TransactionTypeOpen {
+			wantType = txbuild.TransactionTypeUnrecognized
+		}
+
+		for _, c := range []*Channel{initiatorChannel, responderChannel} {
+			ct, err := c.RecognizeTx(txXDR)
+			require.NoError(t, err)
+			assert.Equal(t, wantType, ct.Type)
+			assert.Equal(t, TransactionHash(txHash), ct.Hash)
+			assert.Equal(t, feeBump, ct.FeeBumpHash != TransactionHash{})
+			if wantType == txbuild.TransactionTypeDeclaration || wantType == txbuild.TransactionTypeClose {
+				assert.Equal(t, seqOffset/2, ct.IterationNumber)
+			}
+
+			err = c.IngestTx(1, txXDR, resultXDR, resultMetaXDR)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, balance, initiatorChannel.localChannelAccount.Balance)
+		assert.Equal(t, balance, responderChannel.remoteChannelAccount.Balance)
+	})
+}
@@ -53,6 +53,10 @@ type Snapshot struct {
 
 	LatestAuthorizedCloseAgreement   CloseAgreement
 	LatestUnauthorizedCloseAgreement CloseAgreement
+	DiscardedCloseAgreements         []CloseAgreement `json:",omitempty"`
+	LatestRejectedIterationNumber    int64            `json:",omitempty"`
+
+	Compromises []Compromise `json:",omitempty"`
 }
 
 // NewChannelFromSnapshot creates the channel with the given config, and
@@ -77,6 +81,10 @@ func NewChannelFromSnapshot(c Config, s Snapshot) *Channel {
 
 	channel.latestAuthorizedCloseAgreement = s.LatestAuthorizedCloseAgreement
 	channel.latestUnauthorizedCloseAgreement = s.LatestUnauthorizedCloseAgreement
+	channel.discardedCloseAgreements = s.DiscardedCloseAgreements
+	channel.latestRejectedIterationNumber = s.LatestRejectedIterationNumber
+
+	channel.compromises = s.Compromises
 
 	return channel
 }
@@ -110,8 +118,23 @@ type Channel struct {
 	openExecutedAndValidated bool
 	openExecutedWithError    error
 
+	compromises []Compromise
+
 	latestAuthorizedCloseAgreement   CloseAgreement
 	latestUnauthorizedCloseAgreement CloseAgreement
+
+	// discardedCloseAgreements are the unauthorized close agreements discarded
+	// since the latest authorized close agreement, which the remote
+	// participant holds the local participant's signatures for. Their
+	// iteration numbers must not be reused, and if the remote participant
+	// submits the declaration of one the agreement is authorized when the
+	// declaration is ingested.
+	discardedCloseAgreements []CloseAgreement
+
+	// latestRejectedIterationNumber is the iteration number of the latest
+	// payment the local participant rejected, which the remote participant
+	// discards and so must not be reused.
+	latestRejectedIterationNumber int64
 }
 
 // Snapshot returns a snapshot of the channel's internal state that if combined
@@ -132,6 +155,10 @@ func (c *Channel) Snapshot() Snapshot {
 
 		LatestAuthorizedCloseAgreement:   c.latestAuthorizedCloseAgreement,
 		LatestUnauthorizedCloseAgreement: c.latestUnauthorizedCloseAgreement,
+		DiscardedCloseAgreements:         c.discardedCloseAgreements,
+		LatestRejectedIterationNumber:    c.latestRejectedIterationNumber,
+
+		Compromises: c.Compromises(),
 	}
 }
 
@@ -147,6 +174,27 @@ const (
 	StateClosed
 )
 
+func (s State) String() string {
+	switch s {
+	case StateError:
+		return "error"
+	case StateNone:
+		return "none"
+	case StateOpen:
+		return "open"
+	case StateClosingWithOutdatedState:
+		return "closing_with_outdated_state"
+	case StateClosedWithOutdatedState:
+		return "closed_with_outdated_state"
+	case StateClosing:
+		return "closing"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
 // State returns a single value representing the overall state of the
 // channel. If there was an error finding the state, or internal values are
 // unexpected, then a failed channel state is returned, indicating something is
@@ -200,12 +248,23 @@ func (c *Channel) IsInitiator() bool {
 
 // nextIterationNumber returns the next iteration number for the channel. If
 // there is a pending unauthorized close agreement, then that agreement
-// iteration is used, else the latest authorized agreeement is used.
+// iteration is used, else the iteration after the latest authorized
+// agreeement, or after the latest discarded or rejected agreement if later, is
+// used.
 func (c *Channel) nextIterationNumber() int64 {
 	if !c.latestUnauthorizedCloseAgreement.Envelope.Empty() {
 		return c.latestUnauthorizedCloseAgreement.Envelope.Details.IterationNumber
 	}
-	return c.latestAuthorizedCloseAgreement.Envelope.Details.IterationNumber + 1
+	i := c.latestAuthorizedCloseAgreement.Envelope.Details.IterationNumber
+	if n := len(c.discardedCloseAgreements); n > 0 {
+		if d := c.discardedCloseAgreements[n-1].Envelope.Details.IterationNumber; d > i {
+			i = d
+		}
+	}
+	if c.latestRejectedIterationNumber > i {
+		i = c.latestRejectedIterationNumber
+	}
+	return i + 1
 }
 
 // Balance returns the amount owing from the initiator to the responder, if positive, or
@@ -214,6 +273,23 @@ func (c *Channel) Balance() int64 {
 	return c.latestAuthorizedCloseAgreement.Envelope.Details.Balance
 }
 
+// Capacity returns the largest payment that the local participant can
+// propose, and the largest payment the remote participant can propose, given
+// the balance of the latest authorized close agreement and the balances of
+// the channel accounts.
+func (c *Channel) Capacity() (send, receive int64) {
+	balance := c.Balance()
+	send = c.localChannelAccount.Balance - c.amountToRemote(balance) + c.amountToLocal(balance)
+	receive = c.remoteChannelAccount.Balance - c.amountToLocal(balance) + c.amountToRemote(balance)
+	if send < 0 {
+		send = 0
+	}
+	if receive < 0 {
+		receive = 0
+	}
+	return send, receive
+}
+
 // OpenAgreement returns the open agreement used to open the channel.
 func (c *Channel) OpenAgreement() OpenAgreement {
 	return c.openAgreement
@@ -231,6 +307,45 @@ func (c *Channel) LatestUnauthorizedCloseAgreement() (CloseAgreement, bool) {
 	return c.latestUnauthorizedCloseAgreement, !c.latestUnauthorizedCloseAgreement.Envelope.Empty()
 }
 
+// DiscardUnauthorizedCloseAgreement discards the latest unauthorized close
+// agreement, if any, returning the agreement discarded. It should only be
+// used when the remote participant has rejected the agreement, so that a new
+// payment or close can be proposed in its place.
+//
+// The remote participant still holds the local participant's signatures for
+// the discarded agreement, and could use them to close the channel with it
+// until an agreement with a later iteration number has been authorized. The
+// next payment proposed therefore uses an iteration number after the
+// discarded agreement's, so that it supersedes the discarded agreement, and
+// the channel keeps the discarded agreement so that if the remote participant
+// submits its declaration the agreement is authorized when the declaration is
+// ingested.
+func (c *Channel) DiscardUnauthorizedCloseAgreement() (CloseAgreement, bool) {
+	ca := c.latestUnauthorizedCloseAgreement
+	c.latestUnauthorizedCloseAgreement = CloseAgreement{}
+	c.pruneDiscardedCloseAgreements()
+	if !ca.Envelope.Empty() && ca.Envelope.Details.IterationNumber > c.latestAuthorizedCloseAgreement.Envelope.Details.IterationNumber {
+		c.discardedCloseAgreements = append(c.discardedCloseAgreements, ca)
+	}
+	return ca, !ca.Envelope.Empty()
+}
+
+// pruneDiscardedCloseAgreements removes the discarded close agreements that
+// have been superseded by the latest authorized close agreement.
+func (c *Channel) pruneDiscardedCloseAgreements() {
+	i := c.latestAuthorizedCloseAgreement.Envelope.Details.IterationNumber
+	kept := c.discardedCloseAgreements[:0]
+	for _, ca := range c.discardedCloseAgreements {
+		if ca.Envelope.Details.IterationNumber > i {
+			kept = append(kept, ca)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	c.discardedCloseAgreements = kept
+}
+
 // UpdateLocalChannelAccountBalance updates the local channel account balance.
 func (c *Channel) UpdateLocalChannelAccountBalance(balance int64) {
 	c.localChannelAccount.Balance = balance
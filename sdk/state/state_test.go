@@ -250,3 +250,9 @@ func TestNewChannelWithSnapshot(t *testing.T) {
 	assertChannelSnapshotsAndRestores(t, localConfig, localChannel)
 	assertChannelSnapshotsAndRestores(t, remoteConfig, remoteChannel)
 }
+
+func TestState_String(t *testing.T) {
+	assert.Equal(t, "open", StateOpen.String())
+	assert.Equal(t, "closing_with_outdated_state", StateClosingWithOutdatedState.String())
+	assert.Equal(t, "State(10)", State(10).String())
+}
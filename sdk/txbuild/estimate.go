@@ -0,0 +1,100 @@
+package txbuild
+
+import (
+	"fmt"
+)
+
+// DefaultBaseReserve is the base reserve of the Stellar network at the time of
+// writing, in stroops.
+const DefaultBaseReserve = 5_000_000
+
+type EstimateParams struct {
+	// NumAssets is the number of non-native assets that the channel accounts
+	// hold trustlines for. A channel for the native asset has zero.
+	NumAssets int
+	// BaseFee is the base fee in stroops of the fee bump transactions that
+	// pay the fees of the channel's transactions.
+	BaseFee int64
+	// BaseReserve is the base reserve in stroops, defaulting to
+	// DefaultBaseReserve if zero.
+	BaseReserve int64
+}
+
+// Estimate is the cost of a channel's lifecycle to each participant.
+type Estimate struct {
+	// SponsoredReserves is the number of base reserves that each participant
+	// sponsors while the channel is open, and SponsoredReservesAmount is
+	// their value in stroops. The reserves are held by the account that
+	// created the participant's channel account, and are released when the
+	// channel account is retired.
+	SponsoredReserves       int64
+	SponsoredReservesAmount int64
+
+	// OpenOperations, DeclarationOperations, and CloseOperations are the
+	// number of operations in each transaction.
+	OpenOperations        int
+	DeclarationOperations int
+	CloseOperations       int
+
+	// OpenFee, DeclarationFee, and CloseFee are the fees in stroops of the
+	// fee bump transactions that submit each transaction. TotalFee is the
+	// sum of the fees for a channel that is opened and closed once.
+	OpenFee        int64
+	DeclarationFee int64
+	CloseFee       int64
+	TotalFee       int64
+}
+
+// EstimateChannel estimates the reserves that each participant sponsors and
+// the fees that are paid to open and close a channel.
+//
+// Each participant sponsors for their own channel account the account's two
+// base reserves, their signer, and a trustline for each asset, and for the
+// other participant's channel account their signer.
+//
+// The channel's transactions have a zero fee and are submitted in fee bump
+// transactions, which are charged the base fee for each operation of the
+// inner transaction and for the fee bump itself. The close is estimated with
+// the payment that settles a non-zero balance. Transactions that are
+// resubmitted, and declarations and closes of earlier agreements submitted
+// by a participant that is not cooperating, cost more.
+func EstimateChannel(p EstimateParams) (Estimate, error) {
+	if p.NumAssets < 0 {
+		return Estimate{}, fmt.Errorf("invalid number of assets: cannot be negative")
+	}
+	if p.BaseFee < 0 || p.BaseReserve < 0 {
+		return Estimate{}, fmt.Errorf("invalid base fee or base reserve: cannot be negative")
+	}
+	baseReserve := p.BaseReserve
+	if baseReserve == 0 {
+		baseReserve = DefaultBaseReserve
+	}
+	numAssets := int64(p.NumAssets)
+
+	e := Estimate{}
+	e.SponsoredReserves = 2 + 1 + numAssets + 1
+	e.SponsoredReservesAmount = e.SponsoredReserves * baseReserve
+
+	// The open contains for each participant a sponsorship of their signer
+	// and trustlines on their channel account, and a sponsorship of their
+	// signer on the other participant's channel account, each sponsorship
+	// beginning and ending with an operation.
+	e.OpenOperations = 2 * ((2 + 1 + p.NumAssets) + (2 + 1))
+	// The declaration bumps the sequence number.
+	e.DeclarationOperations = 1
+	// The close sets the options of each channel account and pays the
+	// balance.
+	e.CloseOperations = 2 + 1
+
+	e.OpenFee = feeBumpFee(p.BaseFee, e.OpenOperations)
+	e.DeclarationFee = feeBumpFee(p.BaseFee, e.DeclarationOperations)
+	e.CloseFee = feeBumpFee(p.BaseFee, e.CloseOperations)
+	e.TotalFee = e.OpenFee + e.DeclarationFee + e.CloseFee
+	return e, nil
+}
+
+// feeBumpFee returns the fee of a fee bump transaction for an inner
+// transaction with the number of operations.
+func feeBumpFee(baseFee int64, ops int) int64 {
+	return baseFee * int64(ops+1)
+}
@@ -0,0 +1,114 @@
+package txbuild
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateChannel(t *testing.T) {
+	e, err := EstimateChannel(EstimateParams{NumAssets: 1, BaseFee: 100})
+	require.NoError(t, err)
+	assert.Equal(t, Estimate{
+		SponsoredReserves:       5,
+		SponsoredReservesAmount: 25_000_000,
+		OpenOperations:          14,
+		DeclarationOperations:   1,
+		CloseOperations:         3,
+		OpenFee:                 1500,
+		DeclarationFee:          200,
+		CloseFee:                400,
+		TotalFee:                2100,
+	}, e)
+
+	e, err = EstimateChannel(EstimateParams{BaseFee: 100, BaseReserve: 1_000_000})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), e.SponsoredReserves)
+	assert.Equal(t, int64(4_000_000), e.SponsoredReservesAmount)
+	assert.Equal(t, 12, e.OpenOperations)
+
+	_, err = EstimateChannel(EstimateParams{NumAssets: -1})
+	assert.EqualError(t, err, "invalid number of assets: cannot be negative")
+	_, err = EstimateChannel(EstimateParams{BaseFee: -1})
+	assert.EqualError(t, err, "invalid base fee or base reserve: cannot be negative")
+}
+
+// TestEstimateChannel_matchesTxs checks that the estimate matches the
+// transactions built for a channel.
+func TestEstimateChannel_matchesTxs(t *testing.T) {
+	const baseFee = 250
+	feeAccount := keypair.MustRandom()
+	initiatorSigner := keypair.MustRandom().FromAddress()
+	responderSigner := keypair.MustRandom().FromAddress()
+	initiatorChannelAccount := keypair.MustRandom().FromAddress()
+	responderChannelAccount := keypair.MustRandom().FromAddress()
+
+	testCases := []struct {
+		asset     txnbuild.Asset
+		numAssets int
+	}{
+		{txnbuild.NativeAsset{}, 0},
+		{txnbuild.CreditAsset{Code: "ETH", Issuer: "GBTYEE5BTST64JCBUXVAEEPQJAY3TNV47A5JFUMQKNDWUJRRT6LUVEQH"}, 1},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.numAssets), func(t *testing.T) {
+			e, err := EstimateChannel(EstimateParams{NumAssets: tc.numAssets, BaseFee: baseFee})
+			require.NoError(t, err)
+
+			open, err := Open(OpenParams{
+				InitiatorSigner:         initiatorSigner,
+				ResponderSigner:         responderSigner,
+				InitiatorChannelAccount: initiatorChannelAccount,
+				ResponderChannelAccount: responderChannelAccount,
+				StartSequence:           101,
+				Asset:                   tc.asset,
+				ExpiresAt:               time.Now().Add(time.Minute),
+				ConfirmingSigner:        responderSigner,
+			})
+			require.NoError(t, err)
+			decl, err := Declaration(DeclarationParams{
+				InitiatorChannelAccount: initiatorChannelAccount,
+				StartSequence:           101,
+				IterationNumber:         1,
+				ConfirmingSigner:        responderSigner,
+			})
+			require.NoError(t, err)
+			closeTx, err := Close(CloseParams{
+				InitiatorSigner:         initiatorSigner,
+				ResponderSigner:         responderSigner,
+				InitiatorChannelAccount: initiatorChannelAccount,
+				ResponderChannelAccount: responderChannelAccount,
+				StartSequence:           101,
+				IterationNumber:         1,
+				AmountToResponder:       100,
+				Asset:                   tc.asset,
+			})
+			require.NoError(t, err)
+
+			for _, c := range []struct {
+				tx      *txnbuild.Transaction
+				wantOps int
+				wantFee int64
+			}{
+				{open, e.OpenOperations, e.OpenFee},
+				{decl, e.DeclarationOperations, e.DeclarationFee},
+				{closeTx, e.CloseOperations, e.CloseFee},
+			} {
+				assert.Len(t, c.tx.Operations(), c.wantOps)
+				fbtx, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+					Inner:      c.tx,
+					FeeAccount: feeAccount.Address(),
+					BaseFee:    baseFee,
+				})
+				require.NoError(t, err)
+				env := fbtx.ToXDR()
+				assert.Equal(t, c.wantFee, int64(env.FeeBump.Tx.Fee))
+			}
+		})
+	}
+}
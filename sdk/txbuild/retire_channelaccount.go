@@ -0,0 +1,76 @@
+package txbuild
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+)
+
+type RetireChannelAccountParams struct {
+	ChannelAccount *keypair.FromAddress
+	Owner          *keypair.FromAddress
+	SequenceNumber int64
+	Asset          txnbuild.Asset
+	AssetBalance   int64
+}
+
+// RetireChannelAccount builds a transaction that tears down a channel account
+// once its channel has closed, returning the asset and the reserves to the
+// owner. The owner is the account that created and sponsors the channel
+// account. The transaction's source is the channel account, and it must be
+// signed by the channel account's signer, which after close is the owner's
+// signer.
+//
+// If the asset is not native, the asset balance is paid to the owner and the
+// trustline is removed, releasing the trustline's sponsored reserve. The
+// channel account is then merged into the owner, releasing the sponsored
+// reserves of the account and its signer, and paying any remaining native
+// balance to the owner. The sponsorships are released by removing the sponsored
+// entries rather than by revoking them, since revoking would transfer the
+// reserves to the channel account, which holds no native balance to pay them.
+func RetireChannelAccount(p RetireChannelAccountParams) (*txnbuild.Transaction, error) {
+	if p.AssetBalance < 0 {
+		return nil, fmt.Errorf("invalid asset balance: cannot be negative")
+	}
+
+	ops := []txnbuild.Operation{}
+	if !p.Asset.IsNative() {
+		if p.AssetBalance > 0 {
+			ops = append(ops, &txnbuild.Payment{
+				SourceAccount: p.ChannelAccount.Address(),
+				Destination:   p.Owner.Address(),
+				Asset:         p.Asset,
+				Amount:        amount.StringFromInt64(p.AssetBalance),
+			})
+		}
+		ops = append(ops, &txnbuild.ChangeTrust{
+			SourceAccount: p.ChannelAccount.Address(),
+			Line:          p.Asset.MustToChangeTrustAsset(),
+			Limit:         "0",
+		})
+	}
+	ops = append(ops, &txnbuild.AccountMerge{
+		SourceAccount: p.ChannelAccount.Address(),
+		Destination:   p.Owner.Address(),
+	})
+
+	tx, err := txnbuild.NewTransaction(
+		txnbuild.TransactionParams{
+			SourceAccount: &txnbuild.SimpleAccount{
+				AccountID: p.ChannelAccount.Address(),
+				Sequence:  p.SequenceNumber,
+			},
+			BaseFee: 0,
+			Preconditions: txnbuild.Preconditions{
+				TimeBounds: txnbuild.NewTimeout(300),
+			},
+			Operations: ops,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
@@ -0,0 +1,89 @@
+package txbuild
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetireChannelAccount(t *testing.T) {
+	channelAccount := keypair.MustRandom().FromAddress()
+	owner := keypair.MustRandom().FromAddress()
+	asset := txnbuild.CreditAsset{Code: "ETH", Issuer: "GBTYEE5BTST64JCBUXVAEEPQJAY3TNV47A5JFUMQKNDWUJRRT6LUVEQH"}
+
+	t.Run("credit asset", func(t *testing.T) {
+		tx, err := RetireChannelAccount(RetireChannelAccountParams{
+			ChannelAccount: channelAccount,
+			Owner:          owner,
+			SequenceNumber: 102,
+			Asset:          asset,
+			AssetBalance:   100,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, channelAccount.Address(), tx.SourceAccount().AccountID)
+		assert.Equal(t, int64(102), tx.SequenceNumber())
+		assert.Equal(t, int64(0), tx.BaseFee())
+
+		ops := tx.Operations()
+		require.Len(t, ops, 3)
+		assert.Equal(t, &txnbuild.Payment{
+			SourceAccount: channelAccount.Address(),
+			Destination:   owner.Address(),
+			Asset:         asset,
+			Amount:        "0.0000100",
+		}, ops[0])
+		changeTrust, ok := ops[1].(*txnbuild.ChangeTrust)
+		require.True(t, ok)
+		assert.Equal(t, channelAccount.Address(), changeTrust.SourceAccount)
+		assert.Equal(t, "0", changeTrust.Limit)
+		assert.Equal(t, &txnbuild.AccountMerge{
+			SourceAccount: channelAccount.Address(),
+			Destination:   owner.Address(),
+		}, ops[2])
+	})
+
+	t.Run("credit asset without balance", func(t *testing.T) {
+		tx, err := RetireChannelAccount(RetireChannelAccountParams{
+			ChannelAccount: channelAccount,
+			Owner:          owner,
+			SequenceNumber: 102,
+			Asset:          asset,
+		})
+		require.NoError(t, err)
+		ops := tx.Operations()
+		require.Len(t, ops, 2)
+		assert.IsType(t, &txnbuild.ChangeTrust{}, ops[0])
+		assert.IsType(t, &txnbuild.AccountMerge{}, ops[1])
+	})
+
+	t.Run("native asset", func(t *testing.T) {
+		tx, err := RetireChannelAccount(RetireChannelAccountParams{
+			ChannelAccount: channelAccount,
+			Owner:          owner,
+			SequenceNumber: 102,
+			Asset:          txnbuild.NativeAsset{},
+			AssetBalance:   100,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []txnbuild.Operation{
+			&txnbuild.AccountMerge{
+				SourceAccount: channelAccount.Address(),
+				Destination:   owner.Address(),
+			},
+		}, tx.Operations())
+	})
+
+	t.Run("negative balance", func(t *testing.T) {
+		_, err := RetireChannelAccount(RetireChannelAccountParams{
+			ChannelAccount: channelAccount,
+			Owner:          owner,
+			SequenceNumber: 102,
+			Asset:          asset,
+			AssetBalance:   -1,
+		})
+		assert.EqualError(t, err, "invalid asset balance: cannot be negative")
+	})
+}
@@ -15,11 +15,18 @@ const (
 	TransactionTypeOpen         TransactionType = "open"
 	TransactionTypeDeclaration  TransactionType = "declaration"
 	TransactionTypeClose        TransactionType = "close"
+
+	// TransactionTypeWithdrawal is a transaction of a channel account that
+	// is not one of the channel's open, declaration, or close transactions.
+	// It cannot be identified by sequence number alone.
+	TransactionTypeWithdrawal TransactionType = "withdrawal"
 )
 
 func SequenceNumberToTransactionType(startingSeqNum, seqNum int64) TransactionType {
 	seqRelative := seqNum - startingSeqNum
-	if seqRelative == 0 {
+	if seqRelative < 0 {
+		return TransactionTypeUnrecognized
+	} else if seqRelative == 0 {
 		return TransactionTypeOpen
 	} else if seqRelative > 0 && seqRelative < m {
 		return TransactionTypeUnrecognized
@@ -30,3 +37,9 @@ func SequenceNumberToTransactionType(startingSeqNum, seqNum int64) TransactionTy
 	}
 	panic(fmt.Errorf("unhandled sequence number: startingSeqNum=%d seqNum=%d", startingSeqNum, seqNum))
 }
+
+// SequenceNumberToIterationNumber returns the iteration number of the
+// declaration or close transaction with the sequence number.
+func SequenceNumberToIterationNumber(startingSeqNum, seqNum int64) int64 {
+	return (seqNum - startingSeqNum) / m
+}
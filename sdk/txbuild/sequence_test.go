@@ -19,3 +19,16 @@ func TestSequenceNumberToTransactionType(t *testing.T) {
 	assert.Equal(t, TransactionTypeDeclaration, SequenceNumberToTransactionType(100, 102))
 	assert.Equal(t, TransactionTypeClose, SequenceNumberToTransactionType(100, 103))
 }
+
+func TestSequenceNumberToTransactionType_beforeStart(t *testing.T) {
+	assert.Equal(t, TransactionTypeUnrecognized, SequenceNumberToTransactionType(100, 99))
+	assert.Equal(t, TransactionTypeUnrecognized, SequenceNumberToTransactionType(100, 98))
+	assert.Equal(t, TransactionTypeUnrecognized, SequenceNumberToTransactionType(100, 0))
+}
+
+func TestSequenceNumberToIterationNumber(t *testing.T) {
+	assert.Equal(t, int64(1), SequenceNumberToIterationNumber(100, 102))
+	assert.Equal(t, int64(1), SequenceNumberToIterationNumber(100, 103))
+	assert.Equal(t, int64(2), SequenceNumberToIterationNumber(101, 105))
+	assert.Equal(t, int64(2), SequenceNumberToIterationNumber(101, 106))
+}
@@ -1,6 +1,7 @@
 package txbuildtest
 
 import (
+	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"time"
@@ -9,6 +10,26 @@ import (
 	"github.com/stellar/go/xdr"
 )
 
+// BalanceWithLiabilities is the balance of an account or trustline and its
+// liabilities, with the balance available for spending that is calculated
+// from them.
+type BalanceWithLiabilities struct {
+	Balance            int64
+	BuyingLiabilities  int64
+	SellingLiabilities int64
+	Available          int64
+}
+
+// BalancesWithLiabilities are balances for testing that the balance available
+// for spending is calculated the same wherever balances are collected.
+var BalancesWithLiabilities = []BalanceWithLiabilities{
+	{Balance: 1000, BuyingLiabilities: 0, SellingLiabilities: 0, Available: 1000},
+	{Balance: 1000, BuyingLiabilities: 100, SellingLiabilities: 0, Available: 1000},
+	{Balance: 1000, BuyingLiabilities: 0, SellingLiabilities: 100, Available: 900},
+	{Balance: 1000, BuyingLiabilities: 300, SellingLiabilities: 100, Available: 900},
+	{Balance: 200, BuyingLiabilities: 100, SellingLiabilities: 200, Available: 0},
+}
+
 // BuildResult returns a result XDR base64 encoded that is successful or not
 // based on the input parameter.
 func BuildResultXDR(success bool) (string, error) {
@@ -36,16 +57,19 @@ func BuildResultXDR(success bool) (string, error) {
 // the input ledger entry changes. Only creates one operation meta for
 // simiplicity.
 func BuildResultMetaXDR(ledgerEntryResults []xdr.LedgerEntryData) (string, error) {
-	tm := xdr.TransactionMeta{
-		V: 2,
-		V2: &xdr.TransactionMetaV2{
-			Operations: []xdr.OperationMeta{
-				{},
-			},
-		},
-	}
+	return BuildResultMetaXDRVersion(2, ledgerEntryResults)
+}
 
+// BuildResultMetaXDRVersion returns a result meta XDR base64 encoded of the
+// given version, 0 through 4, that contains the input ledger entry changes.
+// Only creates one operation meta for simiplicity.
+//
+// V4 meta also contains a contract event for the operation, like those emitted
+// by the Stellar Asset Contract for classic payments, so that consumers are
+// tested with events present.
+func BuildResultMetaXDRVersion(version int32, ledgerEntryResults []xdr.LedgerEntryData) (string, error) {
 	rand := rand.New(rand.NewSource(time.Now().UnixNano()))
+	changes := xdr.LedgerEntryChanges{}
 	for _, result := range ledgerEntryResults {
 		change := xdr.LedgerEntryChange{}
 		// When operations like ChangeTrustOp execute they potentially create or
@@ -62,14 +86,93 @@ func BuildResultMetaXDR(ledgerEntryResults []xdr.LedgerEntryData) (string, error
 			change.Type = xdr.LedgerEntryChangeTypeLedgerEntryUpdated
 			change.Updated = &xdr.LedgerEntry{Data: result}
 		}
-		tm.V2.Operations[0].Changes = append(tm.V2.Operations[0].Changes, change)
+		changes = append(changes, change)
 	}
 
-	tmXDR, err := xdr.MarshalBase64(tm)
+	var tmXDR []byte
+	var err error
+	switch version {
+	case 0:
+		tmXDR, err = xdr.TransactionMeta{
+			V:          0,
+			Operations: &[]xdr.OperationMeta{{Changes: changes}},
+		}.MarshalBinary()
+	case 1:
+		tmXDR, err = xdr.TransactionMeta{
+			V: 1,
+			V1: &xdr.TransactionMetaV1{
+				Operations: []xdr.OperationMeta{{Changes: changes}},
+			},
+		}.MarshalBinary()
+	case 2:
+		tmXDR, err = xdr.TransactionMeta{
+			V: 2,
+			V2: &xdr.TransactionMetaV2{
+				Operations: []xdr.OperationMeta{{Changes: changes}},
+			},
+		}.MarshalBinary()
+	case 3:
+		tmXDR, err = xdr.TransactionMeta{
+			V: 3,
+			V3: &xdr.TransactionMetaV3{
+				Operations: []xdr.OperationMeta{{Changes: changes}},
+			},
+		}.MarshalBinary()
+	case 4:
+		tmXDR, err = xdr.TransactionMeta{
+			V: 4,
+			V4: &xdr.TransactionMetaV4{
+				Operations: []xdr.OperationMetaV2{{
+					Changes: changes,
+					Events:  []xdr.ContractEvent{transferEvent()},
+				}},
+			},
+		}.MarshalBinary()
+	default:
+		return "", fmt.Errorf("transaction meta version %d unsupported", version)
+	}
 	if err != nil {
-		return "", fmt.Errorf("encoding transaction meta to base64 xdr: %w", err)
+		return "", fmt.Errorf("encoding transaction meta to xdr: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(tmXDR), nil
+}
+
+// transferEvent returns a ContractEvent in the form of a transfer event of the
+// Stellar Asset Contract.
+func transferEvent() xdr.ContractEvent {
+	contractID := xdr.ContractId{}
+	sym := func(s string) xdr.ScVal {
+		v := xdr.ScSymbol(s)
+		return xdr.ScVal{Type: xdr.ScValTypeScvSymbol, Sym: &v}
+	}
+	from := xdr.ScAddress{
+		Type:      xdr.ScAddressTypeScAddressTypeAccount,
+		AccountId: &xdr.AccountId{Type: xdr.PublicKeyTypePublicKeyTypeEd25519, Ed25519: &xdr.Uint256{}},
+	}
+	to := xdr.ScAddress{
+		Type:         xdr.ScAddressTypeScAddressTypeMuxedAccount,
+		MuxedAccount: &xdr.MuxedEd25519Account{},
+	}
+	asset := xdr.ScString("native")
+	amount := xdr.Int128Parts{}
+	toMuxedID := xdr.Uint64(0)
+	data := &xdr.ScMap{
+		{Key: sym("amount"), Val: xdr.ScVal{Type: xdr.ScValTypeScvI128, I128: &amount}},
+		{Key: sym("to_muxed_id"), Val: xdr.ScVal{Type: xdr.ScValTypeScvU64, U64: &toMuxedID}},
+	}
+	return xdr.ContractEvent{
+		ContractId: &contractID,
+		Type:       xdr.ContractEventTypeContract,
+		Body: xdr.ContractEventBody{V0: &xdr.ContractEventV0{
+			Topics: []xdr.ScVal{
+				sym("transfer"),
+				{Type: xdr.ScValTypeScvAddress, Address: &from},
+				{Type: xdr.ScValTypeScvAddress, Address: &to},
+				{Type: xdr.ScValTypeScvString, Str: &asset},
+			},
+			Data: xdr.ScVal{Type: xdr.ScValTypeScvMap, Map: &data},
+		}},
 	}
-	return tmXDR, nil
 }
 
 type OpenResultMetaParams struct {
@@ -84,6 +187,7 @@ type OpenResultMetaParams struct {
 	StartSequence           int64
 	Asset                   txnbuild.Asset
 	TrustLineFlag           xdr.TrustLineFlags // Defaults to authorized flag.
+	MetaVersion             int32              // Defaults to 2 if not set.
 }
 
 func BuildOpenResultMetaXDR(params OpenResultMetaParams) (string, error) {
@@ -175,5 +279,9 @@ func BuildOpenResultMetaXDR(params OpenResultMetaParams) (string, error) {
 		}...)
 	}
 
-	return BuildResultMetaXDR(led)
+	metaVersion := int32(2)
+	if params.MetaVersion != 0 {
+		metaVersion = params.MetaVersion
+	}
+	return BuildResultMetaXDRVersion(metaVersion, led)
 }
@@ -1,6 +1,7 @@
 package txbuildtest
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"github.com/stellar/go/xdr"
@@ -67,3 +68,36 @@ func Test_txbuildtest_buildResultMetaXDR(t *testing.T) {
 		}
 	}
 }
+
+func Test_txbuildtest_buildResultMetaXDRVersion(t *testing.T) {
+	led := []xdr.LedgerEntryData{
+		{
+			Type: xdr.LedgerEntryTypeAccount,
+			Account: &xdr.AccountEntry{
+				AccountId: xdr.MustAddress("GAKDNXUGEIRGESAXOPUHU4GOWLVYGQFJVHQOGFXKBXDGZ7AKMPPSDDPV"),
+			},
+		},
+	}
+
+	// Versions defined in the XDR package can be decoded by it.
+	for _, version := range []int32{0, 1, 2} {
+		m, err := BuildResultMetaXDRVersion(version, led)
+		require.NoError(t, err)
+		var txMeta xdr.TransactionMeta
+		err = xdr.SafeUnmarshalBase64(m, &txMeta)
+		require.NoError(t, err)
+		assert.Equal(t, version, txMeta.V)
+	}
+
+	// Later versions are encoded with the version first.
+	for _, version := range []int32{3, 4} {
+		m, err := BuildResultMetaXDRVersion(version, led)
+		require.NoError(t, err)
+		b, err := base64.StdEncoding.DecodeString(m)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 0, 0, byte(version)}, b[:4])
+	}
+
+	_, err := BuildResultMetaXDRVersion(5, led)
+	assert.EqualError(t, err, "transaction meta version 5 unsupported")
+}